@@ -0,0 +1,48 @@
+package main
+
+// WithBitsetAlignment rounds the length of each filter's bitset up to a multiple of
+// alignment bytes, such as 64 for a cache line, so that word-at-a-time or vectorized loops
+// over it need no tail handling. The padding is never hashed into: the bit size, false
+// positive rate and serialized form are unchanged, and the padding bytes stay zero. Only
+// the length is aligned; Go does not guarantee the address of the backing array. Values of
+// alignment below 2 disable padding. Filters decoded with the option are padded as well;
+// Fold and UnionFolded produce unpadded bitsets.
+func WithBitsetAlignment(alignment int) Option {
+	return func(o *options) {
+		o.bitsetAlignment = alignment
+	}
+}
+
+// alignedLen rounds n bytes up to a multiple of alignment.
+func alignedLen(n uint, alignment int) uint {
+	if alignment < 2 {
+		return n
+	}
+	a := uint(alignment)
+	return (n + a - 1) / a * a
+}
+
+// alignBitset returns bitset padded with zero bytes to a multiple of alignment bytes.
+func alignBitset(bitset []uint8, alignment int) []uint8 {
+	n := alignedLen(uint(len(bitset)), alignment)
+	if n == uint(len(bitset)) {
+		return bitset
+	}
+	padded := make([]uint8, n)
+	copy(padded, bitset)
+	return padded
+}
+
+// usedBytes returns the bytes of the bitset that hold bits, without alignment padding.
+func (bf *BloomFilter) usedBytes() []uint8 {
+	return bf.bitset[:(bf.bitSize+7)/8]
+}
+
+// AlignedBytes returns the length of the filter's bitset in bytes, including the padding
+// added by WithBitsetAlignment.
+func (bf *BloomFilter) AlignedBytes() int {
+	bf.mutex.RLock()
+	defer bf.mutex.RUnlock()
+
+	return len(bf.bitset)
+}
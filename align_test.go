@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-bloom-filter/bloomtest"
+)
+
+func TestBitsetAlignment(t *testing.T) {
+	probes := testKeys("probe", 20000)
+	for _, capacity := range []int{1, 100, 1000, 12345} {
+		aligned := NewBloomFilter(capacity, 0.01, WithBitsetAlignment(64))
+		plain := NewBloomFilter(capacity, 0.01)
+		if n := aligned.AlignedBytes(); n%64 != 0 || n < len(plain.bitset) || n-len(plain.bitset) >= 64 {
+			t.Errorf("capacity %d: AlignedBytes = %d, want the %d bytes rounded up to a multiple of 64", capacity, n, len(plain.bitset))
+		}
+		if len(aligned.bitset) != aligned.AlignedBytes() || aligned.bitSize != plain.bitSize {
+			t.Errorf("capacity %d: %d bytes of %d bits, want %d bytes of %d bits",
+				capacity, len(aligned.bitset), aligned.bitSize, aligned.AlignedBytes(), plain.bitSize)
+		}
+		if got := plain.AlignedBytes(); got != len(plain.bitset) {
+			t.Errorf("capacity %d: AlignedBytes without alignment = %d, want %d", capacity, got, len(plain.bitset))
+		}
+
+		for _, key := range testKeys("key", capacity) {
+			aligned.Add(key)
+			plain.Add(key)
+		}
+		for _, probe := range probes {
+			if aligned.MightContain(probe) != plain.MightContain(probe) {
+				t.Fatalf("capacity %d: aligned and unaligned filters disagree on %q", capacity, probe)
+			}
+		}
+		if padding := aligned.bitset[len(plain.bitset):]; slices.ContainsFunc(padding, func(b uint8) bool { return b != 0 }) {
+			t.Errorf("capacity %d: padding bytes were set", capacity)
+		}
+
+		// The padding is not serialized.
+		a, _ := aligned.MarshalBinary()
+		p, _ := plain.MarshalBinary()
+		if !bytes.Equal(a, p) {
+			t.Errorf("capacity %d: aligned filter encodes differently", capacity)
+		}
+	}
+
+	// Values below 2 disable padding.
+	for _, alignment := range []int{-1, 0, 1} {
+		if got, want := NewBloomFilter(100, 0.01, WithBitsetAlignment(alignment)).AlignedBytes(), len(NewBloomFilter(100, 0.01).bitset); got != want {
+			t.Errorf("WithBitsetAlignment(%d): %d bytes, want %d", alignment, got, want)
+		}
+	}
+}
+
+func TestBitsetAlignmentScalable(t *testing.T) {
+	clock := bloomtest.NewFakeClock(time.Unix(0, 0))
+	aligned := newTestFilter(t, testConfig, WithClock(clock), WithBitsetAlignment(64))
+	plain := newTestFilter(t, testConfig, WithClock(clock))
+	keys := testKeys("key", 1000) // Several stages
+	addAll(t, aligned, keys)
+	addAll(t, plain, keys)
+	for i, bf := range aligned.filters {
+		if bf.AlignedBytes()%64 != 0 {
+			t.Errorf("stage %d: %d bytes, want a multiple of 64", i, bf.AlignedBytes())
+		}
+	}
+
+	// Aligned and unaligned filters combine, and encode the same.
+	if err := plain.filters[0].Union(aligned.filters[0]); err != nil {
+		t.Errorf("Union of an aligned filter into an unaligned one: %v", err)
+	}
+	if err := aligned.filters[0].Union(plain.filters[0]); err != nil {
+		t.Errorf("Union of an unaligned filter into an aligned one: %v", err)
+	}
+	a, _ := aligned.GobEncode()
+	p, _ := plain.GobEncode()
+	if !bytes.Equal(a, p) {
+		t.Error("aligned filter gob-encodes differently")
+	}
+
+	// Decoding with the option pads again.
+	path := filepath.Join(t.TempDir(), "aligned.bloom")
+	if err := plain.saveFile(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadScalableFile(path, []Option{WithBitsetAlignment(64)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, bf := range loaded.filters {
+		if bf.AlignedBytes()%64 != 0 {
+			t.Errorf("decoded stage %d: %d bytes, want a multiple of 64", i, bf.AlignedBytes())
+		}
+	}
+	if !sameBits(loaded, plain) {
+		t.Error("decoded aligned filter has different bits")
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Append file format, written by AppendSave and read by LoadAppendFile:
+//
+//	magic    [4]byte "BLMA"
+//	version  uint8
+//	records  gob-encoded gobBloomFilter, one per saved version of a sub-filter
+//	footer   gob-encoded appendFooter indexing the current record of every sub-filter
+//	trailer  uint64 big-endian offset of the footer, then the magic again
+//
+// Each append writes records for the sub-filters that changed, then a new footer and
+// trailer after them. Superseded records and footers remain as dead space until the file
+// is rewritten.
+
+// appendMagic identifies a filter file in the append format.
+var appendMagic = [4]byte{'B', 'L', 'M', 'A'}
+
+// appendFormatVersion is the current version of the append format.
+const appendFormatVersion = 1
+
+// Sizes of the fixed parts of an append file.
+const (
+	appendHeaderSize  = 5
+	appendTrailerSize = 12
+)
+
+// errCorruptTrailer reports an append file whose trailer does not point at a footer,
+// most likely because it was truncated.
+var errCorruptTrailer = errors.New("trailer is corrupt; the last append may have been interrupted")
+
+// appendFooter is the index at the end of an append file.
+type appendFooter struct {
+	Filter  gobScalableBloomFilter // Everything but the sub-filters, which are in Records
+	Records []appendRecord
+}
+
+// appendRecord locates the current record of a sub-filter. BitSize, Created and Count
+// identify the sub-filter's state when the record was written, so unchanged sub-filters
+// are not written again.
+type appendRecord struct {
+	Offset  int64
+	Length  int64
+	BitSize uint
+	Created int64 // Unix nanoseconds; 0 if unknown
+	Count   uint
+}
+
+// matches reports whether the record still holds the sub-filter's current state.
+func (rec appendRecord) matches(bf *BloomFilter) bool {
+	bf.mutex.RLock()
+	defer bf.mutex.RUnlock()
+
+	return rec.BitSize == bf.bitSize && rec.Created == unixNanos(bf.created) && rec.Count == bf.count
+}
+
+// unixNanos returns t in Unix nanoseconds, or 0 for the zero time.
+func unixNanos(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// AppendSave saves the filter to path in the append format, writing only what changed
+// since the last save: normally the active sub-filter and any sub-filters added since.
+// Rewriting a large filter on every snapshot is then unnecessary. Sub-filters already
+// in the file are recognized by their bit size, creation time and item count, so the file
+// should only ever be saved from this filter or from one loaded with LoadAppendFile.
+// A missing file is created, and once superseded records would make up more than half of
+// the file, it is atomically rewritten in full instead.
+//
+// The file is synced before AppendSave returns, and a failed append is truncated away,
+// but a crash in the middle of an append leaves a file that LoadAppendFile rejects.
+// Concurrent AppendSave calls for the same path must be serialized by the caller.
+func (sbf *ScalableBloomFilter) AppendSave(path string) error {
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+
+	if sbf.closed {
+		return ErrClosed
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, fs.ErrNotExist) {
+		return sbf.rewriteAppendFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	old, size, err := readAppendFooter(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if old.Filter.Normalizer != sbf.options.normalizer.Name() {
+		return fmt.Errorf("%s: was saved with key normalizer %q, not %q", path, old.Filter.Normalizer, sbf.options.normalizer.Name())
+	}
+
+	footer := appendFooter{Filter: sbf.gobWire(), Records: make([]appendRecord, len(sbf.filters))}
+	var tail bytes.Buffer
+	var live int64
+	for i, filter := range sbf.filters {
+		if i < len(old.Records) && old.Records[i].matches(filter) {
+			footer.Records[i] = old.Records[i]
+		} else if footer.Records[i], err = appendFilterRecord(&tail, size+int64(tail.Len()), filter); err != nil {
+			return err
+		}
+		live += footer.Records[i].Length
+	}
+	if dead := size - appendHeaderSize - (live - int64(tail.Len())); dead > live {
+		return sbf.rewriteAppendFile(path)
+	}
+	if err := writeAppendFooter(&tail, size+int64(tail.Len()), footer); err != nil {
+		return err
+	}
+
+	if _, err := file.WriteAt(tail.Bytes(), size); err != nil {
+		file.Truncate(size)
+		return err
+	}
+	return file.Sync()
+}
+
+// rewriteAppendFile atomically replaces path with a fresh append file holding the whole
+// filter; the caller must hold at least the read lock.
+func (sbf *ScalableBloomFilter) rewriteAppendFile(path string) error {
+	data, err := sbf.appendFileBytes()
+	if err != nil {
+		return err
+	}
+	return writeFileBytes(path, data)
+}
+
+// appendFileBytes returns a fresh append file holding the whole filter; the caller must
+// hold at least the read lock.
+func (sbf *ScalableBloomFilter) appendFileBytes() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(appendMagic[:])
+	buf.WriteByte(appendFormatVersion)
+	footer := appendFooter{Filter: sbf.gobWire(), Records: make([]appendRecord, len(sbf.filters))}
+	for i, filter := range sbf.filters {
+		var err error
+		if footer.Records[i], err = appendFilterRecord(&buf, int64(buf.Len()), filter); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeAppendFooter(&buf, int64(buf.Len()), footer); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// appendFilterRecord writes the record of a sub-filter to buf, which starts at offset
+// in the file, and returns its index entry.
+func appendFilterRecord(buf *bytes.Buffer, offset int64, bf *BloomFilter) (appendRecord, error) {
+	start := buf.Len()
+	wire := bf.gobWire()
+	if err := gob.NewEncoder(buf).Encode(wire); err != nil {
+		return appendRecord{}, err
+	}
+	return appendRecord{
+		Offset:  offset,
+		Length:  int64(buf.Len() - start),
+		BitSize: wire.BitSize,
+		Created: unixNanos(wire.Created),
+		Count:   wire.Count,
+	}, nil
+}
+
+// writeAppendFooter writes the footer, which starts at offset in the file, and the trailer.
+func writeAppendFooter(buf *bytes.Buffer, offset int64, footer appendFooter) error {
+	if err := gob.NewEncoder(buf).Encode(footer); err != nil {
+		return err
+	}
+	buf.Write(binary.BigEndian.AppendUint64(nil, uint64(offset)))
+	buf.Write(appendMagic[:])
+	return nil
+}
+
+// readAppendFooter reads and checks the header, trailer and footer of an append file.
+// It also returns the file's size.
+func readAppendFooter(file *os.File) (appendFooter, int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return appendFooter{}, 0, err
+	}
+	footer, err := parseAppendFooter(file, info.Size())
+	return footer, info.Size(), err
+}
+
+// parseAppendFooter is readAppendFooter for an append file of the given size read from r.
+func parseAppendFooter(r io.ReaderAt, size int64) (appendFooter, error) {
+	var footer appendFooter
+	if size < appendHeaderSize+appendTrailerSize {
+		return footer, errors.New("not an append-format filter file")
+	}
+
+	var header [appendHeaderSize]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return footer, fmt.Errorf("reading header: %w", err)
+	}
+	if [4]byte(header[:4]) != appendMagic {
+		return footer, errors.New("not an append-format filter file")
+	}
+	if header[4] < 1 || header[4] > appendFormatVersion {
+		return footer, fmt.Errorf("unsupported append format version %d", header[4])
+	}
+
+	var trailer [appendTrailerSize]byte
+	if _, err := r.ReadAt(trailer[:], size-appendTrailerSize); err != nil {
+		return footer, fmt.Errorf("reading trailer: %w", err)
+	}
+	offset := int64(binary.BigEndian.Uint64(trailer[:8]))
+	if [4]byte(trailer[8:]) != appendMagic || offset < appendHeaderSize || offset >= size-appendTrailerSize {
+		return footer, errCorruptTrailer
+	}
+	section := io.NewSectionReader(r, offset, size-appendTrailerSize-offset)
+	if err := gob.NewDecoder(section).Decode(&footer); err != nil {
+		return footer, fmt.Errorf("reading footer: %w", err)
+	}
+	for i, rec := range footer.Records {
+		if rec.Offset < appendHeaderSize || rec.Length <= 0 || rec.Offset+rec.Length > offset {
+			return footer, fmt.Errorf("record of sub-filter %d lies outside the file", i)
+		}
+	}
+	return footer, nil
+}
+
+// LoadAppendFile reads a filter saved with AppendSave. The options apply as for
+// NewScalableBloomFilter, except that the file's configuration and hasher take
+// precedence; a configured key normalizer must match the file's.
+func LoadAppendFile(path string, opts ...Option) (*ScalableBloomFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	sbf, err := readAppendFilter(file, info.Size(), opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return sbf, nil
+}
+
+// readAppendFilter is LoadAppendFile for an append file of the given size read from r.
+func readAppendFilter(r io.ReaderAt, size int64, opts []Option) (*ScalableBloomFilter, error) {
+	footer, err := parseAppendFooter(r, size)
+	if err != nil {
+		return nil, err
+	}
+	wire := footer.Filter
+	wire.Filters = make([]gobBloomFilter, len(footer.Records))
+	for i, rec := range footer.Records {
+		section := io.NewSectionReader(r, rec.Offset, rec.Length)
+		if err := gob.NewDecoder(section).Decode(&wire.Filters[i]); err != nil {
+			return nil, fmt.Errorf("reading sub-filter %d: %w", i, err)
+		}
+	}
+
+	sbf := &ScalableBloomFilter{options: buildOptions(opts)}
+	if err := sbf.decodeWire(wire); err != nil {
+		return nil, err
+	}
+	return sbf, nil
+}
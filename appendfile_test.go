@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// appendTestConfig makes sub-filter records large enough to outweigh the footer, so that
+// saves append rather than rewrite the file.
+var appendTestConfig = Config{InitialFP: 0.01, GrowthFactor: 2, TighteningRatio: 0.5, InitialCapacity: 10000}
+
+// footerOffset returns the offset of the current footer of the append file data.
+func footerOffset(data []byte) int {
+	return int(binary.BigEndian.Uint64(data[len(data)-appendTrailerSize:]))
+}
+
+// fileSize returns the size of the file at path.
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestAppendSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.blma")
+	sbf := newTestFilter(t, appendTestConfig)
+	addAll(t, sbf, testKeys("first", 5000))
+	if err := sbf.AppendSave(path); err != nil {
+		t.Fatalf("initial AppendSave: %v", err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addAll(t, sbf, testKeys("growth", 10000)) // Grows a second sub-filter
+	if len(sbf.filters) != 2 {
+		t.Fatalf("%d sub-filters, want 2", len(sbf.filters))
+	}
+	if err := sbf.AppendSave(path); err != nil {
+		t.Fatalf("AppendSave after growth: %v", err)
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Everything up to the old footer is left in place.
+	if len(after) <= len(before) || !bytes.Equal(after[:footerOffset(before)], before[:footerOffset(before)]) {
+		t.Fatal("AppendSave rewrote the existing records instead of appending")
+	}
+
+	loaded, err := LoadAppendFile(path)
+	if err != nil {
+		t.Fatalf("LoadAppendFile: %v", err)
+	}
+	if !sameBits(loaded, sbf) || loaded.ItemCount() != sbf.ItemCount() || loaded.Config() != sbf.Config() {
+		t.Error("loaded filter differs from the saved one")
+	}
+	for _, key := range append(testKeys("first", 5000), testKeys("growth", 10000)...) {
+		if !loaded.MightContain(key) {
+			t.Fatalf("loaded filter lacks %q", key)
+		}
+	}
+
+	// The loaded filter continues the same file, and an unchanged filter only adds a footer.
+	addAll(t, loaded, testKeys("third", 100))
+	if err := loaded.AppendSave(path); err != nil {
+		t.Fatalf("AppendSave of the loaded filter: %v", err)
+	}
+	size := fileSize(t, path)
+	if err := loaded.AppendSave(path); err != nil {
+		t.Fatalf("AppendSave without changes: %v", err)
+	}
+	if grown := fileSize(t, path) - size; grown > 1024 {
+		t.Errorf("AppendSave without changes appended %d bytes, want only a footer", grown)
+	}
+	if again, err := LoadAppendFile(path); err != nil || !sameBits(again, loaded) {
+		t.Errorf("reloading after further appends: %v, or the bits differ", err)
+	}
+}
+
+// TestAppendSaveRewrite checks that superseded records do not accumulate without bound.
+func TestAppendSaveRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.blma")
+	sbf := newTestFilter(t, appendTestConfig)
+	var largest int64
+	for i, key := range testKeys("key", 50) {
+		addAll(t, sbf, []string{key})
+		if err := sbf.AppendSave(path); err != nil {
+			t.Fatalf("AppendSave %d: %v", i, err)
+		}
+		largest = max(largest, fileSize(t, path))
+	}
+	if full, _ := sbf.appendFileBytes(); largest > 3*int64(len(full)) {
+		t.Errorf("file reached %d bytes for a filter of %d, want superseded records rewritten away", largest, len(full))
+	}
+	if loaded, err := LoadAppendFile(path); err != nil || !sameBits(loaded, sbf) {
+		t.Errorf("LoadAppendFile after rewrites: %v, or the bits differ", err)
+	}
+}
+
+func TestAppendSaveErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "filter.blma")
+	sbf := newTestFilter(t, appendTestConfig)
+	addAll(t, sbf, testKeys("key", 10))
+	if err := sbf.AppendSave(path); err != nil {
+		t.Fatal(err)
+	}
+
+	other := newTestFilter(t, appendTestConfig, WithKeyNormalizer(LowercaseNormalizer))
+	if err := other.AppendSave(path); err == nil {
+		t.Error("AppendSave with another key normalizer succeeded")
+	}
+
+	// An interrupted append leaves a torn trailer, which is detected.
+	data, _ := os.ReadFile(path)
+	torn := filepath.Join(dir, "torn.blma")
+	if err := os.WriteFile(torn, data[:len(data)-3], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadAppendFile(torn); !errors.Is(err, errCorruptTrailer) {
+		t.Errorf("LoadAppendFile of a torn file = %v, want errCorruptTrailer", err)
+	}
+	if err := sbf.AppendSave(torn); !errors.Is(err, errCorruptTrailer) {
+		t.Errorf("AppendSave onto a torn file = %v, want errCorruptTrailer", err)
+	}
+	plain := filepath.Join(dir, "plain.bloom")
+	if err := sbf.saveFile(plain); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadAppendFile(plain); err == nil {
+		t.Error("LoadAppendFile of a gob filter file succeeded")
+	}
+
+	sbf.Close()
+	if err := sbf.AppendSave(path); !errors.Is(err, ErrClosed) {
+		t.Errorf("AppendSave after Close = %v, want ErrClosed", err)
+	}
+}
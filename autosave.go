@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// EnableAutoSave starts a goroutine that atomically writes the filter to path every
+// interval, in the format the Manager uses, so a long-running service loses at most one
+// interval of inserts on a crash. Failed saves are reported to the configured Logger and
+// retried at the next interval.
+//
+// The returned stop function halts the goroutine, writes one final snapshot and waits for
+// it to finish. It is safe to call more than once. Close calls it too, so a closed filter
+// is always flushed. Scheduling uses the filter's Clock. Like time.NewTicker, it panics
+// if interval is not positive, which would otherwise save in a busy loop.
+func (sbf *ScalableBloomFilter) EnableAutoSave(path string, interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		panic("bloom: non-positive interval for EnableAutoSave")
+	}
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	save := func() {
+		if err := sbf.snapshotTo(path); err != nil {
+			sbf.options.warnf("bloom: auto-save to %s failed: %v", path, err)
+		}
+	}
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() { close(done) })
+		<-exited
+	}
+	if err := sbf.onClose(func() error { stop(); return nil }); err != nil {
+		// Already closed: there is nothing left to save.
+		return func() {}
+	}
+
+	go func() {
+		defer close(exited)
+		for {
+			select {
+			case <-sbf.options.clock.After(interval):
+				save()
+			case <-done:
+				save()
+				return
+			}
+		}
+	}()
+	return stop
+}
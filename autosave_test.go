@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-bloom-filter/bloomtest"
+)
+
+func TestEnableAutoSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+	clock := bloomtest.NewFakeClock(time.Unix(0, 0))
+	sbf := newTestFilter(t, testConfig, WithClock(clock))
+	addAll(t, sbf, testKeys("first", 10))
+
+	base := runtime.NumGoroutine()
+	stop := sbf.EnableAutoSave(path, time.Minute)
+	waitFor(t, "the auto-save timer", func() bool { return clock.Waiters() == 1 })
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("file before the first interval: %v, want none written", err)
+	}
+
+	clock.Advance(time.Minute)
+	waitFor(t, "the first snapshot", func() bool {
+		loaded, err := loadScalableFile(path, nil)
+		return err == nil && loaded.AllMightContain(testKeys("first", 10))
+	})
+
+	// stop writes a final snapshot and waits for the goroutine to exit.
+	waitFor(t, "the next auto-save timer", func() bool { return clock.Waiters() == 1 })
+	addAll(t, sbf, testKeys("second", 10))
+	stop()
+	waitForGoroutines(t, base)
+	loaded, err := loadScalableFile(path, nil)
+	if err != nil {
+		t.Fatalf("loading the final snapshot: %v", err)
+	}
+	if !loaded.AllMightContain(testKeys("second", 10)) {
+		t.Error("final snapshot lacks items added since the last interval")
+	}
+	stop() // Idempotent
+
+	// No temporary files are left behind by the atomic writes.
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("directory holds %d entries, %v, want only the snapshot", len(entries), err)
+	}
+}
+
+func TestEnableAutoSaveFailure(t *testing.T) {
+	logger := &captureLogger{}
+	clock := bloomtest.NewFakeClock(time.Unix(0, 0))
+	sbf := newTestFilter(t, testConfig, WithClock(clock), WithLogger(logger))
+	stop := sbf.EnableAutoSave(filepath.Join(t.TempDir(), "missing", "filter.bloom"), time.Minute)
+
+	waitFor(t, "the auto-save timer", func() bool { return clock.Waiters() == 1 })
+	clock.Advance(time.Minute)
+	waitFor(t, "the failure warning", func() bool { return len(logger.logged()) == 1 })
+	// A failed save is retried at the next interval rather than stopping the goroutine.
+	waitFor(t, "the next auto-save timer", func() bool { return clock.Waiters() == 1 })
+	stop()
+
+	warnings := logger.logged()
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "auto-save") {
+		t.Errorf("warnings = %q, want one per failed save", warnings)
+	}
+}
+
+func TestEnableAutoSaveAfterClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+	sbf := newTestFilter(t, testConfig)
+	sbf.Close()
+	sbf.EnableAutoSave(path, time.Millisecond)()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("auto-save on a closed filter wrote %s: %v", path, err)
+	}
+}
+
+func TestEnableAutoSaveInvalidInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+	sbf := newTestFilter(t, testConfig)
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if got := panicValue(func() { sbf.EnableAutoSave(path, interval) }); got == nil {
+			t.Errorf("EnableAutoSave with interval %v did not panic", interval)
+		}
+	}
+	// Nothing was registered to run on Close.
+	if err := sbf.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Close after a rejected auto-save wrote %s: %v", path, err)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import "context"
+
+// AddBatch inserts all items, taking the write lock once per chunk rather than once per item.
+func (sbf *ScalableBloomFilter) AddBatch(items []string) error {
+	_, err := sbf.AddBatchCtx(context.Background(), items)
+	return err
+}
+
+// AddBatchCtx is like AddBatch but stops early when ctx is done. The context is checked
+// every ctxCheckInterval items; on cancellation it returns the number of items inserted
+// so far together with ctx's error. An insert error, such as ErrMaxFilters, likewise
+// returns the number of items inserted before the one that failed.
+func (sbf *ScalableBloomFilter) AddBatchCtx(ctx context.Context, items []string) (int, error) {
+	processed := 0
+	for processed < len(items) {
+		if err := ctx.Err(); err != nil {
+			return processed, err
+		}
+		end := min(processed+ctxCheckInterval, len(items))
+		n, err := sbf.addBatch(items[processed:end])
+		processed += n
+		if err != nil {
+			return processed, err
+		}
+	}
+	return processed, nil
+}
+
+// MightContainBatch checks every item and returns the results in the same order.
+func (sbf *ScalableBloomFilter) MightContainBatch(items []string) []bool {
+	results, _ := sbf.MightContainBatchCtx(context.Background(), items)
+	return results
+}
+
+// MightContainBatchCtx is like MightContainBatch but stops early when ctx is done.
+// The context is checked every ctxCheckInterval items; on cancellation the results
+// for the items processed so far are returned together with ctx's error.
+func (sbf *ScalableBloomFilter) MightContainBatchCtx(ctx context.Context, items []string) ([]bool, error) {
+	results := make([]bool, 0, len(items))
+	for len(results) < len(items) {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		end := min(len(results)+ctxCheckInterval, len(items))
+		sbf.mutex.RLock()
+		for _, item := range items[len(results):end] {
+			results = append(results, sbf.mightContain(item))
+		}
+		sbf.mutex.RUnlock()
+	}
+	return results, nil
+}
+
+// AllMightContain reports whether every item might be present, stopping at the first
+// definite miss. Each item is hashed once and the digest is reused across sub-filters.
+func (sbf *ScalableBloomFilter) AllMightContain(items []string) bool {
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+
+	for _, item := range items {
+		if !sbf.containsDigest(sbf.digest(item)) {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterAbsent returns, in their original order, the candidates that are definitely not
+// in the filter, such as the keys that still need to be fetched or processed. A false
+// positive leaves out a candidate that was never added.
+func (sbf *ScalableBloomFilter) FilterAbsent(candidates []string) []string {
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+
+	var absent []string
+	for _, item := range candidates {
+		if !sbf.mightContain(item) {
+			absent = append(absent, item)
+		}
+	}
+	return absent
+}
+
+// EvaluateAccuracy checks items whose membership is known and tallies the outcomes:
+// present holds items that were added and absent items that were not. tp and fn count
+// the present items reported present and absent, fp and tn the absent ones. A correct
+// filter never has false negatives, so fn is always 0, and fp/(fp+tn) estimates the
+// false positive rate actually reached, to compare with EstimatedFP.
+func (sbf *ScalableBloomFilter) EvaluateAccuracy(present, absent []string) (tp, fn, fp, tn int) {
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+
+	for _, item := range present {
+		if sbf.mightContain(item) {
+			tp++
+		} else {
+			fn++
+		}
+	}
+	for _, item := range absent {
+		if sbf.mightContain(item) {
+			fp++
+		} else {
+			tn++
+		}
+	}
+	return tp, fn, fp, tn
+}
+
+// RebuildFrom adds to sbf every candidate that source reports as possibly present, to
+// approximate source's contents in a filter with different parameters, such as a tighter
+// false positive rate. A Bloom filter cannot list its items, so only the given candidate
+// universe is considered: items of source outside it are lost, and candidates that are
+// false positives of source are carried over. Like AddBatch it returns the insert error,
+// such as ErrReadOnly, ErrClosed or ErrMaxFilters, since a rebuild that stopped part way
+// would otherwise pass for a complete one.
+func (sbf *ScalableBloomFilter) RebuildFrom(candidates []string, source *ScalableBloomFilter) error {
+	// Check against source before locking sbf, so rebuilding a filter from itself cannot deadlock.
+	source.mutex.RLock()
+	var present []string
+	for _, item := range candidates {
+		if source.mightContain(item) {
+			present = append(present, item)
+		}
+	}
+	source.mutex.RUnlock()
+
+	return sbf.AddBatch(present)
+}
+
+// MembershipEqual reports whether sbf and other give the same answer for every candidate.
+// Filters built from the same items with different growth timing, or hashed into a
+// different number of sub-filters, have different structures, yet can still be equal in
+// the sense that matters: their answers over the candidate universe. Only the candidates
+// are compared, so unequal filters can agree on all of them, while a candidate that is a
+// false positive of just one filter makes filters holding the same items unequal.
+func (sbf *ScalableBloomFilter) MembershipEqual(other *ScalableBloomFilter, candidates []string) bool {
+	if sbf == other {
+		return true
+	}
+	// Hold one lock at a time, as in RebuildFrom, so that concurrent comparisons in
+	// opposite directions cannot deadlock behind waiting writers.
+	answers := sbf.MightContainBatch(candidates)
+
+	other.mutex.RLock()
+	defer other.mutex.RUnlock()
+
+	for i, item := range candidates {
+		if other.mightContain(item) != answers[i] {
+			return false
+		}
+	}
+	return true
+}
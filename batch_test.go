@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// cancelAfter returns a normalizer, with the identity as its effect, that cancels ctx on
+// its n-th call. Batch APIs normalize every item, so it cancels them mid-batch.
+func cancelAfter(n int, cancel context.CancelFunc) KeyNormalizer {
+	calls := 0
+	return NewKeyNormalizer("cancel-after", func(s string) string {
+		if calls++; calls == n {
+			cancel()
+		}
+		return s
+	})
+}
+
+func TestAddBatchCtxCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sbf := newTestFilter(t, testConfig, WithKeyNormalizer(cancelAfter(ctxCheckInterval+ctxCheckInterval/2, cancel)))
+	items := testKeys("batch", 5*ctxCheckInterval)
+
+	processed, err := sbf.AddBatchCtx(ctx, items)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("AddBatchCtx error = %v, want context.Canceled", err)
+	}
+	// The context is checked between chunks, so the chunk in which it was cancelled completes.
+	if want := 2 * ctxCheckInterval; processed != want {
+		t.Fatalf("AddBatchCtx processed %d items, want %d", processed, want)
+	}
+	for _, item := range items[:processed] {
+		if !sbf.MightContain(item) {
+			t.Fatalf("MightContain(%q) = false for an item reported as processed", item)
+		}
+	}
+	if got := sbf.ItemCount(); got > uint(processed) {
+		t.Errorf("ItemCount() = %d, more than the %d items processed", got, processed)
+	}
+}
+
+func TestMightContainBatchCtxCancel(t *testing.T) {
+	items := testKeys("batch", 5*ctxCheckInterval)
+	plain := newTestFilter(t, testConfig)
+	addAll(t, plain, items[:len(items)/2])
+	want := plain.MightContainBatch(items)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sbf := newTestFilter(t, testConfig, WithKeyNormalizer(cancelAfter(len(items)/2+ctxCheckInterval/2, cancel)))
+	if err := sbf.AddBatch(items[:len(items)/2]); err != nil {
+		t.Fatalf("AddBatch: %v", err)
+	}
+
+	results, err := sbf.MightContainBatchCtx(ctx, items)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("MightContainBatchCtx error = %v, want context.Canceled", err)
+	}
+	if len(results) != ctxCheckInterval {
+		t.Fatalf("MightContainBatchCtx returned %d results, want %d", len(results), ctxCheckInterval)
+	}
+	for i, got := range results {
+		if got != want[i] {
+			t.Errorf("result %d = %v, want %v", i, got, want[i])
+		}
+	}
+}
+
+func TestAddBatchCtxComplete(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	items := testKeys("batch", 3000)
+	processed, err := sbf.AddBatchCtx(context.Background(), items)
+	if err != nil || processed != len(items) {
+		t.Fatalf("AddBatchCtx = %d, %v, want %d, nil", processed, err, len(items))
+	}
+	for i, present := range sbf.MightContainBatch(items) {
+		if !present {
+			t.Fatalf("MightContainBatch result %d = false for an added item", i)
+		}
+	}
+}
+
+// TestAddBatchCtxPartialChunk checks that an insert error part way through a chunk
+// reports exactly the items inserted before it, as adding them one by one would.
+func TestAddBatchCtxPartialChunk(t *testing.T) {
+	config := testConfig
+	config.MaxFilters = 1
+	items := testKeys("batch", 3*ctxCheckInterval)
+
+	single := newTestFilter(t, config)
+	want := 0
+	for _, item := range items {
+		if err := single.Add(item); err != nil {
+			break
+		}
+		want++
+	}
+	if want == 0 || want%ctxCheckInterval == 0 {
+		t.Fatalf("%d items fit in one sub-filter, want a count that ends inside a chunk", want)
+	}
+
+	sbf := newTestFilter(t, config)
+	processed, err := sbf.AddBatchCtx(context.Background(), items)
+	if !errors.Is(err, ErrMaxFilters) {
+		t.Fatalf("AddBatchCtx error = %v, want ErrMaxFilters", err)
+	}
+	if processed != want {
+		t.Errorf("AddBatchCtx processed %d items, want %d", processed, want)
+	}
+	if sbf.ItemCount() != single.ItemCount() {
+		t.Errorf("ItemCount() = %d, want %d", sbf.ItemCount(), single.ItemCount())
+	}
+}
+
+func TestAllMightContain(t *testing.T) {
+	calls := 0
+	counting := NewKeyNormalizer("counting", func(s string) string { calls++; return s })
+	sbf := newTestFilter(t, testConfig, WithKeyNormalizer(counting))
+	members := testKeys("member", 500) // Several sub-filters
+	if err := sbf.AddBatch(members); err != nil {
+		t.Fatalf("AddBatch: %v", err)
+	}
+
+	calls = 0
+	if !sbf.AllMightContain(members) {
+		t.Fatal("AllMightContain(members) = false")
+	}
+	if calls != len(members) {
+		t.Errorf("hashed %d items for a batch of %d, want each hashed once", calls, len(members))
+	}
+
+	calls = 0
+	batch := append([]string{"member-0", "member-1", "absent"}, members...)
+	if sbf.AllMightContain(batch) {
+		t.Fatal("AllMightContain with an absent item = true")
+	}
+	if calls != 3 {
+		t.Errorf("hashed %d items, want 3: checking stops at the first miss", calls)
+	}
+
+	if !sbf.AllMightContain(nil) {
+		t.Error("AllMightContain(nil) = false, want true")
+	}
+}
+
+func TestFilterAbsent(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	members, absent := testKeys("member", 500), testKeys("absent", 500)
+	addAll(t, sbf, members)
+
+	var candidates, want []string
+	for i := range members {
+		candidates = append(candidates, absent[i], members[i])
+		if !sbf.MightContain(absent[i]) {
+			want = append(want, absent[i])
+		}
+	}
+	got := sbf.FilterAbsent(candidates)
+	// Every returned candidate is truly absent, in order; only false positives are missing.
+	if !slices.Equal(got, want) {
+		t.Errorf("FilterAbsent returned %d candidates, want the %d that MightContain rejects, in order", len(got), len(want))
+	}
+	if len(got) < len(absent)*95/100 {
+		t.Errorf("FilterAbsent returned %d of %d absent candidates, want all but the false positives", len(got), len(absent))
+	}
+	if got := sbf.FilterAbsent(members); len(got) != 0 {
+		t.Errorf("FilterAbsent(members) = %q, want none", got)
+	}
+	if got := sbf.FilterAbsent(nil); len(got) != 0 {
+		t.Errorf("FilterAbsent(nil) = %q, want none", got)
+	}
+}
+
+func BenchmarkAllMightContain(b *testing.B) {
+	sbf := newTestFilter(b, defaultConfig)
+	members := testKeys("member", 10000)
+	if err := sbf.AddBatch(members); err != nil {
+		b.Fatalf("AddBatch: %v", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !sbf.AllMightContain(members) {
+			b.Fatal("AllMightContain(members) = false")
+		}
+	}
+}
+
+func TestRebuildFrom(t *testing.T) {
+	source := newTestFilter(t, testConfig)
+	present := testKeys("present", 300)
+	addAll(t, source, present)
+	absent := testKeys("absent", 1000)
+	candidates := append(append([]string(nil), present...), absent...)
+
+	tighter := testConfig
+	tighter.InitialFP = 0.001
+	sbf := newTestFilter(t, tighter)
+	if err := sbf.RebuildFrom(candidates, source); err != nil {
+		t.Fatalf("RebuildFrom: %v", err)
+	}
+	for _, item := range present {
+		if !sbf.MightContain(item) {
+			t.Fatalf("rebuilt filter misses %q", item)
+		}
+	}
+	// Only the candidates source matched were added: the present ones and its false positives.
+	var carried uint
+	for _, item := range absent {
+		if source.MightContain(item) {
+			carried++
+		}
+	}
+	if got, want := sbf.ItemCount(), uint(len(present))+carried; got != want {
+		t.Errorf("rebuilt filter counts %d items, want %d", got, want)
+	}
+	if got := sbf.filters[0].targetFP; got != tighter.InitialFP {
+		t.Errorf("rebuilt filter targets %g, want its own %g", got, tighter.InitialFP)
+	}
+
+	// Rebuilding a filter from itself does not deadlock: source is read before sbf is locked.
+	if err := source.RebuildFrom(present, source); err != nil {
+		t.Fatalf("RebuildFrom itself: %v", err)
+	}
+}
+
+func TestRebuildFromErrors(t *testing.T) {
+	source := newTestFilter(t, testConfig)
+	keys := testKeys("key", 10)
+	addAll(t, source, keys)
+
+	frozen := newTestFilter(t, testConfig)
+	frozen.Freeze()
+	if err := frozen.RebuildFrom(keys, source); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("RebuildFrom into a frozen filter = %v, want ErrReadOnly", err)
+	}
+
+	closed := newTestFilter(t, testConfig)
+	closed.Close()
+	if err := closed.RebuildFrom(keys, source); !errors.Is(err, ErrClosed) {
+		t.Errorf("RebuildFrom into a closed filter = %v, want ErrClosed", err)
+	}
+
+	limited := testConfig
+	limited.MaxFilters = 1
+	full := newTestFilter(t, limited)
+	big := newTestFilter(t, testConfig)
+	many := testKeys("many", 300)
+	addAll(t, big, many)
+	if err := full.RebuildFrom(many, big); !errors.Is(err, ErrMaxFilters) {
+		t.Errorf("RebuildFrom past MaxFilters = %v, want ErrMaxFilters", err)
+	}
+}
+
+func TestEvaluateAccuracy(t *testing.T) {
+	absent := testKeys("absent", 20000)
+	for _, n := range []int{10, 100, 1000, 5000} {
+		sbf := newTestFilter(t, testConfig)
+		present := testKeys("present", n)
+		addAll(t, sbf, present)
+
+		tp, fn, fp, tn := sbf.EvaluateAccuracy(present, absent)
+		if fn != 0 || tp != n {
+			t.Errorf("%d items: tp %d, fn %d, want %d and 0", n, tp, fn, n)
+		}
+		if fp+tn != len(absent) {
+			t.Errorf("%d items: fp %d + tn %d, want %d", n, fp, tn, len(absent))
+		}
+		// Stage rates tighten geometrically, so their sum bounds the compound rate. The
+		// factor leaves room for sampling error over the absent items.
+		bound := testConfig.InitialFP / (1 - testConfig.TighteningRatio)
+		if rate := float64(fp) / float64(len(absent)); rate > 1.5*bound {
+			t.Errorf("%d items: false positive rate %.4f, want at most %.4f", n, rate, 1.5*bound)
+		}
+	}
+
+	// Clearing a stage's bits makes its items false negatives, and they are counted.
+	sbf := newTestFilter(t, testConfig)
+	present := testKeys("present", 50)
+	addAll(t, sbf, present)
+	clear(sbf.filters[0].bitset)
+	if tp, fn, _, _ := sbf.EvaluateAccuracy(present, nil); tp != 0 || fn != 50 {
+		t.Errorf("after clearing the bits: tp %d, fn %d, want 0 and 50", tp, fn)
+	}
+}
+
+func TestMembershipEqual(t *testing.T) {
+	items := testKeys("item", 500)
+	staged := newTestFilter(t, testConfig) // Grows through several sub-filters
+	addAll(t, staged, items)
+	large := testConfig
+	large.InitialCapacity = 10000
+	single := newTestFilter(t, large)
+	addAll(t, single, items)
+	if len(staged.filters) == len(single.filters) {
+		t.Fatalf("both filters have %d sub-filters, want different structures", len(staged.filters))
+	}
+
+	// Absent candidates are kept only where neither filter has a false positive.
+	candidates := append([]string(nil), items...)
+	for _, item := range testKeys("absent", 500) {
+		if !staged.MightContain(item) && !single.MightContain(item) {
+			candidates = append(candidates, item)
+		}
+	}
+	if !staged.MembershipEqual(single, candidates) || !single.MembershipEqual(staged, candidates) {
+		t.Fatal("MembershipEqual = false for filters holding the same items")
+	}
+	if !staged.MembershipEqual(staged, candidates) {
+		t.Error("MembershipEqual with itself = false")
+	}
+
+	extra := candidates[len(candidates)-1]
+	if err := single.Add(extra); err != nil {
+		t.Fatal(err)
+	}
+	if staged.MembershipEqual(single, candidates) || single.MembershipEqual(staged, candidates) {
+		t.Errorf("MembershipEqual = true after only one filter added %q", extra)
+	}
+	// Only the candidates are compared.
+	if !staged.MembershipEqual(single, items) {
+		t.Error("MembershipEqual over candidates both filters contain = false")
+	}
+}
+
+func TestMembershipEqualConcurrent(t *testing.T) {
+	a, b := newTestFilter(t, testConfig), newTestFilter(t, testConfig)
+	items := testKeys("item", 200)
+	addAll(t, a, items)
+	addAll(t, b, items)
+
+	// Comparisons in opposite directions, with writers waiting on both locks, finish.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(4)
+		go func() { defer wg.Done(); a.MembershipEqual(b, items) }()
+		go func() { defer wg.Done(); b.MembershipEqual(a, items) }()
+		go func() { defer wg.Done(); _ = a.Add("writer-a") }()
+		go func() { defer wg.Done(); _ = b.Add("writer-b") }()
+	}
+	wg.Wait()
+}
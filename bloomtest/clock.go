@@ -0,0 +1,75 @@
+// Package bloomtest provides test helpers for code using the bloom filter package.
+package bloomtest
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock is a manually advanced clock for deterministic tests of time-based behavior.
+// It satisfies the filter package's Clock interface. The zero value is not usable;
+// create one with NewFakeClock.
+type FakeClock struct {
+	now     time.Time
+	waiters []waiter
+	mutex   sync.Mutex
+}
+
+// waiter is a pending After call.
+type waiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// NewFakeClock creates a FakeClock set to start.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now returns the clock's current time.
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+// After returns a channel that receives the clock's time once it has been advanced by d.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, waiter{deadline: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward by d and fires every After whose deadline has passed.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.deadline.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = pending
+}
+
+// Waiters returns the number of After calls that have not fired yet. Tests can poll it
+// to wait until the code under test is blocked on the clock before advancing it.
+func (c *FakeClock) Waiters() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.waiters)
+}
@@ -0,0 +1,60 @@
+package bloomtest
+
+import (
+	"testing"
+	"time"
+)
+
+// fired reports whether ch has a value ready, consuming it.
+func fired(ch <-chan time.Time) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFakeClock(start)
+	if got := c.Now(); !got.Equal(start) {
+		t.Fatalf("Now() = %v, want %v", got, start)
+	}
+
+	short, long := c.After(time.Second), c.After(time.Minute)
+	if got := c.Waiters(); got != 2 {
+		t.Fatalf("Waiters() = %d, want 2", got)
+	}
+	c.Advance(500 * time.Millisecond)
+	if fired(short) || fired(long) {
+		t.Fatal("After fired before its deadline")
+	}
+	c.Advance(500 * time.Millisecond)
+	if !fired(short) {
+		t.Error("After(1s) did not fire once the clock reached its deadline")
+	}
+	if fired(long) {
+		t.Error("After(1m) fired early")
+	}
+	if got := c.Waiters(); got != 1 {
+		t.Errorf("Waiters() = %d after one fired, want 1", got)
+	}
+	c.Advance(time.Hour)
+	if !fired(long) {
+		t.Error("After(1m) did not fire after advancing past its deadline")
+	}
+	if got, want := c.Now(), start.Add(time.Hour+time.Second); !got.Equal(want) {
+		t.Errorf("Now() = %v, want %v", got, want)
+	}
+}
+
+func TestFakeClockAfterZero(t *testing.T) {
+	c := NewFakeClock(time.Unix(0, 0))
+	if !fired(c.After(0)) {
+		t.Error("After(0) did not fire immediately")
+	}
+	if c.Waiters() != 0 {
+		t.Error("After(0) left a waiter behind")
+	}
+}
@@ -0,0 +1,571 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// The bloom command line tool is organized as subcommands that operate on filter files,
+// such as "bloom add -f filter.bloom item...". Each subcommand parses its own flags and
+// runs against a cliEnv, so commands can be exercised without a process.
+
+// Exit codes of the command line tool.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// errUsage marks errors caused by invalid command line arguments.
+var errUsage = errors.New("usage error")
+
+// exitStatus is returned by commands that report a result through a specific exit code.
+// runCLI exits with code, printing err first if it is set.
+type exitStatus struct {
+	code int
+	err  error
+}
+
+func (e *exitStatus) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit status %d", e.code)
+	}
+	return e.err.Error()
+}
+
+func (e *exitStatus) Unwrap() error { return e.err }
+
+// defaultConfig is used for new filter files when no configuration is given.
+var defaultConfig = Config{
+	InitialFP:       0.01, // 1% false positive rate
+	GrowthFactor:    2.0,  // Capacity doubles with each new filter
+	TighteningRatio: 0.5,  // False positive rate halves with each new filter
+	InitialCapacity: 1000, // Initial expected number of elements
+}
+
+// cliEnv holds a command's standard streams and global flags.
+type cliEnv struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	json   bool // Set by the global -json flag; see cli_json.go
+}
+
+// command is a subcommand of the command line tool.
+type command struct {
+	name    string
+	summary string
+	run     func(env cliEnv, args []string) error
+}
+
+// commands lists the subcommands in the order they are shown in the usage message.
+// It is populated in init to break the reference cycle with runHelp.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"add", "insert items into a filter file, creating it if needed", runAdd},
+		{"check", "report whether items might be in a filter file", runCheck},
+		{"explain", "show the bits that decide whether an item is in a filter file", runExplain},
+		{"import", "stream keys from a file or stdin into a filter file", runImport},
+		{"dedupe", "copy stdin to stdout, dropping lines seen before", runDedupe},
+		{"files", "record file contents in a filter file or find files seen before", runFiles},
+		{"create", "create an empty filter file ahead of time", runCreate},
+		{"config", "write a configuration template or validate a configuration file", runConfig},
+		{"sample", "recommend a configuration from a sample of the keys", runSample},
+		{"stats", "describe a filter file", runStats},
+		{"inspect", "describe a filter file from its header only", runInspect},
+		{"convert", "convert a filter file to another format", runConvert},
+		{"merge", "combine filter files into their union", runMerge},
+		{"grow", "allocate sub-filters ahead of a bulk load", runGrow},
+		{"diff", "compare two filter files", runDiff},
+		{"bench", "measure filter performance on this machine", runBench},
+		{"verify-fp", "measure a filter file's false positive rate", runVerifyFP},
+		{"repl", "explore a filter file interactively", runREPL},
+		{"demo", "run the built-in example", runDemo},
+		{"help", "show this message", runHelp},
+	}
+}
+
+// runCLI runs the command line tool with args, excluding the program name, and returns
+// the process exit code. A leading -json is the global flag selecting JSON output. For
+// compatibility with the original demo, arguments that start with any other flag instead
+// of a subcommand run the demo.
+func runCLI(env cliEnv, args []string) int {
+	for len(args) > 0 && (args[0] == jsonFlag || args[0] == "-"+jsonFlag) {
+		env.json = true
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		runHelp(env, nil)
+		return exitUsage
+	}
+	name, rest := args[0], args[1:]
+	if strings.HasPrefix(name, "-") {
+		name, rest = "demo", args
+	}
+	for _, cmd := range commands {
+		if cmd.name == name {
+			err := cmd.run(env, rest)
+			var status *exitStatus
+			switch {
+			case err == nil:
+				return exitOK
+			case errors.As(err, &status):
+				if status.err != nil {
+					reportError(env, name, status.err, status.code)
+				}
+				return status.code
+			case errors.Is(err, flag.ErrHelp):
+				return exitOK
+			case errors.Is(err, errUsage):
+				reportError(env, name, err, exitUsage)
+				return exitUsage
+			default:
+				reportError(env, name, err, exitError)
+				return exitError
+			}
+		}
+	}
+	reportError(env, "", fmt.Errorf("unknown command %q", name), exitUsage)
+	if !env.json {
+		runHelp(env, nil)
+	}
+	return exitUsage
+}
+
+// helpCommand describes a subcommand in the JSON output of "bloom help".
+type helpCommand struct {
+	Name    string `json:"name"`
+	Summary string `json:"summary"`
+}
+
+// runHelp prints the list of subcommands, or with the global -json flag the version of
+// the JSON schema and the subcommands to stdout.
+func runHelp(env cliEnv, args []string) error {
+	if env.json {
+		help := struct {
+			SchemaVersion int           `json:"schema_version"`
+			Commands      []helpCommand `json:"commands"`
+		}{SchemaVersion: jsonSchemaVersion}
+		for _, cmd := range commands {
+			help.Commands = append(help.Commands, helpCommand{cmd.name, cmd.summary})
+		}
+		return writeJSON(env.stdout, help)
+	}
+	fmt.Fprintln(env.stderr, "usage: bloom <command> [flags] [args]")
+	fmt.Fprintln(env.stderr)
+	fmt.Fprintln(env.stderr, "commands:")
+	tw := tabwriter.NewWriter(env.stderr, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(env.stderr)
+	fmt.Fprintln(env.stderr, `Run "bloom <command> -h" for the flags of a command.`)
+	return nil
+}
+
+// newFlagSet returns a flag set for a subcommand that reports errors instead of exiting.
+// With the global -json flag, its messages are held back by parseFlags, so that a parse
+// error reaches stderr only as JSON.
+func newFlagSet(env cliEnv, name, args string) *flag.FlagSet {
+	flags := flag.NewFlagSet("bloom "+name, flag.ContinueOnError)
+	flags.SetOutput(env.stderr)
+	if env.json {
+		flags.SetOutput(&heldOutput{w: env.stderr})
+	}
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: bloom %s [flags] %s\n", name, args)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// heldOutput buffers a flag set's messages until parseFlags decides whether to show them.
+type heldOutput struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (h *heldOutput) Write(p []byte) (int, error) { return h.buf.Write(p) }
+
+// parseFlags parses args into the flag set, marking parse errors as usage errors. Held
+// messages are only written for -h, whose usage text was asked for.
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	err := flags.Parse(args)
+	if held, ok := flags.Output().(*heldOutput); ok {
+		if errors.Is(err, flag.ErrHelp) {
+			held.w.Write(held.buf.Bytes())
+		}
+		held.buf.Reset()
+	}
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	return nil
+}
+
+// configFlags holds the flags that configure a new filter.
+type configFlags struct {
+	configPath string
+	config     Config
+}
+
+// register adds the configuration flags to the flag set.
+func (c *configFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&c.configPath, "config", "", "JSON, YAML or TOML configuration file; overrides the other configuration flags")
+	flags.Float64Var(&c.config.InitialFP, "fp", defaultConfig.InitialFP, "initial false positive rate")
+	flags.IntVar(&c.config.InitialCapacity, "capacity", defaultConfig.InitialCapacity, "initial expected number of items")
+	flags.Float64Var(&c.config.GrowthFactor, "growth", defaultConfig.GrowthFactor, "factor by which capacity grows")
+	flags.Float64Var(&c.config.TighteningRatio, "tightening", defaultConfig.TighteningRatio, "ratio by which the false positive rate shrinks")
+	flags.IntVar(&c.config.MaxFilters, "max-filters", 0, "maximum number of sub-filters, 0 for unlimited")
+	flags.Float64Var(&c.config.MinFP, "min-fp", 0, "lowest false positive rate a sub-filter targets, 0 for no floor")
+}
+
+// resolve returns the configuration from the -config file if given, or from the flags.
+func (c *configFlags) resolve() (Config, error) {
+	if c.configPath == "" {
+		return c.config, nil
+	}
+	return loadConfig(c.configPath)
+}
+
+// filterFlags holds the flags of commands that operate on a filter file.
+type filterFlags struct {
+	path   string
+	hasher string
+	configFlags
+}
+
+// register adds the filter file and configuration flags to the flag set.
+func (f *filterFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.path, "f", "", "filter file (required)")
+	flags.StringVar(&f.hasher, "hash", MD5Hasher.Name(), "hasher for a new filter: md5, fnv, sha256 or xxhash")
+	f.configFlags.register(flags)
+}
+
+// open loads the filter file. If it does not exist and create is set, a new filter is
+// built from the configuration flags instead; it is written only when saved.
+func (f *filterFlags) open(create bool) (*ScalableBloomFilter, error) {
+	if f.path == "" {
+		return nil, fmt.Errorf("%w: -f is required", errUsage)
+	}
+	sbf, err := loadScalableFile(f.path, nil)
+	if err == nil || !create || !errors.Is(err, fs.ErrNotExist) {
+		return sbf, err
+	}
+	return f.create()
+}
+
+// create builds a new, empty filter from the configuration flags.
+func (f *filterFlags) create() (*ScalableBloomFilter, error) {
+	config, err := f.resolve()
+	if err != nil {
+		return nil, err
+	}
+	hasher, err := LookupHasher(f.hasher)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errUsage, err)
+	}
+	return NewScalableBloomFilter(config, WithHasher(hasher))
+}
+
+// nulFlagUsage is the help text of the -0 flag shared by commands that read records.
+const nulFlagUsage = "records are terminated by NUL instead of newline, as from find -print0"
+
+// recordDelim returns the record delimiter selected by the -0 flag.
+func recordDelim(nul bool) byte {
+	if nul {
+		return 0
+	}
+	return '\n'
+}
+
+// decompressStdin returns stdin, decompressed if it starts with gzip or zstd magic bytes,
+// and a function that releases the decompressor.
+func decompressStdin(env cliEnv) (io.Reader, func() error, error) {
+	return maybeDecompress(bufio.NewReader(env.stdin), "")
+}
+
+// openInput opens the file at path, or stdin for "-", decompressing gzip or zstd input,
+// and returns a function that closes it.
+func openInput(env cliEnv, path string) (io.Reader, func() error, error) {
+	if path == "-" {
+		return decompressStdin(env)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, closeReader, err := maybeDecompress(bufio.NewReader(file), path)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return r, func() error {
+		closeReader()
+		return file.Close()
+	}, nil
+}
+
+// forEachItem calls fn for each item given as an argument or, if there are none, for
+// each record read from stdin up to delim. Compressed stdin is decompressed, empty
+// records are skipped, and a trailing "\r" is stripped from newline-delimited ones.
+// A read error reports how many records were processed before it.
+func forEachItem(env cliEnv, args []string, delim byte, fn func(item string) error) error {
+	if len(args) > 0 {
+		for _, item := range args {
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	stdin, closeStdin, err := decompressStdin(env)
+	if err != nil {
+		return err
+	}
+	defer closeStdin()
+	return forEachRecord(stdin, delim, fn)
+}
+
+// forEachRecord calls fn for each record read from r up to delim, like forEachItem does
+// for stdin.
+func forEachRecord(in io.Reader, delim byte, fn func(item string) error) error {
+	r := bufio.NewReader(in)
+	for records := 0; ; records++ {
+		line, err := r.ReadString(delim)
+		line = trimRecord(line, delim)
+		if line != "" {
+			if fnErr := fn(line); fnErr != nil {
+				return fnErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("stopped after %d records: %w", records, err)
+		}
+	}
+}
+
+// runAdd implements "bloom add": it inserts the items and saves the filter file,
+// reporting how many items were new.
+func runAdd(env cliEnv, args []string) error {
+	var ff filterFlags
+	var nul bool
+	flags := newFlagSet(env, "add", "[item...]")
+	ff.register(flags)
+	flags.BoolVar(&nul, "0", false, nulFlagUsage)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	sbf, err := ff.open(true)
+	if err != nil {
+		return err
+	}
+
+	var total, added int
+	err = forEachItem(env, flags.Args(), recordDelim(nul), func(item string) error {
+		present, err := sbf.TestAndAdd(item)
+		total++
+		if !present {
+			added++
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := sbf.saveFile(ff.path); err != nil {
+		return err
+	}
+	if env.json {
+		return writeJSON(env.stdout, addResult{Items: total, Added: added})
+	}
+	fmt.Fprintf(env.stdout, "%d of %d items were new\n", added, total)
+	return nil
+}
+
+// addResult is the JSON output of "bloom add".
+type addResult struct {
+	Items int `json:"items"` // Items given
+	Added int `json:"added"` // Items that were new
+}
+
+// Exit codes of "bloom check".
+const (
+	exitCheckPresent = 0
+	exitCheckAbsent  = 1
+	exitCheckError   = 2
+)
+
+// runCheck implements "bloom check": it prints whether each item might be present and
+// sets the exit status for scripts: 0 if every item might be present, or with -any if
+// at least one might be, 1 otherwise, and 2 if the check could not be run. With
+// -tokenize the items are the words of each record, and only those that might be present
+// are printed, followed by a count.
+func runCheck(env cliEnv, args []string) error {
+	var ff filterFlags
+	var tf tokenFlags
+	var quiet, anyPresent, nul bool
+	flags := newFlagSet(env, "check", "[item...]")
+	ff.register(flags)
+	tf.register(flags)
+	flags.BoolVar(&nul, "0", false, nulFlagUsage+"; output records too")
+	flags.BoolVar(&quiet, "q", false, "print nothing; report through the exit status only")
+	flags.BoolVar(&anyPresent, "any", false, "exit 0 if any item might be present instead of all")
+	flags.Usage = checkUsage(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	tokenize, err := tf.tokenizer()
+	if err != nil {
+		return err
+	}
+	sbf, err := ff.open(false)
+	if err != nil {
+		return &exitStatus{code: exitCheckError, err: err}
+	}
+
+	var checked, present int
+	results := []checkResult{}
+	delim := recordDelim(nul)
+	check := func(item string) error {
+		checked++
+		status := "absent"
+		mightContain := sbf.MightContain(item)
+		if mightContain {
+			present++
+			status = "present"
+		}
+		switch {
+		case quiet, tokenize != nil && !mightContain:
+			return nil
+		case env.json:
+			results = append(results, checkResult{item, mightContain})
+			return nil
+		}
+		_, err := fmt.Fprintf(env.stdout, "%s\t%s%c", item, status, delim)
+		return err
+	}
+	if tokenize != nil {
+		err = forEachItem(env, flags.Args(), delim, func(record string) error {
+			for _, token := range tokenize(record) {
+				if err := check(token); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	} else {
+		err = forEachItem(env, flags.Args(), delim, check)
+	}
+	if err != nil {
+		return &exitStatus{code: exitCheckError, err: err}
+	}
+	switch {
+	case quiet:
+	case env.json && tokenize != nil:
+		err = writeJSON(env.stdout, tokenCheckResult{Tokens: checked, Present: present, Hits: results})
+	case env.json:
+		err = writeJSON(env.stdout, results)
+	case tokenize != nil:
+		_, err = fmt.Fprintf(env.stdout, "%d of %d tokens might be present\n", present, checked)
+	}
+	if err != nil {
+		return &exitStatus{code: exitCheckError, err: err}
+	}
+
+	if (anyPresent && present > 0) || (!anyPresent && present == checked) {
+		return nil
+	}
+	return &exitStatus{code: exitCheckAbsent}
+}
+
+// checkResult is an element of the JSON output of "bloom check".
+type checkResult struct {
+	Item    string `json:"item"`
+	Present bool   `json:"present"` // Whether the item might be present
+}
+
+// tokenCheckResult is the JSON output of "bloom check -tokenize".
+type tokenCheckResult struct {
+	Tokens  int           `json:"tokens"`  // Tokens checked
+	Present int           `json:"present"` // Tokens that might be present
+	Hits    []checkResult `json:"hits"`    // The tokens that might be present, in input order
+}
+
+// checkUsage returns a usage function that documents the exit status of "bloom check".
+func checkUsage(flags *flag.FlagSet) func() {
+	return func() {
+		w := flags.Output()
+		fmt.Fprintln(w, "usage: bloom check [flags] [item...]")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Exit status:")
+		fmt.Fprintln(w, "  0  every item might be present (with -any: at least one might be)")
+		fmt.Fprintln(w, "  1  otherwise; some item is definitely absent (with -any: all are)")
+		fmt.Fprintln(w, "  2  the filter could not be read or the arguments are invalid")
+		fmt.Fprintln(w)
+		flags.PrintDefaults()
+	}
+}
+
+// runDemo implements "bloom demo", the original example: it builds a filter from a
+// configuration file or the defaults, adds some fruit and checks for others.
+func runDemo(env cliEnv, args []string) error {
+	flags := newFlagSet(env, "demo", "")
+	configPath := flags.String("config", "config.json", "Path to configuration file")
+	useDefaults := flags.Bool("defaults", false, "Use default configuration if true")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	config := defaultConfig
+	if !*useDefaults {
+		if _, err := os.Stat(*configPath); os.IsNotExist(err) {
+			return fmt.Errorf("configuration file not found: %s", *configPath)
+		}
+		loadedConfig, err := loadConfig(*configPath)
+		if err != nil {
+			return fmt.Errorf("loading configuration: %w", err)
+		}
+		config = loadedConfig
+	}
+
+	// Initialize Scalable Bloom Filter with the loaded configuration
+	sbf, err := NewScalableBloomFilter(config)
+	if err != nil {
+		return fmt.Errorf("initializing Scalable Bloom Filter: %w", err)
+	}
+
+	// Example usage: Add elements
+	elementsToAdd := []string{"apple", "banana", "cherry", "date", "elderberry", "fig", "grape"}
+	for _, item := range elementsToAdd {
+		if err := sbf.Add(item); err != nil {
+			fmt.Fprintf(env.stdout, "Error adding item '%s': %v\n", item, err)
+		}
+	}
+
+	// Example usage: Check for elements
+	elementsToCheck := []string{"apple", "banana", "cherry", "date", "kiwi", "lemon"}
+	for _, item := range elementsToCheck {
+		fmt.Fprintf(env.stdout, "Contains '%s': %v\n", item, sbf.MightContain(item))
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// benchBatch is the number of keys generated, untimed, ahead of each timed batch.
+const benchBatch = 4096
+
+// benchResult is one row of the "bloom bench" table, also printed with -json.
+type benchResult struct {
+	Hasher      string   `json:"hasher"`
+	KeySize     int      `json:"key_size"`
+	Op          string   `json:"op"` // "add", or "check" for lookups of absent keys
+	Ops         int      `json:"ops"`
+	NsPerOp     float64  `json:"ns_per_op"`
+	MBPerSec    float64  `json:"mb_per_sec"`
+	AllocsPerOp float64  `json:"allocs_per_op"`
+	MeasuredFP  *float64 `json:"measured_fp,omitempty"` // Share of absent keys reported present; check only
+}
+
+// benchMeasurement is what a timed loop observed. Only the time spent in the measured
+// operation counts, not generating keys or collecting allocation statistics.
+type benchMeasurement struct {
+	ops     int
+	elapsed time.Duration
+	allocs  uint64
+}
+
+// nsPerOp returns the mean time per operation in nanoseconds.
+func (m benchMeasurement) nsPerOp() float64 {
+	if m.ops == 0 {
+		return 0
+	}
+	return float64(m.elapsed.Nanoseconds()) / float64(m.ops)
+}
+
+// mbPerSec returns the throughput in megabytes of keys per second.
+func (m benchMeasurement) mbPerSec(keySize int) float64 {
+	if m.elapsed <= 0 {
+		return 0
+	}
+	return float64(m.ops) * float64(keySize) / 1e6 / m.elapsed.Seconds()
+}
+
+// allocsPerOp returns the mean number of heap allocations per operation.
+func (m benchMeasurement) allocsPerOp() float64 {
+	if m.ops == 0 {
+		return 0
+	}
+	return float64(m.allocs) / float64(m.ops)
+}
+
+// result converts the measurement into a table row.
+func (m benchMeasurement) result(hasher string, keySize int, op string) benchResult {
+	return benchResult{
+		Hasher:      hasher,
+		KeySize:     keySize,
+		Op:          op,
+		Ops:         m.ops,
+		NsPerOp:     m.nsPerOp(),
+		MBPerSec:    m.mbPerSec(keySize),
+		AllocsPerOp: m.allocsPerOp(),
+	}
+}
+
+// benchClock times the bench subcommand's batches.
+var benchClock Clock = realClock{}
+
+// timeBatches runs op on batches of keys from next until op has run for at least d in
+// total, and at least once.
+func timeBatches(d time.Duration, next func() []string, op func(keys []string)) benchMeasurement {
+	var m benchMeasurement
+	var before, after runtime.MemStats
+	for m.ops == 0 || m.elapsed < d {
+		keys := next()
+		runtime.ReadMemStats(&before)
+		start := benchClock.Now()
+		op(keys)
+		m.elapsed += benchClock.Now().Sub(start)
+		runtime.ReadMemStats(&after)
+		m.allocs += after.Mallocs - before.Mallocs
+		m.ops += len(keys)
+	}
+	return m
+}
+
+// keyGenerator produces reproducible random keys of a fixed size. Generators with
+// different seeds produce different keys, up to collisions that only matter for keys of a
+// few bytes.
+type keyGenerator struct {
+	rng  *rand.Rand
+	buf  []byte
+	keys []string
+}
+
+// newKeyGenerator returns a generator of keys of size bytes seeded with seed.
+func newKeyGenerator(seed int64, size int) *keyGenerator {
+	return &keyGenerator{
+		rng:  rand.New(rand.NewSource(seed)),
+		buf:  make([]byte, size),
+		keys: make([]string, benchBatch),
+	}
+}
+
+// next returns the next batch of keys, reusing the slice returned by the previous call.
+func (g *keyGenerator) next() []string {
+	for i := range g.keys {
+		g.rng.Read(g.buf)
+		g.keys[i] = string(g.buf)
+	}
+	return g.keys
+}
+
+// runBench implements "bloom bench": for every combination of hasher and key size it
+// times Add on a filter that is replaced once it reaches capacity, then fills a new filter
+// to capacity and times MightContain on keys that were never added, counting the false
+// positives among them.
+func runBench(env cliEnv, args []string) error {
+	var capacity, fp float64
+	var hasherList, keySizeList string
+	var duration time.Duration
+	var seed int64
+	var asJSON bool
+	flags := newFlagSet(env, "bench", "")
+	flags.Float64Var(&capacity, "capacity", 1e6, "number of items each filter is sized for and filled with")
+	flags.Float64Var(&fp, "fp", defaultConfig.InitialFP, "false positive rate the filters are sized for")
+	flags.StringVar(&hasherList, "hash", "md5,fnv,xxhash", "comma-separated hashers to compare: md5, fnv, sha256 or xxhash")
+	flags.StringVar(&keySizeList, "keysize", "16,64", "comma-separated key sizes in bytes")
+	flags.DurationVar(&duration, "time", time.Second, "time spent measuring each operation of each combination")
+	flags.Int64Var(&seed, "seed", 1, "seed of the key generator")
+	flags.BoolVar(&asJSON, "json", false, "print JSON instead of a table")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	switch {
+	case capacity < 1 || capacity > math.MaxInt:
+		return fmt.Errorf("%w: -capacity must be a positive integer", errUsage)
+	case fp <= 0 || fp >= 1:
+		return fmt.Errorf("%w: -fp must be between 0 and 1", errUsage)
+	case duration <= 0:
+		return fmt.Errorf("%w: -time must be positive", errUsage)
+	}
+	var hashers []Hasher
+	for _, name := range strings.Split(hasherList, ",") {
+		h, err := LookupHasher(strings.TrimSpace(name))
+		if err != nil {
+			return fmt.Errorf("%w: %v", errUsage, err)
+		}
+		hashers = append(hashers, h)
+	}
+	var keySizes []int
+	for _, s := range strings.Split(keySizeList, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || size < 1 {
+			return fmt.Errorf("%w: invalid key size %q", errUsage, s)
+		}
+		keySizes = append(keySizes, size)
+	}
+
+	n := int(capacity)
+	var results []benchResult
+	for _, h := range hashers {
+		for _, size := range keySizes {
+			results = append(results, benchAdd(n, fp, h, size, seed, duration))
+			results = append(results, benchCheck(n, fp, h, size, seed, duration))
+		}
+	}
+
+	if asJSON || env.json {
+		return writeJSON(env.stdout, results)
+	}
+	_, _, m, k := NewBloomFilter(n, fp).Params()
+	fmt.Fprintf(env.stdout, "capacity %d, target fp %g: %d bits, %d hash functions\n\n", n, fp, m, k)
+	return writeBenchTable(env, results)
+}
+
+// benchAdd times Add with keys of size bytes, starting over with an empty filter whenever
+// the current one holds n items so that fill does not drift past the sizing.
+func benchAdd(n int, fp float64, h Hasher, size int, seed int64, d time.Duration) benchResult {
+	gen := newKeyGenerator(seed, size)
+	bf := NewBloomFilter(n, fp, WithHasher(h))
+	added := 0
+	next := func() []string {
+		if added >= n {
+			bf, added = NewBloomFilter(n, fp, WithHasher(h)), 0
+		}
+		keys := gen.next()[:min(benchBatch, n-added)]
+		added += len(keys)
+		return keys
+	}
+	m := timeBatches(d, next, func(keys []string) {
+		for _, key := range keys {
+			bf.Add(key)
+		}
+	})
+	return m.result(h.Name(), size, "add")
+}
+
+// benchCheck fills a filter with n keys of size bytes, untimed, and times MightContain on
+// keys from another seed, which are absent, so every positive is a false positive.
+func benchCheck(n int, fp float64, h Hasher, size int, seed int64, d time.Duration) benchResult {
+	bf := NewBloomFilter(n, fp, WithHasher(h))
+	members := newKeyGenerator(seed, size)
+	for added := 0; added < n; {
+		keys := members.next()[:min(benchBatch, n-added)]
+		for _, key := range keys {
+			bf.Add(key)
+		}
+		added += len(keys)
+	}
+
+	probes := newKeyGenerator(seed+1, size)
+	positives := 0
+	m := timeBatches(d, probes.next, func(keys []string) {
+		for _, key := range keys {
+			if bf.MightContain(key) {
+				positives++
+			}
+		}
+	})
+	result := m.result(h.Name(), size, "check")
+	measured := float64(positives) / float64(m.ops)
+	result.MeasuredFP = &measured
+	return result
+}
+
+// writeBenchTable prints one row per hasher, key size and operation.
+func writeBenchTable(env cliEnv, results []benchResult) error {
+	tw := tabwriter.NewWriter(env.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HASHER\tKEY SIZE\tOP\tOPS\tNS/OP\tMB/S\tALLOCS/OP\tMEASURED FP")
+	for _, r := range results {
+		measured := "-"
+		if r.MeasuredFP != nil {
+			measured = fmt.Sprintf("%.6g", *r.MeasuredFP)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%.1f\t%.1f\t%.2f\t%s\n",
+			r.Hasher, r.KeySize, r.Op, r.Ops, r.NsPerOp, r.MBPerSec, r.AllocsPerOp, measured)
+	}
+	return tw.Flush()
+}
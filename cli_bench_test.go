@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-bloom-filter/bloomtest"
+)
+
+// useBenchClock replaces benchClock with a fake clock for the test.
+func useBenchClock(t *testing.T) *bloomtest.FakeClock {
+	clock := bloomtest.NewFakeClock(time.Unix(0, 0))
+	benchClock = clock
+	t.Cleanup(func() { benchClock = realClock{} })
+	return clock
+}
+
+func TestTimeBatches(t *testing.T) {
+	clock := useBenchClock(t)
+	gen := newKeyGenerator(1, 16)
+	batches := 0
+	m := timeBatches(time.Second, gen.next, func(keys []string) {
+		batches++
+		clock.Advance(time.Duration(len(keys)) * 100 * time.Nanosecond)
+	})
+
+	// Batches of 4096 keys at 100ns each take 409.6µs, so 2442 are needed to reach 1s.
+	if batches != 2442 || m.ops != 2442*benchBatch {
+		t.Errorf("%d batches, %d ops, want 2442 and %d", batches, m.ops, 2442*benchBatch)
+	}
+	if want := time.Duration(m.ops) * 100 * time.Nanosecond; m.elapsed != want {
+		t.Errorf("elapsed %v, want %v", m.elapsed, want)
+	}
+	if got := m.nsPerOp(); got != 100 {
+		t.Errorf("nsPerOp = %g, want 100", got)
+	}
+	if got := m.mbPerSec(16); math.Abs(got-160) > 1e-9 { // 16 bytes every 100ns
+		t.Errorf("mbPerSec(16) = %g, want 160", got)
+	}
+
+	// Generating keys is not timed, and a duration shorter than a batch still runs one.
+	m = timeBatches(time.Nanosecond, func() []string {
+		clock.Advance(time.Hour)
+		return gen.next()
+	}, func(keys []string) { clock.Advance(time.Millisecond) })
+	if m.ops != benchBatch || m.elapsed != time.Millisecond {
+		t.Errorf("one batch: %d ops in %v, want %d in 1ms", m.ops, m.elapsed, benchBatch)
+	}
+}
+
+func TestBenchMeasurement(t *testing.T) {
+	m := benchMeasurement{ops: 1000, elapsed: 2 * time.Millisecond, allocs: 500}
+	r := m.result("fnv", 64, "add")
+	want := benchResult{Hasher: "fnv", KeySize: 64, Op: "add", Ops: 1000, NsPerOp: 2000, MBPerSec: 32, AllocsPerOp: 0.5}
+	if r != want {
+		t.Errorf("result = %+v, want %+v", r, want)
+	}
+
+	var empty benchMeasurement
+	if empty.nsPerOp() != 0 || empty.mbPerSec(16) != 0 || empty.allocsPerOp() != 0 {
+		t.Error("an empty measurement has non-zero rates")
+	}
+}
+
+func TestKeyGenerator(t *testing.T) {
+	a, b, other := newKeyGenerator(7, 16), newKeyGenerator(7, 16), newKeyGenerator(8, 16)
+	first := slices.Clone(a.next())
+	if !slices.Equal(first, b.next()) {
+		t.Error("generators with the same seed produce different keys")
+	}
+	if slices.Equal(first, other.next()) {
+		t.Error("generators with different seeds produce the same keys")
+	}
+	if slices.Equal(first, a.next()) {
+		t.Error("successive batches are the same")
+	}
+	for _, key := range first {
+		if len(key) != 16 {
+			t.Fatalf("key of %d bytes, want 16", len(key))
+		}
+	}
+}
+
+func TestBenchCheck(t *testing.T) {
+	useBenchClock(t) // Time stands still, so a zero duration times exactly one batch.
+	for _, h := range []Hasher{MD5Hasher, XXHashHasher} {
+		r := benchCheck(1000, 0.01, h, 16, 1, 0)
+		if r.Op != "check" || r.Ops != benchBatch || r.MeasuredFP == nil {
+			t.Fatalf("%s: benchCheck = %+v, want one batch with a measured rate", h.Name(), r)
+		}
+		if *r.MeasuredFP > 0.03 {
+			t.Errorf("%s: measured fp %g, want about 0.01", h.Name(), *r.MeasuredFP)
+		}
+		if again := benchCheck(1000, 0.01, h, 16, 1, 0); *again.MeasuredFP != *r.MeasuredFP {
+			t.Errorf("%s: measured fp %g, then %g with the same seed", h.Name(), *r.MeasuredFP, *again.MeasuredFP)
+		}
+
+		if r := benchAdd(1000, 0.01, h, 16, 1, 0); r.Op != "add" || r.Ops != 1000 || r.MeasuredFP != nil {
+			t.Errorf("%s: benchAdd = %+v, want a batch cut to the 1000 items of the filter", h.Name(), r)
+		}
+	}
+}
+
+func TestCLIBench(t *testing.T) {
+	run := mustRun(t, exitOK, "", "-json", "bench", "-capacity", "1000", "-hash", "md5,xxhash", "-keysize", "8,32", "-time", "1ms")
+	var results []benchResult
+	if err := json.Unmarshal([]byte(run.stdout), &results); err != nil {
+		t.Fatalf("bench -json: %v\n%s", err, run.stdout)
+	}
+	var rows []string
+	for _, r := range results {
+		rows = append(rows, r.Hasher+" "+strconv.Itoa(r.KeySize)+" "+r.Op)
+		if (r.MeasuredFP != nil) != (r.Op == "check") || r.Ops == 0 || r.NsPerOp <= 0 {
+			t.Errorf("row %+v", r)
+		}
+	}
+	want := "md5 8 add, md5 8 check, md5 32 add, md5 32 check, xxhash 8 add, xxhash 8 check, xxhash 32 add, xxhash 32 check"
+	if got := strings.Join(rows, ", "); got != want {
+		t.Errorf("rows %s, want %s", got, want)
+	}
+
+	run = mustRun(t, exitOK, "", "bench", "-capacity", "1000", "-hash", "fnv", "-keysize", "16", "-time", "1ms")
+	if !strings.HasPrefix(run.stdout, "capacity 1000, target fp 0.01: 9586 bits") || !strings.Contains(run.stdout, "HASHER  KEY SIZE  OP") {
+		t.Errorf("bench table:\n%s", run.stdout)
+	}
+
+	for _, args := range [][]string{
+		{"bench", "-capacity", "0"},
+		{"bench", "-fp", "1"},
+		{"bench", "-time", "0s"},
+		{"bench", "-hash", "crc32"},
+		{"bench", "-keysize", "0"},
+	} {
+		if run := runTestCLI(t, "", args...); run.code != exitUsage {
+			t.Errorf("%q: exit code %d, want %d", args, run.code, exitUsage)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runConfig implements "bloom config", which dispatches to its own subcommands: "init"
+// writes a commented configuration template and "validate" checks a configuration file.
+func runConfig(env cliEnv, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: missing subcommand: init or validate", errUsage)
+	}
+	switch args[0] {
+	case "init":
+		return runConfigInit(env, args[1:])
+	case "validate":
+		return runConfigValidate(env, args[1:])
+	case "-h", "-help", "--help":
+		fmt.Fprintln(env.stderr, "usage: bloom config init [flags]")
+		fmt.Fprintln(env.stderr, "       bloom config validate file")
+		return flag.ErrHelp
+	}
+	return fmt.Errorf("%w: unknown subcommand %q: expected init or validate", errUsage, args[0])
+}
+
+// runConfigInit implements "bloom config init": it writes a template with every field of
+// Config set to its default and described by a comment, to stdout or to -o, which it
+// refuses to replace unless -force is given. The format defaults to the one -o's extension
+// selects for -config.
+func runConfigInit(env cliEnv, args []string) error {
+	var output, format string
+	var force bool
+	flags := newFlagSet(env, "config init", "")
+	flags.StringVar(&output, "o", "-", `output file, "-" for stdout`)
+	flags.StringVar(&format, "format", "", "json, yaml or toml; defaults to the extension of -o, or json")
+	flags.BoolVar(&force, "force", false, "overwrite an existing output file")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("%w: unexpected arguments %q", errUsage, flags.Args())
+	}
+	if format == "" {
+		format = configFormat(output)
+	}
+	var buf bytes.Buffer
+	if err := writeConfigTemplate(&buf, defaultConfig, format); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+
+	if output == "-" {
+		_, err := env.stdout.Write(buf.Bytes())
+		return err
+	}
+	if _, err := os.Stat(output); err == nil && !force {
+		return fmt.Errorf("%s already exists; use -force to overwrite it", output)
+	}
+	return os.WriteFile(output, buf.Bytes(), 0o644)
+}
+
+// runConfigValidate implements "bloom config validate": it reads a configuration file the
+// way -config does, but reports unknown fields, malformed values and every violated
+// constraint instead of the first error. It exits with status 1 if there are any.
+func runConfigValidate(env cliEnv, args []string) error {
+	flags := newFlagSet(env, "config validate", "file")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("%w: expected one configuration file", errUsage)
+	}
+	path := flags.Arg(0)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	format := configFormat(path)
+	config, problems, err := decodeConfig(data, format)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	problems = append(problems, config.violations()...)
+
+	result := configValidation{Path: path, Format: format, Valid: len(problems) == 0, Violations: []string{}}
+	for _, p := range problems {
+		result.Violations = append(result.Violations, p.Error())
+	}
+	if env.json {
+		err = writeJSON(env.stdout, result)
+	} else if result.Valid {
+		_, err = fmt.Fprintf(env.stdout, "%s: valid\n", path)
+	} else {
+		for _, v := range result.Violations {
+			if _, err = fmt.Fprintf(env.stdout, "%s: %s\n", path, v); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if !result.Valid {
+		return &exitStatus{code: exitError}
+	}
+	return nil
+}
+
+// configValidation is the JSON output of "bloom config validate".
+type configValidation struct {
+	Path       string   `json:"path"`
+	Format     string   `json:"format"`
+	Valid      bool     `json:"valid"`
+	Violations []string `json:"violations"`
+}
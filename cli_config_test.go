@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCLIConfigInitValidates(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"config.json", "config.yaml", "config.toml"} {
+		path := filepath.Join(dir, name)
+		mustRun(t, exitOK, "", "config", "init", "-o", path)
+		run := mustRun(t, exitOK, "", "config", "validate", path)
+		if want := path + ": valid\n"; run.stdout != want {
+			t.Errorf("config validate %s = %q, want %q", name, run.stdout, want)
+		}
+
+		// The template is read by -config as the defaults it documents.
+		config, err := loadConfig(path)
+		if err != nil || config != defaultConfig {
+			t.Errorf("loadConfig(%s) = %+v, %v, want %+v", name, config, err, defaultConfig)
+		}
+		filter := filepath.Join(dir, name+".bloom")
+		mustRun(t, exitOK, "", "create", "-f", filter, "-config", path)
+	}
+
+	// -format overrides the extension, and stdout is the default output.
+	run := mustRun(t, exitOK, "", "config", "init", "-format", "toml")
+	if !strings.Contains(run.stdout, "initial_fp = ") {
+		t.Errorf("config init -format toml wrote %q", run.stdout)
+	}
+	if got, problems, err := decodeConfig([]byte(run.stdout), configTOML); err != nil || len(problems) > 0 || got != defaultConfig {
+		t.Errorf("stdout template decodes to %+v, %v, %v", got, problems, err)
+	}
+}
+
+func TestCLIConfigInitOverwrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte("kept"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if run := runTestCLI(t, "", "config", "init", "-o", path); run.code != exitError || !strings.Contains(run.stderr, "-force") {
+		t.Errorf("config init over an existing file: exit code %d, stderr %q", run.code, run.stderr)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "kept" {
+		t.Errorf("config init replaced the file with %q without -force", data)
+	}
+	mustRun(t, exitOK, "", "config", "init", "-o", path, "-force")
+	mustRun(t, exitOK, "", "config", "validate", path)
+}
+
+func TestCLIConfigValidateViolations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "initial_fp: 1.5\ngrowth_factor: 1\ntightening_ratio: 0.5\ninitial_capacity: 0\ncapacity: 10\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	run := mustRun(t, exitError, "", "config", "validate", path)
+	for _, want := range []string{`unknown field "capacity"`, "growthFactor", "initialFP", "initialCapacity"} {
+		if !strings.Contains(run.stdout, want) {
+			t.Errorf("config validate output lacks %q:\n%s", want, run.stdout)
+		}
+	}
+
+	run = mustRun(t, exitError, "", "-json", "config", "validate", path)
+	var result configValidation
+	if err := json.Unmarshal([]byte(run.stdout), &result); err != nil {
+		t.Fatalf("config validate -json: %v\n%s", err, run.stdout)
+	}
+	if result.Valid || result.Format != configYAML || len(result.Violations) != 4 {
+		t.Errorf("config validate -json = %+v, want 4 violations of a YAML file", result)
+	}
+}
+
+func TestCLIConfigUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{"config"},
+		{"config", "check"},
+		{"config", "init", "-format", "ini"},
+		{"config", "init", "extra"},
+		{"config", "validate"},
+	} {
+		if run := runTestCLI(t, "", args...); run.code != exitUsage {
+			t.Errorf("%s: exit code %d, want %d", strings.Join(args, " "), run.code, exitUsage)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// convertTargets lists the formats "bloom convert" writes. native-v2 is an alias of native.
+var convertTargets = []string{"native", "native-v2", "append", "json", "binary", "sparse"}
+
+// foreignFormats are formats of other Bloom filter implementations that convert is asked
+// for but cannot write: the library has no encoder for them, and their hashing differs, so
+// a converted filter would not answer queries the same way.
+var foreignFormats = []string{"protobuf", "redisbloom", "bits-and-blooms"}
+
+// runConvert implements "bloom convert": it loads a filter file in any format the library
+// reads, detected from its contents, and writes it in the format selected by -to,
+// optionally compressed. Changing the hasher moves every key's bits, so it is refused
+// unless -rehash-from-wal names a log of the keys to rebuild the filter from.
+func runConvert(env cliEnv, args []string) error {
+	var input, output, to, compression, hasherName, wal string
+	flags := newFlagSet(env, "convert", "")
+	flags.StringVar(&input, "i", "", "filter file to convert, in any format (required)")
+	flags.StringVar(&output, "o", "", "file to write (required)")
+	flags.StringVar(&to, "to", "native", "output format: native, append, json, binary or sparse")
+	flags.StringVar(&compression, "compress", "none", "compress the output: none, gzip or zstd")
+	flags.StringVar(&hasherName, "hash", "", "hasher of the output; defaults to the input's")
+	flags.StringVar(&wal, "rehash-from-wal", "", "file of every key added, one per line, to rebuild the filter from when -hash changes the hasher")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	switch {
+	case input == "" || output == "":
+		return fmt.Errorf("%w: -i and -o are required", errUsage)
+	case slices.Contains(foreignFormats, to):
+		return fmt.Errorf("%w: the %s format is not supported; convert writes %s", errUsage, to, strings.Join(convertTargets, ", "))
+	case !slices.Contains(convertTargets, to):
+		return fmt.Errorf("%w: unknown format %q for -to", errUsage, to)
+	case compression != "none" && compression != "gzip" && compression != "zstd":
+		return fmt.Errorf("%w: -compress must be none, gzip or zstd", errUsage)
+	}
+
+	src, from, err := loadAnyFilter(input)
+	if err != nil {
+		return err
+	}
+	dst := src
+	var rebuilt *Report
+	srcHasher := src.options.hasher.Name()
+	if hasherName != "" && hasherName != srcHasher {
+		hasher, err := LookupHasher(hasherName)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errUsage, err)
+		}
+		if wal == "" {
+			return fmt.Errorf("cannot change the hasher from %s to %s: every key's bits depend on the hasher, "+
+				"so the converted filter would miss the keys already added; pass -rehash-from-wal with a file of the keys to rebuild it",
+				srcHasher, hasherName)
+		}
+		var report Report
+		if dst, report, err = rehashFromWAL(src, hasher, wal); err != nil {
+			return fmt.Errorf("rebuilding from %s: %w", wal, err)
+		}
+		rebuilt = &report
+	} else if wal != "" {
+		return fmt.Errorf("%w: -rehash-from-wal only applies when -hash changes the hasher", errUsage)
+	}
+
+	data, err := encodeConverted(dst, to)
+	if err != nil {
+		return err
+	}
+	if data, err = compressBytes(data, compression); err != nil {
+		return err
+	}
+	if err := writeFileBytes(output, data); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(input)
+	if err != nil {
+		return err
+	}
+	return writeConvertSummary(env, convertSide{from.format, from.compression, src, info.Size()},
+		convertSide{to, compression, dst, int64(len(data))}, wal, rebuilt)
+}
+
+// convertSide describes the input or the output of a conversion.
+type convertSide struct {
+	format      string
+	compression string
+	filter      *ScalableBloomFilter
+	size        int64
+}
+
+// detectedFormat is the format and compression of a filter file, as detected by loadAnyFilter.
+type detectedFormat struct {
+	format      string
+	compression string
+}
+
+// loadAnyFilter reads a filter file in any format the library writes, decompressing it
+// first if it starts with gzip or zstd magic bytes. Single filters in the binary and sparse
+// formats become the only stage of a filter with the default configuration.
+func loadAnyFilter(path string) (*ScalableBloomFilter, detectedFormat, error) {
+	detected := detectedFormat{compression: "none"}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, detected, err
+	}
+	if bytes.HasPrefix(data, gzipMagic) || bytes.HasPrefix(data, zstdMagic) {
+		detected.compression = "zstd"
+		if bytes.HasPrefix(data, gzipMagic) {
+			detected.compression = "gzip"
+		}
+		r, closeReader, err := maybeDecompress(bufio.NewReader(bytes.NewReader(data)), "")
+		if err != nil {
+			return nil, detected, fmt.Errorf("%s: %w", path, err)
+		}
+		data, err = io.ReadAll(r)
+		closeReader()
+		if err != nil {
+			return nil, detected, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	var sbf *ScalableBloomFilter
+	switch {
+	case bytes.HasPrefix(data, appendMagic[:]):
+		detected.format = "append"
+		sbf, err = readAppendFilter(bytes.NewReader(data), int64(len(data)), nil)
+	case bytes.HasPrefix(data, filterMagic[:]):
+		detected.format = "binary"
+		var bf BloomFilter
+		if err = bf.UnmarshalBinary(data); err == nil {
+			sbf, err = singleStageFilter(&bf)
+		}
+	case bytes.HasPrefix(data, sparseMagic[:]):
+		detected.format = "sparse"
+		var s SparseBloomFilter
+		if err = s.UnmarshalBinary(data); err == nil {
+			var bf *BloomFilter
+			if bf, err = FromSparse(s); err == nil {
+				sbf, err = singleStageFilter(bf)
+			}
+		}
+	case json.Valid(data):
+		// Checked in full, since a gob stream can start with the bytes of a JSON object.
+		sbf = &ScalableBloomFilter{options: buildOptions(nil)}
+		err = sbf.UnmarshalJSON(data)
+		detected.format = "json"
+	default:
+		sbf = &ScalableBloomFilter{options: buildOptions(nil)}
+		err = sbf.GobDecode(data)
+		detected.format = fmt.Sprintf("native-v%d", sbf.formatVersion)
+	}
+	if err != nil {
+		return nil, detected, fmt.Errorf("%s: %w", path, err)
+	}
+	return sbf, detected, nil
+}
+
+// singleStageFilter wraps a single filter as the only stage of a Scalable Bloom Filter with
+// the default growth settings, sized like the filter.
+func singleStageFilter(bf *BloomFilter) (*ScalableBloomFilter, error) {
+	config := defaultConfig
+	config.InitialCapacity = max(bf.capacity, 1)
+	if bf.targetFP > 0 && bf.targetFP < 1 {
+		config.InitialFP = bf.targetFP
+	}
+	sbf, err := NewScalableBloomFilter(config, WithHasher(bf.hasher), WithKeyNormalizer(bf.normalizer), WithBitOrder(bf.bitOrder))
+	if err != nil {
+		return nil, err
+	}
+	sbf.filters = []*BloomFilter{bf}
+	return sbf, nil
+}
+
+// rehashFromWAL builds a filter like src but with another hasher by replaying the keys
+// logged in the file at wal, which may be compressed.
+func rehashFromWAL(src *ScalableBloomFilter, hasher Hasher, wal string) (*ScalableBloomFilter, Report, error) {
+	dst, err := NewScalableBloomFilter(src.Config(),
+		WithHasher(hasher), WithKeyNormalizer(src.options.normalizer), WithBitOrder(src.options.bitOrder))
+	if err != nil {
+		return nil, Report{}, err
+	}
+	report, err := dst.AddFromFile(context.Background(), wal)
+	if err != nil {
+		return nil, report, err
+	}
+	if src.Frozen() {
+		dst.Freeze()
+	}
+	return dst, report, nil
+}
+
+// encodeConverted encodes sbf in the given output format. The binary and sparse formats
+// hold a single filter, so they only take filters with one stage.
+func encodeConverted(sbf *ScalableBloomFilter, format string) ([]byte, error) {
+	switch format {
+	case "append":
+		sbf.mutex.RLock()
+		defer sbf.mutex.RUnlock()
+		return sbf.appendFileBytes()
+	case "json":
+		return json.Marshal(sbf)
+	case "binary", "sparse":
+		sbf.mutex.RLock()
+		filters := sbf.filters
+		sbf.mutex.RUnlock()
+		if len(filters) != 1 {
+			return nil, fmt.Errorf("the %s format holds a single filter, but this one has %d stages; convert to native, append or json instead",
+				format, len(filters))
+		}
+		if format == "binary" {
+			return filters[0].MarshalBinary()
+		}
+		sparse := filters[0].ToSparse()
+		return sparse.MarshalBinary()
+	}
+	return sbf.GobEncode()
+}
+
+// compressBytes compresses data with gzip or zstd, or returns it unchanged for "none".
+func compressBytes(data []byte, compression string) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch compression {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "zstd":
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, err
+		}
+		w = zw
+	default:
+		return data, nil
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// convertSummary describes one side of a conversion in the JSON output of "bloom convert".
+type convertSummary struct {
+	Format      string `json:"format"`
+	Compression string `json:"compression"`
+	Hasher      string `json:"hasher"`
+	Stages      int    `json:"stages"`
+	Items       uint   `json:"items"`
+	Bytes       int64  `json:"bytes"`
+}
+
+// summary describes the side of a conversion.
+func (c convertSide) summary() convertSummary {
+	stats := c.filter.Stats()
+	return convertSummary{c.format, c.compression, stats.Hasher, len(stats.Filters), stats.ItemCount, c.size}
+}
+
+// writeConvertSummary prints the input and output of a conversion side by side, followed
+// by notes on what the conversion changed beyond the encoding, or all of it as one JSON
+// document with the global -json flag.
+func writeConvertSummary(env cliEnv, in, out convertSide, wal string, rebuilt *Report) error {
+	inSummary, outSummary := in.summary(), out.summary()
+	notes := []string{}
+	// Keys the rebuilt filter took for duplicates, false positives included, were still in
+	// the log; only a log with fewer keys than the input counted must have lost some.
+	if rebuilt != nil {
+		if logged := rebuilt.ItemsAdded + rebuilt.Duplicates; uint(logged) < inSummary.Items {
+			notes = append(notes, fmt.Sprintf("warning: the input counted %d items but the log only %d keys; keys missing from the log are lost",
+				inSummary.Items, logged))
+		}
+	}
+	if out.format == "binary" || out.format == "sparse" {
+		notes = append(notes, fmt.Sprintf("note: the %s format keeps no growth settings; loading it again uses the defaults", out.format))
+	}
+	if env.json {
+		return writeJSON(env.stdout, struct {
+			Input   convertSummary `json:"input"`
+			Output  convertSummary `json:"output"`
+			Rebuilt *Report        `json:"rebuilt,omitempty"` // Set when -rehash-from-wal rebuilt the filter
+			Notes   []string       `json:"notes"`
+		}{inSummary, outSummary, rebuilt, notes})
+	}
+
+	tw := tabwriter.NewWriter(env.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tINPUT\tOUTPUT")
+	fmt.Fprintf(tw, "format\t%s\t%s\n", inSummary.Format, outSummary.Format)
+	fmt.Fprintf(tw, "compression\t%s\t%s\n", inSummary.Compression, outSummary.Compression)
+	fmt.Fprintf(tw, "hasher\t%s\t%s\n", inSummary.Hasher, outSummary.Hasher)
+	fmt.Fprintf(tw, "stages\t%d\t%d\n", inSummary.Stages, outSummary.Stages)
+	fmt.Fprintf(tw, "items\t%d\t%d\n", inSummary.Items, outSummary.Items)
+	fmt.Fprintf(tw, "bytes\t%d\t%d\n", inSummary.Bytes, outSummary.Bytes)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if rebuilt != nil {
+		fmt.Fprintf(env.stdout, "rebuilt from %s: %d lines, %d keys added, %d duplicates\n",
+			wal, rebuilt.LinesRead, rebuilt.ItemsAdded, rebuilt.Duplicates)
+	}
+	for _, note := range notes {
+		fmt.Fprintln(env.stdout, note)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-bloom-filter/bloomtest"
+)
+
+// writeConvertInput saves a filter over keys, with several stages, for convert to read.
+func writeConvertInput(t *testing.T, keys []string, opts ...Option) (string, *ScalableBloomFilter) {
+	t.Helper()
+	clock := bloomtest.NewFakeClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	sbf := newTestFilter(t, testConfig, append([]Option{WithClock(clock)}, opts...)...)
+	addAll(t, sbf, keys)
+	path := filepath.Join(t.TempDir(), "in.bloom")
+	if err := sbf.saveFile(path); err != nil {
+		t.Fatal(err)
+	}
+	return path, sbf
+}
+
+// writeKeys writes keys one per line to a temporary file and returns its path.
+func writeKeys(t *testing.T, keys []string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(keys, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCLIConvertRoundTrip(t *testing.T) {
+	keys := testKeys("convert", 500)
+	in, _ := writeConvertInput(t, keys)
+	dir := t.TempDir()
+	asJSON, back := filepath.Join(dir, "f.json"), filepath.Join(dir, "back.bloom")
+
+	mustRun(t, exitOK, "", "convert", "-i", in, "-o", asJSON, "-to", "json")
+	mustRun(t, exitOK, "", "convert", "-i", asJSON, "-o", back, "-to", "native-v2")
+
+	original, err := os.ReadFile(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	converted, err := os.ReadFile(back)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(converted, original) {
+		t.Error("native -> json -> native differs from the original file")
+	}
+	a, _ := loadScalableFile(in, nil)
+	b, err := loadScalableFile(back, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameBits(a, b) || a.Config() != b.Config() || a.ItemCount() != b.ItemCount() {
+		t.Error("native -> json -> native changed the filter")
+	}
+}
+
+func TestCLIConvertFormats(t *testing.T) {
+	keys := testKeys("formats", 50) // A single stage, so binary and sparse apply
+	in, sbf := writeConvertInput(t, keys)
+	dir := t.TempDir()
+	for _, to := range []string{"native", "append", "json", "binary", "sparse"} {
+		for _, compression := range []string{"none", "gzip", "zstd"} {
+			out := filepath.Join(dir, to+"."+compression)
+			mustRun(t, exitOK, "", "convert", "-i", in, "-o", out, "-to", to, "-compress", compression)
+
+			// Converting back detects the format and compression.
+			run := mustRun(t, exitOK, "", "-json", "convert", "-i", out, "-o", filepath.Join(dir, "back"))
+			var summary struct{ Input convertSummary }
+			if err := json.Unmarshal([]byte(run.stdout), &summary); err != nil {
+				t.Fatalf("%s %s: %v\n%s", to, compression, err, run.stdout)
+			}
+			format := to
+			if to == "native" {
+				format = "native-v2"
+			}
+			if summary.Input.Format != format || summary.Input.Compression != compression || summary.Input.Items != 50 {
+				t.Errorf("%s %s: detected %+v", to, compression, summary.Input)
+			}
+			back, err := loadScalableFile(filepath.Join(dir, "back"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(back.filters[0].bitset, sbf.filters[0].bitset) {
+				t.Errorf("%s %s: bits changed by the round trip", to, compression)
+			}
+		}
+	}
+
+	// A filter with several stages does not fit the single-filter formats.
+	multi, _ := writeConvertInput(t, testKeys("multi", 500))
+	run := runTestCLI(t, "", "convert", "-i", multi, "-o", filepath.Join(dir, "multi.bin"), "-to", "binary")
+	if run.code != exitError || !strings.Contains(run.stderr, "holds a single filter") {
+		t.Errorf("convert of several stages to binary: exit code %d, stderr %q", run.code, run.stderr)
+	}
+}
+
+func TestCLIConvertRefusesRehash(t *testing.T) {
+	keys := testKeys("rehash", 300)
+	in, _ := writeConvertInput(t, keys)
+	out := filepath.Join(t.TempDir(), "fnv.bloom")
+
+	run := runTestCLI(t, "", "convert", "-i", in, "-o", out, "-hash", "fnv")
+	if run.code != exitError || !strings.Contains(run.stderr, "cannot change the hasher from md5 to fnv") {
+		t.Errorf("convert changing the hasher: exit code %d, stderr %q", run.code, run.stderr)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("refused convert wrote its output: %v", err)
+	}
+
+	// With the keys, the filter is rebuilt with the new hasher.
+	wal := writeKeys(t, keys)
+	run = mustRun(t, exitOK, "", "convert", "-i", in, "-o", out, "-hash", "fnv", "-rehash-from-wal", wal)
+	if !strings.Contains(run.stdout, "300 lines, ") || strings.Contains(run.stdout, "warning") {
+		t.Errorf("convert -rehash-from-wal summary:\n%s", run.stdout)
+	}
+	rebuilt, err := loadScalableFile(out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rebuilt.options.hasher.Name(); got != "fnv" {
+		t.Errorf("rebuilt filter uses %s, want fnv", got)
+	}
+	for _, key := range keys {
+		if !rebuilt.MightContain(key) {
+			t.Fatalf("rebuilt filter misses %q", key)
+		}
+	}
+
+	// A log missing keys is used, with a warning.
+	partial := writeKeys(t, keys[:100])
+	run = mustRun(t, exitOK, "", "convert", "-i", in, "-o", out, "-hash", "fnv", "-rehash-from-wal", partial)
+	if !strings.Contains(run.stdout, "warning: the input counted 300 items but the log only 100 keys") {
+		t.Errorf("convert from a partial log did not warn:\n%s", run.stdout)
+	}
+}
+
+func TestCLIConvertUsage(t *testing.T) {
+	in, _ := writeConvertInput(t, testKeys("usage", 10))
+	out := filepath.Join(t.TempDir(), "out")
+	for _, args := range [][]string{
+		{"convert", "-o", out},
+		{"convert", "-i", in},
+		{"convert", "-i", in, "-o", out, "-to", "xml"},
+		{"convert", "-i", in, "-o", out, "-to", "redisbloom"},
+		{"convert", "-i", in, "-o", out, "-compress", "lz4"},
+		{"convert", "-i", in, "-o", out, "-hash", "nope"},
+		{"convert", "-i", in, "-o", out, "-rehash-from-wal", in},
+	} {
+		if run := runTestCLI(t, "", args...); run.code != exitUsage {
+			t.Errorf("%q: exit code %d, want %d", args, run.code, exitUsage)
+		}
+	}
+}
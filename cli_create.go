@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// runCreate implements "bloom create": it validates the configuration, allocates the first
+// sub-filter and writes the empty filter file, refusing to replace an existing file unless
+// -force is given. It prints the first sub-filter's dimensions and the file size.
+func runCreate(env cliEnv, args []string) error {
+	var ff filterFlags
+	var force bool
+	flags := newFlagSet(env, "create", "")
+	ff.register(flags)
+	flags.BoolVar(&force, "force", false, "overwrite an existing filter file")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if ff.path == "" {
+		return fmt.Errorf("%w: -f is required", errUsage)
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("%w: unexpected arguments %q", errUsage, flags.Args())
+	}
+	if _, err := os.Stat(ff.path); err == nil && !force {
+		return fmt.Errorf("%s already exists; use -force to overwrite it", ff.path)
+	}
+
+	sbf, err := ff.create()
+	if err != nil {
+		return err
+	}
+	// Allocate the first sub-filter now, so bad parameters fail here rather than on first add.
+	sbf.mutex.Lock()
+	err = sbf.grow()
+	sbf.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := sbf.saveFile(ff.path); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(ff.path)
+	if err != nil {
+		return err
+	}
+	first := sbf.Stats().Filters[0]
+	if env.json {
+		return writeJSON(env.stdout, createResult{ff.path, first.BitSize, first.NumHashFuncs, info.Size()})
+	}
+	fmt.Fprintf(env.stdout, "created %s: m=%d k=%d, %d bytes on disk\n", ff.path, first.BitSize, first.NumHashFuncs, info.Size())
+	return nil
+}
+
+// createResult is the JSON output of "bloom create".
+type createResult struct {
+	Path         string `json:"path"`
+	BitSize      uint   `json:"bit_size"`       // Bits of the first sub-filter (m)
+	NumHashFuncs uint   `json:"num_hash_funcs"` // Hash functions of the first sub-filter (k)
+	FileBytes    int64  `json:"file_bytes"`     // Size of the filter file
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCLICreate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+	run := mustRun(t, exitOK, "", "-json", "create", "-f", path, "-capacity", "50", "-fp", "0.001", "-hash", "fnv", "-max-filters", "1")
+	var result createResult
+	if err := json.Unmarshal([]byte(run.stdout), &result); err != nil {
+		t.Fatalf("create -json: %v\n%s", err, run.stdout)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("create did not write the filter: %v", err)
+	}
+	if want := optimalBitSize(50, 0.001); result.BitSize != want || result.NumHashFuncs != optimalHashFuncs(want, 50) {
+		t.Errorf("create reported m=%d k=%d, want %d and %d", result.BitSize, result.NumHashFuncs, want, optimalHashFuncs(want, 50))
+	}
+	if result.FileBytes != info.Size() {
+		t.Errorf("create reported %d bytes, file has %d", result.FileBytes, info.Size())
+	}
+
+	// A later add without flags uses the embedded parameters, including the sub-filter limit.
+	mustRun(t, exitOK, "", "add", "-f", path, "-fp", "0.1", "item")
+	sbf, err := loadScalableFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config := sbf.Config(); config.InitialCapacity != 50 || config.InitialFP != 0.001 || config.MaxFilters != 1 {
+		t.Errorf("filter after add has config %+v, want the one given to create", config)
+	}
+	if sbf.options.hasher.Name() != "fnv" || len(sbf.filters) != 1 || sbf.filters[0].bitSize != result.BitSize {
+		t.Errorf("filter after add uses %s and %d sub-filters, want fnv and the created one", sbf.options.hasher.Name(), len(sbf.filters))
+	}
+	var items strings.Builder
+	for _, key := range testKeys("more", 60) {
+		fmt.Fprintln(&items, key)
+	}
+	if run := runTestCLI(t, items.String(), "add", "-f", path); run.code != exitError || !strings.Contains(run.stderr, ErrMaxFilters.Error()) {
+		t.Errorf("adding past the embedded sub-filter limit: exit code %d, stderr %q", run.code, run.stderr)
+	}
+}
+
+func TestCLICreateOverwrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+	mustRun(t, exitOK, "", "create", "-f", path, "-capacity", "1000")
+	mustRun(t, exitOK, "", "add", "-f", path, "kept")
+
+	if run := runTestCLI(t, "", "create", "-f", path, "-capacity", "10"); run.code != exitError || !strings.Contains(run.stderr, "-force") {
+		t.Errorf("create over an existing file: exit code %d, stderr %q", run.code, run.stderr)
+	}
+	mustRun(t, exitCheckPresent, "", "check", "-f", path, "kept")
+
+	mustRun(t, exitOK, "", "create", "-f", path, "-capacity", "10", "-force")
+	mustRun(t, exitCheckAbsent, "", "check", "-f", path, "kept")
+	if sbf, err := loadScalableFile(path, nil); err != nil || sbf.Config().InitialCapacity != 10 {
+		t.Errorf("create -force left %v, %v, want a new filter with capacity 10", sbf, err)
+	}
+}
+
+func TestCLICreateInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+	for _, args := range [][]string{
+		{"-fp", "1.5"},
+		{"-capacity", "0"},
+		{"-hash", "crc"},
+		{"extra"},
+	} {
+		if run := runTestCLI(t, "", append([]string{"create", "-f", path}, args...)...); run.code == exitOK {
+			t.Errorf("create %s succeeded", strings.Join(args, " "))
+		}
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Error("a failed create wrote the filter file")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// runDedupe implements "bloom dedupe": it copies stdin to stdout, decompressed if need
+// be, dropping every line that was seen before, like "sort -u" without sorting and with
+// bounded memory. Lines differing only in a trailing CR are the same line. The seen set
+// lives in memory unless -f names a filter file to share it across runs. False positives
+// mean a unique line is occasionally dropped, at about the filter's false positive rate.
+func runDedupe(env cliEnv, args []string) error {
+	var ff filterFlags
+	var showStats, nul bool
+	flags := newFlagSet(env, "dedupe", "< input > output")
+	flags.StringVar(&ff.path, "f", "", "filter file that persists the seen lines across runs")
+	flags.StringVar(&ff.hasher, "hash", MD5Hasher.Name(), "hasher for a new filter: md5, fnv, sha256 or xxhash")
+	ff.configFlags.register(flags)
+	flags.BoolVar(&showStats, "stats", false, "print line counts to stderr when done")
+	flags.BoolVar(&nul, "0", false, nulFlagUsage+"; output records too")
+	flags.Usage = dedupeUsage(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("%w: dedupe reads stdin and takes no arguments", errUsage)
+	}
+
+	var sbf *ScalableBloomFilter
+	var err error
+	if ff.path != "" {
+		sbf, err = ff.open(true)
+	} else {
+		sbf, err = ff.create()
+	}
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(env.stdout)
+	dw := NewDedupWriter(out, sbf)
+	dw.SetDelimiter(recordDelim(nul))
+	stdin, closeStdin, err := decompressStdin(env)
+	if err != nil {
+		return err
+	}
+	defer closeStdin()
+	if _, err := io.Copy(dw, stdin); err != nil {
+		// Keep the output for the lines processed so far, as a pipeline would.
+		out.Flush()
+		return fmt.Errorf("stopped after %d lines: %w", dw.Stats().Seen, err)
+	}
+	if err := dw.Close(); err != nil {
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	if ff.path != "" {
+		if err := sbf.saveFile(ff.path); err != nil {
+			return err
+		}
+	}
+
+	if showStats {
+		stats := dw.Stats()
+		if env.json {
+			// Stdout carries the deduplicated lines, so the statistics stay on stderr.
+			return writeJSONLine(env.stderr, stats)
+		}
+		fmt.Fprintf(env.stderr, "%d lines in, %d lines out, %d suppressed\n", stats.Seen, stats.Passed, stats.Suppressed)
+	}
+	return nil
+}
+
+// dedupeUsage returns a usage function that explains the false positive trade-off.
+func dedupeUsage(flags *flag.FlagSet) func() {
+	return func() {
+		w := flags.Output()
+		fmt.Fprintln(w, "usage: bloom dedupe [flags] < input > output")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Lines already seen are dropped. A false positive drops a unique line, so about")
+		fmt.Fprintln(w, "-fp of the unique lines may be missing from the output.")
+		fmt.Fprintln(w)
+		flags.PrintDefaults()
+	}
+}
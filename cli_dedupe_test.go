@@ -0,0 +1,66 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCLIDedupe(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		args        []string
+		input, want string
+	}{
+		{"lines", nil, "b\na\nb\nc\na\nd", "b\na\nc\nd"},
+		{"crlf", nil, "a\r\nb\r\na\nb\r\n", "a\r\nb\r\n"},
+		{"nul", []string{"-0"}, "a\nb\x00c\x00a\nb\x00c", "a\nb\x00c\x00"},
+		{"empty", nil, "", ""},
+	} {
+		run := mustRun(t, exitOK, tc.input, append([]string{"dedupe"}, tc.args...)...)
+		if run.stdout != tc.want {
+			t.Errorf("%s: dedupe output %q, want %q", tc.name, run.stdout, tc.want)
+		}
+	}
+
+	run := mustRun(t, exitOK, "x\ny\nx\nx\n", "dedupe", "-stats")
+	if run.stdout != "x\ny\n" || run.stderr != "4 lines in, 2 lines out, 2 suppressed\n" {
+		t.Errorf("dedupe -stats printed %q to stdout and %q to stderr", run.stdout, run.stderr)
+	}
+	run = mustRun(t, exitOK, "x\ny\nx\n", "-json", "dedupe", "-stats")
+	if run.stderr != `{"seen":3,"passed":2,"suppressed":1}`+"\n" {
+		t.Errorf("dedupe -stats with -json printed %q to stderr", run.stderr)
+	}
+	if run := runTestCLI(t, "", "dedupe", "extra"); run.code != exitUsage {
+		t.Errorf("dedupe with an argument: exit code %d, want %d", run.code, exitUsage)
+	}
+}
+
+func TestCLIDedupePersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seen.bloom")
+	mustRun(t, exitOK, "a\nb\n", "dedupe", "-f", path)
+	// The second run suppresses what the first one saw.
+	run := mustRun(t, exitOK, "b\nc\na\nd\n", "dedupe", "-f", path)
+	if run.stdout != "c\nd\n" {
+		t.Errorf("second dedupe run printed %q, want only the new lines", run.stdout)
+	}
+	mustRun(t, exitCheckPresent, "", "check", "-f", path, "a", "b", "c", "d")
+}
+
+func TestCLIDedupeLarge(t *testing.T) {
+	keys := testKeys("line", 20000)
+	input := strings.Join(keys, "\n") + "\n" + strings.Join(keys[:5000], "\n") + "\n"
+	run := mustRun(t, exitOK, input, "dedupe", "-fp", "0.001")
+	// The rare false positive drops a unique line, never adds a duplicate.
+	out := strings.Split(strings.TrimSuffix(run.stdout, "\n"), "\n")
+	if len(out) > len(keys) || len(out) < len(keys)-len(keys)/100 {
+		t.Errorf("dedupe printed %d lines, want about %d", len(out), len(keys))
+	}
+	seen := make(map[string]bool)
+	for _, line := range out {
+		if seen[line] {
+			t.Fatalf("dedupe printed %q twice", line)
+		}
+		seen[line] = true
+	}
+}
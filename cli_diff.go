@@ -0,0 +1,252 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Exit codes of "bloom diff", following diff(1).
+const (
+	exitDiffSame      = 0
+	exitDiffDifferent = 1
+	exitDiffError     = 2
+)
+
+// filterDiff is the report of "bloom diff", also printed with -json.
+type filterDiff struct {
+	A           string      `json:"a"`
+	B           string      `json:"b"`
+	ParamsMatch bool        `json:"params_match"`
+	Params      []paramDiff `json:"param_diffs"`      // Only the parameters that differ
+	Stages      []stageDiff `json:"stages"`           // One per stage of the longer filter
+	Hamming     uint        `json:"hamming_distance"` // Across the comparable stages
+	OnlyA       uint        `json:"only_a"`
+	OnlyB       uint        `json:"only_b"`
+	Jaccard     *float64    `json:"jaccard,omitempty"` // Estimated; nil if any stage cannot be estimated
+	Identical   bool        `json:"identical"`
+}
+
+// paramDiff is a parameter whose values differ between the two filters.
+type paramDiff struct {
+	Name string `json:"name"`
+	A    string `json:"a"`
+	B    string `json:"b"`
+}
+
+// stageDiff compares the sub-filters at one index of the two filters. Stages whose layout
+// differs, or that only one filter has, are not comparable bit by bit.
+type stageDiff struct {
+	Index      int      `json:"index"`
+	Comparable bool     `json:"comparable"`
+	Reason     string   `json:"reason,omitempty"` // Why the stage is not comparable
+	BitSize    uint     `json:"bit_size,omitempty"`
+	Hamming    uint     `json:"hamming_distance"`
+	OnlyA      uint     `json:"only_a"`
+	OnlyB      uint     `json:"only_b"`
+	Jaccard    *float64 `json:"jaccard,omitempty"` // nil if a stage is saturated
+	ItemsA     uint     `json:"items_a"`
+	ItemsB     uint     `json:"items_b"`
+}
+
+// runDiff implements "bloom diff": it compares two filter files of any format, reporting
+// the parameters that differ and, for every stage with the same layout in both, the bits
+// set in only one of them and the estimated Jaccard similarity of the items behind them.
+// Like diff(1), it exits 0 if the filters are identical, 1 if they differ and 2 on errors.
+func runDiff(env cliEnv, args []string) error {
+	var asJSON bool
+	flags := newFlagSet(env, "diff", "a b")
+	flags.BoolVar(&asJSON, "json", false, "print JSON instead of a table")
+	flags.Usage = diffUsage(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("%w: diff takes exactly two files", errUsage)
+	}
+
+	a, _, err := loadAnyFilter(flags.Arg(0))
+	if err != nil {
+		return &exitStatus{code: exitDiffError, err: err}
+	}
+	b, _, err := loadAnyFilter(flags.Arg(1))
+	if err != nil {
+		return &exitStatus{code: exitDiffError, err: err}
+	}
+	d := diffFilters(a, b)
+	d.A, d.B = flags.Arg(0), flags.Arg(1)
+
+	if asJSON || env.json {
+		err = writeJSON(env.stdout, d)
+	} else {
+		err = writeDiffTable(env, d)
+	}
+	if err != nil {
+		return &exitStatus{code: exitDiffError, err: err}
+	}
+	if d.Identical {
+		return nil
+	}
+	return &exitStatus{code: exitDiffDifferent}
+}
+
+// diffUsage returns a usage function that documents the exit status of "bloom diff".
+func diffUsage(flags *flag.FlagSet) func() {
+	return func() {
+		w := flags.Output()
+		fmt.Fprintln(w, "usage: bloom diff [flags] a b")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Exit status:")
+		fmt.Fprintln(w, "  0  the filters are identical")
+		fmt.Fprintln(w, "  1  the filters differ")
+		fmt.Fprintln(w, "  2  a filter could not be read or the arguments are invalid")
+		fmt.Fprintln(w)
+		flags.PrintDefaults()
+	}
+}
+
+// diffFilters compares the parameters of a and b and their stages index by index.
+func diffFilters(a, b *ScalableBloomFilter) filterDiff {
+	sa, sb := a.Stats(), b.Stats()
+	ca, cb := a.Config(), b.Config()
+	params := [][3]string{
+		{"hasher", sa.Hasher, sb.Hasher},
+		{"normalizer", orNone(sa.Normalizer), orNone(sb.Normalizer)},
+		{"bit order", bitOrderName(a.options.bitOrder), bitOrderName(b.options.bitOrder)},
+		{"initial capacity", strconv.Itoa(ca.InitialCapacity), strconv.Itoa(cb.InitialCapacity)},
+		{"initial fp", fmt.Sprint(ca.InitialFP), fmt.Sprint(cb.InitialFP)},
+		{"growth factor", fmt.Sprint(ca.GrowthFactor), fmt.Sprint(cb.GrowthFactor)},
+		{"tightening ratio", fmt.Sprint(ca.TighteningRatio), fmt.Sprint(cb.TighteningRatio)},
+		{"max filters", strconv.Itoa(ca.MaxFilters), strconv.Itoa(cb.MaxFilters)},
+		{"min fp", fmt.Sprint(ca.MinFP), fmt.Sprint(cb.MinFP)},
+		{"frozen", strconv.FormatBool(sa.Frozen), strconv.FormatBool(sb.Frozen)},
+		{"stages", strconv.Itoa(len(sa.Filters)), strconv.Itoa(len(sb.Filters))},
+	}
+	d := filterDiff{Params: []paramDiff{}, Stages: []stageDiff{}}
+	for _, p := range params {
+		if p[1] != p[2] {
+			d.Params = append(d.Params, paramDiff{Name: p[0], A: p[1], B: p[2]})
+		}
+	}
+	d.ParamsMatch = len(d.Params) == 0
+
+	a.mutex.RLock()
+	fa := a.filters
+	a.mutex.RUnlock()
+	b.mutex.RLock()
+	fb := b.filters
+	b.mutex.RUnlock()
+
+	var na, nb, nu float64
+	estimable := true
+	for i := range max(len(fa), len(fb)) {
+		var stage stageDiff
+		stage.Index = i
+		switch {
+		case i >= len(fa):
+			stage.Reason = "only in b"
+			stage.ItemsB = fb[i].ItemCount()
+		case i >= len(fb):
+			stage.Reason = "only in a"
+			stage.ItemsA = fa[i].ItemCount()
+		default:
+			stage.ItemsA, stage.ItemsB = fa[i].ItemCount(), fb[i].ItemCount()
+			xa, xb, xu, err := bitCounts(fa[i], fb[i])
+			if err != nil {
+				stage.Reason = err.Error()
+				break
+			}
+			_, _, stage.BitSize, _ = fa[i].Params()
+			stage.Comparable = true
+			stage.OnlyA, stage.OnlyB = xu-xb, xu-xa
+			stage.Hamming = stage.OnlyA + stage.OnlyB
+			sna, snb, snu, err := cardinalities(fa[i], fb[i])
+			if err != nil {
+				estimable = false
+				break
+			}
+			stage.Jaccard = jaccard(sna, snb, snu)
+			na, nb, nu = na+sna, nb+snb, nu+snu
+		}
+		if !stage.Comparable {
+			estimable = false
+		}
+		d.Hamming += stage.Hamming
+		d.OnlyA += stage.OnlyA
+		d.OnlyB += stage.OnlyB
+		d.Stages = append(d.Stages, stage)
+	}
+	if estimable {
+		d.Jaccard = jaccard(na, nb, nu)
+	}
+	d.Identical = d.ParamsMatch && estimable && d.Hamming == 0
+	return d
+}
+
+// jaccard returns the Jaccard similarity for cardinality estimates of A, B and A∪B,
+// clamped to [0, 1], like EstimateJaccard.
+func jaccard(na, nb, nu float64) *float64 {
+	j := 1.0
+	if nu > 0 {
+		j = math.Min(math.Max((na+nb-nu)/nu, 0), 1)
+	}
+	return &j
+}
+
+// bitOrderName names a bit order for reports.
+func bitOrderName(o BitOrder) string {
+	if o == MSBFirst {
+		return "msb-first"
+	}
+	return "lsb-first"
+}
+
+// writeDiffTable prints a filterDiff as the differing parameters, a per-stage table and
+// the totals.
+func writeDiffTable(env cliEnv, d filterDiff) error {
+	tw := tabwriter.NewWriter(env.stdout, 0, 0, 2, ' ', 0)
+	if d.ParamsMatch {
+		fmt.Fprintln(tw, "parameters\tmatch")
+	} else {
+		fmt.Fprintf(tw, "PARAMETER\t%s\t%s\n", d.A, d.B)
+		for _, p := range d.Params {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", p.Name, p.A, p.B)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(env.stdout)
+	tw = tabwriter.NewWriter(env.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tITEMS A\tITEMS B\tHAMMING\tONLY A\tONLY B\tJACCARD\tNOTE")
+	for _, s := range d.Stages {
+		if !s.Comparable {
+			fmt.Fprintf(tw, "%d\t%d\t%d\t-\t-\t-\t-\t%s\n", s.Index, s.ItemsA, s.ItemsB, s.Reason)
+			continue
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%d\t%d\t%s\t-\n",
+			s.Index, s.ItemsA, s.ItemsB, s.Hamming, s.OnlyA, s.OnlyB, formatJaccard(s.Jaccard))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	status := "filters differ"
+	if d.Identical {
+		status = "filters are identical"
+	}
+	fmt.Fprintf(env.stdout, "%s: hamming distance %d over comparable stages (%d bits only in a, %d only in b), estimated jaccard %s\n",
+		status, d.Hamming, d.OnlyA, d.OnlyB, formatJaccard(d.Jaccard))
+	return nil
+}
+
+// formatJaccard formats an estimated Jaccard similarity, or "-" if there is none.
+func formatJaccard(j *float64) string {
+	if j == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.4f", *j)
+}
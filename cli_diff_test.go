@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"math/bits"
+	"strings"
+	"testing"
+)
+
+// The diff fixtures hold 150 keys "diff-N" in a filter built with testConfig, the primary;
+// a replica with two extra keys; the primary grown by 200 more keys into a third stage; and
+// the same keys in an fnv filter of twice the initial capacity.
+
+func TestCLIDiff(t *testing.T) {
+	for _, other := range []string{"replica", "grown", "fnv"} {
+		run := runTestCLI(t, "", "diff", "testdata/diff_primary.bloom", "testdata/diff_"+other+".bloom")
+		if run.code != exitDiffDifferent {
+			t.Errorf("diff with %s: exit code %d, want %d: %s", other, run.code, exitDiffDifferent, run.stderr)
+		}
+		checkGolden(t, "cli_diff_"+other, run.stdout)
+	}
+
+	run := mustRun(t, exitDiffSame, "", "diff", "testdata/diff_primary.bloom", "testdata/diff_primary.bloom")
+	if !strings.Contains(run.stdout, "filters are identical: hamming distance 0") {
+		t.Errorf("diff of a file with itself:\n%s", run.stdout)
+	}
+}
+
+// TestCLIDiffCounts checks the reported bit counts against the loaded filters.
+func TestCLIDiffCounts(t *testing.T) {
+	run := runTestCLI(t, "", "diff", "-json", "testdata/diff_primary.bloom", "testdata/diff_replica.bloom")
+	var d filterDiff
+	if err := json.Unmarshal([]byte(run.stdout), &d); err != nil {
+		t.Fatalf("diff -json: %v\n%s", err, run.stdout)
+	}
+	primary, _ := loadScalableFile("testdata/diff_primary.bloom", nil)
+	replica, _ := loadScalableFile("testdata/diff_replica.bloom", nil)
+
+	if !d.ParamsMatch || len(d.Params) != 0 || d.Identical || len(d.Stages) != 2 {
+		t.Fatalf("diff -json = %+v, want matching parameters, two stages, not identical", d)
+	}
+	var onlyA, onlyB uint
+	for i, stage := range d.Stages {
+		var a, b uint
+		for j, x := range primary.filters[i].bitset {
+			y := replica.filters[i].bitset[j]
+			a += uint(bits.OnesCount8(x &^ y))
+			b += uint(bits.OnesCount8(y &^ x))
+		}
+		if !stage.Comparable || stage.OnlyA != a || stage.OnlyB != b || stage.Hamming != a+b {
+			t.Errorf("stage %d = %+v, want %d bits only in a and %d only in b", i, stage, a, b)
+		}
+		onlyA, onlyB = onlyA+a, onlyB+b
+	}
+	if onlyB == 0 || d.OnlyA != onlyA || d.OnlyB != onlyB || d.Hamming != onlyA+onlyB {
+		t.Errorf("totals: hamming %d, only a %d, only b %d, want %d, %d, %d",
+			d.Hamming, d.OnlyA, d.OnlyB, onlyA+onlyB, onlyA, onlyB)
+	}
+	if d.Jaccard == nil || *d.Jaccard < 0.95 || *d.Jaccard >= 1 {
+		t.Errorf("estimated jaccard %v, want about 150/152", d.Jaccard)
+	}
+}
+
+func TestCLIDiffMismatchedParams(t *testing.T) {
+	run := runTestCLI(t, "", "-json", "diff", "testdata/diff_primary.bloom", "testdata/diff_fnv.bloom")
+	if run.code != exitDiffDifferent {
+		t.Fatalf("diff with another hasher: exit code %d, want %d: %s", run.code, exitDiffDifferent, run.stderr)
+	}
+	var d filterDiff
+	if err := json.Unmarshal([]byte(run.stdout), &d); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range d.Params {
+		names = append(names, p.Name)
+	}
+	if got := strings.Join(names, ", "); got != "hasher, initial capacity, stages" {
+		t.Errorf("parameter diffs %s, want hasher, initial capacity, stages", got)
+	}
+	if d.Jaccard != nil || d.Stages[0].Comparable || d.Stages[1].Reason != "only in a" {
+		t.Errorf("stages %+v, want none comparable", d.Stages)
+	}
+}
+
+func TestCLIDiffErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"diff", "testdata/diff_primary.bloom"},
+		{"diff", "testdata/diff_primary.bloom", "testdata/missing.bloom"},
+		{"diff", "testdata/diff_primary.bloom", "testdata/users.csv"},
+	} {
+		if run := runTestCLI(t, "", args...); run.code != exitDiffError {
+			t.Errorf("%q: exit code %d, want %d", args, run.code, exitDiffError)
+		}
+	}
+	if run := runTestCLI(t, "", "diff", "-h"); !strings.Contains(run.stderr, "Exit status:") {
+		t.Errorf("diff -h does not document the exit status:\n%s", run.stderr)
+	}
+}
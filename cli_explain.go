@@ -0,0 +1,32 @@
+package main
+
+import "fmt"
+
+// runExplain implements "bloom explain": it traces the verdict of a filter file for one
+// item, printing the digest halves, the bits probed in every stage and whether each is
+// set, and which stage, if any, matched. It answers "why does the filter say this key is
+// present?" for keys that were never added.
+func runExplain(env cliEnv, args []string) error {
+	var ff filterFlags
+	var asJSON bool
+	flags := newFlagSet(env, "explain", "item")
+	ff.register(flags)
+	flags.BoolVar(&asJSON, "json", false, "print JSON instead of text")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("%w: expected exactly one item", errUsage)
+	}
+	sbf, err := ff.open(false)
+	if err != nil {
+		return err
+	}
+
+	explanation := sbf.Explain(flags.Arg(0))
+	if asJSON || env.json {
+		return writeJSON(env.stdout, explanation)
+	}
+	writeExplanation(env.stdout, explanation)
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// stats_v2.bloom holds stats-0 to stats-298; absent-75 is one of its false positives.
+
+func TestCLIExplain(t *testing.T) {
+	var out strings.Builder
+	// A match in each stage, a false positive, and an absent item, which still exits 0.
+	for _, item := range []string{"stats-0", "stats-250", "absent-75", "absent-0"} {
+		run := mustRun(t, exitOK, "", "explain", "-f", "testdata/stats_v2.bloom", item)
+		out.WriteString(run.stdout)
+	}
+	checkGolden(t, "cli_explain", out.String())
+}
+
+func TestCLIExplainJSON(t *testing.T) {
+	sbf, err := loadScalableFile("testdata/stats_v2.bloom", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range []string{"stats-0", "absent-75", "absent-0"} {
+		for _, args := range [][]string{
+			{"-json", "explain", "-f", "testdata/stats_v2.bloom", item},
+			{"explain", "-json", "-f", "testdata/stats_v2.bloom", item},
+		} {
+			run := mustRun(t, exitOK, "", args...)
+			var got Explanation
+			if err := json.Unmarshal([]byte(run.stdout), &got); err != nil {
+				t.Fatalf("%s: %v\n%s", strings.Join(args, " "), err, run.stdout)
+			}
+			if want := sbf.Explain(item); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s = %+v, want %+v", strings.Join(args, " "), got, want)
+			}
+			if got.Present != sbf.MightContain(item) {
+				t.Errorf("explain %s: present %v, but MightContain = %v", item, got.Present, !got.Present)
+			}
+		}
+	}
+}
+
+func TestCLIExplainUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{"explain", "-f", "testdata/stats_v2.bloom"},
+		{"explain", "-f", "testdata/stats_v2.bloom", "a", "b"},
+	} {
+		if run := runTestCLI(t, "", args...); run.code != exitUsage {
+			t.Errorf("%s: exit code %d, want %d", strings.Join(args, " "), run.code, exitUsage)
+		}
+	}
+	if run := runTestCLI(t, "", "explain", "-f", "testdata/missing.bloom", "a"); run.code != exitError {
+		t.Errorf("explain of a missing file: exit code %d, want %d", run.code, exitError)
+	}
+}
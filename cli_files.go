@@ -0,0 +1,286 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// runFiles implements "bloom files", which dispatches to its own subcommands: "add"
+// inserts the contents of files into a filter file and "check" reports which files have
+// contents it has seen, to find duplicate files across runs such as successive backups.
+// Each file is one item, its content streamed through the filter's hasher.
+func runFiles(env cliEnv, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: missing subcommand: add or check", errUsage)
+	}
+	switch args[0] {
+	case "add":
+		return runFilesAdd(env, args[1:])
+	case "check":
+		return runFilesCheck(env, args[1:])
+	case "-h", "-help", "--help":
+		fmt.Fprintln(env.stderr, "usage: bloom files add [flags] path...")
+		fmt.Fprintln(env.stderr, "       bloom files check [flags] path...")
+		return flag.ErrHelp
+	}
+	return fmt.Errorf("%w: unknown subcommand %q: expected add or check", errUsage, args[0])
+}
+
+// runFilesAdd implements "bloom files add": it inserts the contents of the files found
+// under the paths and saves the filter file, reporting how many were new. Files that
+// cannot be read are reported and skipped, and make the command exit with status 1.
+func runFilesAdd(env cliEnv, args []string) error {
+	var ff filterFlags
+	var wf fileWalkFlags
+	flags := newFlagSet(env, "files add", "path...")
+	ff.register(flags)
+	wf.register(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("%w: expected at least one path", errUsage)
+	}
+	sbf, err := ff.open(true)
+	if err != nil {
+		return err
+	}
+
+	var result filesAddResult
+	fail := func(err error) {
+		result.Unreadable++
+		reportError(env, "files add", err, exitOK)
+	}
+	err = wf.walk(flags.Args(), fail, func(path string) error {
+		f, err := os.Open(path)
+		if err != nil {
+			fail(err)
+			return nil
+		}
+		defer f.Close()
+		seen, err := sbf.TestAndAddFromItemReader(f)
+		if err != nil {
+			return readFailure(err, fail)
+		}
+		result.Files++
+		if seen {
+			result.Seen++
+		} else {
+			result.Added++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if result.Added > 0 {
+		if err := sbf.saveFile(ff.path); err != nil {
+			return err
+		}
+	}
+
+	if env.json {
+		err = writeJSON(env.stdout, result)
+	} else {
+		_, err = fmt.Fprintf(env.stdout, "%d files hashed: %d new, %d seen before, %d unreadable\n",
+			result.Files, result.Added, result.Seen, result.Unreadable)
+	}
+	if err != nil {
+		return err
+	}
+	if result.Unreadable > 0 {
+		return &exitStatus{code: exitError}
+	}
+	return nil
+}
+
+// filesAddResult is the outcome of "bloom files add", also printed as JSON with the global
+// -json flag.
+type filesAddResult struct {
+	Files      int `json:"files"` // Files hashed
+	Added      int `json:"added"` // Files whose contents were new
+	Seen       int `json:"seen"`  // Files whose contents might have been seen before
+	Unreadable int `json:"unreadable"`
+}
+
+// runFilesCheck implements "bloom files check": it prints every file found under the
+// paths followed by "seen" if the filter might hold its contents and "new" otherwise.
+// Files that cannot be read are reported and skipped, and make the command exit with
+// status 1.
+func runFilesCheck(env cliEnv, args []string) error {
+	var ff filterFlags
+	var wf fileWalkFlags
+	flags := newFlagSet(env, "files check", "path...")
+	ff.register(flags)
+	wf.register(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("%w: expected at least one path", errUsage)
+	}
+	sbf, err := ff.open(false)
+	if err != nil {
+		return err
+	}
+
+	unreadable := 0
+	fail := func(err error) {
+		unreadable++
+		reportError(env, "files check", err, exitOK)
+	}
+	results := []fileCheckResult{}
+	err = wf.walk(flags.Args(), fail, func(path string) error {
+		f, err := os.Open(path)
+		if err != nil {
+			fail(err)
+			return nil
+		}
+		defer f.Close()
+		seen, err := sbf.MightContainFromItemReader(f)
+		if err != nil {
+			return readFailure(err, fail)
+		}
+		if env.json {
+			results = append(results, fileCheckResult{path, seen})
+			return nil
+		}
+		status := "new"
+		if seen {
+			status = "seen"
+		}
+		_, err = fmt.Fprintf(env.stdout, "%s\t%s\n", path, status)
+		return err
+	})
+	if err == nil && env.json {
+		err = writeJSON(env.stdout, results)
+	}
+	if err != nil {
+		return err
+	}
+	if unreadable > 0 {
+		return &exitStatus{code: exitError}
+	}
+	return nil
+}
+
+// fileCheckResult is one element of the JSON output of "bloom files check".
+type fileCheckResult struct {
+	Path string `json:"path"`
+	Seen bool   `json:"seen"`
+}
+
+// readFailure passes an error reading a file to fail and returns nil, so the walk goes
+// on; any other error, such as a full filter, is returned to stop it.
+func readFailure(err error, fail func(error)) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		fail(err)
+		return nil
+	}
+	return err
+}
+
+// fileWalkFlags holds the flags that select the files of "bloom files".
+type fileWalkFlags struct {
+	recursive      bool
+	followSymlinks bool
+	include        []string
+	exclude        []string
+}
+
+// register adds the file selection flags to the flag set.
+func (w *fileWalkFlags) register(flags *flag.FlagSet) {
+	flags.BoolVar(&w.recursive, "r", false, "descend into subdirectories")
+	flags.BoolVar(&w.followSymlinks, "follow-symlinks", false, "hash the targets of symbolic links to files instead of skipping the links")
+	flags.Func("include", "only hash files whose name matches this glob; repeatable", globList(&w.include))
+	flags.Func("exclude", "skip files and directories whose name matches this glob; repeatable", globList(&w.exclude))
+}
+
+// globList returns a flag function appending valid glob patterns to patterns.
+func globList(patterns *[]string) func(string) error {
+	return func(pattern string) error {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%q: %v", pattern, err)
+		}
+		*patterns = append(*patterns, pattern)
+		return nil
+	}
+}
+
+// matchAny reports whether name matches any of the patterns, which are known to be valid.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// selected reports whether a regular file named name passes -include and -exclude.
+func (w *fileWalkFlags) selected(name string) bool {
+	return (len(w.include) == 0 || matchAny(w.include, name)) && !matchAny(w.exclude, name)
+}
+
+// walk calls visit with every selected regular file under roots, in lexical order within
+// each root. Roots are followed if they are symbolic links; links met while walking are
+// skipped unless -follow-symlinks is given, and even then links to directories are not
+// walked, so a walk cannot loop. Entries that cannot be read are passed to fail and
+// skipped. An error returned by visit stops the walk.
+func (w *fileWalkFlags) walk(roots []string, fail func(error), visit func(path string) error) error {
+	for _, root := range roots {
+		info, err := os.Stat(root)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		if !info.IsDir() {
+			if info.Mode().IsRegular() && w.selected(info.Name()) {
+				if err := visit(root); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				fail(err)
+				return nil
+			}
+			if d.IsDir() {
+				if path != root && (!w.recursive || matchAny(w.exclude, d.Name())) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type()&fs.ModeSymlink != 0 {
+				if !w.followSymlinks {
+					return nil
+				}
+				target, err := os.Stat(path)
+				if err != nil {
+					fail(err)
+					return nil
+				}
+				if !target.Mode().IsRegular() {
+					return nil
+				}
+			} else if !d.Type().IsRegular() {
+				return nil
+			}
+			if !w.selected(d.Name()) {
+				return nil
+			}
+			return visit(path)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTree creates files under dir from a map of slash-separated paths to contents.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// filesAdd runs "files add" with -json and returns its result.
+func filesAdd(t *testing.T, code int, args ...string) filesAddResult {
+	t.Helper()
+	run := mustRun(t, code, "", append([]string{"-json", "files", "add"}, args...)...)
+	var result filesAddResult
+	if err := json.Unmarshal([]byte(run.stdout), &result); err != nil {
+		t.Fatalf("files add -json: %v\n%s", err, run.stdout)
+	}
+	return result
+}
+
+func TestCLIFiles(t *testing.T) {
+	dir := t.TempDir()
+	backup1, backup2 := filepath.Join(dir, "backup1"), filepath.Join(dir, "backup2")
+	writeTree(t, backup1, map[string]string{
+		"a.txt":     "alpha",
+		"b.txt":     "beta",
+		"sub/c.txt": "alpha", // Duplicate of a.txt within the run
+		"sub/d.log": "delta",
+	})
+	writeTree(t, backup2, map[string]string{
+		"a.txt":       "alpha",
+		"renamed.txt": "beta",
+		"e.txt":       "epsilon",
+	})
+	seen := filepath.Join(dir, "seen.bloom")
+
+	// Without -r only the top level is hashed.
+	if got := filesAdd(t, exitOK, "-f", seen, backup1); got != (filesAddResult{Files: 2, Added: 2}) {
+		t.Errorf("files add without -r = %+v, want 2 files added", got)
+	}
+	if got := filesAdd(t, exitOK, "-f", seen, "-r", backup1); got != (filesAddResult{Files: 4, Added: 1, Seen: 3}) {
+		t.Errorf("files add -r = %+v, want 4 files, with only d.log new", got)
+	}
+
+	// Contents are matched whatever the file name.
+	run := mustRun(t, exitOK, "", "files", "check", "-f", seen, "-r", backup2)
+	want := strings.Join([]string{
+		filepath.Join(backup2, "a.txt") + "\tseen",
+		filepath.Join(backup2, "e.txt") + "\tnew",
+		filepath.Join(backup2, "renamed.txt") + "\tseen",
+	}, "\n") + "\n"
+	if run.stdout != want {
+		t.Errorf("files check printed:\n%s\nwant:\n%s", run.stdout, want)
+	}
+
+	run = mustRun(t, exitOK, "", "-json", "files", "check", "-f", seen, filepath.Join(backup2, "e.txt"))
+	var results []fileCheckResult
+	if err := json.Unmarshal([]byte(run.stdout), &results); err != nil {
+		t.Fatalf("files check -json: %v\n%s", err, run.stdout)
+	}
+	if len(results) != 1 || results[0] != (fileCheckResult{filepath.Join(backup2, "e.txt"), false}) {
+		t.Errorf("files check -json of a file root = %+v", results)
+	}
+	// The filter is unchanged by checks.
+	mustRun(t, exitCheckAbsent, "", "check", "-f", seen, "epsilon")
+	mustRun(t, exitCheckPresent, "", "check", "-f", seen, "delta")
+}
+
+func TestCLIFilesGlobs(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"a.txt":        "a",
+		"b.log":        "b",
+		"sub/c.txt":    "c",
+		"cache/d.txt":  "d",
+		"sub/e.tmp":    "e",
+		"sub/f.bak.gz": "f",
+	})
+	for _, tc := range []struct {
+		args  []string
+		files int
+	}{
+		{nil, 6},
+		{[]string{"-include", "*.txt"}, 3},
+		{[]string{"-include", "*.txt", "-include", "*.log"}, 4},
+		{[]string{"-exclude", "cache"}, 5},
+		{[]string{"-exclude", "*.tmp", "-exclude", "*.gz"}, 4},
+		{[]string{"-include", "*.txt", "-exclude", "cache"}, 2},
+	} {
+		seen := filepath.Join(t.TempDir(), "seen.bloom")
+		args := append([]string{"-f", seen, "-r"}, tc.args...)
+		if got := filesAdd(t, exitOK, append(args, dir)...); got.Files != tc.files {
+			t.Errorf("files add %s hashed %d files, want %d", strings.Join(tc.args, " "), got.Files, tc.files)
+		}
+	}
+	if run := runTestCLI(t, "", "files", "add", "-f", filepath.Join(dir, "x.bloom"), "-include", "[", dir); run.code != exitUsage {
+		t.Errorf("files add with a malformed glob: exit code %d, want %d", run.code, exitUsage)
+	}
+}
+
+func TestCLIFilesSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	tree := filepath.Join(dir, "tree")
+	writeTree(t, dir, map[string]string{"outside.txt": "outside", "tree/inside.txt": "inside"})
+	if err := os.Symlink(filepath.Join(dir, "outside.txt"), filepath.Join(tree, "link.txt")); err != nil {
+		t.Skipf("cannot create symbolic links: %v", err)
+	}
+	if err := os.Symlink(dir, filepath.Join(tree, "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := filepath.Join(dir, "seen.bloom")
+	if got := filesAdd(t, exitOK, "-f", seen, "-r", tree); got.Files != 1 {
+		t.Errorf("files add skipping links hashed %d files, want 1", got.Files)
+	}
+	mustRun(t, exitCheckAbsent, "", "check", "-f", seen, "outside")
+
+	// Links to files are followed on request; links to directories never are.
+	if got := filesAdd(t, exitOK, "-f", seen, "-r", "-follow-symlinks", tree); got.Files != 2 || got.Added != 1 {
+		t.Errorf("files add -follow-symlinks = %+v, want 2 files, the linked one new", got)
+	}
+	mustRun(t, exitCheckPresent, "", "check", "-f", seen, "outside")
+}
+
+func TestCLIFilesUnreadable(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "alpha", "b.txt": "beta"})
+	if err := os.Symlink(filepath.Join(dir, "missing"), filepath.Join(dir, "dangling.txt")); err != nil {
+		t.Skipf("cannot create symbolic links: %v", err)
+	}
+	seen := filepath.Join(t.TempDir(), "seen.bloom")
+
+	// Unreadable entries are reported, the rest are hashed, and the exit status is 1.
+	got := filesAdd(t, exitError, "-f", seen, "-follow-symlinks", dir, filepath.Join(dir, "absent"))
+	if got != (filesAddResult{Files: 2, Added: 2, Unreadable: 2}) {
+		t.Errorf("files add with unreadable entries = %+v, want 2 added and 2 unreadable", got)
+	}
+	mustRun(t, exitCheckPresent, "", "check", "-f", seen, "alpha")
+
+	run := runTestCLI(t, "", "files", "check", "-f", seen, "-follow-symlinks", dir)
+	if run.code != exitError || !strings.Contains(run.stderr, "dangling.txt") || strings.Count(run.stdout, "\tseen\n") != 2 {
+		t.Errorf("files check with a dangling link: exit code %d, stdout %q, stderr %q", run.code, run.stdout, run.stderr)
+	}
+}
+
+func TestCLIFilesUsage(t *testing.T) {
+	seen := filepath.Join(t.TempDir(), "seen.bloom")
+	for _, args := range [][]string{
+		{"files"},
+		{"files", "list"},
+		{"files", "add", "-f", seen},
+		{"files", "check", "-f", seen},
+		{"files", "add", "."},
+	} {
+		if run := runTestCLI(t, "", args...); run.code != exitUsage {
+			t.Errorf("%s: exit code %d, want %d", strings.Join(args, " "), run.code, exitUsage)
+		}
+	}
+}
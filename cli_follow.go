@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// openImportInput opens the input of "bloom import", following it if follow is set. A
+// followed input calls idle, if not nil, every time it waits for appended data.
+func openImportInput(ctx context.Context, env cliEnv, input string, follow bool, clock Clock, poll time.Duration, idle func()) (io.Reader, func() error, error) {
+	if !follow {
+		return openInput(env, input)
+	}
+	fr, err := openFollowReader(ctx, input, clock, poll)
+	if err != nil {
+		return nil, nil, err
+	}
+	fr.idle = idle
+	return fr, fr.Close, nil
+}
+
+// followReader reads a file like "tail -F": at the end of the file it polls for appended
+// data instead of returning io.EOF, and it starts over from the beginning when the file
+// is truncated or replaced by a new file at the same path, as log rotation does. Reads
+// fail with the context's error once it is done.
+type followReader struct {
+	ctx    context.Context
+	path   string
+	clock  Clock
+	poll   time.Duration
+	file   *os.File
+	offset int64
+	idle   func() // Called before each wait for appended data
+}
+
+// openFollowReader opens the file at path for following, polling every poll interval.
+func openFollowReader(ctx context.Context, path string, clock Clock, poll time.Duration) (*followReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &followReader{ctx: ctx, path: path, clock: clock, poll: poll, file: file}, nil
+}
+
+// Read reads appended data, waiting for it at the end of the file.
+func (f *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := f.file.Read(p)
+		f.offset += int64(n)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		restarted, err := f.restartIfRotated()
+		if err != nil {
+			return 0, err
+		}
+		if restarted {
+			continue
+		}
+		if f.idle != nil {
+			f.idle()
+		}
+		select {
+		case <-f.ctx.Done():
+			return 0, f.ctx.Err()
+		case <-f.clock.After(f.poll):
+		}
+	}
+}
+
+// restartIfRotated switches to the beginning of the file at path if it was truncated or
+// replaced, and reports whether it did.
+func (f *followReader) restartIfRotated() (bool, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		// Mid-rotation the path may briefly not exist; keep following the old file.
+		return false, nil
+	}
+	current, err := f.file.Stat()
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case !os.SameFile(info, current):
+		file, err := os.Open(f.path)
+		if err != nil {
+			return false, nil
+		}
+		f.file.Close()
+		f.file, f.offset = file, 0
+		return true, nil
+	case info.Size() < f.offset:
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		f.offset = 0
+		return true, nil
+	}
+	return false, nil
+}
+
+// Close closes the file being followed.
+func (f *followReader) Close() error {
+	return f.file.Close()
+}
+
+// followCheckpoint saves a followed import's filter at most once per interval, and only
+// if items were added since the last save.
+type followCheckpoint struct {
+	env      cliEnv
+	sbf      *ScalableBloomFilter
+	path     string
+	interval time.Duration
+	last     time.Time // Time of the last save
+	saved    uint      // ItemCount at the last save
+}
+
+// newFollowCheckpoint returns a checkpoint for sbf, which was just opened from path.
+func newFollowCheckpoint(env cliEnv, sbf *ScalableBloomFilter, path string, interval time.Duration) *followCheckpoint {
+	return &followCheckpoint{env: env, sbf: sbf, path: path, interval: interval, last: sbf.options.clock.Now(), saved: sbf.ItemCount()}
+}
+
+// maybeSave saves the filter if the interval has passed since the last save and items
+// were added meanwhile. A failed save is reported and retried at the next opportunity.
+func (c *followCheckpoint) maybeSave() {
+	now := c.sbf.options.clock.Now()
+	count := c.sbf.ItemCount()
+	if now.Sub(c.last) < c.interval || count == c.saved {
+		return
+	}
+	c.last = now
+	if err := c.sbf.saveFile(c.path); err != nil {
+		reportError(c.env, "import", fmt.Errorf("checkpoint failed: %w", err), exitOK)
+		return
+	}
+	c.saved = count
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-bloom-filter/bloomtest"
+)
+
+// appendFile appends data to the file at path.
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollowReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ids.log")
+	if err := os.WriteFile(path, []byte("a\nb\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	clock := bloomtest.NewFakeClock(time.Unix(0, 0))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var idle atomic.Int32
+	in, closeInput, err := openImportInput(ctx, cliEnv{}, path, true, clock, time.Second, func() { idle.Add(1) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeInput()
+
+	lines := make(chan string)
+	readErr := make(chan error, 1)
+	go func() {
+		r := bufio.NewReader(in)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				readErr <- err
+				return
+			}
+			lines <- strings.TrimSuffix(line, "\n")
+		}
+	}()
+	expect := func(want ...string) {
+		t.Helper()
+		for _, w := range want {
+			select {
+			case got := <-lines:
+				if got != w {
+					t.Fatalf("read %q, want %q", got, w)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for %q", w)
+			}
+		}
+	}
+	// change alters the file once the reader waits at its end, then lets the reader look again.
+	change := func(alter func()) {
+		t.Helper()
+		waitFor(t, "the reader to wait for data", func() bool { return clock.Waiters() == 1 })
+		alter()
+		clock.Advance(time.Second)
+	}
+
+	expect("a", "b")
+	change(func() { appendFile(t, path, "c\n") })
+	expect("c")
+	if idle.Load() == 0 {
+		t.Error("idle was not called while waiting for data")
+	}
+
+	// Truncation starts over from the beginning of the file.
+	change(func() {
+		if err := os.WriteFile(path, []byte("d\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	})
+	expect("d")
+
+	// So does a new file at the path, as log rotation creates.
+	change(func() {
+		if err := os.Rename(path, path+".1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("e\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	})
+	expect("e")
+
+	waitFor(t, "the reader to wait for data", func() bool { return clock.Waiters() == 1 })
+	cancel()
+	select {
+	case err := <-readErr:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("read after cancellation = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reader did not stop after cancellation")
+	}
+}
+
+// TestCLIImportFollow runs a followed import with real intervals: keys appended to the
+// file, and to its replacement after a rotation, reach the checkpointed filter while the
+// input is otherwise idle, and SIGINT ends the import with a final save.
+func TestCLIImportFollow(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "ids.log")
+	if err := os.WriteFile(input, []byte("id-1\nid-2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "ids.bloom")
+
+	done := make(chan cliRun, 1)
+	go func() {
+		done <- runTestCLI(t, "", "import", "-f", path, "-i", input, "-follow",
+			"-checkpoint-interval", "20ms", "-poll-interval", "5ms", "-progress-interval", "0")
+	}()
+	checkpointed := func(keys ...string) func() bool {
+		return func() bool {
+			sbf, err := loadScalableFile(path, nil)
+			if err != nil {
+				return false
+			}
+			for _, key := range keys {
+				if !sbf.MightContain(key) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	waitFor(t, "the first checkpoint", checkpointed("id-1", "id-2"))
+
+	// Fewer keys than a batch arrive, then nothing more.
+	appendFile(t, input, "id-3\n")
+	waitFor(t, "a checkpoint of the appended key", checkpointed("id-3"))
+
+	if err := os.Rename(input, input+".1"); err != nil {
+		t.Fatal(err)
+	}
+	var rotated strings.Builder
+	for i := 4; i <= 6; i++ {
+		fmt.Fprintf(&rotated, "id-%d\n", i)
+	}
+	if err := os.WriteFile(input, []byte(rotated.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "a checkpoint of the rotated file", checkpointed("id-4", "id-5", "id-6"))
+
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Signal(os.Interrupt); err != nil {
+		t.Skipf("cannot send SIGINT: %v", err)
+	}
+	select {
+	case run := <-done:
+		if run.code != exitOK || !strings.HasPrefix(run.stdout, "6 lines in ") {
+			t.Errorf("followed import ended with exit code %d, stdout %q, stderr %q", run.code, run.stdout, run.stderr)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("followed import did not stop on SIGINT")
+	}
+	if !checkpointed("id-1", "id-6")() {
+		t.Error("final save lacks keys")
+	}
+}
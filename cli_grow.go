@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"text/tabwriter"
+)
+
+// runGrow implements "bloom grow": ahead of a bulk load of -expect items, it allocates the
+// sub-filters the load would otherwise add while running and saves the filter file. It
+// refuses if MaxFilters or -max-bytes would be exceeded, and prints the resulting layout.
+func runGrow(env cliEnv, args []string) error {
+	var path string
+	var expect float64
+	var maxBytes int64
+	flags := newFlagSet(env, "grow", "")
+	flags.StringVar(&path, "f", "", "filter file (required)")
+	flags.Float64Var(&expect, "expect", 0, "number of distinct items the coming load adds (required)")
+	flags.Int64Var(&maxBytes, "max-bytes", 0, "refuse if the bitsets would take more than this many bytes, 0 for no limit")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	switch {
+	case expect < 1 || expect > math.MaxInt:
+		return fmt.Errorf("%w: -expect must be a positive number of items", errUsage)
+	case maxBytes < 0:
+		return fmt.Errorf("%w: -max-bytes must not be negative", errUsage)
+	case flags.NArg() > 0:
+		return fmt.Errorf("%w: unexpected arguments %q", errUsage, flags.Args())
+	}
+	ff := filterFlags{path: path}
+	sbf, err := ff.open(false)
+	if err != nil {
+		return err
+	}
+
+	n := int(expect)
+	plan, err := sbf.ExpectAdditional(n)
+	if err != nil {
+		return err
+	}
+	before := sbf.Stats().MemoryBytes
+	added := 0
+	for _, stage := range plan {
+		added += stage.Bytes
+	}
+	if maxBytes > 0 && int64(before+added) > maxBytes {
+		return fmt.Errorf("%d more items need %d new sub-filters of %d bytes in total, taking the bitsets from %d to %d bytes, over -max-bytes %d",
+			n, len(plan), added, before, before+added, maxBytes)
+	}
+	if len(plan) > 0 {
+		if _, err := sbf.PreGrow(n); err != nil {
+			return err
+		}
+		if err := sbf.saveFile(path); err != nil {
+			return err
+		}
+	}
+
+	stats := sbf.Stats()
+	result := growResult{
+		Path:        path,
+		Expect:      n,
+		NewStages:   plan,
+		AddedBytes:  added,
+		MemoryBytes: stats.MemoryBytes,
+		Filters:     stats.Filters,
+	}
+	if result.NewStages == nil {
+		result.NewStages = []StagePlan{}
+	}
+	if env.json {
+		return writeJSON(env.stdout, result)
+	}
+	return writeGrowResult(env, result)
+}
+
+// growResult is the outcome of "bloom grow", also printed as JSON with the global -json
+// flag.
+type growResult struct {
+	Path        string        `json:"path"`
+	Expect      int           `json:"expect"`
+	NewStages   []StagePlan   `json:"new_stages"`   // Sub-filters allocated, none if the load fits
+	AddedBytes  int           `json:"added_bytes"`  // Bytes allocated for the new sub-filters
+	MemoryBytes int           `json:"memory_bytes"` // Bytes of all bitsets afterwards
+	Filters     []FilterStats `json:"filters"`      // Layout afterwards, oldest first
+}
+
+// writeGrowResult prints the layout with the new sub-filters marked, followed by a summary.
+func writeGrowResult(env cliEnv, r growResult) error {
+	firstNew := len(r.Filters) - len(r.NewStages)
+	tw := tabwriter.NewWriter(env.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tCAPACITY\tITEMS\tTARGET FP\tBYTES\tNOTE")
+	for i, fs := range r.Filters {
+		note := ""
+		if i >= firstNew {
+			note = "new"
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%.6g\t%d\t%s\n", i, fs.Capacity, fs.ItemCount, fs.TargetFP, (fs.BitSize+7)/8, note)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(r.NewStages) == 0 {
+		_, err := fmt.Fprintf(env.stdout, "%d more items fit in the existing sub-filters; %s is unchanged\n", r.Expect, r.Path)
+		return err
+	}
+	stages := "sub-filters"
+	if len(r.NewStages) == 1 {
+		stages = "sub-filter"
+	}
+	_, err := fmt.Fprintf(env.stdout, "added %d %s of %d bytes in total for %d more items; the bitsets now take %d bytes\n",
+		len(r.NewStages), stages, r.AddedBytes, r.Expect, r.MemoryBytes)
+	return err
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCLIGrow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+	mustRun(t, exitOK, "", "create", "-f", path, "-capacity", "100", "-fp", "0.01")
+	mustRun(t, exitOK, "", "add", "-f", path, "a", "b", "c")
+
+	run := mustRun(t, exitOK, "", "-json", "grow", "-f", path, "-expect", "5000")
+	var result growResult
+	if err := json.Unmarshal([]byte(run.stdout), &result); err != nil {
+		t.Fatalf("grow -json: %v\n%s", err, run.stdout)
+	}
+	if len(result.NewStages) == 0 || len(result.Filters) != 1+len(result.NewStages) {
+		t.Fatalf("grow -expect 5000 = %+v, want new sub-filters after the first", result)
+	}
+	added := 0
+	for _, stage := range result.NewStages {
+		added += stage.Bytes
+	}
+	if result.AddedBytes != added {
+		t.Errorf("grow reported %d added bytes, the new sub-filters take %d", result.AddedBytes, added)
+	}
+
+	// The file reloads with the new sub-filters, empty and sized as planned.
+	sbf, err := loadScalableFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stages := len(sbf.filters)
+	if stages != len(result.Filters) || sbf.ItemCount() != 3 {
+		t.Fatalf("grown file has %d sub-filters and %d items, want %d and 3", stages, sbf.ItemCount(), len(result.Filters))
+	}
+	for _, stage := range result.NewStages {
+		if filter := sbf.filters[stage.Index]; filter.bitSize != stage.BitSize || filter.ItemCount() != 0 {
+			t.Errorf("sub-filter %d has %d bits and %d items, want %d bits and none", stage.Index, filter.bitSize, filter.ItemCount(), stage.BitSize)
+		}
+	}
+
+	// Importing the expected volume grows no further.
+	mustRun(t, exitOK, "", "import", "-f", path, "-i", writeKeys(t, testKeys("load", 5000)))
+	if sbf, err = loadScalableFile(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(sbf.filters) != stages {
+		t.Errorf("importing the expected items grew the filter from %d to %d sub-filters", stages, len(sbf.filters))
+	}
+
+	// With room left, nothing is allocated or saved.
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run = mustRun(t, exitOK, "", "grow", "-f", path, "-expect", "1")
+	if !strings.Contains(run.stdout, "fit in the existing sub-filters") {
+		t.Errorf("grow with room left printed:\n%s", run.stdout)
+	}
+	if after, err := os.Stat(path); err != nil || !after.ModTime().Equal(info.ModTime()) {
+		t.Errorf("grow with room left rewrote %s", path)
+	}
+}
+
+func TestCLIGrowRefuses(t *testing.T) {
+	dir := t.TempDir()
+	limited := filepath.Join(dir, "limited.bloom")
+	mustRun(t, exitOK, "", "create", "-f", limited, "-capacity", "100", "-max-filters", "2")
+	plain := filepath.Join(dir, "plain.bloom")
+	mustRun(t, exitOK, "", "create", "-f", plain, "-capacity", "100")
+
+	for _, tc := range []struct {
+		path string
+		args []string
+		want []string
+	}{
+		{limited, []string{"-expect", "100000"}, []string{"MaxFilters 2", ErrMaxFilters.Error()}},
+		{plain, []string{"-expect", "100000", "-max-bytes", "1000"}, []string{"over -max-bytes 1000", "100000 more items"}},
+	} {
+		before, err := os.ReadFile(tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		args := append([]string{"grow", "-f", tc.path}, tc.args...)
+		run := runTestCLI(t, "", args...)
+		if run.code != exitError {
+			t.Errorf("%s: exit code %d, want %d", strings.Join(args, " "), run.code, exitError)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(run.stderr, want) {
+				t.Errorf("%s: stderr %q lacks %q", strings.Join(args, " "), run.stderr, want)
+			}
+		}
+		if after, _ := os.ReadFile(tc.path); string(after) != string(before) {
+			t.Errorf("%s: refused grow changed the file", strings.Join(args, " "))
+		}
+	}
+}
+
+func TestCLIGrowUsage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+	mustRun(t, exitOK, "", "create", "-f", path)
+	for _, args := range [][]string{
+		{"grow", "-f", path},
+		{"grow", "-f", path, "-expect", "0"},
+		{"grow", "-f", path, "-expect", "10", "-max-bytes", "-1"},
+		{"grow", "-f", path, "-expect", "10", "extra"},
+		{"grow", "-expect", "10"},
+	} {
+		if run := runTestCLI(t, "", args...); run.code != exitUsage {
+			t.Errorf("%s: exit code %d, want %d", strings.Join(args, " "), run.code, exitUsage)
+		}
+	}
+}
+
+func TestCLIGrowText(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+	mustRun(t, exitOK, "", "create", "-f", path, "-capacity", "1000", "-fp", "0.01")
+	run := mustRun(t, exitOK, "", "grow", "-f", path, "-expect", "10000")
+	checkGolden(t, "cli_grow", run.stdout)
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// runImport implements "bloom import": it streams keys from a file, or stdin with "-i -",
+// into a filter file, printing progress to stderr and a summary to stdout. Keys are one
+// per line, or one column of a CSV file with -csv. Compressed input is decompressed
+// transparently. If the filter hits its sub-filter limit partway, the keys inserted so
+// far are still saved and the command fails, stating how many lines were processed.
+//
+// With -follow, the file is followed like "tail -F" until SIGINT or SIGTERM, which trigger
+// a final save. Keys are then inserted one at a time rather than in batches, and the
+// filter is saved every checkpoint interval in which keys were added, also while waiting
+// for appended data, so a crash loses at most one interval. No read offset
+// is kept, so a restart reads the file from the beginning again; re-adding keys is
+// harmless and only shows up as duplicates.
+func runImport(env cliEnv, args []string) error {
+	var ff filterFlags
+	var cf csvFlags
+	var tf tokenFlags
+	var input string
+	var nul, follow bool
+	var batchSize, progressLines, workers int
+	var progressInterval, checkpointInterval, pollInterval time.Duration
+	flags := newFlagSet(env, "import", "")
+	ff.register(flags)
+	flags.StringVar(&input, "i", "", `input file of keys, "-" for stdin (required)`)
+	flags.BoolVar(&nul, "0", false, nulFlagUsage)
+	flags.IntVar(&batchSize, "batch-size", defaultImportBatchSize, "keys inserted per lock acquisition; 1 with -follow")
+	flags.IntVar(&workers, "workers", 1, "goroutines hashing and inserting batches while the input is read")
+	flags.DurationVar(&progressInterval, "progress-interval", 5*time.Second, "report progress at this interval, 0 to disable")
+	flags.IntVar(&progressLines, "progress-lines", 0, "also report progress every this many lines, 0 to disable")
+	cf.register(flags)
+	tf.register(flags)
+	flags.BoolVar(&follow, "follow", false, "keep reading data appended to the input file, like tail -F")
+	flags.DurationVar(&checkpointInterval, "checkpoint-interval", 30*time.Second, "with -follow, save the filter at this interval")
+	flags.DurationVar(&pollInterval, "poll-interval", time.Second, "with -follow, check for appended data at this interval")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if input == "" {
+		return fmt.Errorf("%w: -i is required", errUsage)
+	}
+	if batchSize < 1 {
+		return fmt.Errorf("%w: -batch-size must be positive", errUsage)
+	}
+	if workers < 1 {
+		return fmt.Errorf("%w: -workers must be positive", errUsage)
+	}
+	if err := cf.validate(nul); err != nil {
+		return err
+	}
+	tokenize, err := tf.tokenizer()
+	if err != nil {
+		return err
+	}
+	if follow {
+		if err := validateFollow(input, cf, checkpointInterval, pollInterval); err != nil {
+			return err
+		}
+	}
+	sbf, err := ff.open(true)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if follow {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+	}
+	var checkpoint *followCheckpoint
+	var idle func()
+	if follow {
+		checkpoint = newFollowCheckpoint(env, sbf, ff.path, checkpointInterval)
+		idle = checkpoint.maybeSave
+		// Insert keys as they are read, so a checkpoint taken while waiting for appended
+		// data covers every key read so far.
+		batchSize = 1
+	}
+	in, closeInput, err := openImportInput(ctx, env, input, follow, sbf.options.clock, pollInterval, idle)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	unit := "lines"
+	switch {
+	case tokenize != nil:
+		unit = "tokens"
+	case cf.enabled:
+		unit = "rows"
+	}
+	opts := []ImportOption{
+		WithImportBatchSize(batchSize),
+		WithDelimiter(recordDelim(nul)),
+		WithImportWorkers(workers),
+		WithTokenizer(tokenize),
+	}
+	if follow {
+		opts = append(opts, followProgress(env, checkpoint, unit, progressInterval, progressLines))
+	} else {
+		opts = append(opts, WithProgress(progressInterval, progressLines, func(r Report) {
+			printProgress(env, unit, r)
+		}))
+	}
+	var report Report
+	if cf.enabled {
+		report, err = importCSV(ctx, sbf, in, cf, opts)
+	} else {
+		report, err = sbf.AddFromReader(ctx, in, opts...)
+	}
+	if follow && errors.Is(err, context.Canceled) {
+		// Interrupted by a signal, which is how following ends.
+		err = nil
+	}
+	if report.LinesRead > 0 {
+		if saveErr := sbf.saveFile(ff.path); saveErr != nil {
+			return saveErr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("stopped after %d %s: %w", report.LinesRead, unit, err)
+	}
+
+	if env.json {
+		return writeJSON(env.stdout, report)
+	}
+	if cf.enabled && tokenize == nil {
+		fmt.Fprintf(env.stdout, "%d rows read, %d skipped in %s (%.0f rows/s): %d keys added, %d duplicates, %d stages\n",
+			report.LinesRead+report.Skipped, report.Skipped, report.Elapsed.Round(time.Millisecond), linesPerSecond(report),
+			report.ItemsAdded, report.Duplicates, report.Filters)
+		return nil
+	}
+	fmt.Fprintf(env.stdout, "%d %s in %s (%.0f %s/s): %d added, %d duplicates, %d stages\n",
+		report.LinesRead, unit, report.Elapsed.Round(time.Millisecond), linesPerSecond(report), unit,
+		report.ItemsAdded, report.Duplicates, report.Filters)
+	return nil
+}
+
+// printProgress prints an import progress line to stderr, or the Report as a line of
+// JSON with the global -json flag.
+func printProgress(env cliEnv, unit string, r Report) {
+	if env.json {
+		writeJSONLine(env.stderr, r)
+		return
+	}
+	fmt.Fprintf(env.stderr, "%d %s (%.0f/s), %d added, %d duplicates, %d stages\n",
+		r.LinesRead, unit, linesPerSecond(r), r.ItemsAdded, r.Duplicates, r.Filters)
+}
+
+// validateFollow checks that the input and intervals allow -follow.
+func validateFollow(input string, cf csvFlags, checkpointInterval, pollInterval time.Duration) error {
+	switch {
+	case input == "-":
+		return fmt.Errorf("%w: -follow needs an input file, not stdin", errUsage)
+	case cf.enabled:
+		return fmt.Errorf("%w: -follow cannot be combined with -csv", errUsage)
+	case strings.HasSuffix(input, ".gz") || strings.HasSuffix(input, ".zst"):
+		return fmt.Errorf("%w: -follow cannot read compressed files", errUsage)
+	case checkpointInterval <= 0 || pollInterval <= 0:
+		return fmt.Errorf("%w: -checkpoint-interval and -poll-interval must be positive", errUsage)
+	}
+	return nil
+}
+
+// followProgress returns the progress option of a followed import. Besides printing
+// progress as configured, it lets checkpoint save the filter while keys keep arriving; the
+// callback runs between batches, so a checkpoint never misses a batch that was already
+// inserted. While the input is idle, the followed reader drives the checkpoint instead.
+func followProgress(env cliEnv, checkpoint *followCheckpoint, unit string, progressInterval time.Duration, progressLines int) ImportOption {
+	var printedAt time.Duration
+	var printedLines int
+	every := checkpoint.interval
+	if progressInterval > 0 {
+		every = min(every, progressInterval)
+	}
+	return WithProgress(every, progressLines, func(r Report) {
+		if (progressInterval > 0 && r.Elapsed-printedAt >= progressInterval) ||
+			(progressLines > 0 && r.LinesRead-printedLines >= progressLines) {
+			printedAt, printedLines = r.Elapsed, r.LinesRead
+			printProgress(env, unit, r)
+		}
+		checkpoint.maybeSave()
+	})
+}
+
+// linesPerSecond returns the import rate of r, or 0 before any time has elapsed.
+func linesPerSecond(r Report) float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.LinesRead) / r.Elapsed.Seconds()
+}
+
+// csvFlags holds the flags that select CSV input for "bloom import".
+type csvFlags struct {
+	enabled   bool
+	column    string
+	delimiter string
+	noHeader  bool
+	skipBad   bool
+}
+
+// register adds the CSV flags to the flag set.
+func (c *csvFlags) register(flags *flag.FlagSet) {
+	flags.BoolVar(&c.enabled, "csv", false, "read CSV and take the keys from one column")
+	flags.StringVar(&c.column, "column", "", "CSV column holding the keys: a header name, or a 1-based index")
+	flags.StringVar(&c.delimiter, "delimiter", ",", `CSV field delimiter; \t for tab`)
+	flags.BoolVar(&c.noHeader, "no-header", false, "the CSV has no header row")
+	flags.BoolVar(&c.skipBad, "skip-bad-rows", false, "skip and count malformed CSV rows instead of stopping")
+}
+
+// validate checks that the CSV flags are consistent.
+func (c *csvFlags) validate(nul bool) error {
+	switch {
+	case !c.enabled && c.column != "":
+		return fmt.Errorf("%w: -column requires -csv", errUsage)
+	case !c.enabled:
+		return nil
+	case nul:
+		return fmt.Errorf("%w: -0 cannot be combined with -csv", errUsage)
+	case c.column == "":
+		return fmt.Errorf("%w: -csv requires -column", errUsage)
+	}
+	if _, err := c.comma(); err != nil {
+		return err
+	}
+	if _, err := strconv.Atoi(c.column); err != nil && c.noHeader {
+		return fmt.Errorf("%w: -column must be an index with -no-header", errUsage)
+	}
+	return nil
+}
+
+// comma returns the field delimiter selected by -delimiter.
+func (c *csvFlags) comma() (rune, error) {
+	if c.delimiter == `\t` {
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(c.delimiter)
+	if size == 0 || size != len(c.delimiter) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+		return 0, fmt.Errorf("%w: -delimiter must be a single character other than a quote or newline", errUsage)
+	}
+	return r, nil
+}
+
+// importCSV inserts the keys in the selected column of the CSV read from r. Quoted fields
+// may span lines. Rows that are malformed or too short either stop the import or, with
+// -skip-bad-rows, are counted in the Report's Skipped field.
+func importCSV(ctx context.Context, sbf *ScalableBloomFilter, r io.Reader, cf csvFlags, opts []ImportOption) (Report, error) {
+	start := sbf.options.clock.Now()
+	var report Report
+
+	comma, err := cf.comma()
+	if err != nil {
+		return report, err
+	}
+	cr := csv.NewReader(r)
+	cr.Comma = comma
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	column, err := strconv.Atoi(cf.column)
+	if err == nil && column < 1 {
+		return report, fmt.Errorf("%w: -column index must be at least 1", errUsage)
+	}
+	column--
+	if !cf.noHeader {
+		header, err := cr.Read()
+		if err != nil {
+			return report, fmt.Errorf("reading CSV header: %w", err)
+		}
+		if column < 0 {
+			column = slices.Index(header, cf.column)
+			if column < 0 {
+				return report, fmt.Errorf("CSV header has no column %q", cf.column)
+			}
+		}
+	}
+
+	err = sbf.addRecords(ctx, &report, start, buildImportConfig(opts), func() (string, bool, error) {
+		for {
+			row, err := cr.Read()
+			report.BytesProcessed = cr.InputOffset()
+			var parseErr *csv.ParseError
+			switch {
+			case err == nil && column < len(row):
+				return row[column], true, nil
+			case err == nil:
+				line, _ := cr.FieldPos(0)
+				err = fmt.Errorf("line %d: row has %d fields, no column %d", line, len(row), column+1)
+			case errors.As(err, &parseErr):
+				// A malformed row; the reader resumes at the next one if it is skipped.
+			default:
+				return "", false, err
+			}
+			if !cf.skipBad {
+				return "", false, err
+			}
+			report.Skipped++
+		}
+	})
+	report.Elapsed = sbf.options.clock.Now().Sub(start)
+	return report, err
+}
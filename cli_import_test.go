@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// writeKeyFile writes n lines of keys to a file: distinct keys, then the first n/10 of
+// them again.
+func writeKeyFile(t *testing.T, n int) string {
+	t.Helper()
+	distinct := testKeys("import", n-n/10)
+	var b strings.Builder
+	for _, key := range distinct {
+		fmt.Fprintln(&b, key)
+	}
+	for _, key := range distinct[:n/10] {
+		fmt.Fprintln(&b, key)
+	}
+	path := filepath.Join(t.TempDir(), "keys.txt")
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCLIImport(t *testing.T) {
+	const n = 100000
+	input := writeKeyFile(t, n)
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+	run := mustRun(t, exitOK, "", "-json", "import", "-f", path, "-i", input, "-capacity", "10000",
+		"-batch-size", "500", "-progress-interval", "0", "-progress-lines", "25000")
+
+	var report Report
+	if err := json.Unmarshal([]byte(run.stdout), &report); err != nil {
+		t.Fatalf("import -json: %v\n%s", err, run.stdout)
+	}
+	// False positives among the distinct keys count as duplicates; compounded over the
+	// stages they stay below twice the initial rate of 1%.
+	if report.LinesRead != n || report.ItemsAdded+report.Duplicates != n ||
+		report.Duplicates < n/10 || report.Duplicates > n/10+n/50 {
+		t.Errorf("import report %+v, want %d lines of which %d, plus a few false positives, duplicates", report, n, n/10)
+	}
+	sbf, err := loadScalableFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Filters < 3 || report.Filters != len(sbf.filters) || sbf.ItemCount() != uint(report.ItemsAdded) {
+		t.Errorf("report has %d stages and %d items added, saved filter %d and %d",
+			report.Filters, report.ItemsAdded, len(sbf.filters), sbf.ItemCount())
+	}
+	for _, key := range testKeys("import", 100) {
+		if !sbf.MightContain(key) {
+			t.Fatalf("imported filter lacks %q", key)
+		}
+	}
+	// Progress goes to stderr, one JSON line per 25,000 lines.
+	if progress := strings.Count(run.stderr, "\n"); progress < 3 || progress > 4 {
+		t.Errorf("%d progress lines, want one per 25000 lines:\n%s", progress, run.stderr)
+	}
+
+	// The text summary states the same numbers.
+	again := filepath.Join(t.TempDir(), "again.bloom")
+	run = mustRun(t, exitOK, "", "import", "-f", again, "-i", input, "-capacity", "10000", "-progress-interval", "0")
+	summary := regexp.MustCompile(`^100000 lines in \S+ \(\d+ lines/s\): (\d+) added, (\d+) duplicates, (\d+) stages\n$`)
+	if m := summary.FindStringSubmatch(run.stdout); m == nil ||
+		m[1] != fmt.Sprint(report.ItemsAdded) || m[2] != fmt.Sprint(report.Duplicates) || m[3] != fmt.Sprint(report.Filters) {
+		t.Errorf("import summary %q, want the numbers of %+v", run.stdout, report)
+	}
+}
+
+func TestCLIImportStdin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+	run := mustRun(t, exitOK, "a\nb\na\n", "-json", "import", "-f", path, "-i", "-")
+	var report Report
+	if err := json.Unmarshal([]byte(run.stdout), &report); err != nil || report.ItemsAdded != 2 || report.Duplicates != 1 {
+		t.Errorf("import from stdin reported %+v, %v, want 2 added and 1 duplicate", report, err)
+	}
+}
+
+func TestCLIImportCapacityCap(t *testing.T) {
+	input := writeKeyFile(t, 5000)
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+	run := runTestCLI(t, "", "import", "-f", path, "-i", input, "-capacity", "1000", "-max-filters", "1",
+		"-batch-size", "1", "-progress-interval", "0")
+	// Lines that were false positives take no capacity, so a few more than 1000 are read.
+	stopped := regexp.MustCompile(`stopped after (\d+) lines: ` + regexp.QuoteMeta(ErrMaxFilters.Error()))
+	m := stopped.FindStringSubmatch(run.stderr)
+	if run.code != exitError || m == nil {
+		t.Fatalf("import past the sub-filter limit: exit code %d, stderr %q", run.code, run.stderr)
+	}
+	if lines, _ := strconv.Atoi(m[1]); lines < 1000 || lines > 1050 {
+		t.Errorf("stopped after %d lines, want just over the capacity of 1000", lines)
+	}
+	// The keys inserted before the limit are saved.
+	sbf, err := loadScalableFile(path, nil)
+	if err != nil {
+		t.Fatalf("the partial import was not saved: %v", err)
+	}
+	if got := sbf.ItemCount(); got < 990 || got > 1000 {
+		t.Errorf("saved filter holds %d items, want about 1000", got)
+	}
+}
+
+func TestCLIImportWorkers(t *testing.T) {
+	input := writeKeyFile(t, 20000)
+	dir := t.TempDir()
+	var reports []Report
+	for _, workers := range []string{"1", "4"} {
+		path := filepath.Join(dir, "filter-"+workers+".bloom")
+		run := mustRun(t, exitOK, "", "-json", "import", "-f", path, "-i", input, "-capacity", "100000", "-workers", workers)
+		var report Report
+		if err := json.Unmarshal([]byte(run.stdout), &report); err != nil {
+			t.Fatalf("-workers %s: %v\n%s", workers, err, run.stdout)
+		}
+		reports = append(reports, report)
+	}
+	if reports[0].LinesRead != reports[1].LinesRead || reports[0].ItemsAdded+reports[0].Duplicates != reports[1].ItemsAdded+reports[1].Duplicates {
+		t.Errorf("-workers 4 report %+v, want the counts of -workers 1, %+v", reports[1], reports[0])
+	}
+	single, err := loadScalableFile(filepath.Join(dir, "filter-1.bloom"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parallel, err := loadScalableFile(filepath.Join(dir, "filter-4.bloom"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameBits(single, parallel) {
+		t.Error("-workers 4 built a filter with different bits")
+	}
+}
+
+func TestCLIImportUsage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+	for _, args := range [][]string{
+		{"-f", path},
+		{"-f", path, "-i", "-", "-batch-size", "0"},
+		{"-f", path, "-i", "-", "-workers", "0"},
+		{"-f", path, "-i", "-", "-follow"},
+	} {
+		if run := runTestCLI(t, "", append([]string{"import"}, args...)...); run.code != exitUsage {
+			t.Errorf("import %s: exit code %d, want %d", strings.Join(args, " "), run.code, exitUsage)
+		}
+	}
+}
+
+func TestCLICompressedInput(t *testing.T) {
+	plain := "apple\nbanana\napple\n"
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(plain))
+	gw.Close()
+	inputs := map[string]string{
+		"plain": plain,
+		"gzip":  gz.String(),
+		"zstd":  string(zstdBytes(t, []byte(plain))),
+	}
+	for name, input := range inputs {
+		// Compressed data is detected on stdin by its magic bytes.
+		path := filepath.Join(t.TempDir(), "filter.bloom")
+		run := mustRun(t, exitOK, input, "-json", "import", "-f", path, "-i", "-")
+		var report Report
+		if err := json.Unmarshal([]byte(run.stdout), &report); err != nil || report.LinesRead != 3 || report.ItemsAdded != 2 {
+			t.Errorf("%s: import reported %+v, %v, want 3 lines and 2 added", name, report, err)
+		}
+		if run := mustRun(t, exitOK, input, "dedupe"); run.stdout != "apple\nbanana\n" {
+			t.Errorf("%s: dedupe printed %q", name, run.stdout)
+		}
+		if run := mustRun(t, exitCheckPresent, input, "check", "-f", path); run.stdout != "apple\tpresent\nbanana\tpresent\napple\tpresent\n" {
+			t.Errorf("%s: check printed %q", name, run.stdout)
+		}
+	}
+
+	// A corrupt stream fails, stating how far the import got; what was read is saved.
+	keys := testKeys("key", 20000)
+	zst := zstdBytes(t, []byte(strings.Join(keys, "\n")+"\n"))
+	zst[len(zst)-20] ^= 0xff
+	input := filepath.Join(t.TempDir(), "keys.zst")
+	if err := os.WriteFile(input, zst, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+	run := runTestCLI(t, "", "import", "-f", path, "-i", input, "-progress-interval", "0")
+	m := regexp.MustCompile(`stopped after (\d+) lines`).FindStringSubmatch(run.stderr)
+	if run.code != exitError || m == nil {
+		t.Fatalf("import of a corrupt file: exit code %d, stderr %q", run.code, run.stderr)
+	}
+	if lines, _ := strconv.Atoi(m[1]); lines >= len(keys) {
+		t.Errorf("import of a corrupt file stopped after %d of %d lines", lines, len(keys))
+	}
+}
+
+func TestCLIImportCSV(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		column string
+		keys   []string
+	}{
+		{"header name", "user_id", []string{"u1", "u2", "u3", "u4"}},
+		{"index", "2", []string{"Alice", "Bob, Jr."}},
+		{"multiline field", "note", []string{"likes\nnewlines", `she said "hi"`, "multi\nline\nnote"}},
+	} {
+		path := filepath.Join(t.TempDir(), "filter.bloom")
+		run := mustRun(t, exitOK, "", "import", "-f", path, "-i", "testdata/users.csv", "-csv", "-column", tc.column, "-progress-interval", "0")
+		// Five rows after the header, some spanning lines, of which one key repeats for user_id.
+		if !strings.HasPrefix(run.stdout, "5 rows read, 0 skipped in ") {
+			t.Errorf("%s: import summary %q", tc.name, run.stdout)
+		}
+		sbf, err := loadScalableFile(path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range tc.keys {
+			if !sbf.MightContain(key) {
+				t.Errorf("%s: filter lacks %q", tc.name, key)
+			}
+		}
+	}
+	run := mustRun(t, exitOK, "", "import", "-f", filepath.Join(t.TempDir(), "f.bloom"), "-i", "testdata/users.csv",
+		"-csv", "-column", "user_id", "-progress-interval", "0")
+	if !regexp.MustCompile(`: 4 keys added, 1 duplicates, 1 stages\n$`).MatchString(run.stdout) {
+		t.Errorf("import summary %q, want 4 keys added and 1 duplicate", run.stdout)
+	}
+}
+
+func TestCLIImportCSVBadRows(t *testing.T) {
+	args := []string{"-i", "testdata/users_semicolon.csv", "-csv", "-column", "2", "-delimiter", ";", "-no-header", "-progress-interval", "0"}
+
+	// By default the first bad row stops the import; the rows before it are kept.
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+	run := runTestCLI(t, "", append([]string{"import", "-f", path}, args...)...)
+	if run.code != exitError || !strings.Contains(run.stderr, "stopped after 2 rows") || !strings.Contains(run.stderr, "no column 2") {
+		t.Errorf("import with a short row: exit code %d, stderr %q", run.code, run.stderr)
+	}
+	mustRun(t, exitCheckPresent, "", "check", "-f", path, "a;b", "c")
+
+	// With -skip-bad-rows, the short row and the malformed quote are counted instead.
+	path = filepath.Join(t.TempDir(), "filter.bloom")
+	run = mustRun(t, exitOK, "", append([]string{"import", "-f", path, "-skip-bad-rows"}, args...)...)
+	if !strings.HasPrefix(run.stdout, "5 rows read, 2 skipped in ") || !strings.Contains(run.stdout, ": 3 keys added") {
+		t.Errorf("import -skip-bad-rows summary %q, want 5 rows, 2 skipped and 3 keys", run.stdout)
+	}
+	mustRun(t, exitCheckPresent, "a;b\x00c\x00x\ny\x00", "check", "-f", path, "-0")
+
+	for _, bad := range [][]string{
+		{"-column", "user_id"},                 // No -csv
+		{"-csv"},                               // No -column
+		{"-csv", "-column", "x", "-no-header"}, // A name without a header
+		{"-csv", "-column", "1", "-delimiter", `"`},
+		{"-csv", "-column", "1", "-0"},
+	} {
+		run := runTestCLI(t, "", append([]string{"import", "-f", path, "-i", "testdata/users.csv"}, bad...)...)
+		if run.code != exitUsage {
+			t.Errorf("import %s: exit code %d, want %d", strings.Join(bad, " "), run.code, exitUsage)
+		}
+	}
+}
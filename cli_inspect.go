@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// runInspect implements "bloom inspect": it describes a filter file from its header,
+// skipping the bitsets, so it stays fast on files too large to load. A truncated file is
+// described as far as it is readable and then reported as an error.
+func runInspect(env cliEnv, args []string) error {
+	var asJSON bool
+	flags := newFlagSet(env, "inspect", "file")
+	flags.BoolVar(&asJSON, "json", false, "print JSON instead of a table")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("%w: inspect takes exactly one file", errUsage)
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	h, err := InspectHeader(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", flags.Arg(0), err)
+	}
+
+	if asJSON || env.json {
+		err = writeJSON(env.stdout, h)
+	} else {
+		err = writeHeaderTable(env, h)
+	}
+	if err != nil {
+		return err
+	}
+	if h.TruncatedAt > 0 {
+		return fmt.Errorf("%s: header OK, payload truncated at byte %d", flags.Arg(0), h.TruncatedAt)
+	}
+	return nil
+}
+
+// writeHeaderTable prints a Header as a summary followed by one row per stage.
+func writeHeaderTable(env cliEnv, h Header) error {
+	tw := tabwriter.NewWriter(env.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "format\t%s\n", h.Format)
+	fmt.Fprintf(tw, "format version\t%d\n", h.Version)
+	fmt.Fprintf(tw, "compression\t%s\n", orNone(h.Compression))
+	fmt.Fprintf(tw, "hasher\t%s\n", h.Hasher)
+	fmt.Fprintf(tw, "normalizer\t%s\n", orNone(h.Normalizer))
+	if h.Config != nil {
+		fmt.Fprintf(tw, "config\tcapacity=%d fp=%g growth=%g tightening=%g max-filters=%d min-fp=%g\n",
+			h.Config.InitialCapacity, h.Config.InitialFP, h.Config.GrowthFactor, h.Config.TighteningRatio, h.Config.MaxFilters, h.Config.MinFP)
+		fmt.Fprintf(tw, "frozen\t%t\n", h.Frozen)
+	}
+	fmt.Fprintf(tw, "checksum\t%t\n", h.Checksum)
+	fmt.Fprintf(tw, "payload bytes\t%d\n", h.PayloadSize)
+	fmt.Fprintf(tw, "stages\t%d\n", len(h.Stages))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(h.Stages) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(env.stdout)
+	tw = tabwriter.NewWriter(env.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tCREATED\tCAPACITY\tTARGET FP\tBITS\tK\tITEMS")
+	for i, stage := range h.Stages {
+		created := "-"
+		if !stage.Created.IsZero() {
+			created = stage.Created.UTC().Format(time.RFC3339)
+		}
+		targetFP := "-" // Not recorded by format version 1
+		if stage.TargetFP > 0 {
+			targetFP = fmt.Sprintf("%.6g", stage.TargetFP)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%d\t%d\t%d\n",
+			i, created, stage.Capacity, targetFP, stage.BitSize, stage.NumHashFuncs, stage.ItemCount)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCLIInspect(t *testing.T) {
+	for _, file := range []string{"stats_v1.bloom", "stats_v2.bloom", "inspect_v1.bin", "inspect_v2.bin", "inspect.sparse", "inspect.blma"} {
+		run := mustRun(t, exitOK, "", "inspect", filepath.Join("testdata", file))
+		checkGolden(t, "cli_inspect_"+strings.ReplaceAll(file, ".", "_"), run.stdout)
+	}
+
+	run := mustRun(t, exitOK, "", "-json", "inspect", "testdata/inspect_v1.bin")
+	var h Header
+	if err := json.Unmarshal([]byte(run.stdout), &h); err != nil {
+		t.Fatalf("inspect -json: %v\n%s", err, run.stdout)
+	}
+	if h.Format != "binary" || h.Version != 1 || len(h.Stages) != 1 || h.Stages[0].ItemCount != 50 {
+		t.Errorf("inspect -json = %+v, want a version 1 binary filter with one stage of 50 items", h)
+	}
+}
+
+func TestCLIInspectTruncated(t *testing.T) {
+	data, err := os.ReadFile("testdata/stats_v2.bloom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "cut.bloom")
+	if err := os.WriteFile(path, data[:len(data)-100], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := runTestCLI(t, "", "inspect", path)
+	if run.code != exitError {
+		t.Fatalf("inspect of a truncated file: exit code %d, want %d", run.code, exitError)
+	}
+	if want := "header OK, payload truncated at byte " + strconv.Itoa(len(data)-100); !strings.Contains(run.stderr, want) {
+		t.Errorf("inspect of a truncated file: stderr %q, want %q", run.stderr, want)
+	}
+	if !strings.Contains(run.stdout, "format          gob") {
+		t.Errorf("inspect of a truncated file did not describe the readable part:\n%s", run.stdout)
+	}
+
+	run = runTestCLI(t, "", "inspect", "-json", path)
+	var h Header
+	if err := json.Unmarshal([]byte(run.stdout), &h); err != nil || h.TruncatedAt != int64(len(data)-100) {
+		t.Errorf("inspect -json of a truncated file = %+v, %v, want truncated_at %d", h, err, len(data)-100)
+	}
+}
+
+func TestCLIInspectUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{"inspect"},
+		{"inspect", "a", "b"},
+	} {
+		if run := runTestCLI(t, "", args...); run.code != exitUsage {
+			t.Errorf("%q: exit code %d, want %d", args, run.code, exitUsage)
+		}
+	}
+	if run := runTestCLI(t, "", "inspect", filepath.Join(t.TempDir(), "missing")); run.code != exitError {
+		t.Errorf("inspect of a missing file: exit code %d, want %d", run.code, exitError)
+	}
+}
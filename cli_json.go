@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// With the global -json flag, as in "bloom -json check -f filter.bloom apple", every
+// command writes a single JSON document to stdout instead of text, and errors are written
+// to stderr as JSON objects. Import progress is written to stderr as one JSON object per
+// line. The documents are described in the README; they form version jsonSchemaVersion of
+// the schema, which "bloom -json help" reports, and incompatible changes bump it.
+
+// jsonSchemaVersion is the version of the JSON output schema.
+const jsonSchemaVersion = 1
+
+// jsonFlag is the global flag that selects JSON output; "--json" is accepted too.
+const jsonFlag = "-json"
+
+// cliError is an error written to stderr with the global -json flag.
+type cliError struct {
+	SchemaVersion int    `json:"schema_version"`
+	Command       string `json:"command,omitempty"`
+	Error         string `json:"error"`
+	ExitCode      int    `json:"exit_code,omitempty"` // Absent for errors the command continues after
+}
+
+// writeJSON writes v to w as an indented JSON document.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeJSONLine writes v to w as a single line of JSON, for streams of objects.
+func writeJSONLine(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// reportError writes err for the command name to stderr, as a JSON object with the
+// global -json flag or as a "bloom name: err" line otherwise.
+func reportError(env cliEnv, name string, err error, code int) {
+	if env.json {
+		writeJSONLine(env.stderr, cliError{SchemaVersion: jsonSchemaVersion, Command: name, Error: err.Error(), ExitCode: code})
+		return
+	}
+	prefix := "bloom"
+	if name != "" {
+		prefix += " " + name
+	}
+	io.WriteString(env.stderr, prefix+": "+err.Error()+"\n")
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// elapsedField matches the timings in JSON output, which vary from run to run.
+var elapsedField = regexp.MustCompile(`("elapsed_ns": ?)\d+`)
+
+// TestCLIJSONSchemas pins the JSON document of every command that has one, as version 1
+// of the schema. Temporary paths read "DIR" and timings 0 in the goldens.
+func TestCLIJSONSchemas(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "filter.bloom")
+	keys := writeKeys(t, []string{"x", "y", "x"})
+	normalize := func(s string) string {
+		s = strings.ReplaceAll(s, dir, "DIR")
+		s = strings.ReplaceAll(s, filepath.Dir(keys), "KEYS")
+		return elapsedField.ReplaceAllString(s, "${1}0")
+	}
+
+	for _, tc := range []struct {
+		name  string
+		stdin string
+		args  []string
+		code  int
+	}{
+		{"help", "", []string{"help"}, exitOK},
+		{"add", "", []string{"add", "-f", path, "a", "b", "a"}, exitOK},
+		{"check", "", []string{"check", "-f", path, "a", "zz"}, exitCheckAbsent},
+		{"import", "", []string{"import", "-f", path, "-i", keys, "-progress-lines", "2"}, exitOK},
+		{"create", "", []string{"create", "-f", filepath.Join(dir, "created.bloom"), "-capacity", "500"}, exitOK},
+		{"stats", "", []string{"stats", "-f", "testdata/stats_v2.bloom"}, exitOK},
+		{"inspect", "", []string{"inspect", "testdata/inspect_v2.bin"}, exitOK},
+		{"diff", "", []string{"diff", "testdata/diff_primary.bloom", "testdata/diff_replica.bloom"}, exitDiffDifferent},
+		{"merge", "", []string{"merge", "-o", filepath.Join(dir, "merged.bloom"), "testdata/shard-1.bloom", "testdata/shard-2.bloom"}, exitOK},
+		{"convert", "", []string{"convert", "-i", "testdata/stats_v2.bloom", "-o", filepath.Join(dir, "converted.json"), "-to", "json"}, exitOK},
+		{"verify_fp", "", []string{"verify-fp", "-f", "testdata/stats_v2.bloom", "-random", "1000"}, exitOK},
+		{"dedupe", "a\na\nb\n", []string{"dedupe", "-stats"}, exitOK},
+		{"error", "", []string{"check", "-f", filepath.Join(dir, "missing.bloom"), "a"}, exitCheckError},
+		{"usage_error", "", []string{"check", "-nope"}, exitUsage},
+	} {
+		run := runTestCLI(t, tc.stdin, append([]string{"-json"}, tc.args...)...)
+		if run.code != tc.code {
+			t.Errorf("%s: exit code %d, want %d: %s", tc.name, run.code, tc.code, run.stderr)
+		}
+		checkGolden(t, "cli_json_"+tc.name, normalize("stdout:\n"+run.stdout+"stderr:\n"+run.stderr))
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// runMerge implements "bloom merge": it writes the union of filter files to -o. Filters in
+// the binary format are merged with MergeFiles, streaming their bitsets; any other filter
+// files are loaded and merged stage by stage, which requires identical stage layouts unless
+// -allow-scalable-append appends the stages of inputs whose layouts differ. Every input is
+// checked before anything is written, and all incompatible inputs are reported together.
+func runMerge(env cliEnv, args []string) error {
+	var output string
+	var allowAppend bool
+	flags := newFlagSet(env, "merge", "input...")
+	flags.StringVar(&output, "o", "", "merged filter file to write (required)")
+	flags.BoolVar(&allowAppend, "allow-scalable-append", false, "merge filters whose stages differ by appending their stages")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	inputs := flags.Args()
+	switch {
+	case output == "":
+		return fmt.Errorf("%w: -o is required", errUsage)
+	case len(inputs) == 0:
+		return fmt.Errorf("%w: no input files", errUsage)
+	}
+
+	binary, err := allBinaryFilters(inputs)
+	if err != nil {
+		return err
+	}
+	if binary {
+		return mergeBinaryFiles(env, output, inputs)
+	}
+	return mergeScalableFiles(env, output, inputs, allowAppend)
+}
+
+// allBinaryFilters reports whether every file at paths holds a filter in the binary format.
+func allBinaryFilters(paths []string) (bool, error) {
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return false, err
+		}
+		magic, _ := bufio.NewReader(file).Peek(len(filterMagic))
+		file.Close()
+		if !bytes.Equal(magic, filterMagic[:]) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// incompatibleInputs returns the error listing every input that cannot be merged.
+func incompatibleInputs(problems []string) error {
+	return fmt.Errorf("%d of the inputs cannot be merged:\n  %s", len(problems), strings.Join(problems, "\n  "))
+}
+
+// mergeBinaryFiles merges filters in the binary format with MergeFiles after checking
+// every header against the first.
+func mergeBinaryFiles(env cliEnv, output string, inputs []string) error {
+	headers := make([]filterHeader, len(inputs))
+	var problems []string
+	for i, path := range inputs {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		headers[i], err = readHeader(bufio.NewReader(file))
+		file.Close()
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s: %v", path, err))
+		case i > 0 && headers[0].bitSize > 0:
+			if err := headers[0].compatible(headers[i]); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v in %s", path, err, inputs[0]))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return incompatibleInputs(problems)
+	}
+
+	report, err := MergeFiles(output, inputs)
+	if err != nil {
+		return err
+	}
+	result := mergeResult{Output: output, Stages: 1, Inputs: make([]mergeInput, len(inputs))}
+	for i, path := range inputs {
+		result.Items += uint(headers[i].count)
+		result.Inputs[i] = mergeInput{path, 1, uint(headers[i].count), float64(report.SourceSetBits[i]) / float64(headers[i].bitSize), "union"}
+	}
+	// As for merged stages, the count is estimated from the set bits, since the inputs may
+	// share items.
+	if n, err := estimateCardinality(uint(report.SetBits), uint(headers[0].bitSize), uint(headers[0].numHashFuncs)); err == nil {
+		result.Items = uint(math.Round(n))
+	}
+	result.Fill = report.FillRatio
+	result.EstimatedFP = math.Pow(report.FillRatio, float64(headers[0].numHashFuncs))
+	return writeMergeResult(env, result)
+}
+
+// mergeScalableFiles loads filter files of any format and merges them into the first,
+// stage by stage where the stage layout matches the first input's and, with allowAppend,
+// by appending the stages of the others.
+func mergeScalableFiles(env cliEnv, output string, inputs []string, allowAppend bool) error {
+	filters := make([]*ScalableBloomFilter, len(inputs))
+	var problems []string
+	for i, path := range inputs {
+		sbf, _, err := loadAnyFilter(path)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		filters[i] = sbf
+		if i == 0 || filters[0] == nil {
+			continue
+		}
+		if err := mergeCompatible(filters[0], sbf, allowAppend); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v in %s", path, err, inputs[0]))
+		}
+	}
+	if len(problems) > 0 {
+		return incompatibleInputs(problems)
+	}
+
+	// Describe the inputs before merging changes the first one.
+	result := mergeResult{Output: output, Inputs: make([]mergeInput, len(inputs))}
+	base := filters[0]
+	for i, sbf := range filters {
+		stats := sbf.Stats()
+		mode := "base"
+		if i > 0 {
+			mode = "union"
+			if !sameStageLayout(base, sbf) {
+				mode = "append"
+			}
+		}
+		result.Inputs[i] = mergeInput{inputs[i], len(stats.Filters), stats.ItemCount, overallFill(stats), mode}
+	}
+
+	layout := stageLayout(base)
+	for _, sbf := range filters[1:] {
+		if err := mergeInto(base, layout, sbf); err != nil {
+			return err
+		}
+	}
+	if err := base.saveFile(output); err != nil {
+		return err
+	}
+	stats := base.Stats()
+	result.Stages, result.Items = len(stats.Filters), stats.ItemCount
+	result.Fill, result.EstimatedFP = overallFill(stats), stats.EstimatedFP
+	return writeMergeResult(env, result)
+}
+
+// mergeResult is the outcome of "bloom merge", also printed as JSON with the global -json
+// flag.
+type mergeResult struct {
+	Inputs      []mergeInput `json:"inputs"`
+	Output      string       `json:"output"`
+	Stages      int          `json:"stages"`
+	Items       uint         `json:"items"` // Estimated from the set bits where inputs were unioned
+	Fill        float64      `json:"fill"`
+	EstimatedFP float64      `json:"estimated_fp"`
+}
+
+// mergeInput describes an input of "bloom merge".
+type mergeInput struct {
+	Path   string  `json:"path"`
+	Stages int     `json:"stages"`
+	Items  uint    `json:"items"`
+	Fill   float64 `json:"fill"`
+	Merge  string  `json:"merge"` // "base", "union" or "append"
+}
+
+// writeMergeResult prints a table of the inputs followed by a summary of the output.
+func writeMergeResult(env cliEnv, result mergeResult) error {
+	if env.json {
+		return writeJSON(env.stdout, result)
+	}
+	tw := tabwriter.NewWriter(env.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "INPUT\tSTAGES\tITEMS\tFILL\tMERGE")
+	for _, in := range result.Inputs {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.4f\t%s\n", in.Path, in.Stages, in.Items, in.Fill, in.Merge)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	stages := "stages"
+	if result.Stages == 1 {
+		stages = "stage"
+	}
+	fmt.Fprintf(env.stdout, "merged %s: %d %s, about %d items, fill %.4f, estimated fp %.6g\n",
+		result.Output, result.Stages, stages, result.Items, result.Fill, result.EstimatedFP)
+	return nil
+}
+
+// stageLayout returns the bit size and number of hash functions of every stage.
+func stageLayout(sbf *ScalableBloomFilter) [][2]uint {
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+
+	layout := make([][2]uint, len(sbf.filters))
+	for i, filter := range sbf.filters {
+		_, _, layout[i][0], layout[i][1] = filter.Params()
+	}
+	return layout
+}
+
+// sameStageLayout reports whether two filters' stages can be merged bit by bit.
+func sameStageLayout(a, b *ScalableBloomFilter) bool {
+	return slices.Equal(stageLayout(a), stageLayout(b))
+}
+
+// mergeCompatible returns why other cannot be merged into base, or nil.
+func mergeCompatible(base, other *ScalableBloomFilter, allowAppend bool) error {
+	switch {
+	case base.options.hasher.Name() != other.options.hasher.Name():
+		return fmt.Errorf("hasher %s differs from %s", other.options.hasher.Name(), base.options.hasher.Name())
+	case base.options.normalizer.Name() != other.options.normalizer.Name():
+		return fmt.Errorf("key normalizer %q differs from %q", other.options.normalizer.Name(), base.options.normalizer.Name())
+	case base.options.bitOrder != other.options.bitOrder:
+		return errors.New("bit order differs")
+	case !allowAppend && !sameStageLayout(base, other):
+		return fmt.Errorf("stages %s differ from %s; -allow-scalable-append appends them instead",
+			formatLayout(stageLayout(other)), formatLayout(stageLayout(base)))
+	}
+	return nil
+}
+
+// formatLayout describes a stage layout as a list of bits/k pairs.
+func formatLayout(layout [][2]uint) string {
+	stages := make([]string, len(layout))
+	for i, stage := range layout {
+		stages[i] = fmt.Sprintf("%d/%d", stage[0], stage[1])
+	}
+	return "[" + strings.Join(stages, " ") + "]"
+}
+
+// mergeInto merges other into base: stage by stage if other's layout is base's original
+// layout, otherwise by appending other's stages, which base takes over.
+func mergeInto(base *ScalableBloomFilter, layout [][2]uint, other *ScalableBloomFilter) error {
+	otherLayout := stageLayout(other)
+	base.mutex.Lock()
+	defer base.mutex.Unlock()
+	other.mutex.RLock()
+	defer other.mutex.RUnlock()
+
+	if !slices.Equal(otherLayout, layout) {
+		base.filters = append(base.filters, other.filters...)
+		return nil
+	}
+	for i, filter := range other.filters {
+		if err := base.filters[i].Union(filter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// overallFill returns the fraction of set bits across all stages.
+func overallFill(stats Stats) float64 {
+	var set, total float64
+	for _, fs := range stats.Filters {
+		set += fs.FillRatio * float64(fs.BitSize)
+		total += float64(fs.BitSize)
+	}
+	if total == 0 {
+		return 0
+	}
+	return set / total
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The shard fixtures each hold 150 keys "shardN-i" in a filter built with testConfig, so
+// their two stages have the same layout.
+var mergeShards = []string{"testdata/shard-1.bloom", "testdata/shard-2.bloom", "testdata/shard-3.bloom"}
+
+func TestCLIMerge(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "combined.bloom")
+	run := mustRun(t, exitOK, "", append([]string{"-json", "merge", "-o", out}, mergeShards...)...)
+	var result mergeResult
+	if err := json.Unmarshal([]byte(run.stdout), &result); err != nil {
+		t.Fatalf("merge -json: %v\n%s", err, run.stdout)
+	}
+	for i, in := range result.Inputs {
+		want := "union"
+		if i == 0 {
+			want = "base"
+		}
+		if in.Path != mergeShards[i] || in.Items != 150 || in.Merge != want {
+			t.Errorf("input %d = %+v, want %s with 150 items merged as %s", i, in, mergeShards[i], want)
+		}
+	}
+	if result.Stages != 2 || result.Items < 400 || result.Items > 500 {
+		t.Errorf("merged %d stages with about %d items, want 2 and about 450", result.Stages, result.Items)
+	}
+
+	merged, err := loadScalableFile(out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for shard := 1; shard <= 3; shard++ {
+		for _, key := range testKeys(fmt.Sprintf("shard%d", shard), 150) {
+			if !merged.MightContain(key) {
+				t.Fatalf("merged filter misses %q", key)
+			}
+		}
+	}
+
+	run = mustRun(t, exitOK, "", append([]string{"merge", "-o", out}, mergeShards...)...)
+	if !strings.Contains(run.stdout, "merged "+out+": 2 stages, about ") {
+		t.Errorf("merge summary:\n%s", run.stdout)
+	}
+}
+
+func TestCLIMergeIncompatible(t *testing.T) {
+	dir := t.TempDir()
+	fnv := filepath.Join(dir, "fnv.bloom")
+	sbf := newTestFilter(t, testConfig, WithHasher(FNVHasher))
+	addAll(t, sbf, testKeys("fnv", 150))
+	if err := sbf.saveFile(fnv); err != nil {
+		t.Fatal(err)
+	}
+	wide := filepath.Join(dir, "wide.bloom")
+	config := testConfig
+	config.InitialCapacity = 1000
+	sbf = newTestFilter(t, config)
+	addAll(t, sbf, testKeys("wide", 10))
+	if err := sbf.saveFile(wide); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "out.bloom")
+	run := runTestCLI(t, "", "merge", "-o", out, mergeShards[0], fnv, mergeShards[1], wide)
+	if run.code != exitError {
+		t.Fatalf("merge of incompatible inputs: exit code %d, want %d", run.code, exitError)
+	}
+	for _, want := range []string{"2 of the inputs cannot be merged", fnv + ": hasher fnv differs from md5", wide + ": stages"} {
+		if !strings.Contains(run.stderr, want) {
+			t.Errorf("merge of incompatible inputs: stderr lacks %q:\n%s", want, run.stderr)
+		}
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("merge of incompatible inputs wrote its output: %v", err)
+	}
+
+	// Appending takes the filter whose stages differ, but not the other hasher.
+	run = mustRun(t, exitOK, "", "-json", "merge", "-allow-scalable-append", "-o", out, mergeShards[0], wide)
+	var result mergeResult
+	if err := json.Unmarshal([]byte(run.stdout), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Inputs[1].Merge != "append" || result.Stages != 3 {
+		t.Errorf("merge -allow-scalable-append = %+v, want the second input appended, 3 stages", result)
+	}
+	merged, err := loadScalableFile(out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range append(testKeys("shard1", 150), testKeys("wide", 10)...) {
+		if !merged.MightContain(key) {
+			t.Fatalf("appended filter misses %q", key)
+		}
+	}
+	if run := runTestCLI(t, "", "merge", "-allow-scalable-append", "-o", out, mergeShards[0], fnv); run.code != exitError {
+		t.Errorf("merge -allow-scalable-append with another hasher: exit code %d, want %d", run.code, exitError)
+	}
+}
+
+func TestCLIMergeBinary(t *testing.T) {
+	dir := t.TempDir()
+	var inputs []string
+	for shard := 1; shard <= 3; shard++ {
+		bf := NewBloomFilter(1000, 0.01)
+		for _, key := range testKeys(fmt.Sprintf("bin%d", shard), 100) {
+			bf.Add(key)
+		}
+		data, err := bf.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("shard-%d.bin", shard))
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, path)
+	}
+
+	out := filepath.Join(dir, "combined.bin")
+	run := mustRun(t, exitOK, "", append([]string{"-json", "merge", "-o", out}, inputs...)...)
+	var result mergeResult
+	if err := json.Unmarshal([]byte(run.stdout), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Stages != 1 || result.Items < 280 || result.Items > 320 {
+		t.Errorf("merged %d stages with about %d items, want 1 and about 300", result.Stages, result.Items)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, filterMagic[:]) {
+		t.Fatal("merge of binary filters did not write the binary format")
+	}
+	var merged BloomFilter
+	if err := merged.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	for shard := 1; shard <= 3; shard++ {
+		for _, key := range testKeys(fmt.Sprintf("bin%d", shard), 100) {
+			if !merged.MightContain(key) {
+				t.Fatalf("merged filter misses %q", key)
+			}
+		}
+	}
+
+	other := NewBloomFilter(2000, 0.01)
+	data, _ = other.MarshalBinary()
+	bigger := filepath.Join(dir, "bigger.bin")
+	os.WriteFile(bigger, data, 0o644)
+	if run := runTestCLI(t, "", "merge", "-o", out, inputs[0], bigger); run.code != exitError || !strings.Contains(run.stderr, bigger) {
+		t.Errorf("merge of binary filters of different sizes: exit code %d, stderr %q", run.code, run.stderr)
+	}
+}
+
+func TestCLIMergeUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{"merge", mergeShards[0]},
+		{"merge", "-o", filepath.Join(t.TempDir(), "out")},
+	} {
+		if run := runTestCLI(t, "", args...); run.code != exitUsage {
+			t.Errorf("%q: exit code %d, want %d", args, run.code, exitUsage)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// Formats of "bloom stats -format" besides the table and JSON.
+const (
+	formatOpenMetrics = "openmetrics" // OpenMetrics 1.0 text
+	formatPrometheus  = "prometheus"  // Prometheus text exposition format 0.0.4
+)
+
+// writeStatsMetrics writes stats as metrics in the OpenMetrics or, for the node_exporter
+// textfile collector, the Prometheus text format. The two differ only in how counters are
+// declared, the unit metadata and the final "# EOF". The metric names and labels are an
+// interface that dashboards and alerts depend on, so they must not change.
+func writeStatsMetrics(w io.Writer, stats Stats, openMetrics bool) error {
+	bw := bufio.NewWriter(w)
+	family := func(name, typ, unit, help string) {
+		declared := name
+		if typ == "counter" && !openMetrics {
+			declared += "_total"
+		}
+		fmt.Fprintf(bw, "# HELP %s %s\n", declared, help)
+		fmt.Fprintf(bw, "# TYPE %s %s\n", declared, typ)
+		if unit != "" && openMetrics {
+			fmt.Fprintf(bw, "# UNIT %s %s\n", declared, unit)
+		}
+	}
+	value := func(v float64) string {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+
+	family("bloom_items", "counter", "", "Items inserted across all stages, not counting duplicates.")
+	fmt.Fprintf(bw, "bloom_items_total %d\n", stats.ItemCount)
+	family("bloom_stages", "gauge", "", "Number of stages (sub-filters).")
+	fmt.Fprintf(bw, "bloom_stages %d\n", len(stats.Filters))
+	family("bloom_memory_bytes", "gauge", "bytes", "Bytes allocated for the bitsets of all stages.")
+	fmt.Fprintf(bw, "bloom_memory_bytes %d\n", stats.MemoryBytes)
+	family("bloom_fill_ratio", "gauge", "", "Fraction of bits set in each stage.")
+	for i, fs := range stats.Filters {
+		fmt.Fprintf(bw, "bloom_fill_ratio{stage=\"%d\"} %s\n", i, value(fs.FillRatio))
+	}
+	family("bloom_estimated_fp", "gauge", "", "False positive rate across all stages, estimated from their fill.")
+	fmt.Fprintf(bw, "bloom_estimated_fp %s\n", value(stats.EstimatedFP))
+	if openMetrics {
+		fmt.Fprintln(bw, "# EOF")
+	}
+	return bw.Flush()
+}
+
+// writeTextfile atomically replaces path with stats in the Prometheus text format, so the
+// node_exporter textfile collector never reads a partial file. The temporary file starts
+// with a dot and lacks the .prom extension, so the collector ignores it as well.
+func writeTextfile(path string, stats Stats) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		// The exporter usually runs as another user; temporary files are private.
+		if f, ok := w.(*os.File); ok {
+			if err := f.Chmod(0o644); err != nil {
+				return err
+			}
+		}
+		return writeStatsMetrics(w, stats, false)
+	})
+}
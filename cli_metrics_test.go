@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCLIStatsMetrics(t *testing.T) {
+	for _, version := range []string{"v1", "v2"} {
+		path := filepath.Join("testdata", "stats_"+version+".bloom")
+		for _, format := range []string{formatOpenMetrics, formatPrometheus} {
+			run := mustRun(t, exitOK, "", "stats", "-f", path, "-format", format)
+			checkGolden(t, "cli_stats_"+format+"_"+version, run.stdout)
+			checkMetricTypes(t, format, run.stdout)
+		}
+	}
+}
+
+// checkMetricTypes checks that every sample in a metrics exposition belongs to a family
+// declared with a type and help text before it.
+func checkMetricTypes(t *testing.T, format, text string) {
+	t.Helper()
+	types, help := map[string]string{}, map[string]bool{}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		switch {
+		case line == "# EOF":
+			if format != formatOpenMetrics || i != len(lines)-1 {
+				t.Errorf("%s: unexpected # EOF on line %d", format, i+1)
+			}
+		case len(fields) >= 4 && fields[1] == "TYPE":
+			types[fields[2]] = fields[3]
+		case len(fields) >= 4 && fields[1] == "HELP":
+			help[fields[2]] = true
+		case strings.HasPrefix(line, "#"):
+		default:
+			name, _, _ := strings.Cut(fields[0], "{")
+			family := name
+			if format == formatOpenMetrics {
+				family = strings.TrimSuffix(name, "_total")
+			}
+			typ, ok := types[family]
+			switch {
+			case !ok || !help[family]:
+				t.Errorf("%s: sample %q of an undeclared family", format, line)
+			case strings.HasSuffix(name, "_total") != (typ == "counter"):
+				t.Errorf("%s: sample %q of a %s", format, line, typ)
+			}
+		}
+	}
+	if format == formatOpenMetrics && lines[len(lines)-1] != "# EOF" {
+		t.Errorf("%s: output does not end with # EOF", format)
+	}
+}
+
+func TestCLIStatsTextfile(t *testing.T) {
+	dir := t.TempDir()
+	textfile := filepath.Join(dir, "bloom.prom")
+	if err := os.WriteFile(textfile, []byte("stale"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	run := mustRun(t, exitOK, "", "stats", "-f", "testdata/stats_v2.bloom", "-textfile", textfile)
+	if run.stdout != "" {
+		t.Errorf("stats -textfile printed %q", run.stdout)
+	}
+	data, err := os.ReadFile(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "cli_stats_prometheus_v2", string(data))
+
+	// The file is readable by the exporter, and no temporary file is left behind.
+	if info, err := os.Stat(textfile); err != nil || info.Mode().Perm() != 0o644 {
+		t.Errorf("textfile mode = %v, %v, want 0644", info.Mode(), err)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 1 {
+		t.Errorf("textfile directory holds %d entries (%v), want only bloom.prom", len(entries), err)
+	}
+}
+
+// TestCLIStatsTextfileAtomic relies on the textfile being replaced by rename: a reader
+// polling it like the exporter sees either no file or a complete one.
+func TestCLIStatsTextfileAtomic(t *testing.T) {
+	textfile := filepath.Join(t.TempDir(), "bloom.prom")
+	want, err := os.ReadFile("testdata/cli_stats_prometheus_v2.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			data, err := os.ReadFile(textfile)
+			if err == nil && string(data) != string(want) {
+				t.Errorf("read a partial textfile of %d bytes", len(data))
+				return
+			}
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		mustRun(t, exitOK, "", "stats", "-f", "testdata/stats_v2.bloom", "-textfile", textfile)
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestCLIStatsFormatUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{"stats", "-f", "testdata/stats_v2.bloom", "-format", "csv"},
+		{"stats", "-f", "testdata/stats_v2.bloom", "-json", "-format", "openmetrics"},
+		{"-json", "stats", "-f", "testdata/stats_v2.bloom", "-format", "prometheus"},
+	} {
+		if run := runTestCLI(t, "", args...); run.code != exitUsage {
+			t.Errorf("%s: exit code %d, want %d", strings.Join(args, " "), run.code, exitUsage)
+		}
+	}
+	// -format json is the same as -json.
+	a := mustRun(t, exitOK, "", "stats", "-f", "testdata/stats_v2.bloom", "-format", "json")
+	b := mustRun(t, exitOK, "", "stats", "-f", "testdata/stats_v2.bloom", "-json")
+	if a.stdout != b.stdout {
+		t.Errorf("stats -format json printed:\n%s\nstats -json printed:\n%s", a.stdout, b.stdout)
+	}
+}
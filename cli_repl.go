@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// replHelp lists the commands of the REPL.
+const replHelp = `commands:
+  add <key>      insert a key
+  check <key>    print maybe or no
+  explain <key>  show the bits probed for a key in every stage
+  stats          describe the filter
+  save           write the filter file
+  quit           leave, asking to save unsaved changes`
+
+// runREPL implements "bloom repl": an interactive prompt for exploring a filter file.
+// Lines are read without line editing; wrap the command in rlwrap for history.
+func runREPL(env cliEnv, args []string) error {
+	var ff filterFlags
+	var autosave bool
+	flags := newFlagSet(env, "repl", "")
+	ff.register(flags)
+	flags.BoolVar(&autosave, "autosave", false, "save the filter file after every change")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	sbf, err := ff.open(true)
+	if err != nil {
+		return err
+	}
+	return repl(sbf, ff.path, autosave, env.stdin, env.stdout)
+}
+
+// repl runs the REPL command loop on a filter that is saved to path, reading commands
+// from in and writing prompts and results to out. Without autosave, quitting with
+// unsaved changes asks whether to save them first. It returns when the user quits or
+// in is exhausted, and only fails if out does.
+func repl(sbf *ScalableBloomFilter, path string, autosave bool, in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	w := bufio.NewWriter(out)
+	dirty := false
+	save := func() bool {
+		if err := sbf.saveFile(path); err != nil {
+			fmt.Fprintf(w, "error: %v\n", err)
+			return false
+		}
+		dirty = false
+		return true
+	}
+
+	for {
+		fmt.Fprint(w, "bloom> ")
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if !scanner.Scan() {
+			fmt.Fprintln(w)
+			if dirty {
+				fmt.Fprintln(w, "unsaved changes were discarded")
+			}
+			return w.Flush()
+		}
+		command, key, _ := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		key = strings.TrimSpace(key)
+
+		switch command {
+		case "":
+		case "add":
+			if key == "" {
+				fmt.Fprintln(w, "usage: add <key>")
+				break
+			}
+			present, err := sbf.TestAndAdd(key)
+			switch {
+			case err != nil:
+				fmt.Fprintf(w, "error: %v\n", err)
+			case present:
+				fmt.Fprintln(w, "already present (maybe)")
+			default:
+				fmt.Fprintln(w, "added")
+				dirty = true
+				if autosave {
+					save()
+				}
+			}
+		case "check":
+			if key == "" {
+				fmt.Fprintln(w, "usage: check <key>")
+			} else if sbf.MightContain(key) {
+				fmt.Fprintln(w, "maybe")
+			} else {
+				fmt.Fprintln(w, "no")
+			}
+		case "explain":
+			if key == "" {
+				fmt.Fprintln(w, "usage: explain <key>")
+				break
+			}
+			writeExplanation(w, sbf.Explain(key))
+		case "stats":
+			w.Flush()
+			if err := writeStatsTable(cliEnv{stdout: out}, sbf.Stats()); err != nil {
+				return err
+			}
+		case "save":
+			if save() {
+				fmt.Fprintf(w, "saved %s\n", path)
+			}
+		case "quit", "exit":
+			if !dirty || confirmQuit(scanner, w, save) {
+				return w.Flush()
+			}
+		case "help":
+			fmt.Fprintln(w, replHelp)
+		default:
+			fmt.Fprintf(w, "unknown command %q; try help\n", command)
+		}
+	}
+}
+
+// confirmQuit asks whether to save unsaved changes before quitting and reports whether to
+// quit: "y" saves first, "n" discards the changes, and anything else or a failed save
+// cancels.
+func confirmQuit(scanner *bufio.Scanner, w *bufio.Writer, save func() bool) bool {
+	fmt.Fprint(w, "save changes before quitting? [y/n] ")
+	w.Flush()
+	if !scanner.Scan() {
+		fmt.Fprintln(w)
+		return true
+	}
+	switch strings.ToLower(strings.TrimSpace(scanner.Text())) {
+	case "y", "yes":
+		return save()
+	case "n", "no":
+		return true
+	}
+	return false
+}
+
+// writeExplanation prints an Explanation, one line per stage, with each probed index
+// followed by 1 if its bit is set and 0 otherwise.
+func writeExplanation(w io.Writer, e Explanation) {
+	fmt.Fprintf(w, "key %q: hash1=%#08x hash2=%#08x\n", e.Key, e.Hash1, e.Hash2)
+	for i, stage := range e.Stages {
+		set := 0
+		probes := make([]string, len(stage.Indices))
+		for j, index := range stage.Indices {
+			bit := 0
+			if stage.Set[j] {
+				set++
+				bit = 1
+			}
+			probes[j] = fmt.Sprintf("%d=%d", index, bit)
+		}
+		fmt.Fprintf(w, "stage %d: %d of %d bits set: %s\n", i, set, len(stage.Indices), strings.Join(probes, " "))
+	}
+	if e.Present {
+		fmt.Fprintf(w, "verdict: maybe, matched stage %d\n", e.MatchedStage)
+	} else {
+		fmt.Fprintln(w, "verdict: no")
+	}
+}
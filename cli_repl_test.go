@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-bloom-filter/bloomtest"
+)
+
+// runREPLScript runs the REPL on sbf with the script as input and returns its output.
+func runREPLScript(t *testing.T, sbf *ScalableBloomFilter, path string, autosave bool, script string) string {
+	t.Helper()
+	var out strings.Builder
+	if err := repl(sbf, path, autosave, strings.NewReader(script), &out); err != nil {
+		t.Fatalf("repl: %v", err)
+	}
+	return out.String()
+}
+
+func TestREPLSession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+	clock := bloomtest.NewFakeClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	sbf := newTestFilter(t, testConfig, WithClock(clock))
+	script := strings.Join([]string{
+		"help",
+		"add apple",
+		"add apple",
+		"  add   banana split  ",
+		"check apple",
+		"check banana split",
+		"check cherry",
+		"add",
+		"check",
+		"explain apple",
+		"explain cherry",
+		"",
+		"frobnicate",
+		"stats",
+		"save",
+		"quit",
+	}, "\n") + "\n"
+	// The saved file's name differs between runs.
+	out := strings.ReplaceAll(runREPLScript(t, sbf, path, false, script), path, "FILTER")
+	checkGolden(t, "repl_session", out)
+
+	saved, err := loadScalableFile(path, nil)
+	if err != nil {
+		t.Fatalf("save did not write the filter: %v", err)
+	}
+	if !saved.MightContain("apple") || !saved.MightContain("banana split") {
+		t.Error("saved filter lacks the added keys")
+	}
+}
+
+func TestREPLUnsavedChanges(t *testing.T) {
+	dir := t.TempDir()
+
+	// Any answer but y or n cancels quitting; n discards the changes.
+	path := filepath.Join(dir, "discard.bloom")
+	out := runREPLScript(t, newTestFilter(t, testConfig), path, false, "add x\nquit\nmaybe\nquit\nn\ncheck x\n")
+	if strings.Count(out, "save changes before quitting? [y/n] ") != 2 || strings.Contains(out, "maybe\n") {
+		t.Errorf("quit with unsaved changes printed:\n%s", out)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("declining to save wrote the filter file")
+	}
+
+	// y saves first.
+	path = filepath.Join(dir, "save.bloom")
+	runREPLScript(t, newTestFilter(t, testConfig), path, false, "add x\nquit\ny\n")
+	if sbf, err := loadScalableFile(path, nil); err != nil || !sbf.MightContain("x") {
+		t.Errorf("saving on quit: %v", err)
+	}
+
+	// Quitting without changes, or after saving them, does not ask.
+	if out := runREPLScript(t, newTestFilter(t, testConfig), path, false, "check x\nquit\n"); strings.Contains(out, "save changes") {
+		t.Errorf("quit without changes asked to save:\n%s", out)
+	}
+	if out := runREPLScript(t, newTestFilter(t, testConfig), path, false, "add x\nsave\nquit\n"); strings.Contains(out, "save changes") {
+		t.Errorf("quit after saving asked to save:\n%s", out)
+	}
+
+	// The end of input quits, saying what was lost.
+	if out := runREPLScript(t, newTestFilter(t, testConfig), path, false, "add y\n"); !strings.HasSuffix(out, "unsaved changes were discarded\n") {
+		t.Errorf("end of input with unsaved changes printed:\n%s", out)
+	}
+}
+
+func TestREPLAutosave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+	out := runREPLScript(t, newTestFilter(t, testConfig), path, true, "add x\nquit\n")
+	if strings.Contains(out, "save changes") || strings.Contains(out, "error") {
+		t.Errorf("autosaving REPL printed:\n%s", out)
+	}
+	if sbf, err := loadScalableFile(path, nil); err != nil || !sbf.MightContain("x") {
+		t.Errorf("autosave did not write the added key: %v", err)
+	}
+}
+
+func TestCLIREPL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+	mustRun(t, exitOK, "", "add", "-f", path, "existing")
+	run := mustRun(t, exitOK, "check existing\nadd new\nsave\nquit\n", "repl", "-f", path)
+	if !strings.HasPrefix(run.stdout, "bloom> maybe\nbloom> added\n") {
+		t.Errorf("repl printed %q", run.stdout)
+	}
+	mustRun(t, exitCheckPresent, "", "check", "-f", path, "existing", "new")
+}
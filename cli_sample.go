@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// runSample implements "bloom sample": it reads up to -lines records of an input, estimates
+// how many distinct keys the whole input holds, and recommends a Config from OptimalConfig
+// for each -fp, with the stages and memory it projects. A sample that stops before the end
+// of a file is extrapolated from the share of the file's bytes it covered.
+func runSample(env cliEnv, args []string) error {
+	var input, fpList string
+	var lines int
+	var nul, asJSON bool
+	flags := newFlagSet(env, "sample", "")
+	flags.StringVar(&input, "i", "", `input file of keys, "-" for stdin (required)`)
+	flags.IntVar(&lines, "lines", 1000000, "read at most this many records, 0 for the whole input")
+	flags.StringVar(&fpList, "fp", "0.01,0.001", "comma-separated target false positive rates to recommend a configuration for")
+	flags.BoolVar(&nul, "0", false, nulFlagUsage)
+	flags.BoolVar(&asJSON, "json", false, "print JSON instead of a summary")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	switch {
+	case input == "":
+		return fmt.Errorf("%w: -i is required", errUsage)
+	case lines < 0:
+		return fmt.Errorf("%w: -lines must not be negative", errUsage)
+	case flags.NArg() > 0:
+		return fmt.Errorf("%w: unexpected arguments %q", errUsage, flags.Args())
+	}
+	var fps []float64
+	for _, s := range strings.Split(fpList, ",") {
+		fp, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil || fp <= 0 || fp >= 1 {
+			return fmt.Errorf("%w: invalid false positive rate %q: must be between 0 and 1", errUsage, s)
+		}
+		fps = append(fps, fp)
+	}
+
+	result, err := sampleInput(env, input, lines, recordDelim(nul))
+	if err != nil {
+		return err
+	}
+	for _, fp := range fps {
+		rec, err := recommendConfig(int(math.Ceil(result.Distinct)), fp)
+		if err != nil {
+			return err
+		}
+		result.Recommendations = append(result.Recommendations, rec)
+	}
+	if asJSON || env.json {
+		return writeJSON(env.stdout, result)
+	}
+	return writeSampleResult(env, result)
+}
+
+// sampleResult is the outcome of "bloom sample", also printed with -json. Records and
+// Distinct are projected for the whole input; the Sample fields describe what was read.
+type sampleResult struct {
+	Input           string                 `json:"input"`
+	Complete        bool                   `json:"complete"`         // Whether the whole input was read
+	SampleRecords   int                    `json:"sample_records"`   // Non-empty records read
+	SampleDistinct  float64                `json:"sample_distinct"`  // Estimated distinct keys among them
+	SampleBytes     int64                  `json:"sample_bytes"`     // Bytes of the input read, compressed if it is
+	InputBytes      int64                  `json:"input_bytes"`      // Size of the input file, 0 if unknown
+	Records         float64                `json:"records"`          // Projected records in the whole input
+	Distinct        float64                `json:"distinct"`         // Projected distinct keys in the whole input
+	AvgKeyBytes     float64                `json:"avg_key_bytes"`    // Mean length of a record, without its delimiter
+	DuplicationRate float64                `json:"duplication_rate"` // Share of records repeating an earlier key
+	Assumption      string                 `json:"assumption,omitempty"`
+	Recommendations []sampleRecommendation `json:"recommendations"`
+}
+
+// sampleRecommendation is the Config recommended for one target false positive rate.
+type sampleRecommendation struct {
+	TargetFP    float64     `json:"target_fp"`
+	Config      Config      `json:"config"`
+	Stages      []StagePlan `json:"stages"`       // Sub-filters allocated for the projected distinct keys
+	MemoryBytes int         `json:"memory_bytes"` // Bytes of their bitsets
+}
+
+// sampleInput reads up to limit records of the input at path, or all of them if limit is
+// 0, and projects what it finds onto the whole input. The bytes read are counted before
+// decompression, so that compressed files are extrapolated by their size on disk too.
+func sampleInput(env cliEnv, path string, limit int, delim byte) (sampleResult, error) {
+	result := sampleResult{Input: path, Recommendations: []sampleRecommendation{}}
+	var raw *countingReader
+	var in, buffered *bufio.Reader
+	if path == "-" {
+		stdin, closeStdin, err := decompressStdin(env)
+		if err != nil {
+			return result, err
+		}
+		defer closeStdin()
+		in = bufio.NewReader(stdin)
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return result, err
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return result, err
+		}
+		if info.Mode().IsRegular() {
+			result.InputBytes = info.Size()
+		}
+		raw = &countingReader{r: file}
+		buffered = bufio.NewReader(raw)
+		decompressed, closeReader, err := maybeDecompress(buffered, path)
+		if err != nil {
+			return result, err
+		}
+		defer closeReader()
+		in = decompressed
+	}
+
+	hll := newHyperLogLog()
+	var keyBytes int64
+	for limit == 0 || result.SampleRecords < limit {
+		line, err := in.ReadString(delim)
+		if record := trimRecord(line, delim); record != "" {
+			hll.add(record)
+			keyBytes += int64(len(record))
+			result.SampleRecords++
+		}
+		if err == io.EOF {
+			result.Complete = true
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("stopped after %d records: %w", result.SampleRecords, err)
+		}
+	}
+	if !result.Complete {
+		_, err := in.Peek(1)
+		result.Complete = err == io.EOF
+	}
+	if raw != nil {
+		result.SampleBytes = raw.n - int64(buffered.Buffered())
+	}
+	if result.SampleRecords == 0 {
+		return result, nil
+	}
+
+	n := float64(result.SampleRecords)
+	result.SampleDistinct = min(math.Round(hll.estimate()), n)
+	result.AvgKeyBytes = float64(keyBytes) / n
+	result.DuplicationRate = 1 - result.SampleDistinct/n
+	result.Records, result.Distinct = n, result.SampleDistinct
+	switch {
+	case result.Complete:
+	case result.InputBytes > 0 && result.SampleBytes > 0:
+		share := min(float64(result.SampleBytes)/float64(result.InputBytes), 1)
+		result.Records = math.Round(n / share)
+		result.Distinct = math.Round(result.Records * (1 - result.DuplicationRate))
+		result.Assumption = fmt.Sprintf("the sample covers %.1f%% of the file's bytes, and the rest is assumed to hold records of the same length that repeat earlier keys as often; "+
+			"keys recurring throughout the file make the distinct count an overestimate, keys that only appear later an underestimate", 100*share)
+	default:
+		result.Assumption = "the size of the input is unknown, so the figures describe the sample only; use -lines 0 to read the whole input"
+	}
+	return result, nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// recommendConfig returns OptimalConfig for distinct keys at targetFP, with the sub-filters
+// a filter created with it allocates to hold them.
+func recommendConfig(distinct int, targetFP float64) (sampleRecommendation, error) {
+	config := OptimalConfig(distinct, targetFP)
+	sbf, err := NewScalableBloomFilter(config)
+	if err != nil {
+		return sampleRecommendation{}, err
+	}
+	stages, err := sbf.ExpectAdditional(distinct)
+	if err != nil {
+		return sampleRecommendation{}, err
+	}
+	rec := sampleRecommendation{TargetFP: targetFP, Config: config, Stages: stages}
+	for _, stage := range stages {
+		rec.MemoryBytes += stage.Bytes
+	}
+	return rec, nil
+}
+
+// writeSampleResult prints the estimates, the assumption behind them if any, and a table
+// of the recommendations followed by the matching "bloom create" commands.
+func writeSampleResult(env cliEnv, r sampleResult) error {
+	scope := "the whole input"
+	if !r.Complete {
+		scope = "a sample"
+	}
+	fmt.Fprintf(env.stdout, "%s: read %d records, %s\n", r.Input, r.SampleRecords, scope)
+	if r.SampleRecords == 0 {
+		_, err := fmt.Fprintln(env.stdout, "no keys to estimate from")
+		return err
+	}
+	tw := tabwriter.NewWriter(env.stdout, 0, 0, 2, ' ', 0)
+	if r.Complete || r.Records == float64(r.SampleRecords) {
+		fmt.Fprintf(tw, "  records\t%d\n", r.SampleRecords)
+		fmt.Fprintf(tw, "  distinct keys\t~%.0f\n", r.Distinct)
+	} else {
+		fmt.Fprintf(tw, "  records\t%d sampled, ~%.0f in total\n", r.SampleRecords, r.Records)
+		fmt.Fprintf(tw, "  distinct keys\t~%.0f sampled, ~%.0f in total\n", r.SampleDistinct, r.Distinct)
+	}
+	fmt.Fprintf(tw, "  key length\t%.1f bytes on average\n", r.AvgKeyBytes)
+	fmt.Fprintf(tw, "  duplication\t%.1f%% of records repeat an earlier key\n", 100*r.DuplicationRate)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if r.Assumption != "" {
+		fmt.Fprintf(env.stdout, "assuming %s\n", r.Assumption)
+	}
+	fmt.Fprintln(env.stdout)
+
+	tw = tabwriter.NewWriter(env.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TARGET FP\tCAPACITY\tINITIAL FP\tGROWTH\tTIGHTENING\tSTAGES\tBYTES")
+	for _, rec := range r.Recommendations {
+		c := rec.Config
+		fmt.Fprintf(tw, "%g\t%d\t%g\t%g\t%g\t%d\t%d\n",
+			rec.TargetFP, c.InitialCapacity, c.InitialFP, c.GrowthFactor, c.TighteningRatio, len(rec.Stages), rec.MemoryBytes)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(env.stdout)
+	for _, rec := range r.Recommendations {
+		c := rec.Config
+		if _, err := fmt.Fprintf(env.stdout, "bloom create -f FILE -capacity %d -fp %g -growth %g -tightening %g\n",
+			c.InitialCapacity, c.InitialFP, c.GrowthFactor, c.TighteningRatio); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeSampleInput writes records fixed-width keys, cycling through distinct of them, and
+// returns the path.
+func writeSampleInput(t *testing.T, records, distinct int) string {
+	t.Helper()
+	var b strings.Builder
+	for i := 0; i < records; i++ {
+		fmt.Fprintf(&b, "key-%06d\n", i%distinct)
+	}
+	path := filepath.Join(t.TempDir(), "keys.txt")
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// runSampleJSON runs "sample -json" and returns its result.
+func runSampleJSON(t *testing.T, stdin string, args ...string) sampleResult {
+	t.Helper()
+	run := mustRun(t, exitOK, stdin, append([]string{"sample", "-json"}, args...)...)
+	var result sampleResult
+	if err := json.Unmarshal([]byte(run.stdout), &result); err != nil {
+		t.Fatalf("sample -json: %v\n%s", err, run.stdout)
+	}
+	return result
+}
+
+// within reports whether got is within a fraction tolerance of want.
+func within(got, want, tolerance float64) bool {
+	return math.Abs(got-want) <= tolerance*want
+}
+
+func TestCLISampleWhole(t *testing.T) {
+	path := writeSampleInput(t, 20000, 5000)
+	r := runSampleJSON(t, "", "-i", path)
+	if !r.Complete || r.Assumption != "" || r.SampleRecords != 20000 || r.Records != 20000 {
+		t.Errorf("sample of a whole file = %+v, want all 20000 records read without assumptions", r)
+	}
+	if !within(r.Distinct, 5000, 0.04) || r.Distinct != r.SampleDistinct {
+		t.Errorf("sample estimated %g distinct keys, want about 5000", r.Distinct)
+	}
+	if !within(r.DuplicationRate, 0.75, 0.02) || r.AvgKeyBytes != 10 {
+		t.Errorf("sample found %.3f duplication and %g-byte keys, want 0.75 and 10", r.DuplicationRate, r.AvgKeyBytes)
+	}
+	if info, _ := os.Stat(path); r.SampleBytes != info.Size() || r.InputBytes != info.Size() {
+		t.Errorf("sample read %d of %d bytes, want all %d", r.SampleBytes, r.InputBytes, info.Size())
+	}
+
+	// One recommendation per rate, from OptimalConfig, allocating a single stage.
+	if len(r.Recommendations) != 2 {
+		t.Fatalf("sample made %d recommendations, want one for each default rate", len(r.Recommendations))
+	}
+	for i, fp := range []float64{0.01, 0.001} {
+		rec := r.Recommendations[i]
+		want := OptimalConfig(int(math.Ceil(r.Distinct)), fp)
+		if rec.TargetFP != fp || rec.Config != want || len(rec.Stages) != 1 || rec.MemoryBytes != rec.Stages[0].Bytes {
+			t.Errorf("recommendation %d = %+v, want %+v in one stage", i, rec, want)
+		}
+	}
+}
+
+func TestCLISampleExtrapolates(t *testing.T) {
+	// All keys are distinct and equally long, so a tenth of the records projects exactly.
+	path := writeSampleInput(t, 100000, 100000)
+	r := runSampleJSON(t, "", "-i", path, "-lines", "10000", "-fp", "0.05")
+	if r.Complete || r.SampleRecords != 10000 {
+		t.Fatalf("sample -lines 10000 = %+v, want an incomplete sample of 10000 records", r)
+	}
+	if r.Records != 100000 || !within(r.Distinct, 100000, 0.04) {
+		t.Errorf("sample projected %g records and %g distinct keys, want 100000 of each", r.Records, r.Distinct)
+	}
+	if r.SampleBytes != 110000 || !strings.Contains(r.Assumption, "10.0% of the file's bytes") {
+		t.Errorf("sample read %d bytes, assuming %q", r.SampleBytes, r.Assumption)
+	}
+	if len(r.Recommendations) != 1 || r.Recommendations[0].Config.InitialCapacity != int(math.Ceil(r.Distinct)) {
+		t.Errorf("recommendations = %+v, want one sized for the projected keys", r.Recommendations)
+	}
+
+	// A sample that reaches the end of the file is complete.
+	if r := runSampleJSON(t, "", "-i", path, "-lines", "100000"); !r.Complete || r.Assumption != "" {
+		t.Errorf("sample of exactly every record = %+v, want it complete", r)
+	}
+}
+
+func TestCLISampleStdin(t *testing.T) {
+	var b strings.Builder
+	for _, key := range testKeys("stdin", 3000) {
+		fmt.Fprintln(&b, key)
+	}
+	// Stdin has no size to extrapolate from, so the sample describes itself.
+	r := runSampleJSON(t, b.String(), "-i", "-", "-lines", "1000")
+	if r.Complete || r.Records != 1000 || r.InputBytes != 0 || !strings.Contains(r.Assumption, "size of the input is unknown") {
+		t.Errorf("sample of stdin = %+v, want 1000 records and the unknown size stated", r)
+	}
+	if r := runSampleJSON(t, b.String(), "-i", "-", "-lines", "0"); !r.Complete || !within(r.Distinct, 3000, 0.04) {
+		t.Errorf("sample -lines 0 of stdin = %+v, want about 3000 distinct keys", r)
+	}
+}
+
+func TestCLISampleText(t *testing.T) {
+	path := writeSampleInput(t, 20000, 20000)
+	run := mustRun(t, exitOK, "", "sample", "-i", path, "-lines", "2000", "-fp", "0.01")
+	for _, want := range []string{
+		path + ": read 2000 records, a sample\n",
+		"  records        2000 sampled, ~20000 in total\n",
+		"  key length     10.0 bytes on average\n",
+		"assuming the sample covers 10.0% of the file's bytes",
+		"TARGET FP  CAPACITY",
+		"bloom create -f FILE -capacity ",
+	} {
+		if !strings.Contains(run.stdout, want) {
+			t.Errorf("sample printed:\n%s\nwant it to contain %q", run.stdout, want)
+		}
+	}
+
+	run = mustRun(t, exitOK, "\n\n", "sample", "-i", "-")
+	if want := "-: read 0 records, the whole input\nno keys to estimate from\n"; run.stdout != want {
+		t.Errorf("sample of empty input printed %q, want %q", run.stdout, want)
+	}
+}
+
+func TestCLISampleUsage(t *testing.T) {
+	path := writeSampleInput(t, 10, 10)
+	for _, args := range [][]string{
+		{"sample"},
+		{"sample", "-i", path, "-lines", "-1"},
+		{"sample", "-i", path, "-fp", "0"},
+		{"sample", "-i", path, "-fp", "0.01,x"},
+		{"sample", "-i", path, "extra"},
+	} {
+		if run := runTestCLI(t, "", args...); run.code != exitUsage {
+			t.Errorf("%s: exit code %d, want %d", strings.Join(args, " "), run.code, exitUsage)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+)
+
+// runStats implements "bloom stats": it prints the Stats snapshot of a filter file as a
+// table, as JSON with -json, or as metrics with -format. With -textfile the metrics are
+// written to a file for the node_exporter textfile collector instead. The filter file is
+// only read, so read-only files work too, and files in every format version load.
+//
+// No lock is taken: everything in this package that writes a filter file, such as
+// saveFile, autosave and Manager snapshots, writes a temporary file and renames it into
+// place. A concurrent stats therefore reads either the complete old file or the complete
+// new one, never a partial write.
+func runStats(env cliEnv, args []string) error {
+	var path, format, textfile string
+	var asJSON bool
+	flags := newFlagSet(env, "stats", "")
+	flags.StringVar(&path, "f", "", "filter file (required)")
+	flags.BoolVar(&asJSON, "json", false, "print JSON instead of a table; same as -format json")
+	flags.StringVar(&format, "format", "table", "table, json, openmetrics or prometheus")
+	flags.StringVar(&textfile, "textfile", "", "atomically write Prometheus metrics to this file, such as a .prom file for node_exporter, instead of printing")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if asJSON || env.json {
+		if format != "table" && format != "json" {
+			return fmt.Errorf("%w: -json conflicts with -format %s", errUsage, format)
+		}
+		format = "json"
+	}
+	switch format {
+	case "table", "json", formatOpenMetrics, formatPrometheus:
+	default:
+		return fmt.Errorf("%w: unknown -format %q", errUsage, format)
+	}
+	ff := filterFlags{path: path}
+	sbf, err := ff.open(false)
+	if err != nil {
+		return err
+	}
+	stats := sbf.Stats()
+
+	if textfile != "" {
+		return writeTextfile(textfile, stats)
+	}
+	switch format {
+	case "json":
+		return writeJSON(env.stdout, stats)
+	case formatOpenMetrics, formatPrometheus:
+		return writeStatsMetrics(env.stdout, stats, format == formatOpenMetrics)
+	}
+	return writeStatsTable(env, stats)
+}
+
+// writeStatsTable prints stats as a summary followed by one row per sub-filter.
+func writeStatsTable(env cliEnv, stats Stats) error {
+	tw := tabwriter.NewWriter(env.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "format version\t%d\n", stats.FormatVersion)
+	fmt.Fprintf(tw, "hasher\t%s\n", stats.Hasher)
+	fmt.Fprintf(tw, "normalizer\t%s\n", orNone(stats.Normalizer))
+	fmt.Fprintf(tw, "frozen\t%t\n", stats.Frozen)
+	fmt.Fprintf(tw, "items\t%d\n", stats.ItemCount)
+	fmt.Fprintf(tw, "memory bytes\t%d\n", stats.MemoryBytes)
+	fmt.Fprintf(tw, "estimated fp\t%.6g\n", stats.EstimatedFP)
+	fmt.Fprintf(tw, "stages\t%d\n", len(stats.Filters))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(stats.Filters) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(env.stdout)
+	tw = tabwriter.NewWriter(env.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tCREATED\tCAPACITY\tTARGET FP\tBITS\tK\tITEMS\tFILL\tEST FP")
+	for i, fs := range stats.Filters {
+		created := "-"
+		if !fs.Created.IsZero() {
+			created = fs.Created.UTC().Format(time.RFC3339)
+		}
+		targetFP := "-" // Not recorded by format version 1
+		if fs.TargetFP > 0 {
+			targetFP = fmt.Sprintf("%.6g", fs.TargetFP)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%d\t%d\t%d\t%.4f\t%.6g\n",
+			i, created, fs.Capacity, targetFP, fs.BitSize, fs.NumHashFuncs, fs.ItemCount, fs.FillRatio, fs.EstimatedFP)
+	}
+	return tw.Flush()
+}
+
+// orNone returns s, or "none" if it is empty.
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
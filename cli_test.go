@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// cliRun is the outcome of a command run by runTestCLI.
+type cliRun struct {
+	code           int
+	stdout, stderr string
+}
+
+// runTestCLI runs the command line tool with args and stdin and returns its exit code and
+// output.
+func runTestCLI(t *testing.T, stdin string, args ...string) cliRun {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	env := cliEnv{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr}
+	code := runCLI(env, args)
+	return cliRun{code, stdout.String(), stderr.String()}
+}
+
+// mustRun runs the command line tool like runTestCLI and fails the test unless it exits
+// with want.
+func mustRun(t *testing.T, want int, stdin string, args ...string) cliRun {
+	t.Helper()
+	run := runTestCLI(t, stdin, args...)
+	if run.code != want {
+		t.Fatalf("bloom %s: exit code %d, want %d\nstdout: %s\nstderr: %s",
+			strings.Join(args, " "), run.code, want, run.stdout, run.stderr)
+	}
+	return run
+}
+
+// checkGolden compares got with the file testdata/name.golden, or rewrites the file with
+// got when the tests run with -update.
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v; run the tests with -update to create it", err)
+	}
+	if got != string(want) {
+		t.Errorf("output differs from %s:\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func TestCLIAddCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+
+	// The first add creates the file.
+	run := mustRun(t, exitOK, "", "add", "-f", path, "apple", "banana", "apple")
+	if run.stdout != "2 of 3 items were new\n" {
+		t.Errorf("add output %q", run.stdout)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("add did not create the filter file: %v", err)
+	}
+	// Items are read from stdin without arguments, ignoring empty lines and CRs.
+	run = mustRun(t, exitOK, "cherry\r\n\nbanana\n", "add", "-f", path)
+	if run.stdout != "1 of 2 items were new\n" {
+		t.Errorf("add from stdin output %q", run.stdout)
+	}
+
+	run = mustRun(t, exitCheckAbsent, "", "check", "-f", path, "apple", "cherry", "durian")
+	checkGolden(t, "cli_check", run.stdout)
+	mustRun(t, exitCheckPresent, "", "check", "-f", path, "apple", "banana", "cherry")
+	mustRun(t, exitCheckPresent, "", "check", "-f", path, "-any", "durian", "apple")
+	if run := mustRun(t, exitCheckAbsent, "", "check", "-f", path, "-q", "durian"); run.stdout != "" {
+		t.Errorf("check -q printed %q", run.stdout)
+	}
+	run = mustRun(t, exitCheckAbsent, "apple\x00durian\x00", "check", "-f", path, "-0")
+	if run.stdout != "apple\tpresent\x00durian\tabsent\x00" {
+		t.Errorf("check -0 output %q", run.stdout)
+	}
+
+	// Saving replaces the file atomically and leaves no temporary files behind.
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("directory holds %d entries, %v, want only the filter file", len(entries), err)
+	}
+}
+
+func TestCLIAddConfig(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.json")
+	err := os.WriteFile(config, []byte(`{"initial_fp": 0.001, "growth_factor": 4, "tightening_ratio": 0.8, "initial_capacity": 50}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "filter.bloom")
+	mustRun(t, exitOK, "", "add", "-f", path, "-config", config, "-hash", "fnv", "item")
+
+	sbf, err := loadScalableFile(path, nil)
+	if err != nil {
+		t.Fatalf("loading the created filter: %v", err)
+	}
+	if want := (Config{InitialFP: 0.001, GrowthFactor: 4, TighteningRatio: 0.8, InitialCapacity: 50}); sbf.Config() != want {
+		t.Errorf("created filter has config %+v, want %+v", sbf.Config(), want)
+	}
+	if sbf.options.hasher.Name() != "fnv" {
+		t.Errorf("created filter uses %s, want fnv", sbf.options.hasher.Name())
+	}
+	// An existing file keeps its configuration whatever the flags say.
+	mustRun(t, exitOK, "", "add", "-f", path, "-fp", "0.1", "other")
+	if sbf, _ := loadScalableFile(path, nil); sbf.Config().InitialFP != 0.001 {
+		t.Errorf("adding to an existing file changed its configuration to %+v", sbf.Config())
+	}
+}
+
+func TestCLIErrors(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.bloom")
+	for _, tc := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"add", "item"}, exitUsage},                 // No -f
+		{[]string{"add", "-f", missing, "-nope"}, exitUsage}, // Unknown flag
+		{[]string{"add", "-f", missing, "-hash", "crc", "x"}, exitUsage},
+		{[]string{"check", "-f", missing, "item"}, exitCheckError},
+		{[]string{"frobnicate"}, exitUsage},
+		{nil, exitUsage},
+	} {
+		run := runTestCLI(t, "", tc.args...)
+		if run.code != tc.code || run.stderr == "" {
+			t.Errorf("bloom %s: exit code %d with stderr %q, want %d and an error message",
+				strings.Join(tc.args, " "), run.code, run.stderr, tc.code)
+		}
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Error("a failed command created the filter file")
+	}
+}
+
+func TestCLIHelp(t *testing.T) {
+	checkGolden(t, "cli_help", mustRun(t, exitOK, "", "help").stderr)
+	if run := mustRun(t, exitOK, "", "add", "-h"); !strings.Contains(run.stderr, "usage: bloom add") {
+		t.Errorf("add -h printed %q", run.stderr)
+	}
+}
+
+func TestCLICheckExitStatus(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "filter.bloom")
+	mustRun(t, exitOK, "", "add", "-f", path, "a", "b")
+	corrupt := filepath.Join(dir, "corrupt.bloom")
+	if err := os.WriteFile(corrupt, []byte("not a filter"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		items    []string
+		all, any int // Exit codes without and with -any
+	}{
+		{[]string{"a"}, exitCheckPresent, exitCheckPresent},
+		{[]string{"a", "b"}, exitCheckPresent, exitCheckPresent},
+		{[]string{"a", "x"}, exitCheckAbsent, exitCheckPresent},
+		{[]string{"x", "a"}, exitCheckAbsent, exitCheckPresent},
+		{[]string{"x"}, exitCheckAbsent, exitCheckAbsent},
+		{[]string{"x", "y"}, exitCheckAbsent, exitCheckAbsent},
+	} {
+		for _, quiet := range []bool{false, true} {
+			for _, anyPresent := range []bool{false, true} {
+				args := []string{"check", "-f", path}
+				want := tc.all
+				if quiet {
+					args = append(args, "-q")
+				}
+				if anyPresent {
+					args = append(args, "-any")
+					want = tc.any
+				}
+				run := mustRun(t, want, "", append(args, tc.items...)...)
+				if lines := strings.Count(run.stdout, "\n"); (quiet && run.stdout != "") || (!quiet && lines != len(tc.items)) {
+					t.Errorf("bloom %s printed %q", strings.Join(append(args, tc.items...), " "), run.stdout)
+				}
+			}
+		}
+	}
+
+	// Operational errors exit 2 whatever the flags, and -q keeps stdout empty.
+	for _, args := range [][]string{
+		{"-f", filepath.Join(dir, "missing.bloom"), "a"},
+		{"-f", corrupt, "a"},
+		{"-f", corrupt, "-q", "-any", "a"},
+		{"-f", path, "-nope", "a"},
+	} {
+		run := mustRun(t, exitCheckError, "", append([]string{"check"}, args...)...)
+		if run.stdout != "" || run.stderr == "" {
+			t.Errorf("bloom check %s printed %q to stdout and %q to stderr, want only an error",
+				strings.Join(args, " "), run.stdout, run.stderr)
+		}
+	}
+
+	if run := mustRun(t, exitOK, "", "check", "-h"); !strings.Contains(run.stderr, "Exit status:") {
+		t.Errorf("check -h does not document the exit status:\n%s", run.stderr)
+	}
+}
+
+func TestCLINulDelimited(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "paths.bloom")
+	// Keys with embedded newlines, as find -print0 produces; the last one is unterminated.
+	keys := []string{"dir/a\nb.txt", "dir/plain.txt", "dir/c\r\nd"}
+	input := strings.Join(keys, "\x00")
+
+	mustRun(t, exitOK, input, "import", "-f", path, "-i", "-", "-0", "-progress-interval", "0")
+	run := mustRun(t, exitCheckPresent, input, "check", "-f", path, "-0")
+	want := strings.Join(keys, "\tpresent\x00") + "\tpresent\x00"
+	if run.stdout != want {
+		t.Errorf("check -0 printed %q, want %q", run.stdout, want)
+	}
+	// Without -0 the same input is three different records.
+	mustRun(t, exitCheckAbsent, "", "check", "-f", path, "-q", "dir/a")
+
+	other := filepath.Join(t.TempDir(), "added.bloom")
+	mustRun(t, exitOK, "x\ny\x00", "add", "-f", other, "-0")
+	mustRun(t, exitCheckPresent, "", "check", "-f", other, "x\ny")
+	mustRun(t, exitCheckAbsent, "", "check", "-f", other, "-q", "x")
+}
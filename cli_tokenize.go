@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+)
+
+// tokenFlags holds the flags that make import and check work on the words of each record
+// instead of whole records.
+type tokenFlags struct {
+	enabled bool
+	pattern string
+	fold    bool
+}
+
+// register adds the tokenization flags to the flag set.
+func (t *tokenFlags) register(flags *flag.FlagSet) {
+	flags.BoolVar(&t.enabled, "tokenize", false, "split records into words and use each word as an item")
+	flags.StringVar(&t.pattern, "token-pattern", "", "with -tokenize, use the matches of this regular expression as the words")
+	flags.BoolVar(&t.fold, "fold", false, "with -tokenize, case-fold the words; use it for both import and check")
+}
+
+// tokenizer returns the Tokenizer the flags select, or nil without -tokenize.
+func (t *tokenFlags) tokenizer() (Tokenizer, error) {
+	if !t.enabled {
+		if t.pattern != "" || t.fold {
+			return nil, fmt.Errorf("%w: -token-pattern and -fold require -tokenize", errUsage)
+		}
+		return nil, nil
+	}
+	tokenize := Tokenizer(WordTokens)
+	if t.pattern != "" {
+		re, err := regexp.Compile(t.pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: -token-pattern: %v", errUsage, err)
+		}
+		tokenize = RegexpTokenizer(re)
+	}
+	if !t.fold {
+		return tokenize, nil
+	}
+	return func(text string) []string {
+		tokens := tokenize(text)
+		for i, token := range tokens {
+			tokens[i] = CaseFoldNormalizer.Normalize(token)
+		}
+		return tokens
+	}, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tokenSample is text in several scripts: 6 English, 5 German, 4 Russian and 5 Japanese
+// tokens.
+const tokenSample = `The stop-words list isn't long.
+Die Straße ist nicht lang.
+Список стоп-слов короткий.
+東京へ行く
+`
+
+func TestCLIImportTokenize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "words.bloom")
+	input := filepath.Join(dir, "sample.txt")
+	writeTree(t, dir, map[string]string{"sample.txt": tokenSample})
+
+	run := mustRun(t, exitOK, "", "-json", "import", "-f", path, "-i", input, "-tokenize")
+	var report Report
+	if err := json.Unmarshal([]byte(run.stdout), &report); err != nil {
+		t.Fatalf("import -tokenize -json: %v\n%s", err, run.stdout)
+	}
+	if report.LinesRead != 20 || report.ItemsAdded != 20 {
+		t.Errorf("import -tokenize = %+v, want 20 tokens read and added", report)
+	}
+	if run := mustRun(t, exitOK, "", "import", "-f", path, "-i", input, "-tokenize"); !strings.Contains(run.stdout, "20 tokens in ") {
+		t.Errorf("import -tokenize printed %q, want a count of tokens", run.stdout)
+	}
+	mustRun(t, exitCheckPresent, "", "check", "-f", path, "Straße", "короткий", "京", "isn't")
+	mustRun(t, exitCheckAbsent, "", "check", "-f", path, "Die Straße ist nicht lang.")
+}
+
+func TestCLICheckTokenize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stop.bloom")
+	mustRun(t, exitOK, "", "add", "-f", path, "the", "and", "und", "и", "の")
+
+	// Only the tokens that might be present are printed, then the count.
+	run := mustRun(t, exitCheckAbsent, "the cat and the hat\nKatze und Hund\nкот и пёс\n猫の手\n", "check", "-f", path, "-tokenize")
+	want := "the\tpresent\nand\tpresent\nthe\tpresent\nund\tpresent\nи\tpresent\nの\tpresent\n6 of 14 tokens might be present\n"
+	if run.stdout != want {
+		t.Errorf("check -tokenize printed:\n%s\nwant:\n%s", run.stdout, want)
+	}
+	mustRun(t, exitCheckPresent, "", "check", "-f", path, "-tokenize", "-any", "no stop words but the")
+
+	run = mustRun(t, exitCheckAbsent, "", "-json", "check", "-f", path, "-tokenize", "The cat and the hat")
+	var result tokenCheckResult
+	if err := json.Unmarshal([]byte(run.stdout), &result); err != nil {
+		t.Fatalf("check -tokenize -json: %v\n%s", err, run.stdout)
+	}
+	if result.Tokens != 5 || result.Present != 2 || len(result.Hits) != 2 || result.Hits[0] != (checkResult{"and", true}) {
+		t.Errorf("check -tokenize -json = %+v, want 2 of 5 tokens, and then the", result)
+	}
+}
+
+func TestCLITokenizeFoldAndPattern(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "folded.bloom")
+	writeTree(t, dir, map[string]string{"words.txt": "STRASSE Hello\n"})
+	mustRun(t, exitOK, "", "import", "-f", path, "-i", filepath.Join(dir, "words.txt"), "-tokenize", "-fold")
+
+	// Folding both sides matches case variants, and ß with ss.
+	mustRun(t, exitCheckPresent, "", "check", "-f", path, "-tokenize", "-fold", "Straße HELLO")
+	mustRun(t, exitCheckAbsent, "", "check", "-f", path, "-tokenize", "Straße HELLO")
+
+	// A pattern replaces word segmentation, here keeping e-mail addresses whole.
+	emails := filepath.Join(dir, "emails.bloom")
+	pattern := `[\w.+-]+@[\w.-]+`
+	mustRun(t, exitOK, "", "import", "-f", emails, "-i", "-", "-tokenize", "-token-pattern", pattern)
+	mustRun(t, exitOK, "leaked: ann@example.com, bob@example.org\n", "import", "-f", emails, "-i", "-", "-tokenize", "-token-pattern", pattern)
+	mustRun(t, exitCheckPresent, "", "check", "-f", emails, "ann@example.com", "bob@example.org")
+	mustRun(t, exitCheckAbsent, "", "check", "-f", emails, "leaked")
+}
+
+func TestCLITokenizeUsage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.bloom")
+	mustRun(t, exitOK, "", "add", "-f", path, "word")
+	for _, tc := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"check", "-f", path, "-fold", "word"}, exitCheckError},
+		{[]string{"check", "-f", path, "-tokenize", "-token-pattern", "(", "word"}, exitCheckError},
+		{[]string{"import", "-f", path, "-i", "-", "-token-pattern", `\w+`}, exitUsage},
+		{[]string{"import", "-f", path, "-i", "-", "-tokenize", "-token-pattern", "("}, exitUsage},
+	} {
+		if run := runTestCLI(t, "", tc.args...); run.code != tc.code {
+			t.Errorf("%s: exit code %d, want %d", strings.Join(tc.args, " "), run.code, tc.code)
+		}
+	}
+}
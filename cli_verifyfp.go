@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"text/tabwriter"
+)
+
+// Exit codes of "bloom verify-fp".
+const (
+	exitVerifyPass  = 0
+	exitVerifyFail  = 1
+	exitVerifyError = 2
+)
+
+// verifyFPPrefix starts every key generated by "bloom verify-fp -random". No record read
+// by add, check, import or dedupe can contain both a NUL byte and a newline, so the
+// generated keys are absent from filters built with the tool by construction.
+const verifyFPPrefix = "\x00\n"
+
+// runVerifyFP implements "bloom verify-fp": it queries a filter file with keys known to be
+// absent, from -negatives or generated with -random, and compares the observed false
+// positive rate with the target the filter was sized for and with the estimate from its
+// fill. It fails if the observed rate exceeds the target by more than -max-ratio.
+func runVerifyFP(env cliEnv, args []string) error {
+	var path, negatives string
+	var random, maxRatio float64
+	var seed int64
+	var nul bool
+	flags := newFlagSet(env, "verify-fp", "")
+	flags.StringVar(&path, "f", "", "filter file (required)")
+	flags.StringVar(&negatives, "negatives", "", "file of keys known to be absent, one per line, or - for stdin")
+	flags.Float64Var(&random, "random", 0, "query this many generated keys that cannot have been added instead")
+	flags.Int64Var(&seed, "seed", 1, "seed of the key generator for -random")
+	flags.Float64Var(&maxRatio, "max-ratio", 2, "fail if the observed rate exceeds the target by more than this factor")
+	flags.BoolVar(&nul, "0", false, nulFlagUsage)
+	flags.Usage = verifyFPUsage(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	switch {
+	case (negatives == "") == (random == 0):
+		return fmt.Errorf("%w: exactly one of -negatives and -random is required", errUsage)
+	case random < 0 || random > math.MaxInt:
+		return fmt.Errorf("%w: -random must be a positive number of keys", errUsage)
+	case maxRatio <= 0:
+		return fmt.Errorf("%w: -max-ratio must be positive", errUsage)
+	}
+	ff := filterFlags{path: path}
+	sbf, err := ff.open(false)
+	if err != nil {
+		return &exitStatus{code: exitVerifyError, err: err}
+	}
+
+	var queried, positives int
+	query := func(key string) error {
+		queried++
+		if sbf.MightContain(key) {
+			positives++
+		}
+		return nil
+	}
+	if random > 0 {
+		rng := rand.New(rand.NewSource(seed))
+		buf := make([]byte, 16)
+		for range int(random) {
+			rng.Read(buf)
+			query(verifyFPPrefix + hex.EncodeToString(buf))
+		}
+	} else {
+		r, closeInput, err := openInput(env, negatives)
+		if err != nil {
+			return &exitStatus{code: exitVerifyError, err: err}
+		}
+		err = forEachRecord(r, recordDelim(nul), query)
+		closeInput()
+		if err != nil {
+			return &exitStatus{code: exitVerifyError, err: err}
+		}
+		if queried == 0 {
+			return &exitStatus{code: exitVerifyError, err: fmt.Errorf("%s holds no keys", negatives)}
+		}
+	}
+
+	stats := sbf.Stats()
+	result := verifyFPResult{
+		Queried:        queried,
+		FalsePositives: positives,
+		ObservedFP:     float64(positives) / float64(queried),
+		TargetFP:       targetFP(stats, sbf.Config()),
+		EstimatedFP:    stats.EstimatedFP,
+		MaxRatio:       maxRatio,
+	}
+	result.Pass = result.ObservedFP <= result.TargetFP*maxRatio
+	if err := writeVerifyFPResult(env, result); err != nil {
+		return &exitStatus{code: exitVerifyError, err: err}
+	}
+	if !result.Pass {
+		return &exitStatus{code: exitVerifyFail}
+	}
+	return nil
+}
+
+// verifyFPResult is the outcome of "bloom verify-fp", also printed as JSON with the
+// global -json flag.
+type verifyFPResult struct {
+	Queried        int     `json:"queried"`
+	FalsePositives int     `json:"false_positives"`
+	ObservedFP     float64 `json:"observed_fp"`
+	TargetFP       float64 `json:"target_fp"`    // Compound rate the sub-filters were sized for
+	EstimatedFP    float64 `json:"estimated_fp"` // Estimated from the fill
+	MaxRatio       float64 `json:"max_ratio"`
+	Pass           bool    `json:"pass"` // Whether ObservedFP is within MaxRatio times TargetFP
+}
+
+// writeVerifyFPResult prints the measurement followed by the verdict.
+func writeVerifyFPResult(env cliEnv, r verifyFPResult) error {
+	if env.json {
+		return writeJSON(env.stdout, r)
+	}
+	tw := tabwriter.NewWriter(env.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "queried\t%d\n", r.Queried)
+	fmt.Fprintf(tw, "false positives\t%d\n", r.FalsePositives)
+	fmt.Fprintf(tw, "observed fp\t%.6g\n", r.ObservedFP)
+	fmt.Fprintf(tw, "target fp\t%.6g\n", r.TargetFP)
+	fmt.Fprintf(tw, "estimated fp\t%.6g (from fill)\n", r.EstimatedFP)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if r.Pass {
+		_, err := fmt.Fprintf(env.stdout, "PASS: observed rate %.6g is within %g times the target %.6g\n", r.ObservedFP, r.MaxRatio, r.TargetFP)
+		return err
+	}
+	_, err := fmt.Fprintf(env.stdout, "FAIL: observed rate %.6g exceeds %g times the target %.6g\n", r.ObservedFP, r.MaxRatio, r.TargetFP)
+	return err
+}
+
+// targetFP returns the compound false positive rate the sub-filters were sized for: an
+// absent item is a false positive if any sub-filter reports it. Files of format version 1
+// do not record the rates, so they are derived from the configuration.
+func targetFP(stats Stats, config Config) float64 {
+	absent := 1.0
+	for i, fs := range stats.Filters {
+		rate := fs.TargetFP
+		if rate == 0 {
+			rate = config.stageFP(i)
+		}
+		absent *= 1 - rate
+	}
+	return 1 - absent
+}
+
+// verifyFPUsage returns a usage function that documents the exit status of "bloom verify-fp".
+func verifyFPUsage(flags *flag.FlagSet) func() {
+	return func() {
+		w := flags.Output()
+		fmt.Fprintln(w, "usage: bloom verify-fp [flags]")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Exit status:")
+		fmt.Fprintln(w, "  0  the observed false positive rate is within -max-ratio of the target")
+		fmt.Fprintln(w, "  1  it exceeds the target by more than -max-ratio")
+		fmt.Fprintln(w, "  2  the filter or keys could not be read or the arguments are invalid")
+		fmt.Fprintln(w)
+		flags.PrintDefaults()
+	}
+}
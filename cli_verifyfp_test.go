@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCLIVerifyFP(t *testing.T) {
+	run := mustRun(t, exitVerifyPass, "", "verify-fp", "-f", "testdata/stats_v2.bloom", "-random", "10000", "-seed", "42")
+	checkGolden(t, "cli_verify_fp", run.stdout)
+
+	// Version 1 files do not record target rates; they are derived from the configuration.
+	var v1, v2 verifyFPResult
+	for path, result := range map[string]*verifyFPResult{"testdata/stats_v1.bloom": &v1, "testdata/stats_v2.bloom": &v2} {
+		run := mustRun(t, exitVerifyPass, "", "-json", "verify-fp", "-f", path, "-random", "2000")
+		if err := json.Unmarshal([]byte(run.stdout), result); err != nil {
+			t.Fatalf("%s: verify-fp -json: %v\n%s", path, err, run.stdout)
+		}
+	}
+	// Two stages at 0.01 and 0.005.
+	if want := 1 - 0.99*0.995; math.Abs(v2.TargetFP-want) > 1e-12 || v1.TargetFP != v2.TargetFP {
+		t.Errorf("target rates %g for version 1 and %g for version 2, want %g", v1.TargetFP, v2.TargetFP, want)
+	}
+	if v2.Queried != 2000 || v2.ObservedFP != float64(v2.FalsePositives)/2000 || !v2.Pass {
+		t.Errorf("verify-fp -json = %+v", v2)
+	}
+
+	// A tight ratio fails the same measurement.
+	run = runTestCLI(t, "", "verify-fp", "-f", "testdata/stats_v2.bloom", "-random", "10000", "-seed", "42", "-max-ratio", "0.5")
+	if run.code != exitVerifyFail || !strings.Contains(run.stdout, "FAIL: observed rate 0.0131 exceeds 0.5 times the target") {
+		t.Errorf("verify-fp -max-ratio 0.5: exit code %d\n%s", run.code, run.stdout)
+	}
+}
+
+// TestCLIVerifyFPNegatives queries a filter of known contents: keys that were added are
+// all reported present, so passing them as negatives fails, while absent keys pass.
+func TestCLIVerifyFPNegatives(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "known.bloom")
+	sbf := newTestFilter(t, testConfig)
+	members := testKeys("member", 150)
+	addAll(t, sbf, members)
+	if err := sbf.saveFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	run := runTestCLI(t, "", "-json", "verify-fp", "-f", path, "-negatives", writeKeys(t, members))
+	var result verifyFPResult
+	if err := json.Unmarshal([]byte(run.stdout), &result); err != nil {
+		t.Fatal(err)
+	}
+	if run.code != exitVerifyFail || result.Queried != 150 || result.FalsePositives != 150 || result.Pass {
+		t.Errorf("verify-fp with the members as negatives: exit code %d, %+v", run.code, result)
+	}
+
+	absent := testKeys("absent", 5000)
+	var fps int
+	for _, key := range absent {
+		if sbf.MightContain(key) {
+			fps++
+		}
+	}
+	run = mustRun(t, exitVerifyPass, strings.Join(absent, "\x00"), "-json", "verify-fp", "-f", path, "-negatives", "-", "-0")
+	if err := json.Unmarshal([]byte(run.stdout), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Queried != 5000 || result.FalsePositives != fps {
+		t.Errorf("verify-fp of absent keys: %d queried, %d false positives, want 5000 and %d", result.Queried, result.FalsePositives, fps)
+	}
+}
+
+func TestCLIVerifyFPErrors(t *testing.T) {
+	empty := writeKeys(t, nil)
+	for _, args := range [][]string{
+		{"verify-fp", "-f", "testdata/stats_v2.bloom"},
+		{"verify-fp", "-f", "testdata/stats_v2.bloom", "-random", "10", "-negatives", empty},
+		{"verify-fp", "-f", "testdata/stats_v2.bloom", "-random", "-1"},
+		{"verify-fp", "-f", "testdata/stats_v2.bloom", "-random", "10", "-max-ratio", "0"},
+		{"verify-fp", "-f", "testdata/missing.bloom", "-random", "10"},
+		{"verify-fp", "-f", "testdata/stats_v2.bloom", "-negatives", "testdata/missing.txt"},
+	} {
+		if run := runTestCLI(t, "", args...); run.code != exitVerifyError {
+			t.Errorf("%q: exit code %d, want %d", args, run.code, exitVerifyError)
+		}
+	}
+	if run := runTestCLI(t, "", "verify-fp", "-f", "testdata/stats_v2.bloom", "-negatives", empty); run.code != exitVerifyError ||
+		!strings.Contains(run.stderr, "holds no keys") {
+		t.Errorf("verify-fp with no negatives: exit code %d, stderr %q", run.code, run.stderr)
+	}
+	if run := runTestCLI(t, "", "verify-fp", "-h"); !strings.Contains(run.stderr, "Exit status:") {
+		t.Errorf("verify-fp -h does not document the exit status:\n%s", run.stderr)
+	}
+}
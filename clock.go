@@ -0,0 +1,25 @@
+package main
+
+import "time"
+
+// Clock is the source of time for every time-based feature in this package.
+// Tests can inject a fake, such as bloomtest.FakeClock, to run them deterministically.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After returns a channel that receives the current time once d has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the default Clock backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// WithClock sets the clock used for timing and scheduling. It defaults to the real clock.
+func WithClock(c Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
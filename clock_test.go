@@ -0,0 +1,62 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-bloom-filter/bloomtest"
+)
+
+// TestNoDirectTimeCalls checks that time is only read and waited on through a Clock, so
+// every time-based feature can be tested with a fake one.
+func TestNoDirectTimeCalls(t *testing.T) {
+	forbidden := map[string]bool{
+		"Now": true, "Since": true, "Until": true, "After": true, "AfterFunc": true,
+		"Tick": true, "NewTimer": true, "NewTicker": true, "Sleep": true,
+	}
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") || name == "clock.go" {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == "time" && forbidden[sel.Sel.Name] {
+				t.Errorf("%s: time.%s bypasses the Clock", fset.Position(sel.Pos()), sel.Sel.Name)
+			}
+			return true
+		})
+	}
+}
+
+func TestWithClockStageTimestamps(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := bloomtest.NewFakeClock(start)
+	sbf := newTestFilter(t, testConfig, WithClock(clock))
+	addAll(t, sbf, testKeys("first", testConfig.InitialCapacity))
+	clock.Advance(time.Hour)
+	addAll(t, sbf, testKeys("second", 1)) // Grows
+
+	if got := sbf.filters[0].created; !got.Equal(start) {
+		t.Errorf("first sub-filter created %v, want %v", got, start)
+	}
+	if got, want := sbf.filters[1].created, start.Add(time.Hour); !got.Equal(want) {
+		t.Errorf("second sub-filter created %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+// Close releases the filter's resources: it runs the cleanup registered by background
+// features such as auto-save, which flush their final state and stop their goroutines,
+// and then drops the sub-filters. Afterwards every mutation returns ErrClosed and
+// MightContain reports false for every item. Calling Close more than once is safe;
+// later calls return nil.
+func (sbf *ScalableBloomFilter) Close() error {
+	sbf.mutex.Lock()
+	if sbf.closed {
+		sbf.mutex.Unlock()
+		return nil
+	}
+	return sbf.finishClose()
+}
+
+// closeIfSaved atomically writes the filter to path and closes it only if that succeeds.
+// The write lock is held from the snapshot until the filter is marked closed, so no insert
+// can land after it; if the write fails the filter stays open and unchanged. It reports
+// whether the filter is closed afterwards, and returns the write error, the cleanups'
+// errors, or ErrClosed if it was closed already.
+func (sbf *ScalableBloomFilter) closeIfSaved(path string) (bool, error) {
+	sbf.mutex.Lock()
+	if sbf.closed {
+		sbf.mutex.Unlock()
+		return true, ErrClosed
+	}
+	data, err := sbf.encodeGob()
+	if err == nil {
+		err = writeFileBytes(path, data)
+	}
+	if err != nil {
+		sbf.mutex.Unlock()
+		return false, err
+	}
+	return true, sbf.finishClose()
+}
+
+// finishClose marks the filter closed, releases the write lock the caller holds, and runs
+// the cleanups before dropping the sub-filters.
+func (sbf *ScalableBloomFilter) finishClose() error {
+	sbf.closed = true
+	closers := sbf.closers
+	sbf.closers = nil
+	sbf.mutex.Unlock()
+
+	// Run cleanups without holding the lock, since they may need to read the filter
+	// one last time, e.g. to write a final snapshot. Run them in reverse registration order.
+	var errs []error
+	for i := len(closers) - 1; i >= 0; i-- {
+		errs = append(errs, closers[i]())
+	}
+
+	sbf.mutex.Lock()
+	sbf.filters = nil
+	sbf.mutex.Unlock()
+	return errors.Join(errs...)
+}
+
+// onClose registers a cleanup function to run when the filter is closed.
+// It returns ErrClosed if the filter is already closed; the caller must not hold the lock.
+func (sbf *ScalableBloomFilter) onClose(fn func() error) error {
+	sbf.mutex.Lock()
+	defer sbf.mutex.Unlock()
+
+	if sbf.closed {
+		return ErrClosed
+	}
+	sbf.closers = append(sbf.closers, fn)
+	return nil
+}
+
+var (
+	_ io.Closer = (*ScalableBloomFilter)(nil)
+	_ io.Closer = (*CountingBloomFilter)(nil)
+	_ io.Closer = (*Manager)(nil)
+)
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/go-bloom-filter/bloomtest"
+)
+
+// waitForGoroutines waits until no more than want goroutines are running, so a test can
+// check that background goroutines have exited.
+func waitForGoroutines(t *testing.T, want int) {
+	t.Helper()
+	waitFor(t, "background goroutines to exit", func() bool { return runtime.NumGoroutine() <= want })
+}
+
+func TestCloseAutoSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+	clock := bloomtest.NewFakeClock(time.Unix(0, 0))
+	sbf := newTestFilter(t, testConfig, WithClock(clock))
+
+	base := runtime.NumGoroutine()
+	sbf.EnableAutoSave(path, time.Minute)
+	addAll(t, sbf, testKeys("saved", 10))
+	if err := sbf.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	waitForGoroutines(t, base)
+
+	// Close flushed a final snapshot.
+	loaded, err := loadScalableFile(path, nil)
+	if err != nil {
+		t.Fatalf("loading the final snapshot: %v", err)
+	}
+	if !loaded.AllMightContain(testKeys("saved", 10)) {
+		t.Error("final snapshot lacks items added before Close")
+	}
+
+	if err := sbf.Add("late"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Add after Close = %v, want ErrClosed", err)
+	}
+	if sbf.MightContain("saved-0") {
+		t.Error("MightContain after Close = true")
+	}
+	if err := sbf.Close(); err != nil {
+		t.Errorf("second Close = %v, want nil", err)
+	}
+	// Enabling auto-save on a closed filter starts nothing.
+	sbf.EnableAutoSave(path, time.Minute)()
+	waitForGoroutines(t, base)
+}
+
+func TestManagerClose(t *testing.T) {
+	dir := t.TempDir()
+	clock := bloomtest.NewFakeClock(time.Unix(0, 0))
+	base := runtime.NumGoroutine()
+	m, err := NewManagerWithOptions(dir, ManagerOptions{MaxIdle: time.Hour}, WithClock(clock))
+	if err != nil {
+		t.Fatalf("NewManagerWithOptions: %v", err)
+	}
+	sbf, err := m.GetOrCreate("tenant", testConfig)
+	if err != nil {
+		t.Fatalf("GetOrCreate: %v", err)
+	}
+	sbf.Add("item")
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	waitForGoroutines(t, base) // The sweeper has stopped
+
+	if _, err := m.GetOrCreate("tenant", testConfig); !errors.Is(err, ErrClosed) {
+		t.Errorf("GetOrCreate after Close = %v, want ErrClosed", err)
+	}
+	if _, err := m.Get("tenant"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Get after Close = %v, want ErrClosed", err)
+	}
+	if _, _, err := m.Acquire("tenant", testConfig); !errors.Is(err, ErrClosed) {
+		t.Errorf("Acquire after Close = %v, want ErrClosed", err)
+	}
+	if err := m.Delete("tenant"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Delete after Close = %v, want ErrClosed", err)
+	}
+	if err := sbf.Add("late"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Add to a filter of a closed Manager = %v, want ErrClosed", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Errorf("second Close = %v, want nil", err)
+	}
+
+	// The filter was persisted for a new Manager.
+	m2, err := NewManager(dir)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	defer m2.Close()
+	reloaded, err := m2.Get("tenant")
+	if err != nil {
+		t.Fatalf("Get from a new Manager: %v", err)
+	}
+	if !reloaded.MightContain("item") {
+		t.Error("reloaded filter lacks the item added before Close")
+	}
+}
+
+func TestCountingBloomFilterClose(t *testing.T) {
+	cbf := NewCountingBloomFilter(100, 0.01)
+	cbf.Add("item")
+	if err := cbf.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if cbf.MightContain("item") {
+		t.Error("MightContain after Close = true")
+	}
+	cbf.Add("late") // Must not panic on the released counters
+	if cbf.Remove("item") {
+		t.Error("Remove after Close = true")
+	}
+	if _, err := cbf.TestAndAdd("late"); !errors.Is(err, ErrClosed) {
+		t.Errorf("TestAndAdd after Close = %v, want ErrClosed", err)
+	}
+	if err := cbf.TryRemove("item"); !errors.Is(err, ErrClosed) {
+		t.Errorf("TryRemove after Close = %v, want ErrClosed", err)
+	}
+	if err := cbf.Close(); err != nil {
+		t.Errorf("second Close = %v, want nil", err)
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// Binary format of a serialized BloomFilter, all integers big-endian:
+//
+//	magic        [4]byte "BLMF"
+//	version      uint8
+//	bitOrder     uint8
+//	hasher       uint8 length + name
+//	normalizer   uint8 length + name
+//	numHashFuncs uint32
+//	bitSize      uint64
+//	capacity     uint64
+//	count        uint64
+//	targetFP     float64 (IEEE 754 bits; since version 2, 0 if unknown)
+//	bitset       ceil(bitSize/8) bytes
+//
+// The header carries everything needed to validate compatibility before touching the bitset,
+// which lets tools stream bitsets without decoding whole filters.
+
+// filterMagic identifies a serialized BloomFilter.
+var filterMagic = [4]byte{'B', 'L', 'M', 'F'}
+
+// filterFormatVersion is the current version of the binary format. Version 1 lacked
+// targetFP and is still read.
+const filterFormatVersion = 2
+
+// mergeChunkSize is the number of bitset bytes MergeSerialized holds per reader at a time.
+const mergeChunkSize = 64 * 1024
+
+// filterHeader is the decoded header of a serialized BloomFilter.
+type filterHeader struct {
+	version      uint8
+	bitOrder     BitOrder
+	hasher       string
+	normalizer   string
+	numHashFuncs uint32
+	bitSize      uint64
+	capacity     uint64
+	count        uint64
+	targetFP     float64
+}
+
+// bitsetLen returns the number of bitset bytes that follow the header. readMagicHeader
+// bounds the bit size, so the rounding cannot wrap around.
+func (h filterHeader) bitsetLen() uint64 {
+	return (h.bitSize + 7) / 8
+}
+
+// compatible reports whether two filters' bitsets can be combined bit by bit.
+func (h filterHeader) compatible(other filterHeader) error {
+	switch {
+	case h.bitSize != other.bitSize:
+		return fmt.Errorf("bit size %d differs from %d", other.bitSize, h.bitSize)
+	case h.numHashFuncs != other.numHashFuncs:
+		return fmt.Errorf("number of hash functions %d differs from %d", other.numHashFuncs, h.numHashFuncs)
+	case h.hasher != other.hasher:
+		return fmt.Errorf("hasher %q differs from %q", other.hasher, h.hasher)
+	case h.bitOrder != other.bitOrder:
+		return errors.New("bit order differs")
+	case h.normalizer != other.normalizer:
+		return fmt.Errorf("key normalizer %q differs from %q", other.normalizer, h.normalizer)
+	}
+	return nil
+}
+
+// writeHeader writes h in the current version of the binary format, whatever version
+// it was read with.
+func writeHeader(w io.Writer, h filterHeader) error {
+	return writeMagicHeader(w, filterMagic, h)
+}
+
+// writeMagicHeader writes h like writeHeader, but introduced by magic, for formats that
+// share the header but differ in what follows it.
+func writeMagicHeader(w io.Writer, magic [4]byte, h filterHeader) error {
+	if len(h.hasher) > 255 || len(h.normalizer) > 255 {
+		return errors.New("hasher and normalizer names must be at most 255 bytes")
+	}
+	var buf bytes.Buffer
+	buf.Write(magic[:])
+	buf.WriteByte(filterFormatVersion)
+	buf.WriteByte(byte(h.bitOrder))
+	buf.WriteByte(byte(len(h.hasher)))
+	buf.WriteString(h.hasher)
+	buf.WriteByte(byte(len(h.normalizer)))
+	buf.WriteString(h.normalizer)
+	buf.Write(binary.BigEndian.AppendUint32(nil, h.numHashFuncs))
+	buf.Write(binary.BigEndian.AppendUint64(nil, h.bitSize))
+	buf.Write(binary.BigEndian.AppendUint64(nil, h.capacity))
+	buf.Write(binary.BigEndian.AppendUint64(nil, h.count))
+	buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(h.targetFP)))
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// readHeader reads and checks a header in the binary format.
+func readHeader(r io.Reader) (filterHeader, error) {
+	return readMagicHeader(r, filterMagic, "not a serialized bloom filter")
+}
+
+// readMagicHeader reads and checks a header written by writeMagicHeader with magic,
+// failing with notMagic if the data starts with anything else.
+func readMagicHeader(r io.Reader, magic [4]byte, notMagic string) (filterHeader, error) {
+	var h filterHeader
+	var fixed [7]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return h, fmt.Errorf("reading header: %w", err)
+	}
+	if [4]byte(fixed[:4]) != magic {
+		return h, errors.New(notMagic)
+	}
+	h.version = fixed[4]
+	if h.version < 1 || h.version > filterFormatVersion {
+		return h, fmt.Errorf("unsupported format version %d", h.version)
+	}
+	h.bitOrder = BitOrder(fixed[5])
+	if h.bitOrder != LSBFirst && h.bitOrder != MSBFirst {
+		return h, fmt.Errorf("unknown bit order %d", h.bitOrder)
+	}
+
+	hasher := make([]byte, fixed[6])
+	if _, err := io.ReadFull(r, hasher); err != nil {
+		return h, fmt.Errorf("reading header: %w", err)
+	}
+	h.hasher = string(hasher)
+
+	var length [1]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return h, fmt.Errorf("reading header: %w", err)
+	}
+	normalizer := make([]byte, length[0])
+	if _, err := io.ReadFull(r, normalizer); err != nil {
+		return h, fmt.Errorf("reading header: %w", err)
+	}
+	h.normalizer = string(normalizer)
+
+	var numbers [28]byte
+	if _, err := io.ReadFull(r, numbers[:]); err != nil {
+		return h, fmt.Errorf("reading header: %w", err)
+	}
+	h.numHashFuncs = binary.BigEndian.Uint32(numbers[0:4])
+	h.bitSize = binary.BigEndian.Uint64(numbers[4:12])
+	h.capacity = binary.BigEndian.Uint64(numbers[12:20])
+	h.count = binary.BigEndian.Uint64(numbers[20:28])
+	if h.version >= 2 {
+		var targetFP [8]byte
+		if _, err := io.ReadFull(r, targetFP[:]); err != nil {
+			return h, fmt.Errorf("reading header: %w", err)
+		}
+		h.targetFP = math.Float64frombits(binary.BigEndian.Uint64(targetFP[:]))
+	}
+	if h.bitSize == 0 || h.bitSize > maxBitSize {
+		return h, fmt.Errorf("bit size %d is not between 1 and %d", h.bitSize, maxBitSize)
+	}
+	return h, nil
+}
+
+// header returns the filter's header; the caller must hold at least the read lock.
+func (bf *BloomFilter) header() filterHeader {
+	return filterHeader{
+		version:      filterFormatVersion,
+		bitOrder:     bf.bitOrder,
+		hasher:       bf.hasher.Name(),
+		normalizer:   bf.normalizer.Name(),
+		numHashFuncs: uint32(bf.numHashFuncs),
+		bitSize:      uint64(bf.bitSize),
+		capacity:     uint64(bf.capacity),
+		count:        uint64(bf.count),
+		targetFP:     bf.targetFP,
+	}
+}
+
+// WriteTo writes the filter in the binary format. It implements io.WriterTo.
+func (bf *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	bf.mutex.RLock()
+	defer bf.mutex.RUnlock()
+
+	cw := &countingWriter{w: w}
+	if err := writeHeader(cw, bf.header()); err != nil {
+		return cw.n, err
+	}
+	_, err := cw.Write(bf.usedBytes())
+	return cw.n, err
+}
+
+// ReadBloomFilter reads a filter written by WriteTo. The filter's hasher and key normalizer
+// are resolved by name and must be built in or registered.
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	return readBloomFilterBody(r, h)
+}
+
+// readBloomFilterBody reads the bitset following an already-decoded header.
+func readBloomFilterBody(r io.Reader, h filterHeader) (*BloomFilter, error) {
+	hasher, err := LookupHasher(h.hasher)
+	if err != nil {
+		return nil, err
+	}
+	normalizer, err := LookupKeyNormalizer(h.normalizer)
+	if err != nil {
+		return nil, err
+	}
+	// Read the bitset incrementally so a corrupt header claiming a huge size fails on
+	// the short stream instead of allocating the full claimed size up front.
+	var bitset bytes.Buffer
+	if n, err := io.CopyN(&bitset, r, int64(h.bitsetLen())); err != nil {
+		return nil, fmt.Errorf("reading bitset: got %d of %d bytes: %w", n, h.bitsetLen(), err)
+	}
+
+	bf := &BloomFilter{
+		bitset:       bitset.Bytes(),
+		bitSize:      uint(h.bitSize),
+		numHashFuncs: uint(h.numHashFuncs),
+		capacity:     int(h.capacity),
+		targetFP:     h.targetFP,
+		bitOrder:     h.bitOrder,
+		hasher:       hasher,
+		normalizer:   normalizer,
+		count:        uint(h.count),
+	}
+	if err := bf.validate(); err != nil {
+		return nil, err
+	}
+	return bf, nil
+}
+
+// MarshalBinary encodes the filter in the binary format written by WriteTo.
+func (bf *BloomFilter) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := bf.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary replaces the filter's contents with data in the binary format.
+func (bf *BloomFilter) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	decoded, err := ReadBloomFilter(r)
+	if err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("%d trailing bytes after filter", r.Len())
+	}
+
+	bf.mutex.Lock()
+	defer bf.mutex.Unlock()
+
+	bf.bitset = decoded.bitset
+	bf.bitSize = decoded.bitSize
+	bf.numHashFuncs = decoded.numHashFuncs
+	bf.capacity = decoded.capacity
+	bf.targetFP = decoded.targetFP
+	bf.bitOrder = decoded.bitOrder
+	bf.hasher = decoded.hasher
+	bf.normalizer = decoded.normalizer
+	bf.count = decoded.count
+	return nil
+}
+
+// ToBase64 encodes the filter in the binary format as unpadded URL-safe base64, so that a
+// small filter fits in a URL, an HTTP header or a configuration value as is.
+func (bf *BloomFilter) ToBase64() (string, error) {
+	data, err := bf.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// FromBase64 decodes a filter encoded by ToBase64. Padding is accepted, in case the string
+// went through a standard encoder on the way.
+func FromBase64(s string) (*BloomFilter, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, fmt.Errorf("decoding base64: %w", err)
+	}
+	bf := &BloomFilter{}
+	if err := bf.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return bf, nil
+}
+
+// MergeSerialized reads serialized filters with identical layout from readers and writes
+// a single serialized filter holding the bitwise OR of their bitsets to w. All headers are
+// validated before anything is written, and at most one chunk per reader is held in memory.
+func MergeSerialized(w io.Writer, readers ...io.Reader) error {
+	buffered, headers, err := readMergeHeaders(readers)
+	if err != nil {
+		return err
+	}
+	_, err = mergeBitsets(w, buffered, headers, nil)
+	return err
+}
+
+// readMergeHeaders buffers readers and reads their headers, checking that they are all
+// compatible with the first one.
+func readMergeHeaders(readers []io.Reader) ([]*bufio.Reader, []filterHeader, error) {
+	if len(readers) == 0 {
+		return nil, nil, errors.New("no filters to merge")
+	}
+	buffered := make([]*bufio.Reader, len(readers))
+	headers := make([]filterHeader, len(readers))
+	for i, r := range readers {
+		buffered[i] = bufio.NewReader(r)
+		h, err := readHeader(buffered[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("filter %d: %w", i, err)
+		}
+		if i > 0 {
+			if err := headers[0].compatible(h); err != nil {
+				return nil, nil, fmt.Errorf("filter %d is incompatible: %w", i, err)
+			}
+		}
+		headers[i] = h
+	}
+	return buffered, headers, nil
+}
+
+// mergeBitsets writes the merged header and the OR of the bitsets that follow the headers
+// already read from readers, one chunk at a time. If setBits is not nil, it receives each
+// reader's number of set bits. It returns the number of set bits in the merged bitset.
+func mergeBitsets(w io.Writer, readers []*bufio.Reader, headers []filterHeader, setBits []uint64) (uint64, error) {
+	merged := headers[0]
+	for _, h := range headers[1:] {
+		// The exact number of distinct items is unknown; the sum is an upper bound.
+		merged.count += h.count
+	}
+	if err := writeHeader(w, merged); err != nil {
+		return 0, err
+	}
+
+	var total uint64
+	out := make([]byte, mergeChunkSize)
+	chunk := make([]byte, mergeChunkSize)
+	for remaining := merged.bitsetLen(); remaining > 0; {
+		n := min(uint64(mergeChunkSize), remaining)
+		clear(out[:n])
+		for i, r := range readers {
+			if _, err := io.ReadFull(r, chunk[:n]); err != nil {
+				return 0, fmt.Errorf("filter %d: reading bitset: %w", i, err)
+			}
+			for j := range chunk[:n] {
+				out[j] |= chunk[j]
+			}
+			if setBits != nil {
+				setBits[i] += uint64(popCount(chunk[:n]))
+			}
+		}
+		if _, err := w.Write(out[:n]); err != nil {
+			return 0, err
+		}
+		total += uint64(popCount(out[:n]))
+		remaining -= n
+	}
+	return total, nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
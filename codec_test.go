@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"strings"
+	"testing"
+)
+
+func TestBitOrderSerialization(t *testing.T) {
+	lsb := NewBloomFilter(100, 0.01)
+	msb := NewBloomFilter(100, 0.01, WithBitOrder(MSBFirst))
+	for _, key := range testKeys("order", 20) {
+		lsb.Add(key)
+		msb.Add(key)
+	}
+	lsbData, err := lsb.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	msbData, err := msb.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	if len(lsbData) != len(msbData) {
+		t.Fatalf("encodings are %d and %d bytes long, want equal lengths", len(lsbData), len(msbData))
+	}
+
+	// The header records the bit order right after the magic and version.
+	if lsbData[5] != byte(LSBFirst) || msbData[5] != byte(MSBFirst) {
+		t.Errorf("bit order bytes = %d and %d, want %d and %d", lsbData[5], msbData[5], LSBFirst, MSBFirst)
+	}
+	// The same logical bits are stored mirrored within each byte.
+	n := len(lsb.usedBytes())
+	lsbBits, msbBits := lsbData[len(lsbData)-n:], msbData[len(msbData)-n:]
+	if bytes.Equal(lsbBits, msbBits) {
+		t.Fatal("bitsets are identical under both bit orders")
+	}
+	for i := range lsbBits {
+		if bits.Reverse8(lsbBits[i]) != msbBits[i] {
+			t.Fatalf("bitset byte %d is %08b under LSBFirst and %08b under MSBFirst, want mirrored bits", i, lsbBits[i], msbBits[i])
+		}
+	}
+
+	// Each decodes with its own order and answers queries the same way.
+	for name, data := range map[string][]byte{"LSBFirst": lsbData, "MSBFirst": msbData} {
+		decoded, err := ReadBloomFilter(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: ReadBloomFilter: %v", name, err)
+		}
+		for _, key := range testKeys("order", 20) {
+			if !decoded.MightContain(key) {
+				t.Fatalf("%s: decoded MightContain(%q) = false", name, key)
+			}
+		}
+	}
+}
+
+func TestBitOrderMask(t *testing.T) {
+	for _, tc := range []struct {
+		order BitOrder
+		index uint
+		want  uint8
+	}{
+		{LSBFirst, 0, 0x01},
+		{LSBFirst, 7, 0x80},
+		{LSBFirst, 9, 0x02},
+		{MSBFirst, 0, 0x80},
+		{MSBFirst, 7, 0x01},
+		{MSBFirst, 9, 0x40},
+	} {
+		if got := tc.order.mask(tc.index); got != tc.want {
+			t.Errorf("BitOrder(%d).mask(%d) = %#02x, want %#02x", tc.order, tc.index, got, tc.want)
+		}
+	}
+}
+
+// encodeWithHeader serializes bf with its header modified by edit, as a corrupt or
+// hand-crafted file would be.
+func encodeWithHeader(t *testing.T, bf *BloomFilter, edit func(*filterHeader)) []byte {
+	t.Helper()
+	h := bf.header()
+	edit(&h)
+	var buf bytes.Buffer
+	if err := writeHeader(&buf, h); err != nil {
+		t.Fatalf("writeHeader: %v", err)
+	}
+	buf.Write(bf.usedBytes())
+	return buf.Bytes()
+}
+
+func TestReadBloomFilterMalformed(t *testing.T) {
+	bf := NewBloomFilter(100, 0.01)
+	bf.Add("x")
+	for name, edit := range map[string]func(*filterHeader){
+		"zero bit size":           func(h *filterHeader) { h.bitSize = 0 },
+		"no hash functions":       func(h *filterHeader) { h.numHashFuncs = 0 },
+		"too many hash functions": func(h *filterHeader) { h.numHashFuncs = 1 << 31 },
+		"unknown hasher":          func(h *filterHeader) { h.hasher = "crc8" },
+		"bit size past MaxInt":    func(h *filterHeader) { h.bitSize = maxBitSize + 1 },
+	} {
+		if _, err := ReadBloomFilter(bytes.NewReader(encodeWithHeader(t, bf, edit))); err == nil {
+			t.Errorf("%s: ReadBloomFilter succeeded", name)
+		}
+	}
+
+	// A bit size whose byte count wraps around to 0 must not pass with an empty bitset.
+	var buf bytes.Buffer
+	h := bf.header()
+	h.bitSize = math.MaxUint64
+	if err := writeHeader(&buf, h); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadBloomFilter(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Error("ReadBloomFilter of a wrapped bit size with no bitset succeeded")
+	}
+}
+
+// TestMismatchedBitSize checks that a filter claiming more bits than its bitset holds is
+// rejected on decoding rather than panicking on the first query that indexes past the end.
+func TestMismatchedBitSize(t *testing.T) {
+	bf := NewBloomFilter(100, 0.01)
+	data := encodeWithHeader(t, bf, func(h *filterHeader) { h.bitSize *= 4 })
+	// Only the real bitset follows the header, so the stream ends early.
+	if _, err := ReadBloomFilter(bytes.NewReader(data)); err == nil {
+		t.Error("ReadBloomFilter of a bitset shorter than its bit size succeeded")
+	}
+
+	sbf := newTestFilter(t, testConfig)
+	addAll(t, sbf, testKeys("gob", 10))
+	wire := sbf.fullWire()
+	wire.Filters[0].BitSize *= 4
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(wire); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	var decoded ScalableBloomFilter
+	if err := decoded.GobDecode(buf.Bytes()); err == nil {
+		t.Error("GobDecode of a sub-filter with a bitset shorter than its bit size succeeded")
+	}
+}
+
+// marshal serializes bf, failing the test on error.
+func marshal(t *testing.T, bf *BloomFilter) []byte {
+	t.Helper()
+	data, err := bf.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	return data
+}
+
+func TestMergeSerialized(t *testing.T) {
+	// Large enough that the bitsets span several merge chunks.
+	const capacity = 100000
+	var readers []io.Reader
+	var want *BloomFilter
+	for i := 0; i < 3; i++ {
+		bf := NewBloomFilter(capacity, 0.01)
+		for _, key := range testKeys(fmt.Sprintf("part%d", i), 1000) {
+			bf.Add(key)
+		}
+		if len(bf.usedBytes()) <= mergeChunkSize {
+			t.Fatalf("bitset of %d bytes fits in one merge chunk", len(bf.usedBytes()))
+		}
+		readers = append(readers, bytes.NewReader(marshal(t, bf)))
+		if want == nil {
+			want = NewBloomFilter(capacity, 0.01)
+		}
+		want.Union(bf)
+	}
+
+	var out bytes.Buffer
+	if err := MergeSerialized(&out, readers...); err != nil {
+		t.Fatalf("MergeSerialized: %v", err)
+	}
+	merged, err := ReadBloomFilter(&out)
+	if err != nil {
+		t.Fatalf("reading the merged filter: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		for _, key := range testKeys(fmt.Sprintf("part%d", i), 1000) {
+			if !merged.MightContain(key) {
+				t.Fatalf("merged filter lacks %q", key)
+			}
+		}
+	}
+	if !bytes.Equal(merged.usedBytes(), want.usedBytes()) {
+		t.Error("merged bitset differs from the in-memory union")
+	}
+	if got := merged.ItemCount(); got != 3000 {
+		t.Errorf("merged ItemCount() = %d, want the sum of the inputs, 3000", got)
+	}
+}
+
+func TestMergeSerializedIncompatible(t *testing.T) {
+	a := marshal(t, NewBloomFilter(1000, 0.01))
+	for name, other := range map[string][]byte{
+		"bit size":  marshal(t, NewBloomFilter(2000, 0.01)),
+		"hasher":    marshal(t, NewBloomFilter(1000, 0.01, WithHasher(SHA256Hasher))),
+		"truncated": a[:len(a)-1],
+	} {
+		var out bytes.Buffer
+		if err := MergeSerialized(&out, bytes.NewReader(a), bytes.NewReader(other)); err == nil {
+			t.Errorf("%s: MergeSerialized succeeded", name)
+		} else if name != "truncated" && out.Len() != 0 {
+			t.Errorf("%s: %d bytes written before the headers were rejected", name, out.Len())
+		}
+	}
+	if err := MergeSerialized(io.Discard); err == nil {
+		t.Error("MergeSerialized of no filters succeeded")
+	}
+}
+
+func TestBase64RoundTrip(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithHasher(FNVHasher), WithBitOrder(LSBFirst)}} {
+		bf := NewBloomFilter(200, 0.01, opts...)
+		keys := testKeys("key", 200)
+		for _, key := range keys {
+			bf.Add(key)
+		}
+		s, err := bf.ToBase64()
+		if err != nil {
+			t.Fatalf("ToBase64: %v", err)
+		}
+		// URL-safe and unpadded, so it can go in a URL as is.
+		if strings.ContainsAny(s, "+/=") {
+			t.Errorf("ToBase64 = %q, want the unpadded URL-safe alphabet", s)
+		}
+		for _, encoded := range []string{s, s + strings.Repeat("=", (4-len(s)%4)%4)} {
+			decoded, err := FromBase64(encoded)
+			if err != nil {
+				t.Fatalf("FromBase64: %v", err)
+			}
+			if decoded.bitSize != bf.bitSize || decoded.numHashFuncs != bf.numHashFuncs || decoded.ItemCount() != bf.ItemCount() ||
+				decoded.hasher.Name() != bf.hasher.Name() || decoded.bitOrder != bf.bitOrder || !bytes.Equal(decoded.usedBytes(), bf.usedBytes()) {
+				t.Fatal("decoded filter differs from the encoded one")
+			}
+			for _, key := range keys {
+				if !decoded.MightContain(key) {
+					t.Fatalf("decoded filter misses %q", key)
+				}
+			}
+		}
+	}
+}
+
+func TestFromBase64Malformed(t *testing.T) {
+	bf := NewBloomFilter(100, 0.01)
+	bf.Add("x")
+	s, err := bf.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	noHashFuncs := base64.RawURLEncoding.EncodeToString(encodeWithHeader(t, bf, func(h *filterHeader) { h.numHashFuncs = 0 }))
+	// A bit size whose byte count wraps around to 0, with no bitset after the header.
+	var wrapped bytes.Buffer
+	h := bf.header()
+	h.bitSize = math.MaxUint64
+	if err := writeHeader(&wrapped, h); err != nil {
+		t.Fatal(err)
+	}
+	for name, input := range map[string]string{
+		"empty":             "",
+		"truncated":         s[:len(s)/2],
+		"one byte short":    s[:len(s)-2],
+		"trailing data":     s + "AAAA",
+		"garbled":           "!!" + s[2:],
+		"standard alphabet": strings.NewReplacer("-", "+", "_", "/").Replace(s) + "+/",
+		"not base64":        "hello, world",
+		"no hash functions": noHashFuncs,
+		"wrapped bit size":  base64.RawURLEncoding.EncodeToString(wrapped.Bytes()),
+	} {
+		decoded, err := FromBase64(input)
+		if err == nil {
+			t.Errorf("%s: FromBase64 succeeded", name)
+			continue
+		}
+		if decoded != nil {
+			t.Errorf("%s: FromBase64 returned a filter with the error %v", name, err)
+		}
+	}
+}
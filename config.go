@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Formats of configuration files. YAML and TOML files are limited to the flat
+// "key: value" and "key = value" lines that Config needs, with # comments.
+const (
+	configJSON = "json"
+	configYAML = "yaml"
+	configTOML = "toml"
+)
+
+// configField describes a field of Config as it appears in configuration files.
+type configField struct {
+	name  string            // Key in configuration files, as in the JSON encoding
+	usage string            // Meaning and valid range, written as a comment in templates
+	ptr   func(*Config) any // Returns a *float64 or *int pointing at the field
+}
+
+// configFields lists the fields of Config in declaration order.
+var configFields = []configField{
+	{"initial_fp", "false positive rate of the first sub-filter; between 0 and 1, exclusive",
+		func(c *Config) any { return &c.InitialFP }},
+	{"growth_factor", "factor by which each sub-filter's capacity exceeds the previous one's; greater than 1",
+		func(c *Config) any { return &c.GrowthFactor }},
+	{"tightening_ratio", "factor applied to the false positive rate of each new sub-filter; between 0 and 1, exclusive",
+		func(c *Config) any { return &c.TighteningRatio }},
+	{"initial_capacity", "number of items the first sub-filter is sized for; at least 1",
+		func(c *Config) any { return &c.InitialCapacity }},
+	{"max_filters", "maximum number of sub-filters, 0 for unlimited; not negative",
+		func(c *Config) any { return &c.MaxFilters }},
+	{"min_fp", "lowest false positive rate a sub-filter targets, 0 for no floor; between 0 and initial_fp",
+		func(c *Config) any { return &c.MinFP }},
+}
+
+// lookupConfigField returns the field stored under key in configuration files.
+func lookupConfigField(key string) (configField, bool) {
+	for _, f := range configFields {
+		if f.name == key {
+			return f, true
+		}
+	}
+	return configField{}, false
+}
+
+// violations returns every constraint of NewScalableBloomFilter that c breaks, in the
+// order NewScalableBloomFilter checks them.
+func (c Config) violations() []error {
+	var errs []error
+	if c.TighteningRatio <= 0 || c.TighteningRatio >= 1 {
+		errs = append(errs, errors.New("tighteningRatio must be between 0 and 1"))
+	}
+	if c.GrowthFactor <= 1 {
+		errs = append(errs, errors.New("growthFactor must be greater than 1"))
+	}
+	if c.InitialFP <= 0 || c.InitialFP >= 1 {
+		errs = append(errs, errors.New("initialFP must be between 0 and 1"))
+	}
+	if c.InitialCapacity <= 0 {
+		errs = append(errs, errors.New("initialCapacity must be greater than 0"))
+	}
+	if c.MaxFilters < 0 {
+		errs = append(errs, errors.New("maxFilters must not be negative"))
+	}
+	if c.MinFP < 0 || c.MinFP > c.InitialFP {
+		errs = append(errs, errors.New("minFP must be between 0 and initialFP"))
+	}
+	return errs
+}
+
+// configFormat returns the format of the configuration file at path from its extension;
+// anything other than YAML or TOML is read as JSON.
+func configFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return configYAML
+	case ".toml":
+		return configTOML
+	}
+	return configJSON
+}
+
+// decodeConfig parses a configuration file in format, returning every problem with its
+// fields rather than stopping at the first. Unknown keys are problems too, except JSON
+// keys starting with "_", which hold comments. Missing keys are left zero. The error is
+// set instead if the file could not be parsed at all.
+func decodeConfig(data []byte, format string) (Config, []error, error) {
+	var c Config
+	var errs []error
+	set := func(key string, decode func(ptr any) error) {
+		f, ok := lookupConfigField(key)
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown field %q", key))
+			return
+		}
+		if err := decode(f.ptr(&c)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", key, err))
+		}
+	}
+
+	if format == configJSON {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return c, nil, err
+		}
+		for _, f := range configFields {
+			if value, ok := fields[f.name]; ok {
+				set(f.name, func(ptr any) error { return json.Unmarshal(value, ptr) })
+				delete(fields, f.name)
+			}
+		}
+		unknown := make([]string, 0, len(fields))
+		for key := range fields {
+			if !strings.HasPrefix(key, "_") {
+				unknown = append(unknown, key)
+			}
+		}
+		sort.Strings(unknown)
+		for _, key := range unknown {
+			errs = append(errs, fmt.Errorf("unknown field %q", key))
+		}
+		return c, errs, nil
+	}
+
+	sep := ":"
+	if format == configTOML {
+		sep = "="
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		text = strings.TrimSpace(text)
+		if text == "" || text == "---" {
+			continue
+		}
+		key, value, ok := strings.Cut(text, sep)
+		if !ok {
+			errs = append(errs, fmt.Errorf("line %d: expected key%svalue", line, sep))
+			continue
+		}
+		value = strings.TrimSpace(value)
+		set(strings.TrimSpace(key), func(ptr any) error {
+			var err error
+			switch p := ptr.(type) {
+			case *float64:
+				*p, err = strconv.ParseFloat(value, 64)
+			case *int:
+				*p, err = strconv.Atoi(value)
+			}
+			if err != nil {
+				return fmt.Errorf("invalid number %q on line %d", value, line)
+			}
+			return nil
+		})
+	}
+	return c, errs, scanner.Err()
+}
+
+// writeConfigTemplate writes c in format with a comment describing every field. JSON has
+// no comments, so the descriptions go in a "_comment" object, which readers ignore.
+func writeConfigTemplate(w io.Writer, c Config, format string) error {
+	bw := bufio.NewWriter(w)
+	switch format {
+	case configJSON:
+		// Written by hand rather than marshaled, to keep the fields in declaration order.
+		fmt.Fprint(bw, "{\n  \"_comment\": {")
+		for i, f := range configFields {
+			usage, err := json.Marshal(f.usage)
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				fmt.Fprint(bw, ",")
+			}
+			fmt.Fprintf(bw, "\n    %q: %s", f.name, usage)
+		}
+		fmt.Fprint(bw, "\n  }")
+		for _, f := range configFields {
+			fmt.Fprintf(bw, ",\n  %q: %s", f.name, formatConfigValue(f.ptr(&c)))
+		}
+		fmt.Fprint(bw, "\n}\n")
+	case configYAML, configTOML:
+		sep := ": "
+		if format == configTOML {
+			sep = " = "
+		}
+		fmt.Fprintln(bw, "# Configuration of a scalable Bloom filter, read by \"bloom -config\".")
+		for _, f := range configFields {
+			fmt.Fprintf(bw, "\n# %s\n%s%s%s\n", f.usage, f.name, sep, formatConfigValue(f.ptr(&c)))
+		}
+	default:
+		return fmt.Errorf("unknown configuration format %q", format)
+	}
+	return bw.Flush()
+}
+
+// formatConfigValue formats the field ptr points at. Floats keep a decimal point, so that
+// TOML reads them as floats.
+func formatConfigValue(ptr any) string {
+	switch p := ptr.(type) {
+	case *float64:
+		s := strconv.FormatFloat(*p, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eEn") {
+			s += ".0"
+		}
+		return s
+	case *int:
+		return strconv.Itoa(*p)
+	}
+	return fmt.Sprint(ptr)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConfigTemplateRoundTrip(t *testing.T) {
+	custom := Config{InitialFP: 0.002, GrowthFactor: 3, TighteningRatio: 0.8, InitialCapacity: 5000, MaxFilters: 7, MinFP: 1e-9}
+	for _, format := range []string{configJSON, configYAML, configTOML} {
+		for _, want := range []Config{defaultConfig, custom} {
+			var buf bytes.Buffer
+			if err := writeConfigTemplate(&buf, want, format); err != nil {
+				t.Fatalf("%s: writeConfigTemplate: %v", format, err)
+			}
+			got, problems, err := decodeConfig(buf.Bytes(), format)
+			if err != nil || len(problems) > 0 {
+				t.Fatalf("%s: decodeConfig of the template = %v, %v\n%s", format, problems, err, buf.String())
+			}
+			if got != want {
+				t.Errorf("%s: template decodes to %+v, want %+v", format, got, want)
+			}
+			for _, f := range configFields {
+				if !strings.Contains(buf.String(), f.usage) {
+					t.Errorf("%s: template does not describe %s", format, f.name)
+				}
+			}
+		}
+	}
+	if err := writeConfigTemplate(&bytes.Buffer{}, defaultConfig, "ini"); err == nil {
+		t.Error("writeConfigTemplate in an unknown format succeeded")
+	}
+}
+
+func TestDecodeConfigProblems(t *testing.T) {
+	for _, tc := range []struct {
+		format, data string
+		want         []string
+	}{
+		{configJSON, `{"initial_fp": "high", "growth": 2, "_note": "ignored"}`, []string{"initial_fp:", `unknown field "growth"`}},
+		{configYAML, "initial_fp: x\nbogus: 1\nno separator\n", []string{`invalid number "x" on line 1`, `unknown field "bogus"`, "line 3: expected key:value"}},
+		{configTOML, "max_filters = 1.5 # not an integer\n", []string{`invalid number "1.5" on line 1`}},
+	} {
+		_, problems, err := decodeConfig([]byte(tc.data), tc.format)
+		if err != nil {
+			t.Fatalf("%s: decodeConfig: %v", tc.format, err)
+		}
+		if len(problems) != len(tc.want) {
+			t.Errorf("%s: %d problems %v, want %d", tc.format, len(problems), problems, len(tc.want))
+			continue
+		}
+		for i, p := range problems {
+			if !strings.Contains(p.Error(), tc.want[i]) {
+				t.Errorf("%s: problem %d = %q, want it to mention %q", tc.format, i, p, tc.want[i])
+			}
+		}
+	}
+	if _, _, err := decodeConfig([]byte("{"), configJSON); err == nil {
+		t.Error("decodeConfig of malformed JSON succeeded")
+	}
+}
+
+func TestConfigViolations(t *testing.T) {
+	if v := defaultConfig.violations(); len(v) != 0 {
+		t.Errorf("defaultConfig violates %v", v)
+	}
+	// Every field out of range at once is reported field by field.
+	bad := Config{InitialFP: 1, GrowthFactor: 1, TighteningRatio: 0, InitialCapacity: 0, MaxFilters: -1, MinFP: 2}
+	if v := bad.violations(); len(v) != len(configFields) {
+		t.Errorf("violations = %v, want one per field", v)
+	}
+	// NewScalableBloomFilter stops at the first of them.
+	if _, err := NewScalableBloomFilter(bad); err == nil || err.Error() != bad.violations()[0].Error() {
+		t.Errorf("NewScalableBloomFilter error = %v, want %v", err, bad.violations()[0])
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// ErrNotPresent is returned by TryRemove under RemoveStrict for an item that is definitely
+// not in the counting filter, such as one removed more times than it was added.
+var ErrNotPresent = errors.New("item is not present")
+
+// RemovePolicy decides how TryRemove treats an item that is definitely not present, which
+// is an item whose counters include a zero. Either way no counter drops below zero.
+type RemovePolicy int
+
+const (
+	// RemoveClamp leaves the filter untouched and reports success; it is the default.
+	RemoveClamp RemovePolicy = iota
+	// RemoveStrict leaves the filter untouched and returns ErrNotPresent, to catch
+	// double removes in application logic.
+	RemoveStrict
+)
+
+// CountingBloomFilter is a Bloom filter that keeps a small counter per position instead of
+// a single bit, which makes it possible to remove items. It is safe for concurrent use.
+type CountingBloomFilter struct {
+	counters     []uint8
+	size         uint
+	numHashFuncs uint
+	count        uint // Number of items currently inserted
+	removePolicy RemovePolicy
+	closed       bool // Set by Close
+	mutex        sync.RWMutex
+}
+
+// CountingOption configures optional behavior of NewCountingBloomFilter.
+type CountingOption func(*CountingBloomFilter)
+
+// WithRemovePolicy sets how TryRemove treats items that are not present.
+func WithRemovePolicy(policy RemovePolicy) CountingOption {
+	return func(cbf *CountingBloomFilter) {
+		cbf.removePolicy = policy
+	}
+}
+
+// NewCountingBloomFilter creates a new CountingBloomFilter with the given capacity and false positive probability.
+func NewCountingBloomFilter(n int, fp float64, opts ...CountingOption) *CountingBloomFilter {
+	m := optimalBitSize(n, fp)
+	k := max(optimalHashFuncs(m, n), 1)
+	cbf := &CountingBloomFilter{
+		counters:     make([]uint8, m),
+		size:         m,
+		numHashFuncs: k,
+	}
+	for _, opt := range opts {
+		opt(cbf)
+	}
+	return cbf
+}
+
+// Add inserts an item into the counting filter.
+// Counters saturate at their maximum value rather than wrapping around.
+// Add does nothing once the filter is closed; use TestAndAdd to detect that.
+func (cbf *CountingBloomFilter) Add(item string) {
+	cbf.mutex.Lock()
+	defer cbf.mutex.Unlock()
+
+	if cbf.closed {
+		return
+	}
+	cbf.increment(hashIndices(item, cbf.numHashFuncs, cbf.size))
+}
+
+// increment bumps the counters at indices, saturating at the maximum value;
+// the caller must hold the write lock.
+func (cbf *CountingBloomFilter) increment(indices []uint) {
+	for _, index := range indices {
+		if cbf.counters[index] < math.MaxUint8 {
+			cbf.counters[index]++
+		}
+	}
+	cbf.count++
+}
+
+// Remove deletes one occurrence of an item from the counting filter.
+// Returns false, leaving the filter untouched, if the item is definitely not present.
+// Saturated counters are never decremented, since their true value is unknown.
+func (cbf *CountingBloomFilter) Remove(item string) bool {
+	cbf.mutex.Lock()
+	defer cbf.mutex.Unlock()
+
+	return cbf.remove(item)
+}
+
+// TryRemove is like Remove but reports an item that is definitely not present according
+// to the filter's RemovePolicy: as success under RemoveClamp, and as ErrNotPresent under
+// RemoveStrict. It returns ErrClosed once the filter is closed.
+func (cbf *CountingBloomFilter) TryRemove(item string) error {
+	cbf.mutex.Lock()
+	defer cbf.mutex.Unlock()
+
+	if cbf.closed {
+		return ErrClosed
+	}
+	if !cbf.remove(item) && cbf.removePolicy == RemoveStrict {
+		return fmt.Errorf("%w: %q", ErrNotPresent, item)
+	}
+	return nil
+}
+
+// remove implements Remove; the caller must hold the write lock.
+func (cbf *CountingBloomFilter) remove(item string) bool {
+	if cbf.closed {
+		return false
+	}
+	indices := hashIndices(item, cbf.numHashFuncs, cbf.size)
+	for _, index := range indices {
+		if cbf.counters[index] == 0 {
+			return false
+		}
+	}
+	for _, index := range indices {
+		if cbf.counters[index] < math.MaxUint8 {
+			cbf.counters[index]--
+		}
+	}
+	if cbf.count > 0 {
+		cbf.count--
+	}
+	return true
+}
+
+// ItemCount returns the number of items currently inserted.
+func (cbf *CountingBloomFilter) ItemCount() uint {
+	cbf.mutex.RLock()
+	defer cbf.mutex.RUnlock()
+
+	return cbf.count
+}
+
+// MightContain checks if an item might be in the counting filter.
+// Returns true if the item might be present, false if it is definitely not present.
+func (cbf *CountingBloomFilter) MightContain(item string) bool {
+	cbf.mutex.RLock()
+	defer cbf.mutex.RUnlock()
+
+	if cbf.closed {
+		return false
+	}
+	for _, index := range hashIndices(item, cbf.numHashFuncs, cbf.size) {
+		if cbf.counters[index] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// TestAndAdd reports whether the item might already be present and inserts it otherwise.
+// It returns ErrClosed once the filter is closed.
+func (cbf *CountingBloomFilter) TestAndAdd(item string) (bool, error) {
+	cbf.mutex.Lock()
+	defer cbf.mutex.Unlock()
+
+	if cbf.closed {
+		return false, ErrClosed
+	}
+	indices := hashIndices(item, cbf.numHashFuncs, cbf.size)
+	present := true
+	for _, index := range indices {
+		if cbf.counters[index] == 0 {
+			present = false
+			break
+		}
+	}
+	if present {
+		return true, nil
+	}
+	cbf.increment(indices)
+	return false, nil
+}
+
+// Close releases the counters. Afterwards MightContain reports false for every item,
+// Add and Remove do nothing, and TestAndAdd and TryRemove return ErrClosed. Calling
+// Close more than once is safe.
+func (cbf *CountingBloomFilter) Close() error {
+	cbf.mutex.Lock()
+	defer cbf.mutex.Unlock()
+
+	cbf.closed = true
+	cbf.counters = nil
+	return nil
+}
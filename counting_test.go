@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// counterValues returns the counters at the positions of item.
+func counterValues(cbf *CountingBloomFilter, item string) []uint8 {
+	cbf.mutex.RLock()
+	defer cbf.mutex.RUnlock()
+
+	var values []uint8
+	for _, index := range hashIndices(item, cbf.numHashFuncs, cbf.size) {
+		values = append(values, cbf.counters[index])
+	}
+	return values
+}
+
+func TestCountingBloomFilterAddRemove(t *testing.T) {
+	cbf := NewCountingBloomFilter(1000, 0.01)
+	cbf.Add("a")
+	cbf.Add("a")
+	cbf.Add("b")
+	if !cbf.MightContain("a") || !cbf.MightContain("b") {
+		t.Fatal("added items are missing")
+	}
+	if !cbf.Remove("a") || !cbf.MightContain("a") {
+		t.Fatal(`"a" was added twice and should survive one Remove`)
+	}
+	if !cbf.Remove("a") || cbf.MightContain("a") {
+		t.Fatal(`"a" should be gone after as many removes as adds`)
+	}
+	if cbf.Remove("a") {
+		t.Error(`Remove("a") = true for an item that is no longer present`)
+	}
+	if got := cbf.ItemCount(); got != 1 {
+		t.Errorf("ItemCount() = %d, want 1", got)
+	}
+}
+
+// TestCountingBloomFilterConcurrent races adds, removes and lookups of the same item. Run
+// it with -race: counters must neither lose updates nor drop below zero.
+func TestCountingBloomFilterConcurrent(t *testing.T) {
+	const (
+		workers = 4
+		rounds  = 50 // workers*rounds stays below the saturation value of 255
+	)
+	cbf := NewCountingBloomFilter(1000, 0.01)
+	cbf.Add("anchor")
+
+	var wg sync.WaitGroup
+	var adds, removes atomic.Int64
+	for w := 0; w < workers; w++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				cbf.Add("item")
+				adds.Add(1)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				if cbf.Remove("item") {
+					removes.Add(1)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				if !cbf.MightContain("anchor") {
+					t.Error(`MightContain("anchor") = false while only "item" changes`)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	net := adds.Load() - removes.Load()
+	for _, v := range counterValues(cbf, "item") {
+		if int64(v) < net {
+			t.Fatalf(`counters of "item" = %v after %d adds and %d removes, want at least %d each`,
+				counterValues(cbf, "item"), adds.Load(), removes.Load(), net)
+		}
+	}
+	if got, want := cbf.ItemCount(), uint(1+net); got != want {
+		t.Errorf("ItemCount() = %d, want %d", got, want)
+	}
+
+	// Drain what is left: exactly net removes succeed, and the next one does not.
+	for i := int64(0); i < net; i++ {
+		if !cbf.Remove("item") {
+			t.Fatalf("Remove %d of %d remaining failed", i+1, net)
+		}
+	}
+	if cbf.MightContain("item") && cbf.Remove("item") {
+		t.Error(`"item" is still removable after every add was undone`)
+	}
+	if !cbf.MightContain("anchor") {
+		t.Error(`"anchor" was lost`)
+	}
+}
+
+func TestCountingBloomFilterRemovePolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		opts   []CountingOption
+		strict bool
+	}{
+		{"default", nil, false},
+		{"RemoveClamp", []CountingOption{WithRemovePolicy(RemoveClamp)}, false},
+		{"RemoveStrict", []CountingOption{WithRemovePolicy(RemoveStrict)}, true},
+	} {
+		cbf := NewCountingBloomFilter(1000, 0.01, tc.opts...)
+		cbf.Add("a")
+		cbf.Add("b")
+		if err := cbf.TryRemove("a"); err != nil {
+			t.Fatalf("%s: TryRemove of an added item = %v", tc.name, err)
+		}
+		removed, others := counterValues(cbf, "a"), counterValues(cbf, "b")
+
+		// Over-removing, and removing an item never added, leave every counter at or above zero.
+		for _, item := range []string{"a", "never-added"} {
+			err := cbf.TryRemove(item)
+			switch {
+			case tc.strict && !errors.Is(err, ErrNotPresent):
+				t.Errorf("%s: TryRemove(%q) of an absent item = %v, want ErrNotPresent", tc.name, item, err)
+			case !tc.strict && err != nil:
+				t.Errorf("%s: TryRemove(%q) of an absent item = %v, want nil", tc.name, item, err)
+			}
+		}
+		if got := counterValues(cbf, "a"); !slices.Equal(got, removed) {
+			t.Errorf("%s: over-removing changed the counters from %v to %v", tc.name, removed, got)
+		}
+		if !slices.Equal(counterValues(cbf, "b"), others) || !cbf.MightContain("b") {
+			t.Errorf("%s: over-removing changed the counters of another item", tc.name)
+		}
+		if got := cbf.ItemCount(); got != 1 {
+			t.Errorf("%s: ItemCount() = %d after over-removes, want 1", tc.name, got)
+		}
+	}
+}
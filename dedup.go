@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+)
+
+// DedupWriter is an io.Writer that forwards each line to the underlying writer only the
+// first time it is seen, making it usable for log deduplication or a streaming uniq.
+//
+// Membership is tracked by the injected Filter. With a Bloom filter, false positives mean
+// a genuinely new line is occasionally dropped, at roughly the filter's false positive rate;
+// inject an ExactSet when volumes are small enough that this is not acceptable. A line is
+// checked against the filter before it is written and added only after, so DedupWriters
+// sharing a filter may both forward a line that reaches them at the same time.
+type DedupWriter struct {
+	w          io.Writer
+	filter     Filter
+	delim      byte
+	pending    []byte // Partial line carried over between Write calls
+	seen       uint64
+	passed     uint64
+	suppressed uint64
+	mutex      sync.Mutex
+}
+
+// DedupStats holds the line counters of a DedupWriter.
+type DedupStats struct {
+	Seen       uint64 `json:"seen"`       // Complete lines processed
+	Passed     uint64 `json:"passed"`     // Lines forwarded to the underlying writer
+	Suppressed uint64 `json:"suppressed"` // Lines dropped as duplicates
+}
+
+// NewDedupWriter creates a DedupWriter that writes first-seen lines to w, using f to remember them.
+func NewDedupWriter(w io.Writer, f Filter) *DedupWriter {
+	return &DedupWriter{w: w, filter: f, delim: '\n'}
+}
+
+// SetDelimiter changes the byte that terminates lines from '\n', e.g. to 0 for
+// NUL-delimited records. The delimiter is part of each forwarded line but not of its key.
+// Newline-delimited lines also leave a trailing "\r" out of their key, so a CRLF line and
+// the same LF line are duplicates; the first one seen is forwarded unchanged.
+func (dw *DedupWriter) SetDelimiter(delim byte) {
+	dw.mutex.Lock()
+	defer dw.mutex.Unlock()
+
+	dw.delim = delim
+}
+
+// Write buffers p, forwarding every complete first-seen line to the underlying writer.
+// A line split across several Write calls is handled as a single line. If forwarding a
+// line fails, Write returns the number of bytes of p before that line along with the
+// error, and the line is not added to the filter, so writing the rest of p again retries
+// it instead of suppressing it as a duplicate.
+func (dw *DedupWriter) Write(p []byte) (int, error) {
+	dw.mutex.Lock()
+	defer dw.mutex.Unlock()
+
+	carried := len(dw.pending) // Bytes of pending from earlier calls, already reported written
+	dw.pending = append(dw.pending, p...)
+	start := 0 // Start of the current line in pending
+	for {
+		i := bytes.IndexByte(dw.pending[start:], dw.delim)
+		if i < 0 {
+			break
+		}
+		end := start + i + 1
+		line := dw.pending[start:end]
+		if consumed, err := dw.writeLine(line[:i], line); !consumed {
+			// Keep only the part of the line that came from earlier calls; the caller
+			// retries the rest.
+			dw.pending = append(dw.pending[:0:0], dw.pending[start:max(start, carried)]...)
+			return max(start-carried, 0), err
+		} else if err != nil {
+			dw.pending = append(dw.pending[:0:0], dw.pending[end:]...)
+			return max(end-carried, 0), err
+		}
+		start = end
+	}
+	// Compact so the buffer does not keep growing on long streams.
+	dw.pending = append(dw.pending[:0:0], dw.pending[start:]...)
+	return len(p), nil
+}
+
+// Flush processes a trailing line that has no terminating newline yet.
+// The line is forwarded as-is, without adding a newline. If forwarding it fails, the line
+// stays buffered for the next Flush.
+func (dw *DedupWriter) Flush() error {
+	dw.mutex.Lock()
+	defer dw.mutex.Unlock()
+
+	if len(dw.pending) == 0 {
+		return nil
+	}
+	line := dw.pending
+	consumed, err := dw.writeLine(line, line)
+	if consumed {
+		dw.pending = nil
+	}
+	return err
+}
+
+// Close flushes any trailing unterminated line. It does not close the underlying writer.
+func (dw *DedupWriter) Close() error {
+	return dw.Flush()
+}
+
+// Stats returns a snapshot of the line counters.
+func (dw *DedupWriter) Stats() DedupStats {
+	dw.mutex.Lock()
+	defer dw.mutex.Unlock()
+
+	return DedupStats{Seen: dw.seen, Passed: dw.passed, Suppressed: dw.suppressed}
+}
+
+// writeLine forwards raw unless key is already in the filter, and only then adds key, so
+// that a line the underlying writer fails on is not remembered. It reports whether the
+// line was consumed, which is also the case if it was written but adding it failed. The
+// caller must hold the mutex.
+func (dw *DedupWriter) writeLine(key, raw []byte) (bool, error) {
+	k := string(key)
+	if dw.delim == '\n' {
+		k = strings.TrimSuffix(k, "\r")
+	}
+	if dw.filter.MightContain(k) {
+		dw.seen++
+		dw.suppressed++
+		return true, nil
+	}
+	if _, err := dw.w.Write(raw); err != nil {
+		return false, err
+	}
+	dw.seen++
+	dw.passed++
+	_, err := dw.filter.TestAndAdd(k)
+	return true, err
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const dedupInput = "a\nb\na\nc\nb\nb\nd"
+
+func TestDedupWriterTornWrites(t *testing.T) {
+	const want = "a\nb\nc\nd"
+	for _, size := range []int{1, 2, 3, 5, len(dedupInput)} {
+		var out bytes.Buffer
+		dw := NewDedupWriter(&out, NewExactSet())
+		// Split the input every size bytes, so lines are torn across Write calls.
+		for rest := dedupInput; rest != ""; {
+			chunk := rest[:min(size, len(rest))]
+			rest = rest[len(chunk):]
+			if n, err := dw.Write([]byte(chunk)); n != len(chunk) || err != nil {
+				t.Fatalf("size %d: Write(%q) = %d, %v", size, chunk, n, err)
+			}
+		}
+		if got := out.String(); got != "a\nb\nc\n" {
+			t.Errorf("size %d: output before Close = %q, want the complete lines only", size, got)
+		}
+		if err := dw.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		if got := out.String(); got != want {
+			t.Errorf("size %d: output = %q, want %q", size, got, want)
+		}
+		if got, want := dw.Stats(), (DedupStats{Seen: 7, Passed: 4, Suppressed: 3}); got != want {
+			t.Errorf("size %d: Stats() = %+v, want %+v", size, got, want)
+		}
+	}
+}
+
+func TestDedupWriterBloomFilter(t *testing.T) {
+	var out bytes.Buffer
+	dw := NewDedupWriter(&out, newTestFilter(t, testConfig))
+	dw.Write([]byte(dedupInput + "\n"))
+	if got, want := out.String(), "a\nb\nc\nd\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestDedupWriterDelimiter(t *testing.T) {
+	var out bytes.Buffer
+	dw := NewDedupWriter(&out, NewExactSet())
+	dw.SetDelimiter(0)
+	dw.Write([]byte("x\ny\x00z\x00x\ny\x00"))
+	if got, want := out.String(), "x\ny\x00z\x00"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestDedupWriterCRLF(t *testing.T) {
+	var out bytes.Buffer
+	dw := NewDedupWriter(&out, NewExactSet())
+	dw.Write([]byte("a\r\nb\na\nb\r\nc\r"))
+	dw.Close()
+	if got, want := out.String(), "a\r\nb\nc\r"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	// Only newline-delimited records treat a trailing CR as line ending.
+	out.Reset()
+	dw = NewDedupWriter(&out, NewExactSet())
+	dw.SetDelimiter(0)
+	dw.Write([]byte("a\r\x00a\x00"))
+	if got, want := out.String(), "a\r\x00a\x00"; got != want {
+		t.Errorf("NUL-delimited output = %q, want %q", got, want)
+	}
+}
+
+// flakyWriter fails every Write while failing is set.
+type flakyWriter struct {
+	bytes.Buffer
+	failing bool
+}
+
+var errFlaky = errors.New("write failed")
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	if w.failing {
+		return 0, errFlaky
+	}
+	return w.Buffer.Write(p)
+}
+
+// TestDedupWriterRetry checks that a caller retrying the unwritten part of p after an
+// error, as the io.Writer contract allows, gets the failed line forwarded rather than
+// suppressed as a duplicate.
+func TestDedupWriterRetry(t *testing.T) {
+	set := NewExactSet()
+	w := &flakyWriter{}
+	dw := NewDedupWriter(w, set)
+
+	// "par" is carried over into the next call, which fails on its line.
+	if n, err := dw.Write([]byte("one\npar")); n != 7 || err != nil {
+		t.Fatalf("Write = %d, %v, want 7, nil", n, err)
+	}
+	w.failing = true
+	p := []byte("tial\nthree\n")
+	n, err := dw.Write(p)
+	if !errors.Is(err, errFlaky) || n != 0 {
+		t.Fatalf("failing Write = %d, %v, want 0 and the writer's error", n, err)
+	}
+	if set.MightContain("partial") {
+		t.Fatal(`the line that failed to be written was added to the filter`)
+	}
+
+	w.failing = false
+	if n, err := dw.Write(p[n:]); n != len(p) || err != nil {
+		t.Fatalf("retried Write = %d, %v, want %d, nil", n, err, len(p))
+	}
+	if got, want := w.String(), "one\npartial\nthree\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if got, want := dw.Stats(), (DedupStats{Seen: 3, Passed: 3}); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDedupWriterRetryAfterWrittenLines(t *testing.T) {
+	w := &flakyWriter{}
+	dw := NewDedupWriter(w, NewExactSet())
+	p := []byte("a\nb\nc\n")
+
+	// Fail once the first line is out: only "a\n" counts as written.
+	dw.Write(p[:2])
+	w.failing = true
+	n, err := dw.Write(p[2:])
+	if n != 0 || err == nil {
+		t.Fatalf("failing Write = %d, %v, want 0 and an error", n, err)
+	}
+	w.failing = false
+	if _, err := dw.Write(p[2+n:]); err != nil {
+		t.Fatalf("retried Write: %v", err)
+	}
+	if got := w.String(); got != string(p) {
+		t.Errorf("output = %q, want %q", got, p)
+	}
+}
+
+func TestDedupWriterFlushRetry(t *testing.T) {
+	w := &flakyWriter{failing: true}
+	dw := NewDedupWriter(w, NewExactSet())
+	dw.Write([]byte("tail"))
+	if err := dw.Flush(); !errors.Is(err, errFlaky) {
+		t.Fatalf("Flush = %v, want the writer's error", err)
+	}
+	w.failing = false
+	if err := dw.Flush(); err != nil {
+		t.Fatalf("second Flush: %v", err)
+	}
+	if got := w.String(); got != "tail" {
+		t.Errorf("output = %q, want %q", got, "tail")
+	}
+	if strings.Contains(w.String(), "\n") {
+		t.Error("Flush added a newline to the trailing line")
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+)
+
+// overlappingFilters returns two filters over n items each, of which shared are in both.
+func overlappingFilters(n, shared int) (a, b *BloomFilter) {
+	a, b = NewBloomFilter(10000, 0.01), NewBloomFilter(10000, 0.01)
+	for _, key := range testKeys("shared", shared) {
+		a.Add(key)
+		b.Add(key)
+	}
+	for _, key := range testKeys("a", n-shared) {
+		a.Add(key)
+	}
+	for _, key := range testKeys("b", n-shared) {
+		b.Add(key)
+	}
+	return a, b
+}
+
+func TestEstimateJaccard(t *testing.T) {
+	const n = 2000
+	for _, tc := range []struct {
+		shared int
+		want   float64
+	}{
+		{0, 0},
+		{n / 2, 1.0 / 3}, // 1000 shared of 3000 distinct
+		{n, 1},
+	} {
+		a, b := overlappingFilters(n, tc.shared)
+		got, err := EstimateJaccard(a, b)
+		if err != nil {
+			t.Fatalf("%d shared: EstimateJaccard: %v", tc.shared, err)
+		}
+		if math.Abs(got-tc.want) > 0.03 {
+			t.Errorf("%d shared: EstimateJaccard = %.4f, want %.4f ± 0.03", tc.shared, got, tc.want)
+		}
+	}
+
+	empty := NewBloomFilter(10000, 0.01)
+	if got, err := EstimateJaccard(empty, NewBloomFilter(10000, 0.01)); got != 1 || err != nil {
+		t.Errorf("EstimateJaccard of two empty filters = %g, %v, want 1, nil", got, err)
+	}
+}
+
+func TestEstimateJaccardErrors(t *testing.T) {
+	a := NewBloomFilter(10000, 0.01)
+	for name, b := range map[string]*BloomFilter{
+		"bit size": NewBloomFilter(20000, 0.01),
+		"hasher":   NewBloomFilter(10000, 0.01, WithHasher(FNVHasher)),
+	} {
+		if _, err := EstimateJaccard(a, b); err == nil {
+			t.Errorf("EstimateJaccard with a different %s succeeded", name)
+		}
+	}
+
+	saturated := NewBloomFilter(10, 0.5)
+	for i := range saturated.bitset {
+		saturated.bitset[i] = 0xff
+	}
+	other := NewBloomFilter(10, 0.5)
+	if _, err := EstimateJaccard(saturated, other); !errors.Is(err, errSaturated) {
+		t.Errorf("EstimateJaccard with a saturated filter = %v, want errSaturated", err)
+	}
+}
+
+// TestEstimateIntersection checks the error documented on EstimateIntersection: within 1% of
+// the union size, at fill levels from a tenth of the filters' capacity to all of it.
+func TestEstimateIntersection(t *testing.T) {
+	for _, n := range []int{1000, 5000, 10000} {
+		for _, shared := range []int{0, n / 10, n / 2} {
+			a, b := overlappingFilters(n, shared)
+			got, err := EstimateIntersection(a, b)
+			if err != nil {
+				t.Fatalf("%d items, %d shared: EstimateIntersection: %v", n, shared, err)
+			}
+			union := float64(2*n - shared)
+			if got < 0 || math.Abs(got-float64(shared)) > 0.01*union {
+				t.Errorf("%d items, %d shared: EstimateIntersection = %.1f, want %d ± %.0f",
+					n, shared, got, shared, 0.01*union)
+			}
+			t.Logf("%d items, %d shared: estimate %.1f, error %.2f%% of the union",
+				n, shared, got, 100*math.Abs(got-float64(shared))/union)
+		}
+	}
+}
+
+func TestEstimateIntersectionClamped(t *testing.T) {
+	// Disjoint sets whose estimates sum to less than the union's must not go negative.
+	bKeys := testKeys("b", 50)
+	for i, key := range testKeys("a", 50) {
+		a, b := NewBloomFilter(1000, 0.01), NewBloomFilter(1000, 0.01)
+		a.Add(key)
+		b.Add(bKeys[i])
+		got, err := EstimateIntersection(a, b)
+		if err != nil || got < 0 {
+			t.Fatalf("EstimateIntersection of disjoint singletons = %g, %v, want at least 0", got, err)
+		}
+	}
+
+	if _, err := EstimateIntersection(NewBloomFilter(1000, 0.01), NewBloomFilter(2000, 0.01)); err == nil {
+		t.Error("EstimateIntersection with a different bit size succeeded")
+	}
+}
+
+func TestMembershipScore(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	members := testKeys("member", 300) // Several sub-filters
+	addAll(t, sbf, members)
+
+	for _, item := range members {
+		if got := sbf.MembershipScore(item); got < 0.9 || got > 1 {
+			t.Fatalf("MembershipScore(%q) = %g, want near 1", item, got)
+		}
+	}
+	for _, item := range testKeys("absent", 1000) {
+		if sbf.MightContain(item) {
+			continue // A false positive scores like a member
+		}
+		if got := sbf.MembershipScore(item); got != 0 {
+			t.Fatalf("MembershipScore(%q) = %g, want 0 for an item no sub-filter matches", item, got)
+		}
+	}
+
+	// Matches only in a saturated filter are worth nothing.
+	saturated := newTestFilter(t, testConfig)
+	addAll(t, saturated, []string{"first"})
+	bf := saturated.filters[0]
+	for i := uint(0); i < bf.bitSize; i++ {
+		bf.bitset[i/8] |= bf.bitOrder.mask(i)
+	}
+	if got := saturated.MembershipScore("anything"); got != 0 {
+		t.Errorf("MembershipScore in a saturated filter = %g, want 0", got)
+	}
+}
+
+func TestUnionCardinality(t *testing.T) {
+	for _, shared := range []int{0, 500, 2000} {
+		a, b := overlappingFilters(2000, shared)
+		aBits := append([]uint8(nil), a.bitset...)
+		got, err := UnionCardinality(a, b)
+		if err != nil {
+			t.Fatalf("%d shared: UnionCardinality: %v", shared, err)
+		}
+		want := 4000 - shared
+		if math.Abs(float64(got)-float64(want)) > 0.02*float64(want) {
+			t.Errorf("%d shared: UnionCardinality = %d, want %d ± 2%%", shared, got, want)
+		}
+		if !bytes.Equal(a.bitset, aBits) {
+			t.Fatalf("%d shared: UnionCardinality modified its input", shared)
+		}
+	}
+
+	if _, err := UnionCardinality(NewBloomFilter(1000, 0.01), NewBloomFilter(1000, 0.01, WithHasher(FNVHasher))); err == nil {
+		t.Error("UnionCardinality with a different hasher succeeded")
+	}
+}
+
+func TestIntersectionCardinality(t *testing.T) {
+	a, b := overlappingFilters(3000, 1000)
+	got, err := IntersectionCardinality(a, b)
+	if err != nil {
+		t.Fatalf("IntersectionCardinality: %v", err)
+	}
+	// The error scales with the union of 5000 items.
+	if got < 900 || got > 1100 {
+		t.Errorf("IntersectionCardinality = %d, want about 1000", got)
+	}
+	estimate, _ := EstimateIntersection(a, b)
+	if want := uint(math.Round(estimate)); got != want {
+		t.Errorf("IntersectionCardinality = %d, want EstimateIntersection rounded, %d", got, want)
+	}
+
+	if _, err := IntersectionCardinality(a, NewBloomFilter(20000, 0.01)); err == nil {
+		t.Error("IntersectionCardinality with a different bit size succeeded")
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrTooManyFilters is returned when a Manager using EvictReject is asked for a new filter
+// while it already holds MaxFilters.
+var ErrTooManyFilters = errors.New("too many filters loaded")
+
+// errEvicting marks the placeholder entry that stands in for a filter while it is being
+// persisted and unloaded; callers that find it load the filter again.
+var errEvicting = errors.New("filter is being evicted")
+
+// touchGranularity bounds how often an entry's last-use timestamp is written, so touching
+// a hot filter costs an atomic load rather than a store on every access.
+const touchGranularity = time.Second
+
+// EvictPolicy selects what a Manager does when loading a filter would exceed MaxFilters.
+type EvictPolicy int
+
+const (
+	// EvictLRU unloads the least recently used unpinned filters.
+	EvictLRU EvictPolicy = iota
+	// EvictReject refuses to load more filters with ErrTooManyFilters.
+	EvictReject
+)
+
+// ManagerOptions configures when a Manager unloads filters. Unloading persists the filter
+// first if the Manager has a directory, so a later Get loads it back; an in-memory Manager
+// discards it, which turns MaxIdle into a TTL. Filters pinned with Acquire are never
+// unloaded. A filter obtained with Get or GetOrCreate may be unloaded while the caller
+// still holds it: it is closed after its final snapshot, so later writes through that
+// pointer fail with ErrClosed instead of being lost. If the snapshot cannot be written the
+// filter stays loaded, and eviction is retried by the next sweep or load.
+type ManagerOptions struct {
+	MaxIdle     time.Duration // Unload filters not accessed for this long; 0 disables
+	MaxFilters  int           // Maximum number of loaded filters; 0 means unlimited
+	EvictPolicy EvictPolicy   // What to do when MaxFilters would be exceeded
+}
+
+// touch records an access to entry, at most once per touchGranularity.
+func (m *Manager) touch(entry *managedFilter) {
+	now := m.clock.Now().UnixNano()
+	if now-entry.lastUsed.Load() >= int64(touchGranularity) {
+		entry.lastUsed.Store(now)
+	}
+}
+
+// sweeper periodically unloads idle filters until the Manager is closed.
+func (m *Manager) sweeper() {
+	defer close(m.swept)
+	for {
+		select {
+		case <-m.clock.After(m.mopts.MaxIdle / 2):
+			m.sweep()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// sweep unloads every unpinned filter that has been idle for longer than MaxIdle.
+func (m *Manager) sweep() {
+	cutoff := m.clock.Now().Add(-m.mopts.MaxIdle).UnixNano()
+	for name, entry := range m.loaded() {
+		if entry.err == nil && entry.lastUsed.Load() < cutoff {
+			m.evict(name, entry)
+		}
+	}
+}
+
+// evictOverLimit unloads least recently used filters, other than keep, until at most
+// MaxFilters are loaded or only pinned ones remain.
+func (m *Manager) evictOverLimit(keep *managedFilter) {
+	if m.mopts.MaxFilters == 0 || m.mopts.EvictPolicy != EvictLRU {
+		return
+	}
+	for {
+		loaded := m.loaded()
+		if len(loaded) <= m.mopts.MaxFilters {
+			return
+		}
+		var victimName string
+		var victim *managedFilter
+		m.mutex.Lock()
+		for name, entry := range loaded {
+			if entry == keep || entry.err != nil || entry.refs > 0 {
+				continue
+			}
+			if victim == nil || entry.lastUsed.Load() < victim.lastUsed.Load() {
+				victimName, victim = name, entry
+			}
+		}
+		m.mutex.Unlock()
+		if victim == nil || !m.evict(victimName, victim) {
+			return
+		}
+	}
+}
+
+// evict persists and unloads entry unless it is pinned or no longer current. While that
+// happens a placeholder makes concurrent callers wait, so they cannot load a stale file.
+// If the final snapshot fails the entry stays loaded, and a later sweep or load retries.
+// It reports whether the entry was evicted.
+func (m *Manager) evict(name string, entry *managedFilter) bool {
+	m.mutex.Lock()
+	if m.filters[name] != entry || entry.refs > 0 {
+		m.mutex.Unlock()
+		return false
+	}
+	placeholder := &managedFilter{ready: make(chan struct{}), err: errEvicting}
+	m.filters[name] = placeholder
+	m.mutex.Unlock()
+
+	closed := true
+	var err error
+	if m.dir != "" {
+		closed, err = entry.sbf.closeIfSaved(m.path(name))
+	} else {
+		err = entry.sbf.Close()
+	}
+	if err != nil && closed {
+		entry.sbf.options.warnf("bloom: evicting filter %q: %v", name, err)
+	} else if err != nil {
+		entry.sbf.options.warnf("bloom: evicting filter %q: %v; keeping it loaded", name, err)
+	}
+
+	m.mutex.Lock()
+	orphaned := false
+	if closed {
+		delete(m.filters, name)
+	} else if m.filters[name] == placeholder {
+		m.filters[name] = entry
+	} else {
+		// The Manager was closed meanwhile and skipped the placeholder.
+		orphaned = true
+	}
+	m.mutex.Unlock()
+	close(placeholder.ready)
+	if orphaned {
+		entry.sbf.Close()
+	}
+	return closed
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-bloom-filter/bloomtest"
+)
+
+// newEvictingManager returns a Manager over a temporary directory with a fake clock.
+func newEvictingManager(t *testing.T, mopts ManagerOptions, opts ...Option) (*Manager, *bloomtest.FakeClock, string) {
+	t.Helper()
+	dir := t.TempDir()
+	clock := bloomtest.NewFakeClock(time.Unix(0, 0))
+	m, err := NewManagerWithOptions(dir, mopts, append(opts, WithClock(clock))...)
+	if err != nil {
+		t.Fatalf("NewManagerWithOptions: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m, clock, dir
+}
+
+// sweepOnce advances the clock by half of maxIdle, firing one sweep, and waits for the
+// sweeper to be waiting again.
+func sweepOnce(t *testing.T, clock *bloomtest.FakeClock, maxIdle time.Duration) {
+	t.Helper()
+	waitFor(t, "the sweeper", func() bool { return clock.Waiters() == 1 })
+	clock.Advance(maxIdle / 2)
+	waitFor(t, "the sweep", func() bool { return clock.Waiters() == 1 })
+}
+
+// isLoaded reports whether the Manager holds the named filter in memory.
+func isLoaded(m *Manager, name string) bool {
+	_, ok := m.StatsAll()[name]
+	return ok
+}
+
+func TestManagerIdleEviction(t *testing.T) {
+	const maxIdle = 10 * time.Minute
+	m, clock, dir := newEvictingManager(t, ManagerOptions{MaxIdle: maxIdle})
+	idle, err := m.GetOrCreate("idle", testConfig)
+	if err != nil {
+		t.Fatalf("GetOrCreate: %v", err)
+	}
+	addAll(t, idle, testKeys("idle", 20))
+	busy, _ := m.GetOrCreate("busy", testConfig)
+
+	for i := 0; i < 4; i++ {
+		m.Get("busy") // Touched every sweep
+		sweepOnce(t, clock, maxIdle)
+	}
+	if isLoaded(m, "idle") || !isLoaded(m, "busy") {
+		t.Fatalf("loaded filters %v, want only busy after idle exceeded MaxIdle", m.StatsAll())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "idle.bloom")); err != nil {
+		t.Fatalf("evicted filter was not persisted: %v", err)
+	}
+	if err := idle.Add("late"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Add through a pointer to an evicted filter = %v, want ErrClosed", err)
+	}
+
+	reloaded, err := m.Get("idle")
+	if err != nil {
+		t.Fatalf("Get after eviction: %v", err)
+	}
+	if reloaded == idle || !reloaded.AllMightContain(testKeys("idle", 20)) {
+		t.Error("Get after eviction did not reload the persisted filter")
+	}
+	if busy.Add("still open") != nil {
+		t.Error("filter touched within MaxIdle was evicted")
+	}
+}
+
+func TestManagerInMemoryTTL(t *testing.T) {
+	const maxIdle = time.Minute
+	clock := bloomtest.NewFakeClock(time.Unix(0, 0))
+	m, err := NewManagerWithOptions("", ManagerOptions{MaxIdle: maxIdle}, WithClock(clock))
+	if err != nil {
+		t.Fatalf("NewManagerWithOptions: %v", err)
+	}
+	defer m.Close()
+	sbf, _ := m.GetOrCreate("session", testConfig)
+	sbf.Add("token")
+	for i := 0; i < 3; i++ {
+		sweepOnce(t, clock, maxIdle)
+	}
+	if _, err := m.Get("session"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after the TTL = %v, want ErrNotFound", err)
+	}
+}
+
+func TestManagerLRUEviction(t *testing.T) {
+	m, clock, _ := newEvictingManager(t, ManagerOptions{MaxFilters: 2})
+	for _, name := range []string{"a", "b"} {
+		m.GetOrCreate(name, testConfig)
+		clock.Advance(2 * touchGranularity)
+	}
+	m.Get("a") // b is now the least recently used
+	clock.Advance(2 * touchGranularity)
+
+	pinned, release, err := m.Acquire("c", testConfig)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if isLoaded(m, "b") || !isLoaded(m, "a") || !isLoaded(m, "c") {
+		t.Fatalf("loaded filters %v, want a and c after evicting b", m.StatsAll())
+	}
+	pinned.Add("kept")
+
+	// A pinned filter is never the victim, even as the least recently used.
+	clock.Advance(2 * touchGranularity)
+	m.Get("a")
+	m.GetOrCreate("d", testConfig)
+	if !isLoaded(m, "c") || isLoaded(m, "a") {
+		t.Fatalf("loaded filters %v, want the pinned c kept and a evicted", m.StatsAll())
+	}
+	release()
+	clock.Advance(2 * touchGranularity)
+	m.Get("d") // Released and no longer used, c is the least recently used
+	clock.Advance(2 * touchGranularity)
+	m.GetOrCreate("e", testConfig)
+	if isLoaded(m, "c") {
+		t.Error("released filter was not evicted as the least recently used")
+	}
+	if sbf, err := m.Get("c"); err != nil || !sbf.MightContain("kept") {
+		t.Errorf("reloading c = %v, want its items back", err)
+	}
+}
+
+func TestManagerEvictReject(t *testing.T) {
+	m, _, _ := newEvictingManager(t, ManagerOptions{MaxFilters: 1, EvictPolicy: EvictReject})
+	if _, err := m.GetOrCreate("a", testConfig); err != nil {
+		t.Fatalf("GetOrCreate: %v", err)
+	}
+	if _, err := m.GetOrCreate("b", testConfig); !errors.Is(err, ErrTooManyFilters) {
+		t.Errorf("GetOrCreate over MaxFilters = %v, want ErrTooManyFilters", err)
+	}
+	if _, err := m.Get("a"); err != nil {
+		t.Errorf("Get of a loaded filter at MaxFilters: %v", err)
+	}
+}
+
+func TestManagerEvictionSnapshotFailure(t *testing.T) {
+	const maxIdle = time.Minute
+	logger := &captureLogger{}
+	m, clock, dir := newEvictingManager(t, ManagerOptions{MaxIdle: maxIdle}, WithLogger(logger))
+	sbf, _ := m.GetOrCreate("tenant", testConfig)
+	addAll(t, sbf, testKeys("item", 20))
+
+	// A directory in the way makes the snapshot fail.
+	blocker := filepath.Join(dir, "tenant.bloom")
+	if err := os.Mkdir(blocker, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		sweepOnce(t, clock, maxIdle)
+	}
+	if !isLoaded(m, "tenant") {
+		t.Fatal("filter was unloaded although its snapshot failed")
+	}
+	if err := sbf.Add("during outage"); err != nil {
+		t.Fatalf("Add after a failed eviction: %v", err)
+	}
+	warnings := logger.logged()
+	if len(warnings) == 0 || !strings.Contains(warnings[0], "keeping it loaded") {
+		t.Errorf("warnings = %q, want the failed eviction reported", warnings)
+	}
+
+	// Once the snapshot can be written, the next sweep evicts the filter with everything.
+	os.Remove(blocker)
+	sweepOnce(t, clock, maxIdle)
+	if isLoaded(m, "tenant") {
+		t.Fatal("filter was not evicted once its snapshot could be written")
+	}
+	reloaded, err := m.Get("tenant")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !reloaded.AllMightContain(append(testKeys("item", 20), "during outage")) {
+		t.Error("reloaded filter lacks items added before or after the failed eviction")
+	}
+}
+
+// TestManagerEvictionNoLostAdds adds through GetOrCreate while sweeps evict the filter,
+// retrying writes that hit an evicted filter, and checks every add survives the reloads.
+func TestManagerEvictionNoLostAdds(t *testing.T) {
+	const maxIdle = 2 * time.Second
+	m, clock, _ := newEvictingManager(t, ManagerOptions{MaxIdle: maxIdle})
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				if clock.Waiters() == 1 {
+					clock.Advance(2 * maxIdle) // Past MaxIdle since the last add
+				}
+				runtime.Gosched()
+			}
+		}
+	}()
+
+	// Keep adding until the filter has been evicted and reloaded a few times.
+	var keys []string
+	loads := make(map[*ScalableBloomFilter]bool)
+	for i := 0; len(loads) < 4; i++ {
+		if i == 1e6 {
+			t.Fatalf("the filter was evicted %d times in %d adds, want 3", len(loads)-1, i)
+		}
+		key := fmt.Sprintf("key-%d", i)
+		for {
+			sbf, err := m.GetOrCreate("tenant", testConfig)
+			if err != nil {
+				t.Fatalf("GetOrCreate: %v", err)
+			}
+			loads[sbf] = true
+			if _, err := sbf.TestAndAdd(key); err == nil {
+				break
+			} else if !errors.Is(err, ErrClosed) {
+				t.Fatalf("TestAndAdd: %v", err)
+			}
+		}
+		keys = append(keys, key)
+	}
+	close(done)
+	wg.Wait()
+
+	sbf, err := m.Get("tenant")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !sbf.AllMightContain(keys) {
+		t.Error("an add was lost across evictions")
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import "encoding/binary"
+
+// Explanation traces how a Scalable Bloom Filter arrives at its verdict for an item,
+// for debugging surprising answers such as a false positive.
+type Explanation struct {
+	Item         string             `json:"item"`
+	Key          string             `json:"key"`           // Item after key normalization
+	Hash1        uint32             `json:"hash1"`         // First half of the digest, the base index
+	Hash2        uint32             `json:"hash2"`         // Second half of the digest, the index step
+	Stages       []StageExplanation `json:"stages"`        // One per sub-filter, oldest first
+	Present      bool               `json:"present"`       // The verdict of MightContain
+	MatchedStage int                `json:"matched_stage"` // Oldest sub-filter with every probed bit set; -1 if none
+}
+
+// StageExplanation lists the bits probed for an item in one sub-filter.
+type StageExplanation struct {
+	Indices []uint `json:"indices"` // Probed bit indices, one per hash function
+	Set     []bool `json:"set"`     // Whether each probed bit is set
+	Match   bool   `json:"match"`   // Whether every probed bit is set
+}
+
+// Explain returns the digest of item, the bits probed in every sub-filter and whether
+// each is set, together with the resulting verdict. The item is present if any
+// sub-filter has all of its probed bits set.
+func (sbf *ScalableBloomFilter) Explain(item string) Explanation {
+	key := sbf.options.normalizer.Normalize(item)
+	sum := sbf.options.hasher.Sum([]byte(key))
+	explanation := Explanation{
+		Item:         item,
+		Key:          key,
+		Hash1:        binary.BigEndian.Uint32(sum[0:4]),
+		Hash2:        binary.BigEndian.Uint32(sum[4:8]),
+		MatchedStage: -1,
+	}
+
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+
+	explanation.Stages = make([]StageExplanation, len(sbf.filters))
+	for i, filter := range sbf.filters {
+		filter.mutex.RLock()
+		indices := filter.indices(sum)
+		stage := StageExplanation{Indices: indices, Set: make([]bool, len(indices)), Match: true}
+		for j, index := range indices {
+			stage.Set[j] = filter.bitset[index/8]&filter.bitOrder.mask(index) != 0
+			stage.Match = stage.Match && stage.Set[j]
+		}
+		filter.mutex.RUnlock()
+
+		explanation.Stages[i] = stage
+		if stage.Match && !explanation.Present {
+			explanation.Present = true
+			explanation.MatchedStage = i
+		}
+	}
+	return explanation
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// FallbackStats holds the counters maintained by CheckWithFallback.
+type FallbackStats struct {
+	ShortCircuited uint64 // Queries answered false by the filter without calling verify
+	OverlayHits    uint64 // Queries answered false from recorded false positives
+	FallbackCalls  uint64 // Queries that called verify
+	FalsePositives uint64 // Fallback calls where verify reported the item absent
+}
+
+// fallbackState holds the counters and the false-positive overlay of a ScalableBloomFilter.
+type fallbackState struct {
+	shortCircuited atomic.Uint64
+	overlayHits    atomic.Uint64
+	fallbackCalls  atomic.Uint64
+	falsePositives atomic.Uint64
+
+	overlay map[string]struct{} // Digests confirmed absent by verify; nil unless enabled
+	mutex   sync.RWMutex
+}
+
+// WithFalsePositiveOverlay makes CheckWithFallback remember items that verify reported
+// absent, so repeated queries for the same false positive skip the fallback. An item is
+// dropped from the overlay as soon as it is actually added. The overlay grows with every
+// distinct false positive and is not persisted.
+func WithFalsePositiveOverlay() Option {
+	return func(o *options) {
+		o.falsePositiveOverlay = true
+	}
+}
+
+// CheckWithFallback implements the bloom-filter-then-source-of-truth pattern. It returns
+// false immediately when the filter reports the item definitely absent, and otherwise
+// returns the answer of verify, which should consult the authoritative store.
+func (sbf *ScalableBloomFilter) CheckWithFallback(ctx context.Context, item string, verify func(context.Context, string) (bool, error)) (bool, error) {
+	sum := sbf.digest(item)
+
+	sbf.mutex.RLock()
+	present := sbf.containsDigest(sum)
+	sbf.mutex.RUnlock()
+
+	if !present {
+		sbf.fallback.shortCircuited.Add(1)
+		return false, nil
+	}
+
+	if sbf.options.falsePositiveOverlay {
+		sbf.fallback.mutex.RLock()
+		_, known := sbf.fallback.overlay[string(sum)]
+		sbf.fallback.mutex.RUnlock()
+		if known {
+			sbf.fallback.overlayHits.Add(1)
+			return false, nil
+		}
+	}
+
+	sbf.fallback.fallbackCalls.Add(1)
+	exists, err := verify(ctx, item)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		sbf.fallback.falsePositives.Add(1)
+		if sbf.options.falsePositiveOverlay {
+			sbf.fallback.mutex.Lock()
+			if sbf.fallback.overlay == nil {
+				sbf.fallback.overlay = make(map[string]struct{})
+			}
+			sbf.fallback.overlay[string(sum)] = struct{}{}
+			sbf.fallback.mutex.Unlock()
+		}
+	}
+	return exists, nil
+}
+
+// FallbackStats returns a snapshot of the CheckWithFallback counters.
+func (sbf *ScalableBloomFilter) FallbackStats() FallbackStats {
+	return FallbackStats{
+		ShortCircuited: sbf.fallback.shortCircuited.Load(),
+		OverlayHits:    sbf.fallback.overlayHits.Load(),
+		FallbackCalls:  sbf.fallback.fallbackCalls.Load(),
+		FalsePositives: sbf.fallback.falsePositives.Load(),
+	}
+}
+
+// forget removes a digest from the false-positive overlay once the item is really added.
+func (fs *fallbackState) forget(sum []byte) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	delete(fs.overlay, string(sum))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fakeStore is a source of truth for CheckWithFallback that counts its lookups.
+type fakeStore struct {
+	items map[string]bool
+	calls int
+	err   error
+}
+
+func (s *fakeStore) verify(ctx context.Context, item string) (bool, error) {
+	s.calls++
+	return s.items[item], s.err
+}
+
+// check runs CheckWithFallback and fails the test on an error.
+func check(t *testing.T, sbf *ScalableBloomFilter, store *fakeStore, item string) bool {
+	t.Helper()
+	present, err := sbf.CheckWithFallback(context.Background(), item, store.verify)
+	if err != nil {
+		t.Fatalf("CheckWithFallback(%q): %v", item, err)
+	}
+	return present
+}
+
+func TestCheckWithFallback(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	// "stale" is in the filter but no longer in the store, so it is a false positive.
+	addAll(t, sbf, []string{"hit", "stale"})
+	store := &fakeStore{items: map[string]bool{"hit": true}}
+
+	if !check(t, sbf, store, "hit") {
+		t.Error("hit: got false, want true")
+	}
+	if check(t, sbf, store, "miss") {
+		t.Error("miss: got true, want false")
+	}
+	if check(t, sbf, store, "stale") || check(t, sbf, store, "stale") {
+		t.Error("false positive: got true, want false")
+	}
+	// Without the overlay, every false positive goes to the store.
+	if store.calls != 3 {
+		t.Errorf("verify called %d times, want 3", store.calls)
+	}
+	want := FallbackStats{ShortCircuited: 1, FallbackCalls: 3, FalsePositives: 2}
+	if got := sbf.FallbackStats(); got != want {
+		t.Errorf("FallbackStats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCheckWithFallbackOverlay(t *testing.T) {
+	sbf := newTestFilter(t, testConfig, WithFalsePositiveOverlay())
+	addAll(t, sbf, []string{"stale"})
+	store := &fakeStore{items: map[string]bool{}}
+
+	for i := 0; i < 3; i++ {
+		if check(t, sbf, store, "stale") {
+			t.Fatal("false positive: got true, want false")
+		}
+	}
+	if store.calls != 1 {
+		t.Errorf("verify called %d times for a repeated false positive, want 1", store.calls)
+	}
+
+	// Once the item is really added, it leaves the overlay and the store is asked again.
+	store.items["stale"] = true
+	addAll(t, sbf, []string{"stale"})
+	if !check(t, sbf, store, "stale") {
+		t.Error("re-added item: got false, want true")
+	}
+	want := FallbackStats{OverlayHits: 2, FallbackCalls: 2, FalsePositives: 1}
+	if got := sbf.FallbackStats(); got != want {
+		t.Errorf("FallbackStats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCheckWithFallbackError(t *testing.T) {
+	sbf := newTestFilter(t, testConfig, WithFalsePositiveOverlay())
+	addAll(t, sbf, []string{"item"})
+	errStore := errors.New("store unavailable")
+	store := &fakeStore{err: errStore}
+
+	if _, err := sbf.CheckWithFallback(context.Background(), "item", store.verify); !errors.Is(err, errStore) {
+		t.Fatalf("CheckWithFallback = %v, want the verify error", err)
+	}
+	// A failed lookup is not a confirmed false positive.
+	store.err = nil
+	store.items = map[string]bool{"item": true}
+	if !check(t, sbf, store, "item") {
+		t.Error("item: got false after the store recovered, want true")
+	}
+	if got := sbf.FallbackStats().FalsePositives; got != 0 {
+		t.Errorf("FalsePositives = %d, want 0", got)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrUnsupported is returned when an operation is not supported by the underlying filter type.
+	ErrUnsupported = errors.New("operation not supported by this filter")
+	// ErrReadOnly is returned when mutating a filter that has been frozen.
+	ErrReadOnly = errors.New("filter is read-only")
+	// ErrClosed is returned when using a filter after Close.
+	ErrClosed = errors.New("filter is closed")
+	// ErrCapacityOverflow is returned when a Scalable Bloom Filter cannot grow because the
+	// next sub-filter's size would overflow.
+	ErrCapacityOverflow = errors.New("filter capacity overflow")
+	// ErrMaxFilters is returned when a Scalable Bloom Filter is full and already has the
+	// maximum number of sub-filters allowed by its Config.
+	ErrMaxFilters = errors.New("filter has reached its maximum number of sub-filters")
+	// ErrDegraded is returned by HealthCheck when a filter's accuracy has degraded.
+	ErrDegraded = errors.New("filter is degraded")
+)
+
+// Filter is the membership interface shared by the filter types in this package.
+// It lets helpers such as DedupWriter work with any of them, or with an exact set.
+type Filter interface {
+	// MightContain returns true if the item might be present, false if it is definitely not present.
+	MightContain(item string) bool
+	// TestAndAdd reports whether the item might already be present and inserts it otherwise.
+	TestAndAdd(item string) (bool, error)
+}
+
+// ExactSet is a Filter backed by a map. It never yields false positives, at the cost of
+// storing every item, which makes it a good choice for small volumes.
+type ExactSet struct {
+	items map[string]struct{}
+	mutex sync.RWMutex
+}
+
+// NewExactSet creates an empty ExactSet.
+func NewExactSet() *ExactSet {
+	return &ExactSet{items: make(map[string]struct{})}
+}
+
+// MightContain reports whether the item is in the set.
+func (s *ExactSet) MightContain(item string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	_, ok := s.items[item]
+	return ok
+}
+
+// TestAndAdd reports whether the item is already in the set and inserts it otherwise.
+func (s *ExactSet) TestAndAdd(item string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.items[item]; ok {
+		return true, nil
+	}
+	s.items[item] = struct{}{}
+	return false, nil
+}
+
+// ItemCount returns the number of items in the set.
+func (s *ExactSet) ItemCount() uint {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return uint(len(s.items))
+}
+
+// Compile-time checks that the filter types implement Filter.
+var (
+	_ Filter = (*BloomFilter)(nil)
+	_ Filter = (*ScalableBloomFilter)(nil)
+	_ Filter = (*CountingBloomFilter)(nil)
+	_ Filter = (*StableBloomFilter)(nil)
+	_ Filter = (*RotatingBloomFilter)(nil)
+	_ Filter = (*ExactSet)(nil)
+	_ Filter = (*MigratingFilter)(nil)
+)
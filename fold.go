@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// minFoldBits is the smallest bit size a filter can be folded down to.
+const minFoldBits = 8
+
+// WithFoldable rounds each filter's bit size up to a power of two (at least 16 bits),
+// which lets Fold halve it repeatedly. The extra bits lower the false positive rate
+// slightly until the filter is folded.
+func WithFoldable() Option {
+	return func(o *options) {
+		o.foldable = true
+	}
+}
+
+// foldableBitSize rounds m up to the next power of two, and to at least 2*minFoldBits.
+func foldableBitSize(m uint) uint {
+	if m <= 2*minFoldBits {
+		return 2 * minFoldBits
+	}
+	return 1 << bits.Len(m-1)
+}
+
+// Fold halves the filter's bit size by ORing the top half of the bitset onto the bottom
+// half; lookups then reduce indices modulo the new size. Every inserted item stays present,
+// so there are still no false negatives, but the false positive rate rises. Fold returns
+// the new estimated false positive rate so callers can decide whether to fold further.
+// The bit size must be even and its half a whole number of bytes, which filters built
+// WithFoldable guarantee down to 8 bits.
+func (bf *BloomFilter) Fold() (float64, error) {
+	bf.mutex.Lock()
+	half := bf.bitSize / 2
+	if bf.bitSize%2 != 0 || half%8 != 0 || half < minFoldBits {
+		bf.mutex.Unlock()
+		return 0, errors.New("bit size cannot be halved on a byte boundary; build the filter WithFoldable")
+	}
+
+	halfBytes := half / 8
+	folded := make([]uint8, halfBytes)
+	for i := range folded {
+		folded[i] = bf.bitset[i] | bf.bitset[uint(i)+halfBytes]
+	}
+	bf.bitset = folded
+	bf.bitSize = half
+	bf.mutex.Unlock()
+
+	return bf.EstimatedFP(), nil
+}
+
+// UnionFolded combines two filters whose bit sizes differ by a power-of-two factor, such as
+// filters from producers that sized them differently: the larger one is folded down to the
+// smaller one's size and the two are ORed into a new filter. Neither input is modified.
+// Both must share the number of hash functions, hasher, bit order and key normalizer.
+// It returns the result's estimated false positive rate and refuses the combination with
+// an error if that rate would exceed maxFP.
+func UnionFolded(a, b *BloomFilter, maxFP float64) (*BloomFilter, float64, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	if a != b {
+		b.mutex.RLock()
+		defer b.mutex.RUnlock()
+	}
+
+	large, small := a, b
+	if large.bitSize < small.bitSize {
+		large, small = small, large
+	}
+	smallHeader, largeHeader := small.header(), large.header()
+	largeHeader.bitSize = smallHeader.bitSize
+	if err := smallHeader.compatible(largeHeader); err != nil {
+		return nil, 0, misuse(a.strict || b.strict, fmt.Errorf("filters are incompatible: %w", err))
+	}
+	ratio := large.bitSize / small.bitSize
+	if large.bitSize%small.bitSize != 0 || bits.OnesCount(ratio) != 1 {
+		return nil, 0, fmt.Errorf("bit sizes %d and %d do not differ by a power-of-two factor", a.bitSize, b.bitSize)
+	}
+	if ratio > 1 && small.bitSize%8 != 0 {
+		return nil, 0, errors.New("the smaller bit size must be a whole number of bytes to fold onto")
+	}
+
+	// Fold the larger bitset in halves down to the smaller size; every intermediate size is a
+	// multiple of the smaller one and therefore byte-aligned.
+	folded := large.bitset
+	for size := large.bitSize; size > small.bitSize; size /= 2 {
+		halfBytes := size / 16
+		next := make([]uint8, halfBytes)
+		for i := range next {
+			next[i] = folded[i] | folded[uint(i)+halfBytes]
+		}
+		folded = next
+	}
+
+	result := &BloomFilter{
+		bitset:       make([]uint8, len(small.usedBytes())),
+		bitSize:      small.bitSize,
+		numHashFuncs: small.numHashFuncs,
+		capacity:     small.capacity + large.capacity,
+		bitOrder:     small.bitOrder,
+		hasher:       small.hasher,
+		normalizer:   small.normalizer,
+		logger:       small.logger,
+		strict:       small.strict,
+		count:        small.count + large.count,
+
+		trackSelfCollisions: small.trackSelfCollisions,
+	}
+	for i := range result.bitset {
+		result.bitset[i] = small.bitset[i] | folded[i]
+	}
+
+	fp := math.Pow(float64(popCount(result.bitset))/float64(result.bitSize), float64(result.numHashFuncs))
+	if fp > maxFP {
+		return nil, fp, fmt.Errorf("estimated false positive rate %g of the union exceeds the ceiling %g", fp, maxFP)
+	}
+	return result, fp, nil
+}
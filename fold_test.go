@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestFold(t *testing.T) {
+	bf := NewBloomFilter(1000, 0.01, WithFoldable())
+	if bits := bf.bitSize; bits&(bits-1) != 0 {
+		t.Fatalf("WithFoldable bit size %d, want a power of two", bits)
+	}
+	members := testKeys("member", 500)
+	for _, key := range members {
+		bf.Add(key)
+	}
+	absent := testKeys("absent", 20000)
+
+	for fold := 1; fold <= 2; fold++ {
+		// Halves are filled independently, so a bit of the folded filter is clear only if
+		// both bits folded onto it were.
+		fill := bf.FillRatio()
+		predicted := math.Pow(1-(1-fill)*(1-fill), float64(bf.numHashFuncs))
+		size := bf.bitSize
+
+		got, err := bf.Fold()
+		if err != nil {
+			t.Fatalf("fold %d: %v", fold, err)
+		}
+		if bf.bitSize != size/2 || uint(len(bf.bitset))*8 != bf.bitSize {
+			t.Fatalf("fold %d: bit size %d in %d bytes, want %d", fold, bf.bitSize, len(bf.bitset), size/2)
+		}
+		if math.Abs(got-predicted) > 0.2*predicted {
+			t.Errorf("fold %d: estimated FP %.5f, want about %.5f", fold, got, predicted)
+		}
+		for _, key := range members {
+			if !bf.MightContain(key) {
+				t.Fatalf("fold %d: MightContain(%q) = false for an inserted key", fold, key)
+			}
+		}
+
+		positives := 0
+		for _, key := range absent {
+			if bf.MightContain(key) {
+				positives++
+			}
+		}
+		if rate := float64(positives) / float64(len(absent)); math.Abs(rate-got) > 0.3*got+0.001 {
+			t.Errorf("fold %d: measured FP %.5f, estimated %.5f", fold, rate, got)
+		}
+	}
+}
+
+func TestFoldErrors(t *testing.T) {
+	if _, err := NewBloomFilter(1000, 0.01).Fold(); err == nil {
+		t.Error("Fold of a filter not built WithFoldable succeeded")
+	}
+
+	bf := NewBloomFilter(1, 0.5, WithFoldable())
+	if bf.bitSize != 2*minFoldBits {
+		t.Fatalf("smallest foldable bit size %d, want %d", bf.bitSize, 2*minFoldBits)
+	}
+	if _, err := bf.Fold(); err != nil {
+		t.Fatalf("Fold to %d bits: %v", minFoldBits, err)
+	}
+	if _, err := bf.Fold(); err == nil {
+		t.Errorf("Fold below %d bits succeeded", minFoldBits)
+	}
+}
+
+func TestUnionFolded(t *testing.T) {
+	for _, factor := range []int{1, 2, 4} {
+		small := NewBloomFilter(1000, 0.01, WithFoldable())
+		large := NewBloomFilter(1000*factor, 0.01, WithFoldable())
+		if large.bitSize != uint(factor)*small.bitSize || large.numHashFuncs != small.numHashFuncs {
+			t.Fatalf("%d×: bit sizes %d and %d with k %d and %d", factor, small.bitSize, large.bitSize,
+				small.numHashFuncs, large.numHashFuncs)
+		}
+		smallKeys, largeKeys := testKeys("small", 300), testKeys("large", 300)
+		for i := range smallKeys {
+			small.Add(smallKeys[i])
+			large.Add(largeKeys[i])
+		}
+		largeBits := append([]uint8(nil), large.bitset...)
+
+		// Either argument order works.
+		for _, args := range [][2]*BloomFilter{{small, large}, {large, small}} {
+			union, fp, err := UnionFolded(args[0], args[1], 0.05)
+			if err != nil {
+				t.Fatalf("%d×: UnionFolded: %v", factor, err)
+			}
+			if union.bitSize != small.bitSize {
+				t.Errorf("%d×: union bit size %d, want %d", factor, union.bitSize, small.bitSize)
+			}
+			if want := union.EstimatedFP(); fp != want {
+				t.Errorf("%d×: reported FP %g, want the union's estimate %g", factor, fp, want)
+			}
+			if union.ItemCount() != 600 {
+				t.Errorf("%d×: union count %d, want 600", factor, union.ItemCount())
+			}
+			for _, key := range append(smallKeys, largeKeys...) {
+				if !union.MightContain(key) {
+					t.Fatalf("%d×: MightContain(%q) = false for an item of either input", factor, key)
+				}
+			}
+		}
+		if !bytes.Equal(large.bitset, largeBits) {
+			t.Errorf("%d×: UnionFolded modified its input", factor)
+		}
+	}
+}
+
+func TestUnionFoldedRefused(t *testing.T) {
+	small := NewBloomFilter(1000, 0.01, WithFoldable())
+	for _, key := range testKeys("small", 1000) {
+		small.Add(key)
+	}
+
+	large := NewBloomFilter(2000, 0.01, WithFoldable())
+	for _, key := range testKeys("large", 2000) {
+		large.Add(key)
+	}
+	union, fp, err := UnionFolded(small, large, 0.01)
+	if err == nil || union != nil {
+		t.Fatalf("UnionFolded over the FP ceiling succeeded with estimate %g", fp)
+	}
+	if fp <= 0.01 {
+		t.Errorf("refused union reported FP %g, want the estimate above the ceiling", fp)
+	}
+
+	notPowerOfTwo := NewBloomFilter(1000, 0.01, WithFoldable())
+	notPowerOfTwo.bitSize *= 3
+	notPowerOfTwo.bitset = make([]uint8, 3*len(small.bitset))
+	for name, other := range map[string]*BloomFilter{
+		"3× bit size": notPowerOfTwo,
+		"hasher":      NewBloomFilter(2000, 0.01, WithFoldable(), WithHasher(FNVHasher)),
+		"hash count":  NewBloomFilter(2000, 0.0001, WithFoldable()),
+	} {
+		if _, _, err := UnionFolded(small, other, 1); err == nil {
+			t.Errorf("UnionFolded with a different %s succeeded", name)
+		}
+	}
+}
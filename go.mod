@@ -1,3 +1,8 @@
 module github.com/go-bloom-filter
 
 go 1.22.1
+
+require (
+	github.com/klauspost/compress v1.18.0
+	golang.org/x/text v0.21.0
+)
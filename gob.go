@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"time"
+)
+
+// gobBloomFilter is the gob wire representation of a BloomFilter, also used for JSON.
+type gobBloomFilter struct {
+	Bitset       []uint8   `json:"bitset"`
+	BitSize      uint      `json:"bit_size"`
+	NumHashFuncs uint      `json:"num_hash_funcs"`
+	Capacity     int       `json:"capacity"`
+	TargetFP     float64   `json:"target_fp"`
+	Created      time.Time `json:"created"`
+	BitOrder     BitOrder  `json:"bit_order"`
+	Hasher       string    `json:"hasher"`
+	Count        uint      `json:"count"`
+}
+
+// gobFormatVersion is the current version of the gob wire representation. Data written
+// before the version was recorded decodes with Version 0 and is reported as version 1.
+const gobFormatVersion = 2
+
+// gobScalableBloomFilter is the gob wire representation of a ScalableBloomFilter, also
+// used for JSON.
+type gobScalableBloomFilter struct {
+	Version    int              `json:"version"`
+	Config     Config           `json:"config"`
+	BitOrder   BitOrder         `json:"bit_order"`
+	Hasher     string           `json:"hasher"`
+	Normalizer string           `json:"normalizer"`
+	Frozen     bool             `json:"frozen"`
+	Filters    []gobBloomFilter `json:"filters"`
+}
+
+// GobEncode implements gob.GobEncoder so a ScalableBloomFilter can be persisted with encoding/gob.
+func (sbf *ScalableBloomFilter) GobEncode() ([]byte, error) {
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+
+	if sbf.closed {
+		return nil, ErrClosed
+	}
+	return sbf.encodeGob()
+}
+
+// encodeGob encodes the filter even if it is being closed, so cleanups registered with
+// onClose can take a final snapshot; the caller must hold at least the read lock.
+func (sbf *ScalableBloomFilter) encodeGob() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(sbf.fullWire()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fullWire returns the wire representation of the filter including its sub-filters;
+// the caller must hold at least the read lock.
+func (sbf *ScalableBloomFilter) fullWire() gobScalableBloomFilter {
+	wire := sbf.gobWire()
+	wire.Filters = make([]gobBloomFilter, len(sbf.filters))
+	for i, filter := range sbf.filters {
+		wire.Filters[i] = filter.gobWire()
+	}
+	return wire
+}
+
+// gobWire returns the wire representation of everything but the sub-filters;
+// the caller must hold at least the read lock.
+func (sbf *ScalableBloomFilter) gobWire() gobScalableBloomFilter {
+	return gobScalableBloomFilter{
+		Version:    gobFormatVersion,
+		Config:     sbf.config(),
+		BitOrder:   sbf.options.bitOrder,
+		Hasher:     sbf.options.hasher.Name(),
+		Normalizer: sbf.options.normalizer.Name(),
+		Frozen:     sbf.frozen,
+	}
+}
+
+// gobWire returns the wire representation of the filter, with a copy of its bitset.
+func (bf *BloomFilter) gobWire() gobBloomFilter {
+	bf.mutex.RLock()
+	defer bf.mutex.RUnlock()
+
+	return gobBloomFilter{
+		Bitset:       append([]uint8(nil), bf.usedBytes()...),
+		BitSize:      bf.bitSize,
+		NumHashFuncs: bf.numHashFuncs,
+		Capacity:     bf.capacity,
+		TargetFP:     bf.targetFP,
+		Created:      bf.created,
+		BitOrder:     bf.bitOrder,
+		Hasher:       bf.hasher.Name(),
+		Count:        bf.count,
+	}
+}
+
+// GobDecode implements gob.GobDecoder, replacing the receiver's contents with the decoded filter.
+func (sbf *ScalableBloomFilter) GobDecode(data []byte) error {
+	var wire gobScalableBloomFilter
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&wire); err != nil {
+		return err
+	}
+	return sbf.decodeWire(wire)
+}
+
+// decodeWire replaces the receiver's contents with a decoded wire representation.
+func (sbf *ScalableBloomFilter) decodeWire(wire gobScalableBloomFilter) error {
+	if wire.Version > gobFormatVersion {
+		return fmt.Errorf("gob: unsupported format version %d", wire.Version)
+	}
+	// Reuse the constructor's parameter validation for the embedded configuration.
+	if _, err := NewScalableBloomFilter(wire.Config); err != nil {
+		return err
+	}
+
+	hasher, err := gobHasher(wire.Hasher)
+	if err != nil {
+		return err
+	}
+	normalizer, err := LookupKeyNormalizer(wire.Normalizer)
+	if err != nil {
+		return err
+	}
+	if configured := sbf.options.normalizer.Name(); configured != "" && configured != wire.Normalizer {
+		return fmt.Errorf("gob: filter was built with key normalizer %q, not %q", wire.Normalizer, configured)
+	}
+	filters := make([]*BloomFilter, len(wire.Filters))
+	for i, f := range wire.Filters {
+		filterHasher, err := gobHasher(f.Hasher)
+		if err != nil {
+			return err
+		}
+		if f.Capacity <= 0 {
+			// Without a recorded capacity, treat the sub-filter as full so new items go to a fresh one.
+			f.Capacity = int(f.Count)
+		}
+		filters[i] = &BloomFilter{
+			bitset:       f.Bitset,
+			bitSize:      f.BitSize,
+			numHashFuncs: f.NumHashFuncs,
+			capacity:     f.Capacity,
+			targetFP:     f.TargetFP,
+			created:      f.Created,
+			bitOrder:     f.BitOrder,
+			hasher:       filterHasher,
+			normalizer:   normalizer,
+			logger:       sbf.options.logger,
+			strict:       sbf.options.strict,
+			count:        f.Count,
+
+			trackSelfCollisions: sbf.options.trackSelfCollisions,
+		}
+		if err := filters[i].validate(); err != nil {
+			return fmt.Errorf("gob: sub-filter %d: %w", i, err)
+		}
+		filters[i].bitset = alignBitset(f.Bitset, sbf.options.bitsetAlignment)
+	}
+
+	sbf.mutex.Lock()
+	defer sbf.mutex.Unlock()
+
+	if sbf.closed {
+		return ErrClosed
+	}
+	if sbf.frozen {
+		return ErrReadOnly
+	}
+	sbf.filters = filters
+	sbf.initialFP = wire.Config.InitialFP
+	sbf.growthFactor = wire.Config.GrowthFactor
+	sbf.tighteningRatio = wire.Config.TighteningRatio
+	sbf.initialCapacity = wire.Config.InitialCapacity
+	sbf.maxFilters = wire.Config.MaxFilters
+	sbf.minFP = wire.Config.MinFP
+	sbf.options.bitOrder = wire.BitOrder
+	sbf.options.hasher = hasher
+	sbf.options.normalizer = normalizer
+	sbf.frozen = wire.Frozen
+	sbf.formatVersion = max(wire.Version, 1)
+	if sbf.options.clock == nil {
+		// Decoding into a zero ScalableBloomFilter skips the constructor's defaults.
+		sbf.options.clock = realClock{}
+	}
+	return nil
+}
+
+// gobHasher resolves a serialized hasher name; data written before hashers were
+// configurable has no name and always used MD5.
+func gobHasher(name string) (Hasher, error) {
+	if name == "" {
+		return MD5Hasher, nil
+	}
+	return LookupHasher(name)
+}
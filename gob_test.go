@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"testing"
+)
+
+// sameBits reports whether a and b have sub-filters with identical dimensions and bits.
+func sameBits(a, b *ScalableBloomFilter) bool {
+	if len(a.filters) != len(b.filters) {
+		return false
+	}
+	for i := range a.filters {
+		fa, fb := a.filters[i], b.filters[i]
+		if fa.bitSize != fb.bitSize || fa.numHashFuncs != fb.numHashFuncs || !bytes.Equal(fa.usedBytes(), fb.usedBytes()) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestGobRoundTrip(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	keys := testKeys("gob", 1000) // Several sub-filters
+	addAll(t, sbf, keys)
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(sbf); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	var decoded ScalableBloomFilter
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	if got := decoded.Config(); got != sbf.Config() {
+		t.Errorf("decoded Config() = %+v, want %+v", got, sbf.Config())
+	}
+	if got, want := decoded.ItemCount(), sbf.ItemCount(); got != want {
+		t.Errorf("decoded ItemCount() = %d, want %d", got, want)
+	}
+	if !sameBits(&decoded, sbf) {
+		t.Error("decoded sub-filters differ from the original ones")
+	}
+	for _, key := range keys {
+		if !decoded.MightContain(key) {
+			t.Fatalf("decoded MightContain(%q) = false", key)
+		}
+	}
+	// The decoded filter keeps growing like the original.
+	more := testKeys("more", 1000)
+	addAll(t, &decoded, more)
+	if len(decoded.filters) <= len(sbf.filters) {
+		t.Errorf("decoded filter has %d sub-filters after more adds, want more than %d", len(decoded.filters), len(sbf.filters))
+	}
+}
+
+func TestGobDecodeGarbage(t *testing.T) {
+	var sbf ScalableBloomFilter
+	if err := sbf.GobDecode([]byte("not gob")); err == nil {
+		t.Error("GobDecode of garbage succeeded")
+	}
+}
+
+func TestGobDecodeWrappedBitSize(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	addAll(t, sbf, testKeys("gob", 10))
+	data, err := sbf.GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wire gobScalableBloomFilter
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&wire); err != nil {
+		t.Fatal(err)
+	}
+	// (bitSize+7)/8 wraps to 0, which an empty bitset would otherwise satisfy.
+	wire.Filters[0].BitSize = math.MaxUint
+	wire.Filters[0].Bitset = nil
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(wire); err != nil {
+		t.Fatal(err)
+	}
+	var decoded ScalableBloomFilter
+	if err := decoded.GobDecode(buf.Bytes()); err == nil {
+		t.Error("GobDecode of a sub-filter with a wrapped bit size succeeded")
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// gobScanner decodes a gob stream without the types it was encoded from, so the metadata
+// of a filter file can be read while its bitsets are skipped rather than loaded. Values
+// decode to bool, int64, uint64, float64, string, []byte for GobEncoder types,
+// map[string]any for structs and []any for slices and arrays; byte slices decode to
+// gobSkipped. Maps and interfaces, which the filter formats do not use, are rejected.
+type gobScanner struct {
+	r     *bufio.Reader
+	src   io.Reader
+	size  int64 // Length of src if it can seek, otherwise -1
+	off   int64 // Offset of the next unread byte
+	types map[int64]gobType
+}
+
+// gobSkipped stands for a byte slice that was skipped; it holds the slice's length.
+type gobSkipped int64
+
+// gobMaxInline bounds the strings and GobEncoder values the scanner reads into memory,
+// which are names and timestamps in valid filter files.
+const gobMaxInline = 1 << 16
+
+// Kinds of gob types, as far as the scanner distinguishes them.
+const (
+	gobKindStruct = iota + 1
+	gobKindSlice
+	gobKindArray
+	gobKindMap
+	gobKindEncoder
+)
+
+// gobType is a type definition of a gob stream.
+type gobType struct {
+	kind   int
+	fields []gobField
+	elem   int64
+}
+
+// gobField is a field of a struct type definition.
+type gobField struct {
+	name string
+	id   int64
+}
+
+// Ids of the types that gob predefines rather than sending. gobEncoderTypeID is not a gob
+// id; the encoder never sends the definition of wireType, so any unused key will do.
+const (
+	gobBoolID        = 1
+	gobIntID         = 2
+	gobUintID        = 3
+	gobFloatID       = 4
+	gobBytesID       = 5
+	gobStringID      = 6
+	gobComplexID     = 7
+	gobWireTypeID    = 16
+	gobEncoderTypeID = -1
+)
+
+// gobPredefined describes the type definitions that gob itself uses to send types.
+func gobPredefined() map[int64]gobType {
+	common := gobField{"CommonType", 18}
+	return map[int64]gobType{
+		16: {kind: gobKindStruct, fields: []gobField{
+			{"ArrayT", 17}, {"SliceT", 19}, {"StructT", 20}, {"MapT", 23},
+			{"GobEncoderT", gobEncoderTypeID}, {"BinaryMarshalerT", gobEncoderTypeID}, {"TextMarshalerT", gobEncoderTypeID},
+		}},
+		17:               {kind: gobKindStruct, fields: []gobField{common, {"Elem", gobIntID}, {"Len", gobIntID}}},
+		18:               {kind: gobKindStruct, fields: []gobField{{"Name", gobStringID}, {"Id", gobIntID}}},
+		19:               {kind: gobKindStruct, fields: []gobField{common, {"Elem", gobIntID}}},
+		20:               {kind: gobKindStruct, fields: []gobField{common, {"Field", 22}}},
+		21:               {kind: gobKindStruct, fields: []gobField{{"Name", gobStringID}, {"Id", gobIntID}}},
+		22:               {kind: gobKindSlice, elem: 21},
+		23:               {kind: gobKindStruct, fields: []gobField{common, {"Key", gobIntID}, {"Elem", gobIntID}}},
+		gobEncoderTypeID: {kind: gobKindStruct, fields: []gobField{common}},
+	}
+}
+
+// newGobScanner returns a scanner reading src. If size is not negative, src must be an
+// io.Seeker of that length, and skipped data is seeked over instead of read.
+func newGobScanner(src io.Reader, size int64) *gobScanner {
+	return &gobScanner{r: bufio.NewReader(src), src: src, size: size, types: gobPredefined()}
+}
+
+// Read implements io.Reader, so formats with a binary header can be read through the scanner.
+func (s *gobScanner) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.off += int64(n)
+	return n, err
+}
+
+// skip discards the next n bytes. If the stream ends first, it is positioned at the end
+// and fails with io.ErrUnexpectedEOF.
+func (s *gobScanner) skip(n int64) error {
+	if n <= int64(s.r.Buffered()) {
+		s.r.Discard(int(n))
+		s.off += n
+		return nil
+	}
+	if s.size >= 0 {
+		end := s.off + n
+		target := min(end, s.size)
+		if _, err := s.src.(io.Seeker).Seek(target, io.SeekStart); err != nil {
+			return err
+		}
+		s.r.Reset(s.src)
+		s.off = target
+		if target < end {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	}
+	discarded, err := io.CopyN(io.Discard, s.r, n)
+	s.off += discarded
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// ReadByte implements io.ByteReader.
+func (s *gobScanner) ReadByte() (byte, error) {
+	b, err := s.r.ReadByte()
+	if err == nil {
+		s.off++
+	}
+	return b, err
+}
+
+// uint reads an unsigned integer: one byte below 0x80, otherwise the negated byte count
+// followed by the big-endian bytes.
+func (s *gobScanner) uint() (uint64, error) {
+	b, err := s.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b < 0x80 {
+		return uint64(b), nil
+	}
+	n := -int(int8(b))
+	if n > 8 {
+		return 0, errors.New("gob: invalid unsigned integer")
+	}
+	var buf [8]byte
+	if _, err := io.ReadFull(s, buf[8-n:]); err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+// int reads a signed integer, stored with the sign in the lowest bit.
+func (s *gobScanner) int() (int64, error) {
+	u, err := s.uint()
+	if u&1 != 0 {
+		return int64(^(u >> 1)), err
+	}
+	return int64(u >> 1), err
+}
+
+// bytes reads a length-prefixed byte string of at most gobMaxInline bytes.
+func (s *gobScanner) bytes() ([]byte, error) {
+	n, err := s.uint()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if n > gobMaxInline {
+		return nil, fmt.Errorf("gob: %d-byte string is too long for a filter file", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(s, b); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return b, nil
+}
+
+// unexpectedEOF converts io.EOF, which only ends a stream between messages, to
+// io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// next reads messages up to and including the next value, recording the type definitions
+// on the way, and returns the value. If the stream ends inside the value, whatever was
+// decoded is returned together with io.ErrUnexpectedEOF.
+func (s *gobScanner) next() (any, error) {
+	for {
+		if _, err := s.uint(); err != nil { // The message length
+			return nil, err
+		}
+		id, err := s.int()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if id < 0 {
+			wire, err := s.value(gobWireTypeID)
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			if err := s.define(-id, wire); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if t, ok := s.types[id]; !ok || t.kind != gobKindStruct {
+			// Values other than structs start with a zero field delta.
+			if _, err := s.uint(); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+		}
+		v, err := s.value(id)
+		return v, unexpectedEOF(err)
+	}
+}
+
+// define records the type definition decoded from a wireType.
+func (s *gobScanner) define(id int64, wire any) error {
+	w, _ := wire.(map[string]any)
+	var t gobType
+	switch {
+	case w["StructT"] != nil:
+		t.kind = gobKindStruct
+		fields, _ := w["StructT"].(map[string]any)["Field"].([]any)
+		for _, f := range fields {
+			field, _ := f.(map[string]any)
+			name, _ := field["Name"].(string)
+			fieldID, _ := field["Id"].(int64)
+			t.fields = append(t.fields, gobField{name, fieldID})
+		}
+	case w["SliceT"] != nil:
+		t.kind = gobKindSlice
+		t.elem, _ = w["SliceT"].(map[string]any)["Elem"].(int64)
+	case w["ArrayT"] != nil:
+		t.kind = gobKindArray
+		t.elem, _ = w["ArrayT"].(map[string]any)["Elem"].(int64)
+	case w["MapT"] != nil:
+		t.kind = gobKindMap
+	case w["GobEncoderT"] != nil || w["BinaryMarshalerT"] != nil || w["TextMarshalerT"] != nil:
+		t.kind = gobKindEncoder
+	default:
+		return fmt.Errorf("gob: empty definition of type %d", id)
+	}
+	s.types[id] = t
+	return nil
+}
+
+// value decodes a value of the type with the given id.
+func (s *gobScanner) value(id int64) (any, error) {
+	switch id {
+	case gobBoolID:
+		u, err := s.uint()
+		return u != 0, err
+	case gobIntID:
+		return s.int()
+	case gobUintID:
+		return s.uint()
+	case gobFloatID:
+		u, err := s.uint()
+		return math.Float64frombits(bits.ReverseBytes64(u)), err
+	case gobComplexID:
+		if _, err := s.uint(); err != nil {
+			return nil, err
+		}
+		_, err := s.uint()
+		return nil, err
+	case gobBytesID:
+		n, err := s.uint()
+		if err != nil {
+			return nil, err
+		}
+		return gobSkipped(n), s.skip(int64(n))
+	case gobStringID:
+		b, err := s.bytes()
+		return string(b), err
+	}
+
+	t, ok := s.types[id]
+	if !ok {
+		return nil, fmt.Errorf("gob: unsupported type %d", id)
+	}
+	switch t.kind {
+	case gobKindStruct:
+		return s.structValue(t)
+	case gobKindSlice, gobKindArray:
+		n, err := s.uint()
+		if err != nil {
+			return nil, err
+		}
+		var elems []any
+		for range n {
+			elem, err := s.value(t.elem)
+			if err != nil {
+				return elems, err
+			}
+			elems = append(elems, elem)
+		}
+		return elems, nil
+	case gobKindEncoder:
+		return s.bytes()
+	}
+	return nil, fmt.Errorf("gob: unsupported type %d", id)
+}
+
+// structValue decodes a struct: field deltas and values, ended by a zero delta. Fields
+// holding zero values are not sent. If decoding fails, the fields decoded so far are
+// returned, including a partial value of the failing field.
+func (s *gobScanner) structValue(t gobType) (map[string]any, error) {
+	fields := make(map[string]any)
+	for field := -1; ; {
+		delta, err := s.uint()
+		if err != nil {
+			return fields, err
+		}
+		if delta == 0 {
+			return fields, nil
+		}
+		if delta > uint64(len(t.fields)) || field+int(delta) >= len(t.fields) {
+			return fields, errors.New("gob: field number out of range")
+		}
+		field += int(delta)
+		v, err := s.value(t.fields[field].id)
+		if v != nil {
+			fields[t.fields[field].name] = v
+		}
+		if err != nil {
+			return fields, err
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"io"
+)
+
+// Hasher produces the digest from which the double-hashing base values are derived.
+// Sum is the one-shot path and New the streaming path; both must yield identical digests
+// for the same content, and the digest must be at least 16 bytes long.
+type Hasher interface {
+	// Name identifies the hasher in serialized filters.
+	Name() string
+	// Sum returns the digest of data.
+	Sum(data []byte) []byte
+	// New returns a streaming hash whose Sum(nil) equals Sum of everything written to it.
+	New() hash.Hash
+}
+
+// stdHasher adapts a standard library hash to the Hasher interface.
+type stdHasher struct {
+	name  string
+	newFn func() hash.Hash
+	sumFn func(data []byte) []byte
+}
+
+func (h stdHasher) Name() string           { return h.name }
+func (h stdHasher) Sum(data []byte) []byte { return h.sumFn(data) }
+func (h stdHasher) New() hash.Hash         { return h.newFn() }
+
+// Built-in hashers. MD5Hasher is the default.
+var (
+	MD5Hasher Hasher = stdHasher{
+		name:  "md5",
+		newFn: md5.New,
+		sumFn: func(data []byte) []byte { sum := md5.Sum(data); return sum[:] },
+	}
+	FNVHasher Hasher = stdHasher{
+		name:  "fnv",
+		newFn: fnv.New128a,
+		sumFn: func(data []byte) []byte { h := fnv.New128a(); h.Write(data); return h.Sum(nil) },
+	}
+	SHA256Hasher Hasher = stdHasher{
+		name:  "sha256",
+		newFn: sha256.New,
+		sumFn: func(data []byte) []byte { sum := sha256.Sum256(data); return sum[:] },
+	}
+)
+
+// hashers maps hasher names to the built-in hashers, for serialization and the CLI.
+var hashers = map[string]Hasher{
+	MD5Hasher.Name():    MD5Hasher,
+	FNVHasher.Name():    FNVHasher,
+	SHA256Hasher.Name(): SHA256Hasher,
+	XXHashHasher.Name(): XXHashHasher,
+}
+
+// LookupHasher returns the built-in hasher with the given name.
+func LookupHasher(name string) (Hasher, error) {
+	h, ok := hashers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown hasher %q", name)
+	}
+	return h, nil
+}
+
+// streamDigest hashes everything read from r with h's streaming mode.
+func streamDigest(h Hasher, r io.Reader) ([]byte, error) {
+	hh := h.New()
+	if _, err := io.Copy(hh, r); err != nil {
+		return nil, err
+	}
+	return hh.Sum(nil), nil
+}
+
+// digestIndices generates k indices in [0, m) from a digest using double hashing.
+// A zero second hash would map all k indices to the same bit, so it is replaced by 1.
+func digestIndices(sum []byte, k, m uint) []uint {
+	hash1 := binary.BigEndian.Uint32(sum[0:4])
+	hash2 := binary.BigEndian.Uint32(sum[4:8])
+	if hash2 == 0 {
+		hash2 = 1
+	}
+	hashes := make([]uint, k)
+	for i := uint(0); i < k; i++ {
+		combinedHash := hash1 + uint32(i)*hash2
+		hashes[i] = uint(combinedHash) % m
+	}
+	return hashes
+}
+
+// zeroSecondHash reports whether digestIndices substitutes the second hash of sum.
+func zeroSecondHash(sum []byte) bool {
+	return binary.BigEndian.Uint32(sum[4:8]) == 0
+}
+
+// Hash returns the double-hashing base values that a filter using the default hasher and
+// no key normalizer derives for item. Pipelines that already hash keys for sharding can
+// pass them to AddHashed and MightContainHashed instead of hashing again. Only the low
+// 32 bits of each value are used by the filter.
+func Hash(item string) (uint64, uint64) {
+	sum := MD5Hasher.Sum([]byte(item))
+	return uint64(binary.BigEndian.Uint32(sum[0:4])), uint64(binary.BigEndian.Uint32(sum[4:8]))
+}
+
+// hashedDigest encodes precomputed base hashes as the digest prefix digestIndices reads.
+func hashedDigest(h1, h2 uint64) []byte {
+	sum := binary.BigEndian.AppendUint32(nil, uint32(h1))
+	return binary.BigEndian.AppendUint32(sum, uint32(h2))
+}
+
+// AddHashed inserts an item given its precomputed base hashes, skipping the hasher and
+// any key normalizer. AddHashed(Hash(item)) is equivalent to Add(item) on a filter with
+// the default hasher and no normalizer.
+func (bf *BloomFilter) AddHashed(h1, h2 uint64) {
+	bf.addDigest(hashedDigest(h1, h2))
+}
+
+// MightContainHashed checks an item given its precomputed base hashes, as produced by Hash.
+func (bf *BloomFilter) MightContainHashed(h1, h2 uint64) bool {
+	return bf.containsDigest(hashedDigest(h1, h2))
+}
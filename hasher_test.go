@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestHasherStreamingMatchesOneShot(t *testing.T) {
+	// Content larger than any internal block size, read in small pieces.
+	content := []byte(strings.Repeat("large blob content ", 1000))
+	for name, h := range hashers {
+		streamed, err := streamDigest(h, iotest.HalfReader(bytes.NewReader(content)))
+		if err != nil {
+			t.Fatalf("%s: streamDigest: %v", name, err)
+		}
+		if oneShot := h.Sum(content); !bytes.Equal(streamed, oneShot) {
+			t.Errorf("%s: streaming digest %x differs from one-shot digest %x", name, streamed, oneShot)
+		}
+		if len(streamed) < 16 {
+			t.Errorf("%s: digest is %d bytes, want at least 16", name, len(streamed))
+		}
+		if got, err := LookupHasher(name); err != nil || got.Name() != name {
+			t.Errorf("LookupHasher(%q) = %v, %v", name, got, err)
+		}
+	}
+}
+
+func TestAddFromItemReader(t *testing.T) {
+	content := strings.Repeat("x", 100000)
+	for name, h := range hashers {
+		bf := NewBloomFilter(100, 0.01, WithHasher(h))
+		sbf := newTestFilter(t, testConfig, WithHasher(h))
+		if err := bf.AddFromItemReader(strings.NewReader(content)); err != nil {
+			t.Fatalf("%s: BloomFilter.AddFromItemReader: %v", name, err)
+		}
+		if err := sbf.AddFromItemReader(strings.NewReader(content)); err != nil {
+			t.Fatalf("%s: ScalableBloomFilter.AddFromItemReader: %v", name, err)
+		}
+		// Both paths hash the same bytes to the same digest.
+		if !bf.MightContain(content) || !sbf.MightContain(content) {
+			t.Errorf("%s: MightContain of streamed content = false", name)
+		}
+		if present, err := bf.MightContainFromItemReader(strings.NewReader(content)); !present || err != nil {
+			t.Errorf("%s: BloomFilter.MightContainFromItemReader = %v, %v, want true, nil", name, present, err)
+		}
+		if present, err := sbf.MightContainFromItemReader(strings.NewReader(content)); !present || err != nil {
+			t.Errorf("%s: ScalableBloomFilter.MightContainFromItemReader = %v, %v, want true, nil", name, present, err)
+		}
+	}
+}
+
+func TestAddFromItemReaderError(t *testing.T) {
+	errRead := errors.New("read failed")
+	r := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errRead))
+	sbf := newTestFilter(t, testConfig)
+	if err := sbf.AddFromItemReader(r); !errors.Is(err, errRead) {
+		t.Fatalf("AddFromItemReader = %v, want the read error", err)
+	}
+	if got := sbf.ItemCount(); got != 0 {
+		t.Errorf("ItemCount() = %d after a failed read, want 0", got)
+	}
+}
+
+func TestTestAndAddFromItemReader(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	for i, want := range []bool{false, true} {
+		seen, err := sbf.TestAndAddFromItemReader(strings.NewReader("content"))
+		if err != nil || seen != want {
+			t.Fatalf("TestAndAddFromItemReader call %d = %v, %v, want %v, nil", i+1, seen, err, want)
+		}
+	}
+	if got := sbf.ItemCount(); got != 1 {
+		t.Errorf("ItemCount() = %d, want 1: content seen before is not added again", got)
+	}
+	if !sbf.MightContain("content") {
+		t.Error("MightContain of streamed content = false")
+	}
+
+	errRead := errors.New("read failed")
+	r := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errRead))
+	if _, err := sbf.TestAndAddFromItemReader(r); !errors.Is(err, errRead) {
+		t.Fatalf("TestAndAddFromItemReader = %v, want the read error", err)
+	}
+	if got := sbf.ItemCount(); got != 1 {
+		t.Errorf("ItemCount() = %d after a failed read, want 1", got)
+	}
+}
+
+func TestAddHashed(t *testing.T) {
+	keys := testKeys("key", 500)
+	hashed, plain := NewBloomFilter(1000, 0.01), NewBloomFilter(1000, 0.01)
+	for _, key := range keys {
+		hashed.AddHashed(Hash(key))
+		plain.Add(key)
+	}
+	if !bytes.Equal(hashed.bitset, plain.bitset) || hashed.ItemCount() != plain.ItemCount() {
+		t.Fatal("AddHashed(Hash(key)) set different bits or counts than Add(key)")
+	}
+	for _, key := range append(keys, testKeys("absent", 500)...) {
+		if got, want := hashed.MightContainHashed(Hash(key)), plain.MightContain(key); got != want {
+			t.Errorf("MightContainHashed(Hash(%q)) = %v, MightContain = %v", key, got, want)
+		}
+	}
+
+	// Only the low 32 bits of each base hash are used.
+	h1, h2 := Hash("key-0")
+	if !hashed.MightContainHashed(h1|0xdead<<32, h2|0xbeef<<32) {
+		t.Error("MightContainHashed depends on the high 32 bits")
+	}
+}
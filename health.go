@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Thresholds used by HealthCheck. An optimally sized sub-filter is about half full at
+// capacity, so a fill ratio well above that means it took far more items than planned.
+const (
+	healthMaxFillRatio = 0.6
+	healthMaxFPFactor  = 2.0
+)
+
+// HealthCheck returns nil if the filter is fit to serve, for use in readiness probes.
+// It returns ErrClosed after Close, and an error wrapping ErrDegraded that names every
+// problem found when a sub-filter is filled beyond the safe fill ratio or the estimated
+// compound false positive rate exceeds twice the rate the sub-filters were sized for.
+func (sbf *ScalableBloomFilter) HealthCheck() error {
+	sbf.mutex.RLock()
+	closed := sbf.closed
+	sbf.mutex.RUnlock()
+	if closed {
+		return ErrClosed
+	}
+
+	stats := sbf.Stats()
+	config := sbf.Config()
+	var problems []string
+	allNegative := 1.0
+	for i, fs := range stats.Filters {
+		if fs.FillRatio > healthMaxFillRatio {
+			problems = append(problems, fmt.Sprintf("sub-filter %d is saturated: %.0f%% of bits set, above the safe %.0f%%",
+				i, 100*fs.FillRatio, 100*healthMaxFillRatio))
+		}
+		target := fs.TargetFP
+		if target == 0 {
+			// Filters decoded from old data lack the target; assume the configured schedule.
+			target = config.stageFP(i)
+		}
+		allNegative *= 1 - target
+	}
+	if target := 1 - allNegative; stats.EstimatedFP > healthMaxFPFactor*target {
+		problems = append(problems, fmt.Sprintf("estimated false positive rate %.4g exceeds %g times the target %.4g",
+			stats.EstimatedFP, healthMaxFPFactor, target))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrDegraded, strings.Join(problems, "; "))
+	}
+	return nil
+}
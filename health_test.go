@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestHealthCheck(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	if err := sbf.HealthCheck(); err != nil {
+		t.Errorf("HealthCheck of an empty filter = %v, want nil", err)
+	}
+	addAll(t, sbf, testKeys("healthy", 2000)) // Several growth steps
+	if err := sbf.HealthCheck(); err != nil {
+		t.Errorf("HealthCheck of a filter grown as planned = %v, want nil", err)
+	}
+
+	// Overfill the first sub-filter behind the scalable filter's back.
+	overfilled := newTestFilter(t, testConfig)
+	addAll(t, overfilled, []string{"first"})
+	for _, key := range testKeys("overfill", 10*testConfig.InitialCapacity) {
+		overfilled.filters[0].Add(key)
+	}
+	err := overfilled.HealthCheck()
+	if !errors.Is(err, ErrDegraded) {
+		t.Fatalf("HealthCheck of an overfilled filter = %v, want ErrDegraded", err)
+	}
+	for _, want := range []string{"sub-filter 0 is saturated", "estimated false positive rate"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("HealthCheck error %q does not mention %q", err, want)
+		}
+	}
+
+	sbf.Close()
+	if err := sbf.HealthCheck(); !errors.Is(err, ErrClosed) {
+		t.Errorf("HealthCheck after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestHealthCheckLegacy(t *testing.T) {
+	// Version 1 files record no target rates, so the configured schedule stands in.
+	sbf, err := loadScalableFile("testdata/stats_v1.bloom", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sbf.HealthCheck(); err != nil {
+		t.Errorf("HealthCheck of a healthy version 1 filter = %v, want nil", err)
+	}
+}
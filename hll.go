@@ -0,0 +1,54 @@
+package main
+
+import (
+	"hash/maphash"
+	"math"
+	"math/bits"
+)
+
+// hllPrecision is the number of hash bits that select a register of a hyperLogLog. Its
+// 2^14 registers take 16 KiB and give a standard error of about 0.8%.
+const hllPrecision = 14
+
+// hyperLogLog estimates the number of distinct strings added to it in constant memory,
+// using the HyperLogLog algorithm of Flajolet et al. with linear counting for small
+// cardinalities. The zero value is not usable; create one with newHyperLogLog.
+type hyperLogLog struct {
+	seed      maphash.Seed
+	registers []uint8
+}
+
+// newHyperLogLog returns an empty hyperLogLog.
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{seed: maphash.MakeSeed(), registers: make([]uint8, 1<<hllPrecision)}
+}
+
+// add records s. Its hash selects a register by the top hllPrecision bits, which keeps
+// the longest run of leading zeros seen in the remaining bits, plus one.
+func (h *hyperLogLog) add(s string) {
+	x := maphash.String(h.seed, s)
+	i := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > h.registers[i] {
+		h.registers[i] = rank
+	}
+}
+
+// estimate returns the approximate number of distinct strings added.
+func (h *hyperLogLog) estimate() float64 {
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	e := alpha * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// Few registers are set, so the fraction still empty is the better estimator.
+		return m * math.Log(m/float64(zeros))
+	}
+	return e
+}
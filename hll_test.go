@@ -0,0 +1,31 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	if got := newHyperLogLog().estimate(); got != 0 {
+		t.Errorf("estimate of an empty hyperLogLog = %g, want 0", got)
+	}
+	for _, n := range []int{1, 10, 1000, 50000, 500000} {
+		hll := newHyperLogLog()
+		keys := testKeys("key", n)
+		for _, key := range keys {
+			hll.add(key)
+		}
+		once := hll.estimate()
+		// Repeats leave the estimate unchanged.
+		for _, key := range keys[:n/2] {
+			hll.add(key)
+		}
+		if got := hll.estimate(); got != once {
+			t.Errorf("%d keys: estimate changed from %g to %g by repeats", n, once, got)
+		}
+		// Five standard errors of 0.8%, and one key for tiny sets.
+		if tolerance := math.Max(0.04*float64(n), 1); math.Abs(once-float64(n)) > tolerance {
+			t.Errorf("%d keys: estimate %g, want within %g", n, once, tolerance)
+		}
+	}
+}
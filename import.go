@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ctxCheckInterval is the number of items processed between context checks in bulk operations.
+const ctxCheckInterval = 1024
+
+// Magic bytes that start every gzip and zstd stream.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Report summarizes a bulk import into a Scalable Bloom Filter.
+type Report struct {
+	LinesRead      int           `json:"lines_read"`      // Number of lines processed, including empty ones
+	ItemsAdded     int           `json:"items_added"`     // Number of items that were definitely new and got inserted
+	Duplicates     int           `json:"duplicates"`      // Number of items that were already (probably) present
+	Skipped        int           `json:"skipped"`         // Number of malformed records skipped, not counted in LinesRead
+	BytesProcessed int64         `json:"bytes_processed"` // Number of uncompressed bytes consumed
+	Filters        int           `json:"filters"`         // Number of sub-filters after the import
+	Elapsed        time.Duration `json:"elapsed_ns"`      // Wall time spent importing
+}
+
+// defaultImportBatchSize is the number of items AddFromReader inserts per lock acquisition.
+const defaultImportBatchSize = 64
+
+// importConfig holds the optional parameters of AddFromReader and AddFromFile.
+type importConfig struct {
+	batchSize     int
+	delim         byte
+	progress      func(Report)
+	progressEvery time.Duration
+	progressLines int
+	workers       int
+	tokenize      Tokenizer
+}
+
+// ImportOption configures AddFromReader and AddFromFile.
+type ImportOption func(*importConfig)
+
+// WithImportBatchSize sets the number of items inserted under a single lock. Larger batches
+// import faster but make concurrent readers wait longer. Values below 1 are ignored.
+func WithImportBatchSize(n int) ImportOption {
+	return func(c *importConfig) {
+		if n > 0 {
+			c.batchSize = n
+		}
+	}
+}
+
+// WithDelimiter sets the byte that terminates records, in place of '\n'. With any other
+// delimiter, such as 0 for NUL-terminated input, records are taken verbatim and a
+// trailing "\r" is kept.
+func WithDelimiter(delim byte) ImportOption {
+	return func(c *importConfig) {
+		c.delim = delim
+	}
+}
+
+// WithProgress calls fn with the partial Report whenever at least every has elapsed or
+// lines more lines have been processed since the previous call; a zero value disables
+// that trigger. fn runs on the importing goroutine, between batches.
+func WithProgress(every time.Duration, lines int, fn func(Report)) ImportOption {
+	return func(c *importConfig) {
+		c.progress = fn
+		c.progressEvery = every
+		c.progressLines = lines
+	}
+}
+
+// WithImportWorkers hashes and inserts batches on n worker goroutines while the calling
+// goroutine reads, for imports limited by hashing rather than by reading. Items are then
+// inserted in no particular order, which no membership answer depends on; each is still
+// tested and added under the lock, so an item repeated in the input counts as a duplicate
+// whichever worker inserts it. Values below 2 import on the calling goroutine.
+func WithImportWorkers(n int) ImportOption {
+	return func(c *importConfig) {
+		c.workers = n
+	}
+}
+
+// WithTokenizer inserts the tokens of each record instead of the record itself, such as
+// its words with WordTokens. The Report then counts tokens where it would count lines,
+// and records without tokens are not counted.
+func WithTokenizer(tokenize Tokenizer) ImportOption {
+	return func(c *importConfig) {
+		c.tokenize = tokenize
+	}
+}
+
+// AddFromReader inserts every newline-delimited item read from r, or items terminated by
+// the delimiter set WithDelimiter. Empty lines are counted but skipped, and a trailing
+// "\r" is stripped so CRLF input behaves like LF input.
+// The context is checked periodically; on cancellation the partial Report is returned
+// together with the context's error. If an insert fails, for example with ErrMaxFilters,
+// the import stops and the Report covers the lines processed before the failure.
+func (sbf *ScalableBloomFilter) AddFromReader(ctx context.Context, r io.Reader, opts ...ImportOption) (Report, error) {
+	start := sbf.options.clock.Now()
+	var report Report
+	err := sbf.addLines(ctx, bufio.NewReader(r), &report, start, buildImportConfig(opts))
+	report.Elapsed = sbf.options.clock.Now().Sub(start)
+	return report, err
+}
+
+// AddFromFile inserts every newline-delimited item in the file at path. Gzip- and
+// zstd-compressed files are detected by their ".gz" or ".zst" extension or magic bytes
+// and decompressed transparently.
+// On cancellation the partial Report is returned together with the context's error.
+func (sbf *ScalableBloomFilter) AddFromFile(ctx context.Context, path string, opts ...ImportOption) (Report, error) {
+	start := sbf.options.clock.Now()
+	var report Report
+
+	file, err := os.Open(path)
+	if err != nil {
+		return report, err
+	}
+	defer file.Close()
+
+	reader, closeReader, err := maybeDecompress(bufio.NewReader(file), path)
+	if err != nil {
+		return report, err
+	}
+	defer closeReader()
+
+	err = sbf.addLines(ctx, reader, &report, start, buildImportConfig(opts))
+	report.Elapsed = sbf.options.clock.Now().Sub(start)
+	return report, err
+}
+
+// buildImportConfig applies opts over the defaults.
+func buildImportConfig(opts []ImportOption) importConfig {
+	config := importConfig{batchSize: defaultImportBatchSize, delim: '\n'}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+// maybeDecompress wraps r in a gzip or zstd reader when name has the matching extension
+// or the stream starts with the matching magic bytes, and returns r unchanged otherwise.
+// The returned close function releases the decompressor, if any.
+func maybeDecompress(r *bufio.Reader, name string) (*bufio.Reader, func() error, error) {
+	switch {
+	case strings.HasSuffix(name, ".gz") || hasMagic(r, gzipMagic):
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return bufio.NewReader(gz), gz.Close, nil
+	case strings.HasSuffix(name, ".zst") || hasMagic(r, zstdMagic):
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, nil, err
+		}
+		return bufio.NewReader(zr), func() error { zr.Close(); return nil }, nil
+	}
+	return r, func() error { return nil }, nil
+}
+
+// hasMagic reports whether r starts with magic. Streams too short to hold it do not.
+func hasMagic(r *bufio.Reader, magic []byte) bool {
+	start, err := r.Peek(len(magic))
+	return err == nil && string(start) == string(magic)
+}
+
+// addLines reads items terminated by config.delim from r and inserts them in batches,
+// updating report as it goes.
+func (sbf *ScalableBloomFilter) addLines(ctx context.Context, r *bufio.Reader, report *Report, start time.Time, config importConfig) error {
+	flushed := false
+	return sbf.addRecords(ctx, report, start, config, func() (string, bool, error) {
+		if r.Buffered() == 0 && !flushed {
+			// The next read may block on a slow source, such as a followed file, so hand
+			// over the pending batch first.
+			flushed = true
+			return "", false, nil
+		}
+		flushed = false
+		line, err := r.ReadString(config.delim)
+		report.BytesProcessed += int64(len(line))
+		return trimRecord(line, config.delim), len(line) > 0, err
+	})
+}
+
+// addRecords inserts the items produced by next in batches, updating report as it goes.
+// next returns the next item and whether there was one, which may come together with an
+// error; io.EOF ends the import successfully. Returning no item and no error flushes the
+// current batch early. Empty items are counted but not inserted.
+func (sbf *ScalableBloomFilter) addRecords(ctx context.Context, report *Report, start time.Time, config importConfig, next func() (string, bool, error)) (err error) {
+	if config.tokenize != nil {
+		next = tokenRecords(next, config.tokenize)
+	}
+	var pool *importPool
+	if config.workers > 1 {
+		pool = sbf.startImportPool(config.workers, report)
+		defer func() {
+			if waitErr := pool.wait(); err == nil {
+				err = waitErr
+			}
+		}()
+	}
+	batch := make([]string, 0, config.batchSize)
+	lastProgress, lastProgressLines := start, 0
+	flush := func() error {
+		var err error
+		if pool != nil {
+			err = pool.insert(batch)
+		} else {
+			err = sbf.addImportBatch(batch, report)
+		}
+		batch = batch[:0]
+		if err != nil || config.progress == nil {
+			return err
+		}
+		now := sbf.options.clock.Now()
+		if (config.progressEvery > 0 && now.Sub(lastProgress) >= config.progressEvery) ||
+			(config.progressLines > 0 && report.LinesRead-lastProgressLines >= config.progressLines) {
+			lastProgress, lastProgressLines = now, report.LinesRead
+			snapshot := *report
+			snapshot.Elapsed = now.Sub(start)
+			config.progress(snapshot)
+		}
+		return nil
+	}
+
+	for read := 0; ; read++ {
+		if read%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		item, found, readErr := next()
+		if found {
+			if item == "" {
+				report.LinesRead++
+			} else {
+				batch = append(batch, item)
+			}
+		}
+		if len(batch) > 0 && (len(batch) == config.batchSize || !found || readErr != nil) {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+// trimRecord strips the delimiter from a record read up to delim. Newline-delimited
+// records also lose a trailing "\r", so CRLF input behaves like LF input.
+func trimRecord(record string, delim byte) string {
+	record = strings.TrimSuffix(record, string(delim))
+	if delim == '\n' {
+		record = strings.TrimSuffix(record, "\r")
+	}
+	return record
+}
+
+// addImportBatch inserts items under a single lock, counting each processed line in report.
+func (sbf *ScalableBloomFilter) addImportBatch(items []string, report *Report) error {
+	sbf.mutex.Lock()
+	defer sbf.mutex.Unlock()
+
+	defer func() { report.Filters = len(sbf.filters) }()
+	for _, item := range items {
+		present, err := sbf.testAndAdd(item)
+		if err != nil {
+			return err
+		}
+		report.LinesRead++
+		if present {
+			report.Duplicates++
+		} else {
+			report.ItemsAdded++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-bloom-filter/bloomtest"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestAddFromReaderReport(t *testing.T) {
+	clock := bloomtest.NewFakeClock(time.Unix(0, 0))
+	sbf := newTestFilter(t, testConfig, WithClock(clock))
+	input := "a\nb\n\na\r\nc\nb"
+	report, err := sbf.AddFromReader(context.Background(), strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("AddFromReader: %v", err)
+	}
+	want := Report{LinesRead: 6, ItemsAdded: 3, Duplicates: 2, BytesProcessed: int64(len(input)), Filters: 1}
+	if report != want {
+		t.Errorf("AddFromReader report = %+v, want %+v", report, want)
+	}
+	for _, item := range []string{"a", "b", "c"} {
+		if !sbf.MightContain(item) {
+			t.Errorf("MightContain(%q) = false after import", item)
+		}
+	}
+	if sbf.MightContain("a\r") {
+		t.Error(`MightContain("a\r") = true; the CR of a CRLF line should have been stripped`)
+	}
+}
+
+// cancelingReader cancels a context once it has served after bytes.
+type cancelingReader struct {
+	r      io.Reader
+	after  int
+	read   int
+	cancel context.CancelFunc
+}
+
+func (c *cancelingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	if c.read >= c.after {
+		c.cancel()
+	}
+	return n, err
+}
+
+func TestAddFromReaderCancel(t *testing.T) {
+	keys := testKeys("key", 20000)
+	input := strings.Join(keys, "\n") + "\n"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sbf := newTestFilter(t, testConfig)
+	r := &cancelingReader{r: strings.NewReader(input), after: len(input) / 4, cancel: cancel}
+
+	report, err := sbf.AddFromReader(ctx, r)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("AddFromReader error = %v, want context.Canceled", err)
+	}
+	if report.LinesRead == 0 || report.LinesRead >= len(keys) {
+		t.Fatalf("LinesRead = %d, want a partial import of %d lines", report.LinesRead, len(keys))
+	}
+	if report.ItemsAdded+report.Duplicates != report.LinesRead {
+		t.Errorf("report = %+v: added and duplicates do not add up to the lines read", report)
+	}
+	for _, key := range keys[:report.LinesRead] {
+		if !sbf.MightContain(key) {
+			t.Fatalf("MightContain(%q) = false, but the partial report covers it", key)
+		}
+	}
+}
+
+func TestAddFromReaderDelimiter(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	report, err := sbf.AddFromReader(context.Background(), strings.NewReader("line\none\x00two\r\x00"), WithDelimiter(0))
+	if err != nil {
+		t.Fatalf("AddFromReader: %v", err)
+	}
+	if report.LinesRead != 2 || report.ItemsAdded != 2 {
+		t.Errorf("report = %+v, want 2 records added", report)
+	}
+	for _, item := range []string{"line\none", "two\r"} {
+		if !sbf.MightContain(item) {
+			t.Errorf("MightContain(%q) = false; NUL-delimited records are taken verbatim", item)
+		}
+	}
+}
+
+// zstdBytes returns data compressed with zstd.
+func zstdBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestAddFromFileCompressed(t *testing.T) {
+	keys := testKeys("file", 500)
+	plain := []byte(strings.Join(keys, "\n") + "\n")
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write(plain)
+	gw.Close()
+
+	zst := zstdBytes(t, plain)
+
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{"keys.txt", plain},
+		{"keys.txt.gz", gz.Bytes()},
+		{"keys-gzip-without-extension", gz.Bytes()},
+		{"keys.txt.zst", zst},
+		{"keys-zstd-without-extension", zst},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, tc.name)
+			if err := os.WriteFile(path, tc.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			sbf := newTestFilter(t, testConfig)
+			report, err := sbf.AddFromFile(context.Background(), path)
+			if err != nil {
+				t.Fatalf("AddFromFile: %v", err)
+			}
+			if report.LinesRead != len(keys) || report.ItemsAdded+report.Duplicates != len(keys) {
+				t.Errorf("report = %+v, want %d lines", report, len(keys))
+			}
+			if report.BytesProcessed != int64(len(plain)) {
+				t.Errorf("BytesProcessed = %d, want the %d uncompressed bytes", report.BytesProcessed, len(plain))
+			}
+			for _, key := range keys {
+				if !sbf.MightContain(key) {
+					t.Fatalf("MightContain(%q) = false after import", key)
+				}
+			}
+		})
+	}
+}
+
+func TestAddFromFileCorrupt(t *testing.T) {
+	keys := testKeys("file", 20000)
+	plain := []byte(strings.Join(keys, "\n") + "\n")
+	zst := zstdBytes(t, plain)
+	// Damage the end of the stream, so the first blocks still decode.
+	zst[len(zst)-20] ^= 0xff
+	path := filepath.Join(t.TempDir(), "keys.txt.zst")
+	if err := os.WriteFile(path, zst, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sbf := newTestFilter(t, testConfig)
+	report, err := sbf.AddFromFile(context.Background(), path)
+	if err == nil {
+		t.Fatal("AddFromFile of a corrupt zstd file succeeded")
+	}
+	if report.LinesRead >= len(keys) || report.ItemsAdded+report.Duplicates != report.LinesRead {
+		t.Errorf("report = %+v, want the lines read before the damage", report)
+	}
+}
+
+func TestAddFromFileMissing(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	_, err := sbf.AddFromFile(context.Background(), filepath.Join(t.TempDir(), "missing.txt"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("AddFromFile error = %v, want os.ErrNotExist", err)
+	}
+}
+
+// workerInput returns n lines of keys, every tenth a repeat of an earlier one and every
+// hundredth blank, and the distinct keys.
+func workerInput(n int) (string, []string) {
+	distinct := testKeys("worker", n)
+	var b strings.Builder
+	for i, key := range distinct {
+		switch {
+		case i%100 == 99:
+			b.WriteString("\n")
+		case i%10 == 9:
+			b.WriteString(distinct[i/2] + "\n")
+		default:
+			b.WriteString(key + "\n")
+		}
+	}
+	return b.String(), distinct
+}
+
+// TestAddFromReaderWorkers imports the same input with one and several workers: the
+// membership is the same, and so are the counts, since every line is either added or a
+// duplicate under TestAndAdd semantics.
+func TestAddFromReaderWorkers(t *testing.T) {
+	input, _ := workerInput(200000)
+	// Large enough not to grow, so the bits do not depend on the insertion order.
+	config := Config{InitialFP: 0.01, GrowthFactor: 2, TighteningRatio: 0.5, InitialCapacity: 300000}
+	var single *ScalableBloomFilter
+	var singleReport Report
+	for _, workers := range []int{1, 2, 8} {
+		sbf := newTestFilter(t, config)
+		report, err := sbf.AddFromReader(context.Background(), strings.NewReader(input), WithImportWorkers(workers))
+		if err != nil {
+			t.Fatalf("%d workers: AddFromReader: %v", workers, err)
+		}
+		if workers == 1 {
+			single, singleReport = sbf, report
+			continue
+		}
+		if !sameBits(sbf, single) {
+			t.Errorf("%d workers: the bits differ from a single worker's", workers)
+		}
+		if report.LinesRead != singleReport.LinesRead || report.ItemsAdded+report.Duplicates != singleReport.ItemsAdded+singleReport.Duplicates ||
+			report.BytesProcessed != singleReport.BytesProcessed || report.Filters != 1 {
+			t.Errorf("%d workers: report %+v, want the counts of %+v", workers, report, singleReport)
+		}
+		// Which of two concurrent inserts of a key is the duplicate depends on timing, and
+		// a false positive can change sides, but not by much.
+		if diff := report.Duplicates - singleReport.Duplicates; diff < -100 || diff > 100 {
+			t.Errorf("%d workers: %d duplicates, want about the %d of a single worker", workers, report.Duplicates, singleReport.Duplicates)
+		}
+	}
+}
+
+func TestAddFromReaderWorkersGrowth(t *testing.T) {
+	input, distinct := workerInput(20000)
+	sbf := newTestFilter(t, testConfig)
+	var progress []Report
+	report, err := sbf.AddFromReader(context.Background(), strings.NewReader(input),
+		WithImportWorkers(4), WithImportBatchSize(100), WithProgress(0, 1000, func(r Report) { progress = append(progress, r) }))
+	if err != nil {
+		t.Fatalf("AddFromReader: %v", err)
+	}
+	for i, key := range distinct {
+		if i%100 != 99 && i%10 != 9 && !sbf.MightContain(key) {
+			t.Fatalf("filter misses %q", key)
+		}
+	}
+	if report.LinesRead != 20000 || report.Filters != len(sbf.filters) || report.Filters < 5 {
+		t.Errorf("report %+v, want 20000 lines and the %d stages", report, len(sbf.filters))
+	}
+
+	// Progress adds up the batches of all workers as they finish.
+	if len(progress) < 5 {
+		t.Fatalf("%d progress reports, want one about every 1000 lines", len(progress))
+	}
+	for i := 1; i < len(progress); i++ {
+		if progress[i].LinesRead < progress[i-1].LinesRead || progress[i].ItemsAdded < progress[i-1].ItemsAdded {
+			t.Fatalf("progress went backwards: %+v after %+v", progress[i], progress[i-1])
+		}
+	}
+	if last := progress[len(progress)-1]; last.LinesRead > report.LinesRead {
+		t.Errorf("progress reported %d lines, more than the %d read", last.LinesRead, report.LinesRead)
+	}
+}
+
+func BenchmarkAddFromReaderWorkers(b *testing.B) {
+	input, _ := workerInput(100000)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("sha256/workers=%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			for i := 0; i < b.N; i++ {
+				sbf := newTestFilter(b, defaultConfig, WithHasher(SHA256Hasher))
+				if _, err := sbf.AddFromReader(context.Background(), strings.NewReader(input), WithImportWorkers(workers)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// Header describes a filter file as far as it can be known without reading its bitsets.
+type Header struct {
+	Format      string        `json:"format"`                 // "gob", "append", "binary" or "sparse"
+	Version     int           `json:"version"`                // Version of the format
+	Compression string        `json:"compression,omitempty"`  // "gzip" or "zstd" if the file is compressed
+	Hasher      string        `json:"hasher"`                 // Name of the hasher
+	Normalizer  string        `json:"normalizer"`             // Name of the key normalizer, empty if none
+	Config      *Config       `json:"config,omitempty"`       // Configuration of a Scalable Bloom Filter; nil for single filters
+	Frozen      bool          `json:"frozen"`                 // See Freeze
+	Stages      []StageHeader `json:"stages"`                 // Sub-filters, oldest first; only the readable ones if truncated
+	Checksum    bool          `json:"checksum"`               // Whether the file carries a checksum; no format has one yet
+	PayloadSize int64         `json:"payload_size"`           // Bytes of bitsets declared, or of encoded set bits in the sparse format
+	TruncatedAt int64         `json:"truncated_at,omitempty"` // Where the data ends if the file is truncated, otherwise 0
+}
+
+// StageHeader describes one sub-filter of a filter file.
+type StageHeader struct {
+	Capacity     int       `json:"capacity"`       // Number of items the sub-filter was sized for
+	TargetFP     float64   `json:"target_fp"`      // False positive rate it was sized for; 0 if unknown
+	BitSize      uint64    `json:"bit_size"`       // Number of bits (m)
+	NumHashFuncs uint      `json:"num_hash_funcs"` // Number of hash functions (k)
+	ItemCount    uint64    `json:"item_count"`     // Number of items inserted into the sub-filter
+	Created      time.Time `json:"created"`        // When the sub-filter was added; zero if unknown
+}
+
+// InspectHeader describes the filter file read from r without loading its bitsets, which
+// are skipped over. It recognizes files written by saveFile or GobEncode, AppendSave,
+// WriteTo and the sparse format, also when compressed with gzip or zstd; compressed files
+// are decompressed as they are read, so skipping their bitsets costs time but no memory.
+// r must also have a Size or Stat method, like *os.File, *bytes.Reader and
+// *io.SectionReader do.
+//
+// If the header is intact but the file ends early, the Header is returned without an
+// error and with TruncatedAt set to where the data ends: the file's size, or the size of
+// the decompressed data. Truncated sparse and append files are only recognized when the
+// data cannot hold the declared set bits or the footer.
+func InspectHeader(r io.ReaderAt) (Header, error) {
+	size, err := readerSize(r)
+	if err != nil {
+		return Header{}, err
+	}
+	start := bufio.NewReader(io.NewSectionReader(r, 0, size))
+	switch {
+	case hasMagic(start, appendMagic[:]):
+		return inspectAppend(r, size)
+	case hasMagic(start, gzipMagic) || hasMagic(start, zstdMagic):
+		compression := "zstd"
+		if hasMagic(start, gzipMagic) {
+			compression = "gzip"
+		}
+		decompressed, closeReader, err := maybeDecompress(start, "")
+		if err != nil {
+			return Header{}, err
+		}
+		defer closeReader()
+		h, err := inspectStream(newGobScanner(decompressed, -1))
+		h.Compression = compression
+		return h, err
+	}
+	return inspectStream(newGobScanner(io.NewSectionReader(r, 0, size), size))
+}
+
+// readerSize returns the size of the data behind r.
+func readerSize(r io.ReaderAt) (int64, error) {
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		return r.Size(), nil
+	case interface{ Stat() (fs.FileInfo, error) }:
+		info, err := r.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+	return 0, errors.New("cannot determine the size of the reader")
+}
+
+// inspectStream describes a file in any format but the append format, which needs random
+// access.
+func inspectStream(s *gobScanner) (Header, error) {
+	magic, _ := s.r.Peek(4)
+	switch string(magic) {
+	case string(filterMagic[:]):
+		return inspectBinary(s)
+	case string(sparseMagic[:]):
+		return inspectSparse(s)
+	case string(appendMagic[:]):
+		return Header{}, errors.New("append-format files must be decompressed to be inspected")
+	}
+	return inspectGob(s)
+}
+
+// binaryHeader converts the header of the binary or sparse format.
+func binaryHeader(format string, h filterHeader) Header {
+	return Header{
+		Format:     format,
+		Version:    int(h.version),
+		Hasher:     h.hasher,
+		Normalizer: h.normalizer,
+		Stages: []StageHeader{{
+			Capacity:     int(h.capacity),
+			TargetFP:     h.targetFP,
+			BitSize:      h.bitSize,
+			NumHashFuncs: uint(h.numHashFuncs),
+			ItemCount:    h.count,
+		}},
+	}
+}
+
+// inspectBinary describes a filter written by WriteTo.
+func inspectBinary(s *gobScanner) (Header, error) {
+	h, err := readHeader(s)
+	if err != nil {
+		return Header{}, err
+	}
+	header := binaryHeader("binary", h)
+	header.PayloadSize = int64(h.bitsetLen())
+	err = s.skip(header.PayloadSize)
+	if err == io.ErrUnexpectedEOF {
+		header.TruncatedAt = s.off
+		err = nil
+	}
+	return header, err
+}
+
+// inspectSparse describes a filter in the sparse format. The set bits are not decoded, but
+// a file too short to hold their declared number, at least a byte each, is truncated.
+func inspectSparse(s *gobScanner) (Header, error) {
+	h, err := readMagicHeader(s, sparseMagic, "not a serialized sparse bloom filter")
+	if err != nil {
+		return Header{}, err
+	}
+	header := binaryHeader("sparse", h)
+	payloadStart := s.off
+	n, err := binary.ReadUvarint(s)
+	if err != nil {
+		header.TruncatedAt = s.off
+		return header, nil
+	}
+	end := s.size
+	if end < 0 {
+		discarded, err := io.Copy(io.Discard, s)
+		if err != nil {
+			return Header{}, err
+		}
+		end = s.off + discarded
+	}
+	header.PayloadSize = end - payloadStart
+	if uint64(end-s.off) < n {
+		header.TruncatedAt = end
+	}
+	return header, nil
+}
+
+// inspectGob describes a filter written by GobEncode, reading the metadata of each
+// sub-filter and skipping its bitset.
+func inspectGob(s *gobScanner) (Header, error) {
+	v, err := s.next()
+	wire, _ := v.(map[string]any)
+	if err != nil && (err != io.ErrUnexpectedEOF || wire["Filters"] == nil) {
+		return Header{}, fmt.Errorf("not a filter file: %w", err)
+	}
+
+	version, _ := wire["Version"].(int64)
+	hasher, _ := wire["Hasher"].(string)
+	normalizer, _ := wire["Normalizer"].(string)
+	frozen, _ := wire["Frozen"].(bool)
+	config, _ := wire["Config"].(map[string]any)
+	h := Header{
+		Format:     "gob",
+		Version:    max(int(version), 1),
+		Hasher:     hasher,
+		Normalizer: normalizer,
+		Config:     gobConfig(config),
+		Frozen:     frozen,
+		Stages:     []StageHeader{},
+	}
+	if h.Hasher == "" {
+		h.Hasher = MD5Hasher.Name()
+	}
+	filters, _ := wire["Filters"].([]any)
+	for _, f := range filters {
+		h.addGobStage(f)
+	}
+	if err != nil {
+		h.TruncatedAt = s.off
+	}
+	return h, nil
+}
+
+// gobConfig converts a decoded Config.
+func gobConfig(wire map[string]any) *Config {
+	var config Config
+	config.InitialFP, _ = wire["InitialFP"].(float64)
+	config.GrowthFactor, _ = wire["GrowthFactor"].(float64)
+	config.TighteningRatio, _ = wire["TighteningRatio"].(float64)
+	initialCapacity, _ := wire["InitialCapacity"].(int64)
+	maxFilters, _ := wire["MaxFilters"].(int64)
+	config.MinFP, _ = wire["MinFP"].(float64)
+	config.InitialCapacity = int(initialCapacity)
+	config.MaxFilters = int(maxFilters)
+	return &config
+}
+
+// addGobStage appends the stage described by a decoded gobBloomFilter, whose bitset was
+// skipped, and counts its bitset in the payload.
+func (h *Header) addGobStage(v any) {
+	wire, _ := v.(map[string]any)
+	var stage StageHeader
+	capacity, _ := wire["Capacity"].(int64)
+	numHashFuncs, _ := wire["NumHashFuncs"].(uint64)
+	stage.Capacity = int(capacity)
+	stage.NumHashFuncs = uint(numHashFuncs)
+	stage.TargetFP, _ = wire["TargetFP"].(float64)
+	stage.BitSize, _ = wire["BitSize"].(uint64)
+	stage.ItemCount, _ = wire["Count"].(uint64)
+	if created, ok := wire["Created"].([]byte); ok {
+		// A malformed timestamp only leaves the creation time unknown.
+		stage.Created.GobDecode(created)
+	}
+	bitset, _ := wire["Bitset"].(gobSkipped)
+	h.PayloadSize += int64(bitset)
+	h.Stages = append(h.Stages, stage)
+}
+
+// inspectAppend describes a file written by AppendSave. Its footer is read whole, since it
+// holds no bitsets, and each current record only up to its bitset. A file whose trailer
+// does not point at a footer is reported as truncated.
+func inspectAppend(r io.ReaderAt, size int64) (Header, error) {
+	var prefix [appendHeaderSize]byte
+	if _, err := r.ReadAt(prefix[:], 0); err != nil {
+		return Header{}, fmt.Errorf("reading header: %w", err)
+	}
+	h := Header{Format: "append", Version: int(prefix[4]), Stages: []StageHeader{}}
+	footer, err := parseAppendFooter(r, size)
+	if errors.Is(err, errCorruptTrailer) {
+		h.TruncatedAt = size
+		return h, nil
+	}
+	if err != nil {
+		return Header{}, err
+	}
+
+	config := footer.Filter.Config
+	h.Hasher = footer.Filter.Hasher
+	h.Normalizer = footer.Filter.Normalizer
+	h.Config = &config
+	h.Frozen = footer.Filter.Frozen
+	for i, rec := range footer.Records {
+		s := newGobScanner(io.NewSectionReader(r, rec.Offset, rec.Length), rec.Length)
+		v, err := s.next()
+		if err != nil {
+			return Header{}, fmt.Errorf("reading sub-filter %d: %w", i, err)
+		}
+		h.addGobStage(v)
+	}
+	return h, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"testing"
+)
+
+// The inspect fixtures hold the same 50 keys: a 200-item fnv filter written by WriteTo in
+// format versions 1 and 2 and in the sparse format. inspect.blma is stats_v2.bloom saved
+// with AppendSave.
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestInspectHeader(t *testing.T) {
+	for _, tc := range []struct {
+		file     string
+		format   string
+		version  int
+		hasher   string
+		stages   int
+		targetFP float64
+		items    uint64
+	}{
+		{"stats_v1.bloom", "gob", 1, "md5", 2, 0, 100},
+		{"stats_v2.bloom", "gob", 2, "md5", 2, 0.01, 100},
+		{"inspect_v1.bin", "binary", 1, "fnv", 1, 0, 50},
+		{"inspect_v2.bin", "binary", 2, "fnv", 1, 0.01, 50},
+		{"inspect.sparse", "sparse", 2, "fnv", 1, 0.01, 50},
+		{"inspect.blma", "append", 1, "md5", 2, 0.01, 100},
+	} {
+		h, err := InspectHeader(bytes.NewReader(readFixture(t, tc.file)))
+		if err != nil {
+			t.Errorf("%s: InspectHeader: %v", tc.file, err)
+			continue
+		}
+		if h.Format != tc.format || h.Version != tc.version || h.Hasher != tc.hasher || h.Compression != "" || h.TruncatedAt != 0 {
+			t.Errorf("%s: format %q version %d hasher %q compression %q truncated at %d, want %q, %d, %q, none, not truncated",
+				tc.file, h.Format, h.Version, h.Hasher, h.Compression, h.TruncatedAt, tc.format, tc.version, tc.hasher)
+		}
+		if len(h.Stages) != tc.stages {
+			t.Errorf("%s: %d stages, want %d", tc.file, len(h.Stages), tc.stages)
+			continue
+		}
+		if first := h.Stages[0]; first.TargetFP != tc.targetFP || first.ItemCount != tc.items || first.BitSize == 0 || first.NumHashFuncs == 0 {
+			t.Errorf("%s: first stage %+v, want target rate %g and %d items", tc.file, first, tc.targetFP, tc.items)
+		}
+		if h.PayloadSize == 0 {
+			t.Errorf("%s: payload size 0", tc.file)
+		}
+	}
+}
+
+// TestInspectHeaderMatchesLoad checks the stages InspectHeader reads without the bitsets
+// against the filter loaded in full.
+func TestInspectHeaderMatchesLoad(t *testing.T) {
+	sbf, err := loadScalableFile("testdata/stats_v2.bloom", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := InspectHeader(bytes.NewReader(readFixture(t, "stats_v2.bloom")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *h.Config != sbf.config() || h.Frozen {
+		t.Errorf("config %+v frozen %t, want %+v, false", *h.Config, h.Frozen, sbf.config())
+	}
+	var payload int64
+	for i, bf := range sbf.filters {
+		stage := h.Stages[i]
+		if stage.BitSize != uint64(bf.bitSize) || stage.NumHashFuncs != bf.numHashFuncs ||
+			stage.ItemCount != uint64(bf.count) || stage.Capacity != bf.capacity || !stage.Created.Equal(bf.created) {
+			t.Errorf("stage %d = %+v, loaded filter has %d bits, k=%d, %d items, capacity %d, created %v",
+				i, stage, bf.bitSize, bf.numHashFuncs, bf.count, bf.capacity, bf.created)
+		}
+		payload += int64(len(bf.bitset))
+	}
+	if h.PayloadSize != payload {
+		t.Errorf("payload size %d, want the bitsets' %d bytes", h.PayloadSize, payload)
+	}
+}
+
+func TestInspectHeaderCompressed(t *testing.T) {
+	data := readFixture(t, "stats_v2.bloom")
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	zw.Write(data)
+	zw.Close()
+
+	want, err := InspectHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for compression, compressed := range map[string][]byte{
+		"gzip": gzipped.Bytes(),
+		"zstd": zstdBytes(t, data),
+	} {
+		h, err := InspectHeader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Errorf("%s: InspectHeader: %v", compression, err)
+			continue
+		}
+		if h.Compression != compression || h.TruncatedAt != 0 || h.PayloadSize != want.PayloadSize || len(h.Stages) != len(want.Stages) {
+			t.Errorf("%s: compression %q, truncated at %d, payload %d, %d stages, want %s, 0, %d, %d",
+				compression, h.Compression, h.TruncatedAt, h.PayloadSize, len(h.Stages), compression, want.PayloadSize, len(want.Stages))
+		}
+	}
+}
+
+func TestInspectHeaderTruncated(t *testing.T) {
+	for _, file := range []string{"stats_v1.bloom", "stats_v2.bloom", "inspect_v1.bin", "inspect_v2.bin", "inspect.sparse", "inspect.blma"} {
+		data := readFixture(t, file)
+		cut := int64(len(data) - 20)
+		h, err := InspectHeader(bytes.NewReader(data[:cut]))
+		if err != nil {
+			t.Errorf("%s cut to %d bytes: InspectHeader: %v", file, cut, err)
+			continue
+		}
+		if h.TruncatedAt != cut {
+			t.Errorf("%s cut to %d bytes: truncated at %d, want %d", file, cut, h.TruncatedAt, cut)
+		}
+	}
+
+	// Without an intact header there is nothing to describe.
+	for _, file := range []string{"stats_v2.bloom", "inspect_v2.bin", "inspect.sparse", "inspect.blma"} {
+		if _, err := InspectHeader(bytes.NewReader(readFixture(t, file)[:6])); err == nil {
+			t.Errorf("%s cut to 6 bytes: InspectHeader succeeded", file)
+		}
+	}
+	if _, err := InspectHeader(bytes.NewReader([]byte("not a filter at all"))); err == nil {
+		t.Error("InspectHeader of text succeeded")
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// MarshalJSON implements json.Marshaler. The JSON holds the same fields as the gob
+// encoding, with each bitset in base64, for tools that cannot read gob.
+func (sbf *ScalableBloomFilter) MarshalJSON() ([]byte, error) {
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+
+	if sbf.closed {
+		return nil, ErrClosed
+	}
+	return json.Marshal(sbf.fullWire())
+}
+
+// UnmarshalJSON implements json.Unmarshaler, replacing the receiver's contents with the
+// filter encoded by MarshalJSON.
+func (sbf *ScalableBloomFilter) UnmarshalJSON(data []byte) error {
+	var wire gobScalableBloomFilter
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return fmt.Errorf("json: %w", err)
+	}
+	return sbf.decodeWire(wire)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A key log is a write-ahead log of the keys added to a filter. Filters keep only bits, so
+// the log is what lets a filter be rebuilt with another false positive target, capacity or
+// hasher. It is kept as one or more segment files, each possibly gzip- or zstd-compressed.
+// A segment starts with the line "#bloom-wal 1", followed by one record per line made of
+// the key's CRC-32 (IEEE) as 8 hex digits, a tab, and the key. The checksum lets a rebuild
+// skip records torn or damaged on disk instead of inserting garbage, and the version in
+// the header lets a reader refuse segments in a format it does not know.
+
+// keyLogMagic starts the header line of every key log segment.
+const keyLogMagic = "#bloom-wal "
+
+// keyLogVersion is the segment format KeyLogWriter writes and KeyLog reads.
+const keyLogVersion = 1
+
+// KeyLogWriter appends keys to a key log segment.
+type KeyLogWriter struct {
+	w io.Writer
+}
+
+// NewKeyLogWriter starts a key log segment on w by writing its header. Writes are not
+// buffered, so each Append reaches w as a single record.
+func NewKeyLogWriter(w io.Writer) (*KeyLogWriter, error) {
+	if _, err := fmt.Fprintf(w, "%s%d\n", keyLogMagic, keyLogVersion); err != nil {
+		return nil, err
+	}
+	return &KeyLogWriter{w: w}, nil
+}
+
+// Append writes a record for key. Keys containing a newline cannot be logged.
+func (lw *KeyLogWriter) Append(key string) error {
+	if strings.Contains(key, "\n") {
+		return errors.New("key log: keys cannot contain a newline")
+	}
+	_, err := fmt.Fprintf(lw.w, "%08x\t%s\n", crc32.ChecksumIEEE([]byte(key)), key)
+	return err
+}
+
+// keyLogConfig holds the settings of a KeyLog.
+type keyLogConfig struct {
+	progressEvery int
+	progress      func(Report)
+}
+
+// KeyLogOption configures a KeyLog.
+type KeyLogOption func(*keyLogConfig)
+
+// WithRebuildProgress makes rebuilds call fn with the Report so far after every n records,
+// and once more with the final Report when the rebuild completes. Values of n below 1
+// only report the final Report.
+func WithRebuildProgress(n int, fn func(Report)) KeyLogOption {
+	return func(c *keyLogConfig) {
+		c.progressEvery = n
+		c.progress = fn
+	}
+}
+
+// KeyLog reads the segments of a key log in order to rebuild filters from it.
+type KeyLog struct {
+	segments []string
+	config   keyLogConfig
+}
+
+// NewKeyLog returns the key log made of the segment files at paths, replayed in order.
+func NewKeyLog(paths []string, opts ...KeyLogOption) *KeyLog {
+	var config keyLogConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return &KeyLog{segments: paths, config: config}
+}
+
+// RebuildWithConfig replays the key log into a new filter created with newCfg and opts,
+// so it can differ from the filter the log was written for in false positive target,
+// capacity, hasher or any other setting. Segments are streamed, so memory use does not
+// depend on the size of the log. Records that are malformed or fail their checksum are
+// skipped and counted in the Report's Skipped field rather than ending a long rebuild.
+// On cancellation or a read error the partial filter is discarded and the error returned.
+func (l *KeyLog) RebuildWithConfig(ctx context.Context, newCfg Config, opts ...Option) (*ScalableBloomFilter, error) {
+	dst, err := NewScalableBloomFilter(newCfg, opts...)
+	if err != nil {
+		return nil, err
+	}
+	start := dst.options.clock.Now()
+	var report Report
+	for _, path := range l.segments {
+		if err := l.replay(ctx, dst, path, &report, start); err != nil {
+			return nil, err
+		}
+	}
+	if l.config.progress != nil {
+		report.Elapsed = dst.options.clock.Now().Sub(start)
+		l.config.progress(report)
+	}
+	return dst, nil
+}
+
+// replay inserts the keys of the segment at path into dst, updating report, for a rebuild
+// that began at start, as it goes.
+func (l *KeyLog) replay(ctx context.Context, dst *ScalableBloomFilter, path string, report *Report, start time.Time) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r, closeR, err := maybeDecompress(bufio.NewReader(file), path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	defer closeR()
+
+	header, err := r.ReadString('\n')
+	report.BytesProcessed += int64(len(header))
+	if err == io.EOF && header == "" {
+		// Created but not yet written to, as by a crash right after the segment was opened.
+		return nil
+	}
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if header = strings.TrimSuffix(header, "\n"); header != keyLogMagic+strconv.Itoa(keyLogVersion) {
+		return fmt.Errorf("%s: unsupported key log header %q", path, header)
+	}
+
+	for {
+		records := report.LinesRead + report.Skipped
+		if records%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		line, readErr := r.ReadString('\n')
+		if len(line) > 0 {
+			report.BytesProcessed += int64(len(line))
+			if key, ok := parseKeyLogRecord(strings.TrimSuffix(line, "\n")); !ok {
+				report.Skipped++
+			} else {
+				report.LinesRead++
+				present, err := dst.TestAndAdd(key)
+				if err != nil {
+					return err
+				}
+				if present {
+					report.Duplicates++
+				} else {
+					report.ItemsAdded++
+				}
+			}
+			if l.config.progress != nil && l.config.progressEvery > 0 && (records+1)%l.config.progressEvery == 0 {
+				report.Elapsed = dst.options.clock.Now().Sub(start)
+				l.config.progress(*report)
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return fmt.Errorf("%s: %w", path, readErr)
+		}
+	}
+}
+
+// parseKeyLogRecord returns the key of a record, without its newline, and whether the
+// record is well formed with a matching checksum.
+func parseKeyLogRecord(record string) (string, bool) {
+	if len(record) < 9 || record[8] != '\t' {
+		return "", false
+	}
+	sum, err := strconv.ParseUint(record[:8], 16, 32)
+	key := record[9:]
+	if err != nil || uint32(sum) != crc32.ChecksumIEEE([]byte(key)) {
+		return "", false
+	}
+	return key, true
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeSegment writes data to a file named name in dir, gzipping it for a ".gz" name.
+func writeSegment(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	if strings.HasSuffix(name, ".gz") {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(data)
+		gz.Close()
+		data = buf.Bytes()
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// keyLogSegment returns a key log segment logging keys.
+func keyLogSegment(t *testing.T, keys []string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	lw, err := NewKeyLogWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if err := lw.Append(key); err != nil {
+			t.Fatalf("Append(%q): %v", key, err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestRebuildWithConfig(t *testing.T) {
+	dir := t.TempDir()
+	oldKeys, newKeys := testKeys("old", 200), testKeys("new", 300)
+
+	// A compressed segment, an empty one left by a crash, then one with a damaged record,
+	// a garbage line and a record torn by a crash.
+	first := keyLogSegment(t, oldKeys)
+	compressed := writeSegment(t, dir, "0001.wal.gz", first)
+	empty := writeSegment(t, dir, "0002.wal", nil)
+	damaged := bytes.Replace(keyLogSegment(t, newKeys), []byte("\tnew-7\n"), []byte("\tnew-X\n"), 1)
+	damaged = append(damaged, "not a record\n"...)
+	header := len(keyLogMagic) + 2
+	damaged = append(damaged, keyLogSegment(t, []string{"torn-record"})[header:header+12]...)
+	last := writeSegment(t, dir, "0003.wal", damaged)
+
+	var reports []Report
+	keyLog := NewKeyLog([]string{compressed, empty, last}, WithRebuildProgress(100, func(r Report) { reports = append(reports, r) }))
+	config := Config{InitialFP: 0.0001, GrowthFactor: 2, TighteningRatio: 0.5, InitialCapacity: 1000}
+	sbf, err := keyLog.RebuildWithConfig(context.Background(), config, WithHasher(FNVHasher))
+	if err != nil {
+		t.Fatalf("RebuildWithConfig: %v", err)
+	}
+	if sbf.Config() != config || sbf.options.hasher.Name() != FNVHasher.Name() {
+		t.Errorf("rebuilt filter has config %+v and hasher %s, want %+v and fnv", sbf.Config(), sbf.options.hasher.Name(), config)
+	}
+
+	for _, key := range append(oldKeys, newKeys...) {
+		if key != "new-7" && !sbf.MightContain(key) {
+			t.Fatalf("MightContain(%q) = false for a logged key", key)
+		}
+	}
+	for _, key := range []string{"new-7", "new-X", "not a record", "torn-record", "tor"} {
+		if sbf.MightContain(key) {
+			t.Errorf("MightContain(%q) = true for a key only in a corrupt record", key)
+		}
+	}
+
+	// 502 records are read in all, so progress is reported 5 times before the final Report.
+	if len(reports) != 6 {
+		t.Fatalf("progress called %d times, want 5 periodic calls and a final one", len(reports))
+	}
+	final := reports[len(reports)-1]
+	if final.Skipped != 3 || final.ItemsAdded != 499 || final.LinesRead != 499 {
+		t.Errorf("final report %+v, want 3 skipped and 499 lines and keys added", final)
+	}
+	if final.BytesProcessed != int64(len(first)+len(damaged)) {
+		t.Errorf("final report processed %d bytes, want the uncompressed size of the segments", final.BytesProcessed)
+	}
+}
+
+func TestRebuildWithConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	good := writeSegment(t, dir, "good.wal", keyLogSegment(t, testKeys("key", 10)))
+	future := writeSegment(t, dir, "future.wal", []byte("#bloom-wal 2\nabc\n"))
+	plain := writeSegment(t, dir, "keys.txt", []byte(strings.Join(testKeys("key", 10), "\n")))
+
+	for name, paths := range map[string][]string{
+		"missing segment": {good, filepath.Join(dir, "missing.wal")},
+		"newer format":    {good, future},
+		"no header":       {good, plain},
+	} {
+		if sbf, err := NewKeyLog(paths).RebuildWithConfig(context.Background(), testConfig); err == nil || sbf != nil {
+			t.Errorf("%s: RebuildWithConfig = %v, %v, want an error", name, sbf, err)
+		}
+	}
+
+	if _, err := NewKeyLog([]string{good}).RebuildWithConfig(context.Background(), Config{}); err == nil {
+		t.Error("RebuildWithConfig with an invalid config succeeded")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewKeyLog([]string{good}).RebuildWithConfig(ctx, testConfig); !errors.Is(err, context.Canceled) {
+		t.Errorf("RebuildWithConfig with a cancelled context = %v, want context.Canceled", err)
+	}
+
+	if err := (&KeyLogWriter{w: &bytes.Buffer{}}).Append("two\nlines"); err == nil {
+		t.Error("Append of a key with a newline succeeded")
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding"
+	"encoding/binary"
+	"net/netip"
+)
+
+// The helpers in this file add items that are not plain strings. Each encodes the value
+// to bytes and then hashes those bytes exactly like a string item with the same content.
+// Because the encodings are binary, they bypass any configured key normalizer.
+
+// AddMarshaler marshals v with MarshalBinary and inserts the resulting bytes.
+// MarshalBinary must be deterministic: the same logical value has to produce the same
+// bytes on every call, or later lookups will miss.
+func (bf *BloomFilter) AddMarshaler(v encoding.BinaryMarshaler) error {
+	data, err := v.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	bf.addKey(data)
+	return nil
+}
+
+// MightContainMarshaler marshals v with MarshalBinary and checks the resulting bytes.
+func (bf *BloomFilter) MightContainMarshaler(v encoding.BinaryMarshaler) (bool, error) {
+	data, err := v.MarshalBinary()
+	if err != nil {
+		return false, err
+	}
+	return bf.containsKey(data), nil
+}
+
+// AddMarshaler marshals v with MarshalBinary and inserts the resulting bytes.
+// MarshalBinary must be deterministic: the same logical value has to produce the same
+// bytes on every call, or later lookups will miss.
+func (sbf *ScalableBloomFilter) AddMarshaler(v encoding.BinaryMarshaler) error {
+	data, err := v.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return sbf.addKey(data)
+}
+
+// MightContainMarshaler marshals v with MarshalBinary and checks the resulting bytes.
+func (sbf *ScalableBloomFilter) MightContainMarshaler(v encoding.BinaryMarshaler) (bool, error) {
+	data, err := v.MarshalBinary()
+	if err != nil {
+		return false, err
+	}
+	return sbf.containsKey(data), nil
+}
+
+// Canonical encodings for typed keys. These define the key space and must never change:
+//   - uint64: 8 bytes, big-endian.
+//   - int64: the two's complement bit pattern as a uint64, 8 bytes, big-endian.
+//   - netip.Addr: 4 bytes for IPv4 and 16 bytes for IPv6. IPv4-mapped IPv6 addresses
+//     (::ffff:a.b.c.d) are unmapped first, so they are the same key as a.b.c.d. Zones are
+//     ignored, and the zero Addr encodes as the empty key.
+//   - namespaced item: the namespace length as a uvarint, the namespace, then the item
+//     after key normalization. The length prefix keeps ("ab", "c") and ("a", "bc") apart.
+// Typed keys share the key space with string items of the same bytes.
+
+// uint64Key returns the canonical encoding of v.
+func uint64Key(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)
+}
+
+// ipKey returns the canonical encoding of ip.
+func ipKey(ip netip.Addr) []byte {
+	return ip.Unmap().AsSlice()
+}
+
+// namespacedKey returns the canonical encoding of an already normalized item in namespace.
+func namespacedKey(namespace, item string) []byte {
+	key := binary.AppendUvarint(nil, uint64(len(namespace)))
+	key = append(key, namespace...)
+	return append(key, item...)
+}
+
+// addKey inserts raw key bytes, bypassing the normalizer.
+func (bf *BloomFilter) addKey(key []byte) bool {
+	return bf.addDigest(bf.hasher.Sum(key))
+}
+
+// containsKey checks raw key bytes, bypassing the normalizer.
+func (bf *BloomFilter) containsKey(key []byte) bool {
+	return bf.containsDigest(bf.hasher.Sum(key))
+}
+
+// addKey inserts raw key bytes, bypassing the normalizer.
+func (sbf *ScalableBloomFilter) addKey(key []byte) error {
+	sum := sbf.options.hasher.Sum(key)
+
+	sbf.mutex.Lock()
+	defer sbf.mutex.Unlock()
+
+	return sbf.addDigest(sum)
+}
+
+// containsKey checks raw key bytes, bypassing the normalizer.
+func (sbf *ScalableBloomFilter) containsKey(key []byte) bool {
+	sum := sbf.options.hasher.Sum(key)
+
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+
+	return sbf.containsDigest(sum)
+}
+
+// AddUint64 inserts v using its canonical 8-byte big-endian encoding.
+func (bf *BloomFilter) AddUint64(v uint64) bool {
+	return bf.addKey(uint64Key(v))
+}
+
+// MightContainUint64 checks v using its canonical 8-byte big-endian encoding.
+func (bf *BloomFilter) MightContainUint64(v uint64) bool {
+	return bf.containsKey(uint64Key(v))
+}
+
+// AddInt64 inserts v using its canonical two's complement 8-byte big-endian encoding.
+func (bf *BloomFilter) AddInt64(v int64) bool {
+	return bf.addKey(uint64Key(uint64(v)))
+}
+
+// MightContainInt64 checks v using its canonical two's complement 8-byte big-endian encoding.
+func (bf *BloomFilter) MightContainInt64(v int64) bool {
+	return bf.containsKey(uint64Key(uint64(v)))
+}
+
+// AddIP inserts ip using its canonical 4- or 16-byte encoding.
+func (bf *BloomFilter) AddIP(ip netip.Addr) bool {
+	return bf.addKey(ipKey(ip))
+}
+
+// MightContainIP checks ip using its canonical 4- or 16-byte encoding.
+func (bf *BloomFilter) MightContainIP(ip netip.Addr) bool {
+	return bf.containsKey(ipKey(ip))
+}
+
+// AddUint64 inserts v using its canonical 8-byte big-endian encoding.
+func (sbf *ScalableBloomFilter) AddUint64(v uint64) error {
+	return sbf.addKey(uint64Key(v))
+}
+
+// MightContainUint64 checks v using its canonical 8-byte big-endian encoding.
+func (sbf *ScalableBloomFilter) MightContainUint64(v uint64) bool {
+	return sbf.containsKey(uint64Key(v))
+}
+
+// AddInt64 inserts v using its canonical two's complement 8-byte big-endian encoding.
+func (sbf *ScalableBloomFilter) AddInt64(v int64) error {
+	return sbf.addKey(uint64Key(uint64(v)))
+}
+
+// MightContainInt64 checks v using its canonical two's complement 8-byte big-endian encoding.
+func (sbf *ScalableBloomFilter) MightContainInt64(v int64) bool {
+	return sbf.containsKey(uint64Key(uint64(v)))
+}
+
+// AddIP inserts ip using its canonical 4- or 16-byte encoding.
+func (sbf *ScalableBloomFilter) AddIP(ip netip.Addr) error {
+	return sbf.addKey(ipKey(ip))
+}
+
+// MightContainIP checks ip using its canonical 4- or 16-byte encoding.
+func (sbf *ScalableBloomFilter) MightContainIP(ip netip.Addr) bool {
+	return sbf.containsKey(ipKey(ip))
+}
+
+// AddNamespaced inserts item within namespace, so that tenants sharing one filter cannot
+// collide by design: the same item in two namespaces is two independent members. The key
+// normalizer applies to the item but not to the namespace.
+func (sbf *ScalableBloomFilter) AddNamespaced(namespace, item string) error {
+	return sbf.addKey(namespacedKey(namespace, sbf.options.normalizer.Normalize(item)))
+}
+
+// MightContainNamespaced checks item within namespace, as inserted by AddNamespaced.
+func (sbf *ScalableBloomFilter) MightContainNamespaced(namespace, item string) bool {
+	return sbf.containsKey(namespacedKey(namespace, sbf.options.normalizer.Normalize(item)))
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+// point marshals deterministically to its coordinates, big-endian.
+type point struct{ x, y int32 }
+
+func (p point) MarshalBinary() ([]byte, error) {
+	data := binary.BigEndian.AppendUint32(nil, uint32(p.x))
+	return binary.BigEndian.AppendUint32(data, uint32(p.y)), nil
+}
+
+// brokenMarshaler always fails to marshal.
+type brokenMarshaler struct{}
+
+var errMarshal = errors.New("cannot marshal")
+
+func (brokenMarshaler) MarshalBinary() ([]byte, error) { return nil, errMarshal }
+
+func TestMarshaler(t *testing.T) {
+	bf := NewBloomFilter(1000, 0.01)
+	sbf := newTestFilter(t, testConfig)
+	add := map[string]func(point) error{
+		"BloomFilter":         func(p point) error { return bf.AddMarshaler(p) },
+		"ScalableBloomFilter": func(p point) error { return sbf.AddMarshaler(p) },
+	}
+	contains := map[string]func(point) (bool, error){
+		"BloomFilter":         func(p point) (bool, error) { return bf.MightContainMarshaler(p) },
+		"ScalableBloomFilter": func(p point) (bool, error) { return sbf.MightContainMarshaler(p) },
+	}
+	for name := range add {
+		if err := add[name](point{1, 2}); err != nil {
+			t.Fatalf("%s: AddMarshaler: %v", name, err)
+		}
+		// A separately constructed equal value marshals to the same bytes.
+		if present, err := contains[name](point{1, 2}); !present || err != nil {
+			t.Errorf("%s: MightContainMarshaler(added) = %v, %v, want true, nil", name, present, err)
+		}
+		if present, _ := contains[name](point{2, 1}); present {
+			t.Errorf("%s: MightContainMarshaler(other) = true", name)
+		}
+	}
+
+	// The marshaled bytes are hashed like a string item with the same content.
+	data, _ := point{1, 2}.MarshalBinary()
+	if !bf.MightContain(string(data)) || !sbf.MightContain(string(data)) {
+		t.Error("MightContain of the marshaled bytes = false")
+	}
+}
+
+func TestMarshalerError(t *testing.T) {
+	bf := NewBloomFilter(1000, 0.01)
+	sbf := newTestFilter(t, testConfig)
+	if err := bf.AddMarshaler(brokenMarshaler{}); !errors.Is(err, errMarshal) {
+		t.Errorf("BloomFilter.AddMarshaler = %v, want the marshal error", err)
+	}
+	if _, err := bf.MightContainMarshaler(brokenMarshaler{}); !errors.Is(err, errMarshal) {
+		t.Errorf("BloomFilter.MightContainMarshaler = %v, want the marshal error", err)
+	}
+	if err := sbf.AddMarshaler(brokenMarshaler{}); !errors.Is(err, errMarshal) {
+		t.Errorf("ScalableBloomFilter.AddMarshaler = %v, want the marshal error", err)
+	}
+	if _, err := sbf.MightContainMarshaler(brokenMarshaler{}); !errors.Is(err, errMarshal) {
+		t.Errorf("ScalableBloomFilter.MightContainMarshaler = %v, want the marshal error", err)
+	}
+	if bf.ItemCount() != 0 || sbf.ItemCount() != 0 {
+		t.Error("a failed AddMarshaler inserted something")
+	}
+}
+
+func TestTypedKeys(t *testing.T) {
+	bf := NewBloomFilter(1000, 0.01)
+	sbf := newTestFilter(t, testConfig)
+
+	bf.AddUint64(1)
+	sbf.AddUint64(1)
+	bf.AddInt64(-1)
+	sbf.AddInt64(-1)
+	for name, f := range map[string]interface {
+		MightContainUint64(uint64) bool
+		MightContainInt64(int64) bool
+		MightContain(string) bool
+	}{"BloomFilter": bf, "ScalableBloomFilter": sbf} {
+		if !f.MightContainUint64(1) || f.MightContainUint64(2) {
+			t.Errorf("%s: MightContainUint64 disagrees with what was added", name)
+		}
+		// -1 is all ones, so it is the same key as the largest uint64.
+		if !f.MightContainInt64(-1) || !f.MightContainUint64(1<<64-1) {
+			t.Errorf("%s: MightContainInt64(-1) or MightContainUint64(max) = false", name)
+		}
+		// The canonical encoding is 8 bytes big-endian, not decimal text.
+		if !f.MightContain("\x00\x00\x00\x00\x00\x00\x00\x01") || f.MightContain("1") {
+			t.Errorf("%s: uint64 key is not the 8-byte big-endian encoding", name)
+		}
+	}
+}
+
+func TestIPKeys(t *testing.T) {
+	bf := NewBloomFilter(1000, 0.01)
+	sbf := newTestFilter(t, testConfig)
+	bf.AddIP(netip.MustParseAddr("::ffff:1.2.3.4"))
+	if err := sbf.AddIP(netip.MustParseAddr("::ffff:1.2.3.4")); err != nil {
+		t.Fatalf("AddIP: %v", err)
+	}
+	bf.AddIP(netip.MustParseAddr("2001:db8::1"))
+	sbf.AddIP(netip.MustParseAddr("2001:db8::1"))
+
+	for _, tc := range []struct {
+		addr string
+		want bool
+	}{
+		{"1.2.3.4", true}, // An IPv4-mapped address is the same key as the IPv4 address
+		{"::ffff:1.2.3.4", true},
+		{"2001:db8::1", true},
+		{"2001:db8:0::1", true},    // Parsing canonicalizes the textual form
+		{"2001:db8::1%eth0", true}, // Zones are ignored
+		{"::1.2.3.4", false},       // IPv4-compatible, not IPv4-mapped
+		{"1.2.3.5", false},
+	} {
+		addr := netip.MustParseAddr(tc.addr)
+		if got := bf.MightContainIP(addr); got != tc.want {
+			t.Errorf("BloomFilter.MightContainIP(%s) = %v, want %v", tc.addr, got, tc.want)
+		}
+		if got := sbf.MightContainIP(addr); got != tc.want {
+			t.Errorf("ScalableBloomFilter.MightContainIP(%s) = %v, want %v", tc.addr, got, tc.want)
+		}
+	}
+	if !bf.MightContain("\x01\x02\x03\x04") {
+		t.Error("IPv4 key is not the 4-byte encoding")
+	}
+}
+
+func TestNamespaced(t *testing.T) {
+	sbf := newTestFilter(t, testConfig, WithKeyNormalizer(LowercaseNormalizer))
+	for _, key := range testKeys("key", 200) {
+		if err := sbf.AddNamespaced("tenant-a", key); err != nil {
+			t.Fatalf("AddNamespaced: %v", err)
+		}
+	}
+
+	var leaked int
+	for _, key := range testKeys("key", 200) {
+		if !sbf.MightContainNamespaced("tenant-a", key) {
+			t.Fatalf("MightContainNamespaced(tenant-a, %q) = false", key)
+		}
+		// Another namespace, or no namespace, sees only false positives.
+		if sbf.MightContainNamespaced("tenant-b", key) || sbf.MightContain(key) {
+			leaked++
+		}
+	}
+	if leaked > 10 {
+		t.Errorf("%d of 200 items of tenant-a are visible outside it, want only false positives", leaked)
+	}
+
+	// The namespace length keeps boundaries apart, and only the item is normalized.
+	sbf = newTestFilter(t, testConfig, WithKeyNormalizer(LowercaseNormalizer))
+	sbf.AddNamespaced("ab", "c")
+	if sbf.MightContainNamespaced("a", "bc") {
+		t.Error(`("a", "bc") matches ("ab", "c")`)
+	}
+	if !sbf.MightContainNamespaced("ab", "C") || sbf.MightContainNamespaced("AB", "c") {
+		t.Error("the normalizer applies to the namespace or not to the item")
+	}
+
+	sbf.Freeze()
+	if err := sbf.AddNamespaced("ab", "d"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("AddNamespaced on a frozen filter = %v, want ErrReadOnly", err)
+	}
+}
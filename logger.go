@@ -0,0 +1,23 @@
+package main
+
+// Logger receives warnings about internal adjustments the filters make, such as clamping
+// the number of hash functions. It is satisfied by most structured and printf-style loggers
+// through a small adapter.
+type Logger interface {
+	Warnf(format string, args ...any)
+}
+
+// WithLogger sets the logger that receives internal warnings. A nil logger, the default,
+// keeps the filters silent.
+func WithLogger(l Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// warnf logs a warning if a logger is configured.
+func (o options) warnf(format string, args ...any) {
+	if o.logger != nil {
+		o.logger.Warnf(format, args...)
+	}
+}
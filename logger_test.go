@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// captureLogger records every warning it receives.
+type captureLogger struct {
+	warnings []string
+	mutex    sync.Mutex
+}
+
+func (l *captureLogger) Warnf(format string, args ...any) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+}
+
+// logged returns the warnings received so far.
+func (l *captureLogger) logged() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return append([]string(nil), l.warnings...)
+}
+
+func TestLoggerClampedHashFuncs(t *testing.T) {
+	logger := &captureLogger{}
+	// A 90% false positive target needs a fraction of a hash function, which rounds to 0.
+	bf := NewBloomFilter(100, 0.9, WithLogger(logger))
+	if bf.numHashFuncs != 1 {
+		t.Fatalf("numHashFuncs = %d, want it clamped to 1", bf.numHashFuncs)
+	}
+	warnings := logger.logged()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "clamping to 1") {
+		t.Errorf("warnings = %q, want one about clamping the hash functions", warnings)
+	}
+
+	// Without a logger the same adjustment is silent.
+	if bf := NewBloomFilter(100, 0.9); bf.numHashFuncs != 1 {
+		t.Errorf("numHashFuncs without a logger = %d, want 1", bf.numHashFuncs)
+	}
+}
+
+func TestLoggerZeroSecondHash(t *testing.T) {
+	logger := &captureLogger{}
+	bf := NewBloomFilter(100, 0.01, WithLogger(logger))
+	bf.AddHashed(12345, 0)
+	warnings := logger.logged()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "zero second hash") {
+		t.Errorf("warnings = %q, want one about the zero second hash", warnings)
+	}
+}
+
+func TestLoggerQuiet(t *testing.T) {
+	logger := &captureLogger{}
+	sbf := newTestFilter(t, testConfig, WithLogger(logger))
+	addAll(t, sbf, testKeys("quiet", 500))
+	if warnings := logger.logged(); len(warnings) != 0 {
+		t.Errorf("warnings = %q for an ordinary filter, want none", warnings)
+	}
+}
@@ -1,24 +1,36 @@
 package main
 
 import (
-	"crypto/md5"
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
-	"flag"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"io/ioutil"
 	"math"
+	"math/rand"
 	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Config holds the configuration parameters for the Scalable Bloom Filter.
 type Config struct {
-	InitialFP       float64 `json:"initial_fp"`       // Initial false positive rate
-	GrowthFactor    float64 `json:"growth_factor"`    // Factor by which capacity grows
-	TighteningRatio float64 `json:"tightening_ratio"` // Ratio to reduce false positive rate
-	InitialCapacity int     `json:"initial_capacity"` // Initial expected number of elements
+	InitialFP       float64 `json:"initial_fp"`            // Initial false positive rate
+	GrowthFactor    float64 `json:"growth_factor"`         // Factor by which capacity grows
+	TighteningRatio float64 `json:"tightening_ratio"`      // Ratio to reduce false positive rate
+	InitialCapacity int     `json:"initial_capacity"`      // Initial expected number of elements
+	MaxFilters      int     `json:"max_filters,omitempty"` // Maximum number of sub-filters; 0 means unlimited
+	MinFP           float64 `json:"min_fp,omitempty"`      // Lowest false positive rate a sub-filter targets; 0 means no floor
+}
+
+// stageFP returns the false positive rate targeted by sub-filter i: the initial rate
+// tightened once for every earlier sub-filter, but not below MinFP.
+func (c Config) stageFP(i int) float64 {
+	return max(c.InitialFP*math.Pow(c.TighteningRatio, float64(i)), c.MinFP)
 }
 
 // ScalableBloomFilter represents a scalable bloom filter.
@@ -28,24 +40,31 @@ type ScalableBloomFilter struct {
 	growthFactor    float64
 	tighteningRatio float64
 	initialCapacity int
+	maxFilters      int
+	minFP           float64
+	options         options
+	lastGrowth      string // Reason for the most recent growth, see LastGrowthReason
+	fallback        fallbackState
+	frozen          bool // Set by Freeze; mutations return ErrReadOnly
+	closed          bool // Set by Close; mutations return ErrClosed
+	closers         []func() error
+	formatVersion   int // Version of the gob format the filter was decoded from, if any
 	mutex           sync.RWMutex
 }
 
+// Growth reasons reported by LastGrowthReason.
+const (
+	// GrowthReasonCapacity means the active sub-filter held as many items as it was sized for.
+	GrowthReasonCapacity = "capacity"
+)
+
 // NewScalableBloomFilter creates a new ScalableBloomFilter with the given configuration.
 // It validates the parameters to ensure they are within acceptable ranges.
-func NewScalableBloomFilter(config Config) (*ScalableBloomFilter, error) {
+// The options are applied to every sub-filter.
+func NewScalableBloomFilter(config Config, opts ...Option) (*ScalableBloomFilter, error) {
 	// Parameter Validation
-	if config.TighteningRatio <= 0 || config.TighteningRatio >= 1 {
-		return nil, errors.New("tighteningRatio must be between 0 and 1")
-	}
-	if config.GrowthFactor <= 1 {
-		return nil, errors.New("growthFactor must be greater than 1")
-	}
-	if config.InitialFP <= 0 || config.InitialFP >= 1 {
-		return nil, errors.New("initialFP must be between 0 and 1")
-	}
-	if config.InitialCapacity <= 0 {
-		return nil, errors.New("initialCapacity must be greater than 0")
+	if errs := config.violations(); len(errs) > 0 {
+		return nil, errs[0]
 	}
 
 	return &ScalableBloomFilter{
@@ -54,118 +73,829 @@ func NewScalableBloomFilter(config Config) (*ScalableBloomFilter, error) {
 		growthFactor:    config.GrowthFactor,
 		tighteningRatio: config.TighteningRatio,
 		initialCapacity: config.InitialCapacity,
+		maxFilters:      config.MaxFilters,
+		minFP:           config.MinFP,
+		options:         buildOptions(opts),
 	}, nil
 }
 
 // Add inserts an item into the Scalable Bloom Filter.
-// If the current Bloom filter cannot accommodate the new item, a new Bloom filter is created.
+// If the current Bloom filter has reached its capacity, a new Bloom filter is created.
 func (sbf *ScalableBloomFilter) Add(item string) error {
 	sbf.mutex.Lock()
 	defer sbf.mutex.Unlock()
 
-	// If there are no filters or the last filter cannot accommodate the item, create a new filter
-	if len(sbf.filters) == 0 || !sbf.filters[len(sbf.filters)-1].Add(item) {
-		// Calculate new false positive probability using tighteningRatio
-		newFP := sbf.initialFP * math.Pow(sbf.tighteningRatio, float64(len(sbf.filters)))
+	return sbf.add(item)
+}
+
+// AddFromItemReader inserts a single item whose content is streamed from r, hashing it
+// without buffering it in memory. An item added this way must also be queried with
+// MightContainFromItemReader, or with the same bytes through MightContain, since both
+// paths produce identical digests.
+func (sbf *ScalableBloomFilter) AddFromItemReader(r io.Reader) error {
+	sum, err := streamDigest(sbf.options.hasher, r)
+	if err != nil {
+		return err
+	}
+
+	sbf.mutex.Lock()
+	defer sbf.mutex.Unlock()
+
+	return sbf.addDigest(sum)
+}
+
+// MightContainFromItemReader checks a single item whose content is streamed from r.
+func (sbf *ScalableBloomFilter) MightContainFromItemReader(r io.Reader) (bool, error) {
+	sum, err := streamDigest(sbf.options.hasher, r)
+	if err != nil {
+		return false, err
+	}
+
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+
+	return sbf.containsDigest(sum), nil
+}
+
+// TestAndAddFromItemReader is like TestAndAdd for a single item whose content is streamed
+// from r. The content is hashed before the lock is taken.
+func (sbf *ScalableBloomFilter) TestAndAddFromItemReader(r io.Reader) (bool, error) {
+	sum, err := streamDigest(sbf.options.hasher, r)
+	if err != nil {
+		return false, err
+	}
+
+	sbf.mutex.Lock()
+	defer sbf.mutex.Unlock()
+
+	if sbf.containsDigest(sum) {
+		return true, nil
+	}
+	return false, sbf.addDigest(sum)
+}
+
+// TestAndAdd reports whether the item might already be present and, if it is definitely
+// absent, inserts it. The check and the insert happen under a single lock, so concurrent
+// callers racing on the same item see exactly one false result.
+func (sbf *ScalableBloomFilter) TestAndAdd(item string) (bool, error) {
+	sbf.mutex.Lock()
+	defer sbf.mutex.Unlock()
+
+	return sbf.testAndAdd(item)
+}
+
+// testAndAdd implements TestAndAdd; the caller must hold the write lock.
+func (sbf *ScalableBloomFilter) testAndAdd(item string) (bool, error) {
+	sum := sbf.digest(item)
+	if sbf.containsDigest(sum) {
+		return true, nil
+	}
+	return false, sbf.addDigest(sum)
+}
 
-		// Calculate new capacity using growthFactor
-		// Each new filter has capacity = initialCapacity * (growthFactor ^ number_of_filters)
-		newCapacity := float64(sbf.initialCapacity) * math.Pow(sbf.growthFactor, float64(len(sbf.filters)))
+// addBatch inserts items in order while taking the write lock only once. It stops at the
+// first error and returns the number of items inserted before it.
+func (sbf *ScalableBloomFilter) addBatch(items []string) (int, error) {
+	sbf.mutex.Lock()
+	defer sbf.mutex.Unlock()
+
+	for i, item := range items {
+		if err := sbf.add(item); err != nil {
+			return i, err
+		}
+	}
+	return len(items), nil
+}
 
-		// Create a new Bloom filter with scaled capacity and adjusted false positive rate
-		newFilter := NewBloomFilter(int(math.Ceil(newCapacity)), newFP)
+// add inserts an item; the caller must hold the write lock.
+func (sbf *ScalableBloomFilter) add(item string) error {
+	return sbf.addDigest(sbf.digest(item))
+}
 
-		// Add the item to the new filter
-		newFilter.Add(item)
+// addDigest inserts an item given its digest; the caller must hold the write lock.
+func (sbf *ScalableBloomFilter) addDigest(sum []byte) error {
+	if sbf.closed {
+		return ErrClosed
+	}
+	if sbf.frozen {
+		return ErrReadOnly
+	}
+	// If there are no filters or the active filter cannot accommodate the item, move on to
+	// the next one, creating it unless PreGrow already has
+	if len(sbf.filters) == 0 {
+		if err := sbf.grow(); err != nil {
+			return err
+		}
+	}
+	active := sbf.activeIndex()
+	if reason := sbf.growthReason(active); reason != "" {
+		if active == len(sbf.filters)-1 {
+			if err := sbf.grow(); err != nil {
+				return err
+			}
+		}
+		active++
+		sbf.lastGrowth = reason
+	}
+	sbf.filters[active].addDigest(sum)
+	if sbf.options.falsePositiveOverlay {
+		sbf.fallback.forget(sum)
+	}
+	return nil
+}
 
-		// Append the new filter to the list of filters
-		sbf.filters = append(sbf.filters, newFilter)
+// grow appends a new sub-filter with scaled capacity and tightened false positive rate;
+// the caller must hold the write lock. It returns ErrMaxFilters once the configured number
+// of sub-filters exists, and ErrCapacityOverflow instead of wrapping around when the scaled
+// size no longer fits in an int.
+func (sbf *ScalableBloomFilter) grow() error {
+	if sbf.maxFilters > 0 && len(sbf.filters) >= sbf.maxFilters {
+		return fmt.Errorf("%w (%d)", ErrMaxFilters, sbf.maxFilters)
+	}
+	newCapacity, newFP, err := sbf.stageSize(len(sbf.filters))
+	if err != nil {
+		return err
 	}
+
+	// Create a new Bloom filter with scaled capacity and adjusted false positive rate
+	newFilter := newBloomFilter(newCapacity, newFP, sbf.options)
+
+	// Append the new filter to the list of filters
+	sbf.filters = append(sbf.filters, newFilter)
 	return nil
 }
 
+// stageSize returns the capacity and false positive rate of sub-filter i.
+func (sbf *ScalableBloomFilter) stageSize(i int) (int, float64, error) {
+	// Calculate new false positive probability using tighteningRatio, floored at minFP
+	newFP := sbf.config().stageFP(i)
+
+	// Calculate new capacity using growthFactor
+	// Each new filter has capacity = initialCapacity * (growthFactor ^ number_of_filters)
+	newCapacity := math.Ceil(float64(sbf.initialCapacity) * math.Pow(sbf.growthFactor, float64(i)))
+
+	// Converting a float64 beyond the int range is implementation-defined and may wrap
+	// negative, so check the capacity and the bit size derived from it first.
+	newBits := -newCapacity * math.Log(newFP) / (math.Ln2 * math.Ln2)
+	if newCapacity >= math.MaxInt || newBits >= math.MaxInt || newFP <= 0 {
+		return 0, 0, fmt.Errorf("%w: sub-filter %d would need capacity %g at false positive rate %g",
+			ErrCapacityOverflow, i, newCapacity, newFP)
+	}
+	return int(newCapacity), newFP, nil
+}
+
+// digest normalizes and hashes an item with the filter's configured normalizer and hasher.
+func (sbf *ScalableBloomFilter) digest(item string) []byte {
+	return sbf.options.hasher.Sum([]byte(sbf.options.normalizer.Normalize(item)))
+}
+
+// activeIndex returns the index of the sub-filter that takes new items: the newest one
+// holding items, or the oldest if none does. Empty sub-filters allocated by PreGrow wait
+// behind it until it is full. The caller must hold the lock, and the filter must have a
+// sub-filter.
+func (sbf *ScalableBloomFilter) activeIndex() int {
+	i := len(sbf.filters) - 1
+	for i > 0 && sbf.filters[i].ItemCount() == 0 {
+		i--
+	}
+	return i
+}
+
+// growthReason returns why sub-filter i cannot take another item, or "" if it can; the
+// caller must hold the lock.
+func (sbf *ScalableBloomFilter) growthReason(i int) string {
+	if len(sbf.filters) == 0 {
+		return ""
+	}
+	active := sbf.filters[i]
+	if active.ItemCount() >= uint(active.capacity) {
+		return GrowthReasonCapacity
+	}
+	return ""
+}
+
+// LastGrowthReason reports why the most recent sub-filter was added, as one of the
+// GrowthReason constants. It returns "" while the filter has not grown beyond its first sub-filter.
+func (sbf *ScalableBloomFilter) LastGrowthReason() string {
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+
+	return sbf.lastGrowth
+}
+
+// Config returns a copy of the filter's effective configuration. Passing it back to
+// NewScalableBloomFilter creates an equivalent, empty filter.
+func (sbf *ScalableBloomFilter) Config() Config {
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+
+	return sbf.config()
+}
+
+// config returns the effective configuration; the caller must hold at least the read lock.
+func (sbf *ScalableBloomFilter) config() Config {
+	return Config{
+		InitialFP:       sbf.initialFP,
+		GrowthFactor:    sbf.growthFactor,
+		TighteningRatio: sbf.tighteningRatio,
+		InitialCapacity: sbf.initialCapacity,
+		MaxFilters:      sbf.maxFilters,
+		MinFP:           sbf.minFP,
+	}
+}
+
+// SetInitialFP changes the false positive target used to size sub-filters created after the call.
+// Existing sub-filters keep the rate they were built with; the tightening ratio still applies
+// on top of the new target for every subsequent growth step, down to the configured MinFP.
+func (sbf *ScalableBloomFilter) SetInitialFP(fp float64) error {
+	if fp <= 0 || fp >= 1 {
+		return errors.New("initialFP must be between 0 and 1")
+	}
+
+	sbf.mutex.Lock()
+	defer sbf.mutex.Unlock()
+
+	if sbf.closed {
+		return ErrClosed
+	}
+	if sbf.frozen {
+		return ErrReadOnly
+	}
+	sbf.initialFP = fp
+	return nil
+}
+
+// Freeze makes the filter read-only: every later attempt to add items or change its
+// configuration returns ErrReadOnly, while queries and serialization keep working.
+// The frozen state is serialized, so a published filter stays frozen when loaded.
+// Freezing is irreversible.
+func (sbf *ScalableBloomFilter) Freeze() {
+	sbf.mutex.Lock()
+	defer sbf.mutex.Unlock()
+
+	sbf.frozen = true
+}
+
+// Frozen reports whether Freeze has been called.
+func (sbf *ScalableBloomFilter) Frozen() bool {
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+
+	return sbf.frozen
+}
+
 // MightContain checks if an item might be in the Scalable Bloom Filter.
 // Returns true if the item might be present, false if it is definitely not present.
 func (sbf *ScalableBloomFilter) MightContain(item string) bool {
 	sbf.mutex.RLock()
 	defer sbf.mutex.RUnlock()
 
+	return sbf.mightContain(item)
+}
+
+// MightContainInFilter checks an item against the single sub-filter at index,
+// where 0 is the oldest generation. It is intended for debugging the scaling
+// structure and returns an error if index is out of range.
+func (sbf *ScalableBloomFilter) MightContainInFilter(index int, item string) (bool, error) {
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+
+	if index < 0 || index >= len(sbf.filters) {
+		return false, fmt.Errorf("filter index %d out of range [0, %d)", index, len(sbf.filters))
+	}
+	return sbf.filters[index].containsDigest(sbf.digest(item)), nil
+}
+
+// mightContain checks all sub-filters; the caller must hold at least the read lock.
+func (sbf *ScalableBloomFilter) mightContain(item string) bool {
+	return sbf.containsDigest(sbf.digest(item))
+}
+
+// containsDigest checks all sub-filters for a digest, hashing the item only once;
+// the caller must hold at least the read lock.
+func (sbf *ScalableBloomFilter) containsDigest(sum []byte) bool {
 	for _, filter := range sbf.filters {
-		if filter.MightContain(item) {
+		if filter.containsDigest(sum) {
 			return true
 		}
 	}
 	return false
 }
 
+// ItemCount returns the number of items inserted across all sub-filters.
+// Duplicates that did not set any new bit are not counted.
+func (sbf *ScalableBloomFilter) ItemCount() uint {
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+
+	var total uint
+	for _, filter := range sbf.filters {
+		total += filter.ItemCount()
+	}
+	return total
+}
+
+// DistinctAddedApprox returns the number of Add calls that set at least one new bit since
+// the filter was built or decoded, across all sub-filters. Unlike ItemCount, it leaves out
+// items carried over from an encoded filter or brought in by Union and merges. The count
+// of calls is exact; it only approximates the number of distinct items added because a
+// new item whose bits were all set by others is a false positive and not counted.
+func (sbf *ScalableBloomFilter) DistinctAddedApprox() uint64 {
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+
+	var total uint64
+	for _, filter := range sbf.filters {
+		total += filter.distinctAdds.Load()
+	}
+	return total
+}
+
+// MemoryEfficiency compares the memory a single optimally-sized Bloom filter would need
+// for the items added so far against the memory actually allocated by the sub-filters.
+// theoreticalBytes is derived from the item count and initial false positive rate using
+// the Bloom formula; actualBytes is the sum of all allocated bitsets. A large gap indicates
+// over-allocation from aggressive growth.
+func (sbf *ScalableBloomFilter) MemoryEfficiency() (theoreticalBytes, actualBytes int) {
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+
+	var items int
+	for _, filter := range sbf.filters {
+		filter.mutex.RLock()
+		items += int(filter.count)
+		actualBytes += len(filter.bitset)
+		filter.mutex.RUnlock()
+	}
+	if items > 0 {
+		theoreticalBytes = int((optimalBitSize(items, sbf.initialFP) + 7) / 8)
+	}
+	return theoreticalBytes, actualBytes
+}
+
+// LargestFilter returns the index of the sub-filter whose bitset takes the most memory,
+// where 0 is the oldest, and its size in bytes. With a growth factor above 1 this is
+// normally the newest sub-filter; ties go to the older one. It returns -1 and 0 if no
+// sub-filter has been allocated yet.
+func (sbf *ScalableBloomFilter) LargestFilter() (index int, bytes int) {
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+
+	index = -1
+	for i, filter := range sbf.filters {
+		filter.mutex.RLock()
+		size := len(filter.bitset)
+		filter.mutex.RUnlock()
+		if size > bytes {
+			index, bytes = i, size
+		}
+	}
+	return index, bytes
+}
+
+// StateHash returns a 64-bit FNV-1a fingerprint of the filter's bits, for keying caches of
+// results derived from it. Every sub-filter contributes its bit size, number of hash
+// functions and bitset, without alignment padding, so filters in the same state share the
+// fingerprint, and adding an item changes it, up to hash collisions, only if it sets a new
+// bit. Re-adding an item already present in the active sub-filter leaves it unchanged, but
+// an item present only in an earlier one is set in the active one too, and a re-add that
+// fills the active sub-filter grows the filter. Item counts and other metadata are not
+// included.
+func (sbf *ScalableBloomFilter) StateHash() uint64 {
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+
+	h := fnv.New64a()
+	var layout [16]byte
+	for _, filter := range sbf.filters {
+		filter.mutex.RLock()
+		binary.BigEndian.PutUint64(layout[0:8], uint64(filter.bitSize))
+		binary.BigEndian.PutUint64(layout[8:16], uint64(filter.numHashFuncs))
+		h.Write(layout[:])
+		h.Write(filter.usedBytes())
+		filter.mutex.RUnlock()
+	}
+	return h.Sum64()
+}
+
 // BloomFilter represents a single Bloom filter.
 type BloomFilter struct {
 	bitset       []uint8
 	bitSize      uint
 	numHashFuncs uint
+	capacity     int       // Expected number of elements the filter was sized for
+	targetFP     float64   // False positive rate the filter was sized for; 0 if unknown
+	created      time.Time // When the filter was built; zero if unknown
+	bitOrder     BitOrder
+	hasher       Hasher
+	normalizer   KeyNormalizer
+	logger       Logger
+	strict       bool          // Set by WithStrictMode; misuse panics instead of returning an error
+	count        uint          // Number of Add calls that set at least one new bit
+	distinctAdds atomic.Uint64 // Like count, but only those made since construction or decoding
 	mutex        sync.RWMutex
+
+	trackSelfCollisions bool   // Set by WithSelfCollisionTracking
+	selfCollisions      uint64 // Inserts whose indices were not all distinct, if tracked
 }
 
 // NewBloomFilter creates a new BloomFilter with the given capacity and false positive probability.
-func NewBloomFilter(n int, fp float64) *BloomFilter {
+func NewBloomFilter(n int, fp float64, opts ...Option) *BloomFilter {
+	return newBloomFilter(n, fp, buildOptions(opts))
+}
+
+// NewBloomFilterCtx is like NewBloomFilter but gives up when ctx is done before the
+// bitset is allocated, returning ctx's error, as a guard against accidentally gigantic
+// sizes on constrained systems. The allocation runs in its own goroutine and cannot be
+// interrupted: an abandoned one still completes in the background and is then garbage
+// collected. A ctx that is already done returns before anything is allocated, and a size
+// beyond what the runtime can allocate returns ErrCapacityOverflow instead of panicking.
+func NewBloomFilterCtx(ctx context.Context, n int, fp float64, opts ...Option) (*BloomFilter, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	o := buildOptions(opts)
+	done := make(chan *BloomFilter, 1)
+	failed := make(chan error, 1)
+	go func() {
+		// A panic here would take the process down, as nothing up the goroutine recovers.
+		defer func() {
+			if r := recover(); r != nil {
+				failed <- fmt.Errorf("%w: %d items at false positive rate %g: %v", ErrCapacityOverflow, n, fp, r)
+			}
+		}()
+		done <- newBloomFilter(n, fp, o)
+	}()
+	select {
+	case bf := <-done:
+		return bf, nil
+	case err := <-failed:
+		return nil, err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// bitSize returns the number of bits newBloomFilter allocates for n items at false
+// positive rate fp.
+func (o options) bitSize(n int, fp float64) uint {
 	m := optimalBitSize(n, fp)
+	if o.foldable {
+		m = foldableBitSize(m)
+	}
+	return m
+}
+
+// newBloomFilter creates a new BloomFilter with already-resolved options.
+func newBloomFilter(n int, fp float64, o options) *BloomFilter {
+	m := o.bitSize(n, fp)
 	k := optimalHashFuncs(m, n)
+	if k == 0 {
+		// A very loose false positive target rounds k down to 0, which would report every item as present.
+		o.warnf("bloom: optimal number of hash functions for n=%d, fp=%g is 0; clamping to 1", n, fp)
+		k = 1
+	}
 	// Initialize the bitset with the number of bytes needed
 	byteSize := (m + 7) / 8 // Round up to the nearest byte
-	return &BloomFilter{
-		bitset:       make([]uint8, byteSize),
+	bf := &BloomFilter{
+		bitset:       make([]uint8, alignedLen(byteSize, o.bitsetAlignment)),
 		bitSize:      m,
 		numHashFuncs: k,
+		capacity:     n,
+		targetFP:     fp,
+		created:      o.clock.Now(),
+		bitOrder:     o.bitOrder,
+		hasher:       o.hasher,
+		normalizer:   o.normalizer,
+		logger:       o.logger,
+		strict:       o.strict,
+
+		trackSelfCollisions: o.trackSelfCollisions,
+	}
+	if o.prefault {
+		bf.prefault()
 	}
+	return bf
+}
+
+// quickFP is the false positive rate used by Quick.
+const quickFP = 0.01
+
+// Quick builds a BloomFilter sized for items with a 1% false positive rate and returns
+// a closure that tests membership against it. It hides all configuration for scripts
+// that just need a quick filter.
+func Quick(items []string) func(string) bool {
+	bf := NewBloomFilter(max(len(items), 1), quickFP)
+	for _, item := range items {
+		bf.Add(item)
+	}
+	return bf.MightContain
 }
 
 // Add inserts an item into the Bloom filter.
 // Returns true if at least one bit was newly set (indicating a new item).
 func (bf *BloomFilter) Add(item string) bool {
+	return bf.addDigest(bf.digest(item))
+}
+
+// AddFromItemReader inserts a single item whose content is streamed from r, hashing it
+// without buffering it in memory. Both the streaming and the one-shot path produce the
+// same digest, but a given key should consistently be hashed from the same bytes.
+func (bf *BloomFilter) AddFromItemReader(r io.Reader) error {
+	sum, err := streamDigest(bf.hasher, r)
+	if err != nil {
+		return err
+	}
+	bf.addDigest(sum)
+	return nil
+}
+
+// MightContainFromItemReader checks a single item whose content is streamed from r.
+func (bf *BloomFilter) MightContainFromItemReader(r io.Reader) (bool, error) {
+	sum, err := streamDigest(bf.hasher, r)
+	if err != nil {
+		return false, err
+	}
+	return bf.containsDigest(sum), nil
+}
+
+// maxHashFuncs bounds the number of hash functions of a decoded filter. Even the smallest
+// positive float64 false positive rate needs fewer than 1100; a corrupt count in the
+// billions would otherwise make every query spin.
+const maxHashFuncs = 2048
+
+// maxBitSize bounds the bit size of a decoded filter, so that rounding it up to whole
+// bytes neither wraps around to a tiny bitset nor overflows an int.
+const maxBitSize = math.MaxInt - 7
+
+// validate checks that the filter's dimensions are consistent, so that a corrupted or
+// imported filter is rejected up front instead of panicking with an out-of-range index
+// in the middle of a query. A filter without hash functions, which would report every
+// item present, is rejected as well.
+func (bf *BloomFilter) validate() error {
+	if err := checkDimensions(uint64(bf.bitSize), uint64(bf.numHashFuncs)); err != nil {
+		return err
+	}
+	if uint(len(bf.bitset)) < (bf.bitSize+7)/8 {
+		return fmt.Errorf("bitset of %d bytes cannot hold %d bits", len(bf.bitset), bf.bitSize)
+	}
+	if bf.hasher == nil {
+		return errors.New("hasher must be set")
+	}
+	return nil
+}
+
+// checkDimensions returns why a decoded filter of bitSize bits and k hash functions
+// cannot be used, or nil.
+func checkDimensions(bitSize, k uint64) error {
+	if bitSize == 0 || bitSize > maxBitSize {
+		return fmt.Errorf("bit size %d is not between 1 and %d", bitSize, uint64(maxBitSize))
+	}
+	if k == 0 || k > maxHashFuncs {
+		return fmt.Errorf("number of hash functions %d is not between 1 and %d", k, maxHashFuncs)
+	}
+	return nil
+}
+
+// digest normalizes and hashes an item with the filter's configured normalizer and hasher.
+func (bf *BloomFilter) digest(item string) []byte {
+	return bf.hasher.Sum([]byte(bf.normalizer.Normalize(item)))
+}
+
+// addDigest inserts an item given its digest.
+// Returns true if at least one bit was newly set.
+func (bf *BloomFilter) addDigest(sum []byte) bool {
 	bf.mutex.Lock()
 	defer bf.mutex.Unlock()
 
-	hashes := bf.getHashes(item)
+	hashes := bf.indices(sum)
+	if bf.trackSelfCollisions {
+		bf.countSelfCollision(hashes)
+	}
 	isNew := false
 	for _, hash := range hashes {
 		byteIndex := hash / 8
-		bitIndex := hash % 8
-		if (bf.bitset[byteIndex] & (1 << bitIndex)) == 0 {
+		mask := bf.bitOrder.mask(hash)
+		if (bf.bitset[byteIndex] & mask) == 0 {
 			isNew = true
-			bf.bitset[byteIndex] |= (1 << bitIndex)
+			bf.bitset[byteIndex] |= mask
 		}
 	}
+	if isNew {
+		bf.count++
+		bf.distinctAdds.Add(1)
+	}
 	return isNew
 }
 
+// ItemCount returns the number of Add calls that set at least one new bit.
+func (bf *BloomFilter) ItemCount() uint {
+	bf.mutex.RLock()
+	defer bf.mutex.RUnlock()
+
+	return bf.count
+}
+
+// Params returns the parameters the filter was built with, for auditing persisted filters
+// or creating an identically sized one. targetFP is 0 if it is unknown, as for filters
+// decoded from data written before it was recorded or imported from a roaring bitmap.
+// bitSize reflects any Fold since construction.
+func (bf *BloomFilter) Params() (capacity int, targetFP float64, bitSize uint, numHashFuncs uint) {
+	bf.mutex.RLock()
+	defer bf.mutex.RUnlock()
+
+	return bf.capacity, bf.targetFP, bf.bitSize, bf.numHashFuncs
+}
+
+// Union merges other into bf with a bitwise OR, so bf then reports every item of either filter.
+// Both filters must have the same bit size, hash functions, hasher, bit order and key normalizer.
+// Items in both filters cannot be told apart, so if the merge sets new bits, ItemCount is
+// afterwards estimated from the set bits, bounded by the sum of both counts.
+func (bf *BloomFilter) Union(other *BloomFilter) error {
+	if bf == other {
+		return nil
+	}
+
+	bf.mutex.Lock()
+	defer bf.mutex.Unlock()
+	other.mutex.RLock()
+	defer other.mutex.RUnlock()
+
+	if err := checkSameLayout(bf, other); err != nil {
+		return err
+	}
+	changed := false
+	for i := range bf.usedBytes() {
+		if other.bitset[i]&^bf.bitset[i] != 0 {
+			bf.bitset[i] |= other.bitset[i]
+			changed = true
+		}
+	}
+	if changed {
+		bf.count = bf.mergedCount(bf.count, other.count)
+	}
+	return nil
+}
+
+// mergedCount estimates the item count from the set bits after a merge set new ones, as
+// the number of distinct items behind merged bits is unknown. The estimate stays above
+// before, so AppendSave, which detects changes by count, sees the merge, and at most
+// before+added; the caller must hold the write lock.
+func (bf *BloomFilter) mergedCount(before, added uint) uint {
+	upper := before + max(added, 1)
+	n, err := estimateCardinality(popCount(bf.usedBytes()), bf.bitSize, bf.numHashFuncs)
+	if err != nil {
+		return upper
+	}
+	return min(max(uint(math.Round(n)), before+1), upper)
+}
+
+// weightedUnionSeed seeds the RNG used by WeightedUnion so results are reproducible.
+const weightedUnionSeed = 1
+
+// WeightedUnion copies each bit that is set only in other into bf with probability
+// keepOtherProbability, leaving bits already set in bf untouched. It is a research tool
+// for studying false positive tradeoffs when combining filters of differing confidence;
+// unlike Union it can introduce false negatives for items of other. The RNG is seeded
+// with a fixed value, so the same inputs always blend the same bits. Like Union, it requires
+// filters with identical layout and re-estimates ItemCount from the set bits if any were copied.
+func (bf *BloomFilter) WeightedUnion(other *BloomFilter, keepOtherProbability float64) error {
+	if keepOtherProbability < 0 || keepOtherProbability > 1 {
+		return errors.New("keepOtherProbability must be between 0 and 1")
+	}
+	if bf == other {
+		return nil
+	}
+
+	bf.mutex.Lock()
+	defer bf.mutex.Unlock()
+	other.mutex.RLock()
+	defer other.mutex.RUnlock()
+
+	if err := checkSameLayout(bf, other); err != nil {
+		return err
+	}
+	rng := rand.New(rand.NewSource(weightedUnionSeed))
+	changed := false
+	for i := range bf.usedBytes() {
+		onlyOther := other.bitset[i] &^ bf.bitset[i]
+		for bit := uint8(1); onlyOther != 0; bit <<= 1 {
+			if onlyOther&bit == 0 {
+				continue
+			}
+			onlyOther &^= bit
+			if rng.Float64() < keepOtherProbability {
+				bf.bitset[i] |= bit
+				changed = true
+			}
+		}
+	}
+	if changed {
+		bf.count = bf.mergedCount(bf.count, other.count)
+	}
+	return nil
+}
+
+// TestAndAdd reports whether the item might already be present and inserts it otherwise.
+func (bf *BloomFilter) TestAndAdd(item string) (bool, error) {
+	return !bf.Add(item), nil
+}
+
 // MightContain checks if an item might be in the Bloom filter.
 // Returns true if the item might be present, false if it is definitely not present.
 func (bf *BloomFilter) MightContain(item string) bool {
+	return bf.containsDigest(bf.digest(item))
+}
+
+// containsDigest checks if an item might be in the Bloom filter given its digest.
+func (bf *BloomFilter) containsDigest(sum []byte) bool {
 	bf.mutex.RLock()
 	defer bf.mutex.RUnlock()
 
-	hashes := bf.getHashes(item)
+	hashes := bf.indices(sum)
 	for _, hash := range hashes {
 		byteIndex := hash / 8
-		bitIndex := hash % 8
-		if (bf.bitset[byteIndex] & (1 << bitIndex)) == 0 {
+		if (bf.bitset[byteIndex] & bf.bitOrder.mask(hash)) == 0 {
 			return false
 		}
 	}
 	return true
 }
 
+// CollisionRate returns the fraction of hash positions, across the given items, that are shared
+// with at least one other item in the set. Only the filter's dimensions are used; its current
+// contents are ignored. A high rate at low fill signals a hashing problem.
+func (bf *BloomFilter) CollisionRate(items []string) float64 {
+	perItem := make([][]uint, len(items))
+	owners := make(map[uint]int)
+	for i, item := range items {
+		// Deduplicate within an item so self-collisions are not counted against other items.
+		seen := make(map[uint]bool, bf.numHashFuncs)
+		for _, hash := range bf.getHashes(item) {
+			if !seen[hash] {
+				seen[hash] = true
+				perItem[i] = append(perItem[i], hash)
+				owners[hash]++
+			}
+		}
+	}
+
+	var total, collisions int
+	for _, hashes := range perItem {
+		for _, hash := range hashes {
+			total++
+			if owners[hash] > 1 {
+				collisions++
+			}
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(collisions) / float64(total)
+}
+
+// SharedHashCount returns how many of the numHashFuncs positions of a are also positions
+// of b, from 0 for keys that could never be confused to numHashFuncs for identical keys.
+// Like CollisionRate it only uses the filter's dimensions, not its contents, and can serve
+// as a building block for similarity heuristics.
+func (bf *BloomFilter) SharedHashCount(a, b string) int {
+	positions := make(map[uint]bool, bf.numHashFuncs)
+	for _, hash := range bf.getHashes(b) {
+		positions[hash] = true
+	}
+	shared := 0
+	for _, hash := range bf.getHashes(a) {
+		if positions[hash] {
+			shared++
+		}
+	}
+	return shared
+}
+
 // getHashes generates the required number of hash indices for an item using double hashing.
 func (bf *BloomFilter) getHashes(item string) []uint {
-	data := md5.Sum([]byte(item))
-	hash1 := binary.BigEndian.Uint32(data[0:4])
-	hash2 := binary.BigEndian.Uint32(data[4:8])
-	hashes := make([]uint, bf.numHashFuncs)
-	for i := uint(0); i < bf.numHashFuncs; i++ {
-		combinedHash := hash1 + uint32(i)*hash2
-		hashes[i] = uint(combinedHash) % bf.bitSize
+	return bf.indices(bf.digest(item))
+}
+
+// warnf logs a warning if the filter has a logger.
+func (bf *BloomFilter) warnf(format string, args ...any) {
+	if bf.logger != nil {
+		bf.logger.Warnf(format, args...)
+	}
+}
+
+// indices generates the filter's hash indices for a digest.
+func (bf *BloomFilter) indices(sum []byte) []uint {
+	if zeroSecondHash(sum) {
+		bf.warnf("bloom: zero second hash for a key; substituting 1 so its %d indices differ", bf.numHashFuncs)
 	}
-	return hashes
+	return digestIndices(sum, bf.numHashFuncs, bf.bitSize)
+}
+
+// hashIndices generates k indices in [0, m) for an item using the default hasher.
+func hashIndices(item string, k, m uint) []uint {
+	return digestIndices(MD5Hasher.Sum([]byte(item)), k, m)
 }
 
 // optimalBitSize calculates the optimal size of the bit array (m) for a Bloom filter.
@@ -180,71 +910,56 @@ func optimalHashFuncs(m uint, n int) uint {
 	return uint(math.Round(k))
 }
 
-// loadConfig loads the configuration from a JSON file.
-// Returns a Config struct or an error if loading fails.
-func loadConfig(filepath string) (Config, error) {
-	var config Config
-	data, err := ioutil.ReadFile(filepath)
-
-	if err != nil {
-		return config, err
+// CapacityForFP recommends the capacity a rebuilt filter should be created with, given that
+// a filter holding currentItems has degraded to an observed false positive rate of currentFP.
+// When currentFP exceeds targetFP, the item count is scaled by ln(targetFP)/ln(currentFP), the
+// ratio of bits per item the target requires to the bits per item effectively in use, which
+// leaves headroom proportional to how far the filter has degraded. Otherwise currentItems is
+// returned unchanged. Rates outside (0, 1) are treated as no degradation.
+func CapacityForFP(currentItems int, targetFP, currentFP float64) int {
+	capacity := max(currentItems, 1)
+	if targetFP <= 0 || targetFP >= 1 || currentFP <= 0 || currentFP >= 1 || currentFP <= targetFP {
+		return capacity
 	}
-	err = json.Unmarshal(data, &config)
-	return config, err
+	scaled := int(math.Ceil(float64(capacity) * math.Log(targetFP) / math.Log(currentFP)))
+	return max(scaled, capacity+1)
 }
 
-func main() {
-	// Define command-line flags for configuration
-	configPath := flag.String("config", "config.json", "Path to configuration file")
-	useDefaults := flag.Bool("defaults", false, "Use default configuration if true")
-	flag.Parse()
+// OptimalConfig recommends a Config for about expectedItems distinct items at a false
+// positive rate of targetFP. The first sub-filter is sized for all of them, and its rate is
+// set so that the rates of every sub-filter added should the estimate be too low sum to at
+// most targetFP: with the default tightening ratio of 0.5, the first targets targetFP/2.
+// The result is validated by NewScalableBloomFilter like any other Config.
+func OptimalConfig(expectedItems int, targetFP float64) Config {
+	const growthFactor, tighteningRatio = 2.0, 0.5
+	return Config{
+		InitialFP:       targetFP * (1 - tighteningRatio),
+		GrowthFactor:    growthFactor,
+		TighteningRatio: tighteningRatio,
+		InitialCapacity: max(expectedItems, 1),
+	}
+}
 
+// loadConfig loads the configuration from a JSON file, or a YAML or TOML file as told by
+// its extension. Returns a Config struct or an error if loading fails.
+func loadConfig(filepath string) (Config, error) {
 	var config Config
+	data, err := ioutil.ReadFile(filepath)
 
-	if *useDefaults {
-		// Default configuration
-		config = Config{
-			InitialFP:       0.01, // 1% false positive rate
-			GrowthFactor:    2.0,  // Capacity doubles with each new filter
-			TighteningRatio: 0.5,  // False positive rate halves with each new filter
-			InitialCapacity: 1000, // Initial expected number of elements
-		}
-	} else {
-		// Load configuration from file
-		if _, err := os.Stat(*configPath); os.IsNotExist(err) {
-			fmt.Printf("Configuration file not found: %s\n", *configPath)
-			os.Exit(1)
-		}
-		loadedConfig, err := loadConfig(*configPath)
-		if err != nil {
-			fmt.Printf("Error loading configuration: %v\n", err)
-			os.Exit(1)
-		}
-		config = loadedConfig
-	}
-
-	// Initialize Scalable Bloom Filter with the loaded configuration
-	sbf, err := NewScalableBloomFilter(config)
 	if err != nil {
-		fmt.Printf("Error initializing Scalable Bloom Filter: %v\n", err)
-		os.Exit(1)
+		return config, err
 	}
-
-	// Example usage: Add elements
-	elementsToAdd := []string{"apple", "banana", "cherry", "date", "elderberry", "fig", "grape"}
-
-	for _, item := range elementsToAdd {
-		err := sbf.Add(item)
+	if format := configFormat(filepath); format != configJSON {
+		config, problems, err := decodeConfig(data, format)
 		if err != nil {
-			fmt.Printf("Error adding item '%s': %v\n", item, err)
+			return config, err
 		}
+		return config, errors.Join(problems...)
 	}
+	err = json.Unmarshal(data, &config)
+	return config, err
+}
 
-	// Example usage: Check for elements
-	elementsToCheck := []string{"apple", "banana", "cherry", "date", "kiwi", "lemon"}
-
-	for _, item := range elementsToCheck {
-		contains := sbf.MightContain(item)
-		fmt.Printf("Contains '%s': %v\n", item, contains)
-	}
+func main() {
+	os.Exit(runCLI(cliEnv{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}, os.Args[1:]))
 }
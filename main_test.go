@@ -0,0 +1,805 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testConfig is a small configuration that grows after a few hundred items.
+var testConfig = Config{
+	InitialFP:       0.01,
+	GrowthFactor:    2,
+	TighteningRatio: 0.5,
+	InitialCapacity: 100,
+}
+
+// newTestFilter returns an empty scalable filter built from config, failing the test if
+// the configuration is rejected.
+func newTestFilter(t testing.TB, config Config, opts ...Option) *ScalableBloomFilter {
+	t.Helper()
+	sbf, err := NewScalableBloomFilter(config, opts...)
+	if err != nil {
+		t.Fatalf("NewScalableBloomFilter(%+v): %v", config, err)
+	}
+	return sbf
+}
+
+// testKeys returns n distinct keys starting with prefix.
+func testKeys(prefix string, n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%s-%d", prefix, i)
+	}
+	return keys
+}
+
+// addAll adds every key to sbf, failing the test on the first error.
+func addAll(t testing.TB, sbf *ScalableBloomFilter, keys []string) {
+	t.Helper()
+	for _, key := range keys {
+		if err := sbf.Add(key); err != nil {
+			t.Fatalf("Add(%q): %v", key, err)
+		}
+	}
+}
+
+func TestMemoryEfficiency(t *testing.T) {
+	sbf := newTestFilter(t, defaultConfig)
+	if theoretical, actual := sbf.MemoryEfficiency(); theoretical != 0 || actual != 0 {
+		t.Errorf("empty filter: MemoryEfficiency() = %d, %d, want 0, 0", theoretical, actual)
+	}
+
+	// Enough items for several growth steps of the default configuration.
+	addAll(t, sbf, testKeys("item", 10000))
+	theoretical, actual := sbf.MemoryEfficiency()
+	if theoretical <= 0 || actual <= 0 {
+		t.Fatalf("MemoryEfficiency() = %d, %d, want both positive", theoretical, actual)
+	}
+	// Tightened sub-filters and unused capacity in the newest one cost extra memory, but
+	// with a growth factor of 2 and a tightening ratio of 0.5 no more than a few times the
+	// optimum.
+	if ratio := float64(actual) / float64(theoretical); ratio < 1 || ratio > 4 {
+		t.Errorf("actual/theoretical = %d/%d = %.2f, want between 1 and 4", actual, theoretical, ratio)
+	}
+}
+
+func TestSetInitialFP(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	addAll(t, sbf, testKeys("before", testConfig.InitialCapacity))
+	if len(sbf.filters) != 1 {
+		t.Fatalf("%d sub-filters after filling the first, want 1", len(sbf.filters))
+	}
+
+	const newFP = 0.001
+	if err := sbf.SetInitialFP(newFP); err != nil {
+		t.Fatalf("SetInitialFP(%g): %v", newFP, err)
+	}
+	if got := sbf.filters[0].targetFP; got != testConfig.InitialFP {
+		t.Errorf("existing sub-filter targets %g after SetInitialFP, want it unchanged at %g", got, testConfig.InitialFP)
+	}
+	addAll(t, sbf, testKeys("after", 1)) // Grows
+	if len(sbf.filters) != 2 {
+		t.Fatalf("%d sub-filters, want 2", len(sbf.filters))
+	}
+	if got, want := sbf.filters[1].targetFP, newFP*testConfig.TighteningRatio; got != want {
+		t.Errorf("new sub-filter targets %g, want the new rate tightened once, %g", got, want)
+	}
+	if got := sbf.Config().InitialFP; got != newFP {
+		t.Errorf("Config().InitialFP = %g, want %g", got, newFP)
+	}
+
+	for _, fp := range []float64{0, 1, -0.5} {
+		if err := sbf.SetInitialFP(fp); err == nil {
+			t.Errorf("SetInitialFP(%g) succeeded, want an error", fp)
+		}
+	}
+}
+
+func TestCollisionRate(t *testing.T) {
+	bf := NewBloomFilter(100, 0.01)
+	if got := bf.CollisionRate(nil); got != 0 {
+		t.Errorf("CollisionRate(nil) = %g, want 0", got)
+	}
+	normal := bf.CollisionRate(testKeys("key", 10))
+
+	// Adversarial keys, found by brute force, that each share at least two of their
+	// positions with an anchor key.
+	const anchor = "anchor"
+	adversarial := []string{anchor}
+	for i := 0; len(adversarial) <= 10; i++ {
+		if key := fmt.Sprintf("probe-%d", i); bf.SharedHashCount(anchor, key) >= 2 {
+			adversarial = append(adversarial, key)
+		}
+	}
+	crafted := bf.CollisionRate(adversarial)
+
+	if normal > 0.15 {
+		t.Errorf("CollisionRate of ordinary keys = %.3f, want at most 0.15 at this fill", normal)
+	}
+	if crafted < 2*normal || crafted < 0.3 {
+		t.Errorf("CollisionRate of crafted keys = %.3f, want well above the %.3f of ordinary keys", crafted, normal)
+	}
+	t.Logf("collision rate: ordinary %.3f, crafted %.3f", normal, crafted)
+
+	// Identical items collide on every position; a single item collides with nothing.
+	if got := bf.CollisionRate([]string{"x", "x"}); got != 1 {
+		t.Errorf(`CollisionRate(["x", "x"]) = %g, want 1`, got)
+	}
+	if got := bf.CollisionRate([]string{"x"}); got != 0 {
+		t.Errorf(`CollisionRate(["x"]) = %g, want 0`, got)
+	}
+}
+
+func TestSharedHashCount(t *testing.T) {
+	bf := NewBloomFilter(10000, 0.01)
+	k := int(bf.numHashFuncs)
+	if got := bf.SharedHashCount("same", "same"); got != k {
+		t.Errorf("SharedHashCount of identical keys = %d, want all %d positions", got, k)
+	}
+
+	// Unrelated keys share a position with probability about k/m each.
+	var total, most int
+	a, b := testKeys("a", 1000), testKeys("b", 1000)
+	for i := range a {
+		shared := bf.SharedHashCount(a[i], b[i])
+		total += shared
+		most = max(most, shared)
+	}
+	if expected := float64(len(a)*k*k) / float64(bf.bitSize); float64(total) > 3*expected+5 || most > 2 {
+		t.Errorf("unrelated keys share %d positions in total, at most %d per pair, want about %.1f in total",
+			total, most, expected)
+	}
+
+	// The count depends on the filter's dimensions and normalizer, not its contents.
+	before := bf.SharedHashCount("a-0", "b-0")
+	bf.Add("a-0")
+	if got := bf.SharedHashCount("a-0", "b-0"); got != before {
+		t.Errorf("SharedHashCount changed from %d to %d after an Add", before, got)
+	}
+	lower := NewBloomFilter(10000, 0.01, WithKeyNormalizer(LowercaseNormalizer))
+	if got := lower.SharedHashCount("Key", "kEY"); got != k {
+		t.Errorf("SharedHashCount of keys equal after normalization = %d, want %d", got, k)
+	}
+}
+
+func TestQuick(t *testing.T) {
+	words := []string{"apple", "banana", "cherry", "date", "elderberry"}
+	contains := Quick(words)
+	for _, word := range words {
+		if !contains(word) {
+			t.Errorf("contains(%q) = false for a word in the list", word)
+		}
+	}
+	for _, word := range []string{"fig", "grape", "kiwi"} {
+		if contains(word) {
+			t.Errorf("contains(%q) = true for a word not in the list", word)
+		}
+	}
+	if Quick(nil)("anything") {
+		t.Error("a quick filter of no items contains something")
+	}
+}
+
+func TestWeightedUnion(t *testing.T) {
+	build := func(prefix string) *BloomFilter {
+		bf := NewBloomFilter(10000, 0.01)
+		for _, key := range testKeys(prefix, 2000) {
+			bf.Add(key)
+		}
+		return bf
+	}
+	other := build("other")
+	onlyOther := func(bf *BloomFilter) uint {
+		var n uint
+		for i := range bf.bitset {
+			n += uint(bits.OnesCount8(other.bitset[i] &^ bf.bitset[i]))
+		}
+		return n
+	}
+
+	bf := build("base")
+	before, count := popCount(bf.bitset), bf.ItemCount()
+	candidates := onlyOther(bf)
+	const p = 0.3
+	if err := bf.WeightedUnion(other, p); err != nil {
+		t.Fatalf("WeightedUnion: %v", err)
+	}
+	// Binomial(candidates, p): allow four standard deviations.
+	blended := float64(popCount(bf.bitset) - before)
+	want := p * float64(candidates)
+	if tolerance := 4 * math.Sqrt(want*(1-p)); math.Abs(blended-want) > tolerance {
+		t.Errorf("blended %.0f of %d bits, want %.0f ± %.0f", blended, candidates, want, tolerance)
+	}
+	if got := bf.ItemCount(); got <= count || got > count+other.ItemCount() {
+		t.Errorf("ItemCount() = %d after blending, want more than %d and at most %d", got, count, count+other.ItemCount())
+	}
+
+	// The RNG is seeded, so the same inputs blend the same bits.
+	again := build("base")
+	again.WeightedUnion(other, p)
+	if !bytes.Equal(again.bitset, bf.bitset) {
+		t.Error("WeightedUnion of identical inputs blended different bits")
+	}
+
+	none := build("base")
+	none.WeightedUnion(other, 0)
+	if popCount(none.bitset) != before || none.ItemCount() != count {
+		t.Error("WeightedUnion with probability 0 changed the filter")
+	}
+	all := build("base")
+	all.WeightedUnion(other, 1)
+	if onlyOther(all) != 0 {
+		t.Error("WeightedUnion with probability 1 left bits of other out")
+	}
+
+	for _, prob := range []float64{-0.1, 1.1} {
+		if err := bf.WeightedUnion(other, prob); err == nil {
+			t.Errorf("WeightedUnion with probability %g succeeded", prob)
+		}
+	}
+	if err := bf.WeightedUnion(NewBloomFilter(10000, 0.01, WithHasher(FNVHasher)), p); err == nil {
+		t.Error("WeightedUnion with a different hasher succeeded")
+	}
+}
+
+// TestWeightedUnionAppendSave checks that an append save after a merge writes the merged
+// sub-filter again instead of keeping its earlier record.
+func TestWeightedUnionAppendSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.blma")
+	// Large enough that the record outweighs the footer, so the save appends rather than
+	// rewriting the file.
+	config := Config{InitialFP: 0.01, GrowthFactor: 2, TighteningRatio: 0.5, InitialCapacity: 10000}
+	sbf := newTestFilter(t, config)
+	addAll(t, sbf, testKeys("saved", 10))
+	if err := sbf.AppendSave(path); err != nil {
+		t.Fatalf("AppendSave: %v", err)
+	}
+
+	other := newTestFilter(t, config)
+	addAll(t, other, testKeys("merged", 10))
+	if err := sbf.filters[0].WeightedUnion(other.filters[0], 1); err != nil {
+		t.Fatalf("WeightedUnion: %v", err)
+	}
+	if err := sbf.AppendSave(path); err != nil {
+		t.Fatalf("second AppendSave: %v", err)
+	}
+	loaded, err := LoadAppendFile(path)
+	if err != nil {
+		t.Fatalf("LoadAppendFile: %v", err)
+	}
+	for _, key := range testKeys("merged", 10) {
+		if !loaded.MightContain(key) {
+			t.Fatalf("loaded filter lacks merged key %q", key)
+		}
+	}
+}
+
+func TestLastGrowthReason(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	addAll(t, sbf, testKeys("fill", testConfig.InitialCapacity))
+	if got := sbf.LastGrowthReason(); got != "" {
+		t.Errorf("LastGrowthReason() = %q before any growth, want \"\"", got)
+	}
+	addAll(t, sbf, testKeys("grow", 1))
+	if len(sbf.filters) != 2 {
+		t.Fatalf("%d sub-filters, want 2", len(sbf.filters))
+	}
+	if got := sbf.LastGrowthReason(); got != GrowthReasonCapacity {
+		t.Errorf("LastGrowthReason() = %q, want %q", got, GrowthReasonCapacity)
+	}
+	if got := sbf.Stats().LastGrowthReason; got != GrowthReasonCapacity {
+		t.Errorf("Stats().LastGrowthReason = %q, want %q", got, GrowthReasonCapacity)
+	}
+}
+
+func TestStageSizeOverflow(t *testing.T) {
+	for _, growth := range []float64{1.5, 2, 10} {
+		config := testConfig
+		config.GrowthFactor = growth
+		sbf := newTestFilter(t, config)
+		prev := 0
+		for i := 0; ; i++ {
+			capacity, fp, err := sbf.stageSize(i)
+			if err != nil {
+				if !errors.Is(err, ErrCapacityOverflow) {
+					t.Fatalf("growth %g: stageSize(%d): %v, want ErrCapacityOverflow", growth, i, err)
+				}
+				if i < 10 {
+					t.Errorf("growth %g: overflow after only %d stages", growth, i)
+				}
+				break
+			}
+			if capacity <= prev || fp <= 0 {
+				t.Fatalf("growth %g: stage %d has capacity %d and rate %g after capacity %d, want growing and positive",
+					growth, i, capacity, fp, prev)
+			}
+			prev = capacity
+		}
+	}
+}
+
+func TestGrowCapacityOverflow(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	addAll(t, sbf, testKeys("fill", testConfig.InitialCapacity))
+	// Growing for real would allocate far too much memory before overflowing.
+	sbf.growthFactor = 1e300
+	if err := sbf.Add("overflow"); !errors.Is(err, ErrCapacityOverflow) {
+		t.Fatalf("Add needing an overflowing sub-filter = %v, want ErrCapacityOverflow", err)
+	}
+	if len(sbf.filters) != 1 || sbf.ItemCount() != uint(testConfig.InitialCapacity) {
+		t.Errorf("after the failed growth: %d sub-filters, %d items, want 1 and %d",
+			len(sbf.filters), sbf.ItemCount(), testConfig.InitialCapacity)
+	}
+	if !sbf.MightContain("fill-0") {
+		t.Error("existing items lost after the failed growth")
+	}
+}
+
+func TestMinFP(t *testing.T) {
+	config := Config{InitialFP: 0.01, GrowthFactor: 1.1, TighteningRatio: 0.5, InitialCapacity: 100, MinFP: 1e-4}
+	sbf := newTestFilter(t, config)
+	for i := 0; len(sbf.filters) < 20; i++ {
+		addAll(t, sbf, []string{fmt.Sprint("floor-", i)})
+	}
+
+	// Unfloored, the last stage would target 2e-8 and need 37 bits an item rather than 20.
+	maxBitsPerItem := -math.Log(config.MinFP)/(math.Ln2*math.Ln2) + 1
+	for i, bf := range sbf.filters {
+		if bf.targetFP < config.MinFP {
+			t.Errorf("stage %d targets %g, below MinFP %g", i, bf.targetFP, config.MinFP)
+		}
+		if want := config.stageFP(i); bf.targetFP != want {
+			t.Errorf("stage %d targets %g, want %g", i, bf.targetFP, want)
+		}
+		if perItem := float64(bf.bitSize) / float64(bf.capacity); perItem > maxBitsPerItem {
+			t.Errorf("stage %d has %.1f bits an item, want at most %.1f", i, perItem, maxBitsPerItem)
+		}
+	}
+	if last := sbf.filters[len(sbf.filters)-1]; last.targetFP != config.MinFP {
+		t.Errorf("stage %d targets %g, want the floor %g", len(sbf.filters)-1, last.targetFP, config.MinFP)
+	}
+
+	// The floor survives a save, and later growth still respects it.
+	path := filepath.Join(t.TempDir(), "floored.bloom")
+	if err := sbf.saveFile(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadScalableFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Config().MinFP; got != config.MinFP {
+		t.Errorf("loaded MinFP = %g, want %g", got, config.MinFP)
+	}
+
+	for _, minFP := range []float64{-1e-4, 0.02} {
+		invalid := config
+		invalid.MinFP = minFP
+		if _, err := NewScalableBloomFilter(invalid); err == nil {
+			t.Errorf("NewScalableBloomFilter with MinFP %g and InitialFP %g succeeded", minFP, config.InitialFP)
+		}
+	}
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	config := sbf.Config()
+	if config != testConfig {
+		t.Errorf("Config() = %+v, want %+v", config, testConfig)
+	}
+
+	// The returned configuration builds an equivalent filter: the same items give the same bits.
+	clone := newTestFilter(t, config)
+	keys := testKeys("config", 500)
+	addAll(t, sbf, keys)
+	addAll(t, clone, keys)
+	if !sameBits(clone, sbf) {
+		t.Error("filter built from Config() differs from the original after the same adds")
+	}
+
+	// Config returns a copy.
+	config.InitialFP = 0.5
+	if got := sbf.Config().InitialFP; got != testConfig.InitialFP {
+		t.Errorf("modifying the returned Config changed the filter's InitialFP to %g", got)
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	keys := testKeys("frozen", 200)
+	addAll(t, sbf, keys)
+	data, err := sbf.GobEncode()
+	if err != nil {
+		t.Fatalf("GobEncode: %v", err)
+	}
+	sbf.Freeze()
+	if !sbf.Frozen() || !sbf.Stats().Frozen {
+		t.Fatal("Frozen() = false after Freeze")
+	}
+
+	for name, mutate := range map[string]func() error{
+		"Add":               func() error { return sbf.Add("new") },
+		"TestAndAdd":        func() error { _, err := sbf.TestAndAdd("new"); return err },
+		"AddBatch":          func() error { return sbf.AddBatch([]string{"new"}) },
+		"AddUint64":         func() error { return sbf.AddUint64(1) },
+		"AddFromItemReader": func() error { return sbf.AddFromItemReader(strings.NewReader("new")) },
+		"SetInitialFP":      func() error { return sbf.SetInitialFP(0.001) },
+		"PreGrow":           func() error { _, err := sbf.PreGrow(1000); return err },
+		"GobDecode":         func() error { return sbf.GobDecode(data) },
+	} {
+		if err := mutate(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s on a frozen filter = %v, want ErrReadOnly", name, err)
+		}
+	}
+	if sbf.MightContain("new") {
+		t.Error("a rejected mutation changed the filter")
+	}
+
+	// The frozen state survives serialization.
+	frozen, err := sbf.GobEncode()
+	if err != nil {
+		t.Fatalf("GobEncode of a frozen filter: %v", err)
+	}
+	var loaded ScalableBloomFilter
+	if err := loaded.GobDecode(frozen); err != nil {
+		t.Fatalf("GobDecode: %v", err)
+	}
+	if !loaded.Frozen() {
+		t.Error("decoded filter is not frozen")
+	}
+	if err := loaded.Add("new"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Add on a decoded frozen filter = %v, want ErrReadOnly", err)
+	}
+}
+
+// TestFreezeLoaded freezes a filter loaded from disk for query-only serving.
+func TestFreezeLoaded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "served.bloom")
+	sbf := newTestFilter(t, testConfig)
+	keys := testKeys("served", 300)
+	addAll(t, sbf, keys)
+	if err := sbf.saveFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadScalableFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.Freeze()
+	if err := loaded.Add("new"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Add on a loaded, frozen filter = %v, want ErrReadOnly", err)
+	}
+	for _, key := range keys {
+		if !loaded.MightContain(key) {
+			t.Fatalf("MightContain(%q) = false after Freeze", key)
+		}
+	}
+	if got := loaded.ItemCount(); got != sbf.ItemCount() {
+		t.Errorf("ItemCount() = %d after the rejected Add, want %d", got, sbf.ItemCount())
+	}
+}
+
+func TestFreezeConcurrentReads(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	keys := testKeys("frozen", 200)
+	addAll(t, sbf, keys)
+
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				for _, key := range keys {
+					if !sbf.MightContain(key) {
+						t.Errorf("MightContain(%q) = false", key)
+						return
+					}
+				}
+			}
+		}()
+	}
+	// Freeze while readers are running, then keep trying to write.
+	sbf.Freeze()
+	for i := 0; i < 100; i++ {
+		if err := sbf.Add(fmt.Sprintf("late-%d", i)); !errors.Is(err, ErrReadOnly) {
+			t.Fatalf("Add after Freeze = %v, want ErrReadOnly", err)
+		}
+	}
+	wg.Wait()
+}
+
+func TestCapacityForFP(t *testing.T) {
+	for _, tc := range []struct {
+		items               int
+		targetFP, currentFP float64
+	}{
+		{1000, 0.01, 0.05},
+		{1000, 0.01, 0.011},
+		{10, 0.001, 0.5},
+		{1, 0.01, 0.02},
+	} {
+		got := CapacityForFP(tc.items, tc.targetFP, tc.currentFP)
+		if got <= tc.items {
+			t.Errorf("CapacityForFP(%d, %g, %g) = %d, want more than the current item count", tc.items, tc.targetFP, tc.currentFP, got)
+		}
+	}
+	// ln(0.01)/ln(0.1) = 2: a filter at 10% needs twice the bits per item to reach 1%.
+	if got := CapacityForFP(1000, 0.01, 0.1); got < 2000 || got > 2001 {
+		t.Errorf("CapacityForFP(1000, 0.01, 0.1) = %d, want 2000 up to rounding", got)
+	}
+	// Already on target, or nonsensical rates: keep the current load.
+	for _, tc := range []struct{ targetFP, currentFP float64 }{{0.01, 0.01}, {0.01, 0.001}, {0, 0.5}, {0.01, 1}} {
+		if got := CapacityForFP(1000, tc.targetFP, tc.currentFP); got != 1000 {
+			t.Errorf("CapacityForFP(1000, %g, %g) = %d, want 1000", tc.targetFP, tc.currentFP, got)
+		}
+	}
+}
+
+func TestMightContainInFilter(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	stage := make(map[string]int)
+	for _, key := range testKeys("stage", 500) {
+		addAll(t, sbf, []string{key})
+		stage[key] = len(sbf.filters) - 1 // Items always go to the newest sub-filter
+	}
+	if len(sbf.filters) < 3 {
+		t.Fatalf("%d sub-filters, want growth to several", len(sbf.filters))
+	}
+
+	elsewhere := 0
+	for key, added := range stage {
+		for i := range sbf.filters {
+			found, err := sbf.MightContainInFilter(i, key)
+			if err != nil {
+				t.Fatalf("MightContainInFilter(%d, %q): %v", i, key, err)
+			}
+			if i == added && !found {
+				t.Fatalf("MightContainInFilter(%d, %q) = false for the sub-filter it was added to", i, key)
+			}
+			if i != added && found {
+				elsewhere++
+			}
+		}
+	}
+	// Other sub-filters only match by false positive.
+	if rate := float64(elsewhere) / float64(len(stage)*(len(sbf.filters)-1)); rate > 0.05 {
+		t.Errorf("%.3f of lookups matched a sub-filter the item was not added to", rate)
+	}
+
+	for _, index := range []int{-1, len(sbf.filters)} {
+		if _, err := sbf.MightContainInFilter(index, "stage-0"); err == nil {
+			t.Errorf("MightContainInFilter(%d) succeeded out of range", index)
+		}
+	}
+}
+
+func TestParams(t *testing.T) {
+	bf := NewBloomFilter(1000, 0.01)
+	capacity, targetFP, bitSize, numHashFuncs := bf.Params()
+	if capacity != 1000 || targetFP != 0.01 {
+		t.Errorf("Params() capacity and FP = %d, %g, want 1000, 0.01", capacity, targetFP)
+	}
+	if bitSize != optimalBitSize(1000, 0.01) || numHashFuncs != optimalHashFuncs(bitSize, 1000) {
+		t.Errorf("Params() bits and k = %d, %d, want the optimal %d, %d",
+			bitSize, numHashFuncs, optimalBitSize(1000, 0.01), optimalHashFuncs(bitSize, 1000))
+	}
+
+	// The parameters survive serialization and are enough to build an identical filter.
+	data, err := bf.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	decoded := &BloomFilter{}
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	c, fp, m, k := decoded.Params()
+	if c != capacity || fp != targetFP || m != bitSize || k != numHashFuncs {
+		t.Errorf("decoded Params() = %d, %g, %d, %d, want %d, %g, %d, %d", c, fp, m, k, capacity, targetFP, bitSize, numHashFuncs)
+	}
+	clone := NewBloomFilter(c, fp)
+	if _, _, m, k := clone.Params(); m != bitSize || k != numHashFuncs {
+		t.Errorf("filter built from Params() has %d bits and k %d, want %d and %d", m, k, bitSize, numHashFuncs)
+	}
+}
+
+func TestNewBloomFilterCtx(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	for ctx, want := range map[context.Context]error{canceled: context.Canceled, expired: context.DeadlineExceeded} {
+		// Large enough to take a while, but allocated only if the check is missing.
+		if bf, err := NewBloomFilterCtx(ctx, 1e9, 1e-6); bf != nil || !errors.Is(err, want) {
+			t.Errorf("NewBloomFilterCtx with a done context = %v, %v, want nil, %v", bf, err, want)
+		}
+	}
+
+	bf, err := NewBloomFilterCtx(context.Background(), 1000, 0.01, WithHasher(FNVHasher))
+	if err != nil {
+		t.Fatalf("NewBloomFilterCtx: %v", err)
+	}
+	want := NewBloomFilter(1000, 0.01, WithHasher(FNVHasher))
+	if bf.bitSize != want.bitSize || bf.numHashFuncs != want.numHashFuncs || bf.hasher.Name() != "fnv" || len(bf.bitset) != len(want.bitset) {
+		t.Errorf("NewBloomFilterCtx built %d bits, k=%d, want %d bits, k=%d", bf.bitSize, bf.numHashFuncs, want.bitSize, want.numHashFuncs)
+	}
+
+	// Far beyond what the runtime can allocate: an error, not a crash.
+	if _, err := NewBloomFilterCtx(context.Background(), math.MaxInt/2, 1e-9); !errors.Is(err, ErrCapacityOverflow) {
+		t.Errorf("NewBloomFilterCtx of an impossible size = %v, want ErrCapacityOverflow", err)
+	}
+}
+
+func TestLargestFilter(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	if index, size := sbf.LargestFilter(); index != -1 || size != 0 {
+		t.Errorf("LargestFilter of an empty filter = %d, %d, want -1, 0", index, size)
+	}
+
+	for i := 0; len(sbf.filters) < 6; i++ {
+		addAll(t, sbf, []string{fmt.Sprint("grow-", i)})
+		want, wantSize := -1, 0
+		for j, bf := range sbf.filters {
+			if len(bf.bitset) > wantSize {
+				want, wantSize = j, len(bf.bitset)
+			}
+		}
+		if index, size := sbf.LargestFilter(); index != want || size != wantSize {
+			t.Fatalf("%d stages: LargestFilter = %d, %d, want %d, %d", len(sbf.filters), index, size, want, wantSize)
+		}
+	}
+	if index, _ := sbf.LargestFilter(); index != 5 {
+		t.Errorf("LargestFilter = %d after growth, want the newest stage, 5", index)
+	}
+
+	// Ties go to the older stage, and alignment padding counts.
+	tied := newTestFilter(t, testConfig, WithBitsetAlignment(4096))
+	addAll(t, tied, testKeys("tied", 150))
+	if len(tied.filters) != 2 || len(tied.filters[0].bitset) != 4096 || len(tied.filters[1].bitset) != 4096 {
+		t.Fatalf("want two stages padded to 4096 bytes")
+	}
+	if index, size := tied.LargestFilter(); index != 0 || size != 4096 {
+		t.Errorf("LargestFilter with equal stages = %d, %d, want 0, 4096", index, size)
+	}
+}
+
+func TestStateHash(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	empty := sbf.StateHash()
+	if got := newTestFilter(t, testConfig).StateHash(); got != empty {
+		t.Errorf("StateHash of two empty filters = %#x and %#x", empty, got)
+	}
+
+	items := testKeys("item", 300) // Several sub-filters
+	addAll(t, sbf, items)
+	before := sbf.StateHash()
+	if before == empty {
+		t.Fatal("StateHash unchanged by adding items to an empty filter")
+	}
+	if got := sbf.StateHash(); got != before {
+		t.Errorf("StateHash is not stable: %#x, then %#x", before, got)
+	}
+
+	// Re-adding items of the active sub-filter, short of its capacity, sets no bit. Items
+	// of earlier sub-filters would set their bits in the active one too.
+	roomy := testConfig
+	roomy.InitialCapacity = 1000
+	single := newTestFilter(t, roomy)
+	addAll(t, single, items)
+	once := single.StateHash()
+	addAll(t, single, items[:100])
+	if got := single.StateHash(); got != once {
+		t.Errorf("StateHash after re-adding present items = %#x, want %#x", got, once)
+	}
+
+	// The same items give the same fingerprint, whatever the bitset alignment.
+	aligned := newTestFilter(t, testConfig, WithBitsetAlignment(64))
+	addAll(t, aligned, items)
+	if got := aligned.StateHash(); got != before {
+		t.Errorf("StateHash of the same items in an aligned filter = %#x, want %#x", got, before)
+	}
+
+	var added string
+	for _, item := range testKeys("new", 100) {
+		if !sbf.MightContain(item) {
+			added = item
+			break
+		}
+	}
+	if err := sbf.Add(added); err != nil {
+		t.Fatal(err)
+	}
+	if got := sbf.StateHash(); got == before {
+		t.Errorf("StateHash unchanged after adding the new item %q", added)
+	}
+}
+
+func TestDistinctAddedApprox(t *testing.T) {
+	roomy := testConfig
+	roomy.InitialCapacity = 1000 // One sub-filter, where a re-add sets no new bit
+	sbf := newTestFilter(t, roomy)
+	items := testKeys("item", 200)
+	addAll(t, sbf, items)
+	addAll(t, sbf, items[:100])
+
+	// 300 Add calls: 200 changed the state, and the bits estimate about as many items.
+	if got := sbf.DistinctAddedApprox(); got != 200 {
+		t.Errorf("DistinctAddedApprox() = %d after 200 new and 100 repeated adds, want 200", got)
+	}
+	if got := sbf.ItemCount(); got != 200 {
+		t.Errorf("ItemCount() = %d, want 200", got)
+	}
+	filter := sbf.filters[0]
+	estimate, err := estimateCardinality(popCount(filter.usedBytes()), filter.bitSize, filter.numHashFuncs)
+	if err != nil || math.Abs(estimate-200) > 20 {
+		t.Errorf("estimated %g items from the bits (%v), want about 200", estimate, err)
+	}
+
+	// Decoding keeps ItemCount but starts the new counter over.
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(sbf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded ScalableBloomFilter
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.Add("new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.Add(items[0]); err != nil {
+		t.Fatal(err)
+	}
+	if got, count := decoded.DistinctAddedApprox(), decoded.ItemCount(); got != 1 || count != 201 {
+		t.Errorf("after decoding and one new add: DistinctAddedApprox() = %d, ItemCount() = %d, want 1 and 201", got, count)
+	}
+
+	// Items brought in by Union count toward ItemCount only.
+	other := newTestFilter(t, roomy)
+	addAll(t, other, testKeys("other", 50))
+	if err := decoded.filters[0].Union(other.filters[0]); err != nil {
+		t.Fatal(err)
+	}
+	if got, count := decoded.DistinctAddedApprox(), decoded.ItemCount(); got != 1 || count <= 201 {
+		t.Errorf("after Union: DistinctAddedApprox() = %d, ItemCount() = %d, want 1 and more than 201", got, count)
+	}
+}
+
+func TestOptimalConfig(t *testing.T) {
+	for _, tc := range []struct {
+		items    int
+		targetFP float64
+	}{{1, 0.5}, {1000, 0.01}, {5000000, 0.001}, {0, 0.01}, {-5, 0.01}} {
+		config := OptimalConfig(tc.items, tc.targetFP)
+		if _, err := NewScalableBloomFilter(config); err != nil {
+			t.Errorf("OptimalConfig(%d, %g) = %+v, rejected: %v", tc.items, tc.targetFP, config, err)
+			continue
+		}
+		if want := max(tc.items, 1); config.InitialCapacity != want {
+			t.Errorf("OptimalConfig(%d, %g) sized the first stage for %d items, want %d", tc.items, tc.targetFP, config.InitialCapacity, want)
+		}
+		// The rates of however many stages are added sum to at most the target.
+		if sum := config.InitialFP / (1 - config.TighteningRatio); sum > tc.targetFP*(1+1e-12) {
+			t.Errorf("OptimalConfig(%d, %g): stage rates sum to %g", tc.items, tc.targetFP, sum)
+		}
+	}
+
+	// A filter with the recommended Config holds the expected items in one stage.
+	sbf := newTestFilter(t, OptimalConfig(2000, 0.01))
+	addAll(t, sbf, testKeys("item", 2000))
+	if len(sbf.filters) != 1 {
+		t.Errorf("%d expected items took %d sub-filters, want 1", 2000, len(sbf.filters))
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrNotFound is returned by Manager.Get for a name that has no filter.
+var ErrNotFound = errors.New("filter not found")
+
+// managerFileExt is the extension of the files a persistent Manager keeps its filters in.
+const managerFileExt = ".bloom"
+
+// validManagedName matches the names a persistent Manager accepts. Names must start with a
+// letter or digit, which rules out "." and "..", and cannot contain path separators.
+var validManagedName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Manager is a registry of named Scalable Bloom Filters, such as one per tenant or topic.
+// It is safe for concurrent use. Creation is single-flight per name: concurrent callers
+// asking for the same new name wait for one of them to build it and share the result.
+//
+// A Manager bound to a directory persists each filter as <dir>/<name>.bloom when Flush or
+// Close is called, and loads it lazily on the first Get or GetOrCreate for its name.
+// See ManagerOptions for unloading idle filters.
+type Manager struct {
+	dir     string
+	opts    []Option
+	mopts   ManagerOptions
+	clock   Clock
+	filters map[string]*managedFilter
+	stop    chan struct{} // Closed by Close to halt the sweeper
+	swept   chan struct{} // Closed when the sweeper has exited
+	closing sync.Once
+	closed  bool // Set by Close; guarded by mutex
+	mutex   sync.Mutex
+}
+
+// managedFilter is a Manager entry. ready is closed once the filter has been built or
+// loaded, after which sbf and err are immutable. refs and lastUsed drive eviction.
+type managedFilter struct {
+	ready    chan struct{}
+	sbf      *ScalableBloomFilter
+	err      error
+	refs     int          // Outstanding Acquire calls; guarded by the Manager's mutex
+	lastUsed atomic.Int64 // Unix nanoseconds of the last access, see touch
+}
+
+// NewManager creates a Manager that never unloads filters. If dir is empty the filters live
+// only in memory; otherwise dir is created if needed and used for persistence. The options
+// are applied to every filter the Manager creates or loads.
+func NewManager(dir string, opts ...Option) (*Manager, error) {
+	return NewManagerWithOptions(dir, ManagerOptions{}, opts...)
+}
+
+// NewManagerWithOptions creates a Manager like NewManager, with the eviction behavior
+// described by mopts. If mopts.MaxIdle is set, a background sweeper runs until Close.
+func NewManagerWithOptions(dir string, mopts ManagerOptions, opts ...Option) (*Manager, error) {
+	if mopts.MaxIdle < 0 || mopts.MaxFilters < 0 {
+		return nil, errors.New("MaxIdle and MaxFilters must not be negative")
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	m := &Manager{
+		dir:     dir,
+		opts:    opts,
+		mopts:   mopts,
+		clock:   buildOptions(opts).clock,
+		filters: make(map[string]*managedFilter),
+		stop:    make(chan struct{}),
+		swept:   make(chan struct{}),
+	}
+	if mopts.MaxIdle > 0 {
+		go m.sweeper()
+	} else {
+		close(m.swept)
+	}
+	return m, nil
+}
+
+// GetOrCreate returns the filter with the given name, loading it from disk or creating it
+// with config if it does not exist yet. An existing filter keeps its own configuration.
+func (m *Manager) GetOrCreate(name string, config Config) (*ScalableBloomFilter, error) {
+	entry, err := m.get(name, func() (*ScalableBloomFilter, error) {
+		return NewScalableBloomFilter(config, m.opts...)
+	}, false)
+	if err != nil {
+		return nil, err
+	}
+	return entry.sbf, nil
+}
+
+// Get returns the filter with the given name, loading it from disk if needed.
+// It returns ErrNotFound if there is no such filter.
+func (m *Manager) Get(name string) (*ScalableBloomFilter, error) {
+	entry, err := m.get(name, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	return entry.sbf, nil
+}
+
+// Acquire returns the filter with the given name like GetOrCreate, and pins it so it is
+// not evicted until release is called. Callers that keep using a filter across the
+// eviction window should use Acquire instead of Get. release must be called exactly once.
+func (m *Manager) Acquire(name string, config Config) (sbf *ScalableBloomFilter, release func(), err error) {
+	entry, err := m.get(name, func() (*ScalableBloomFilter, error) {
+		return NewScalableBloomFilter(config, m.opts...)
+	}, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entry.sbf, func() {
+		m.mutex.Lock()
+		entry.refs--
+		m.mutex.Unlock()
+		m.touch(entry)
+	}, nil
+}
+
+// get returns the named entry, building its filter with create if it is neither loaded
+// nor persisted. A nil create makes a missing filter an ErrNotFound. If pin is set, the
+// entry's reference count is incremented.
+func (m *Manager) get(name string, create func() (*ScalableBloomFilter, error), pin bool) (*managedFilter, error) {
+	if err := m.validateName(name); err != nil {
+		return nil, err
+	}
+
+	for {
+		m.mutex.Lock()
+		if m.closed {
+			m.mutex.Unlock()
+			return nil, ErrClosed
+		}
+		entry, ok := m.filters[name]
+		if !ok {
+			break // Still holding the lock.
+		}
+		m.mutex.Unlock()
+
+		<-entry.ready
+		if entry.err == errEvicting {
+			// The filter has been persisted and unloaded; load it again.
+			continue
+		}
+		if entry.err != nil {
+			return nil, entry.err
+		}
+		if pin {
+			m.mutex.Lock()
+			evicted := m.filters[name] != entry
+			if !evicted {
+				entry.refs++
+			}
+			m.mutex.Unlock()
+			if evicted {
+				continue
+			}
+		}
+		m.touch(entry)
+		return entry, nil
+	}
+
+	if m.mopts.EvictPolicy == EvictReject && m.mopts.MaxFilters > 0 && len(m.filters) >= m.mopts.MaxFilters {
+		m.mutex.Unlock()
+		return nil, ErrTooManyFilters
+	}
+	entry := &managedFilter{ready: make(chan struct{})}
+	if pin {
+		entry.refs++
+	}
+	m.filters[name] = entry
+	m.mutex.Unlock()
+
+	entry.sbf, entry.err = m.open(name, create)
+	if entry.err != nil {
+		// Forget the failure so a later call can retry.
+		m.mutex.Lock()
+		if m.filters[name] == entry {
+			delete(m.filters, name)
+		}
+		m.mutex.Unlock()
+	}
+	m.touch(entry)
+	close(entry.ready)
+	if entry.err != nil {
+		return nil, entry.err
+	}
+	m.evictOverLimit(entry)
+	return entry, nil
+}
+
+// open loads the named filter from disk or, failing that, builds it with create.
+func (m *Manager) open(name string, create func() (*ScalableBloomFilter, error)) (*ScalableBloomFilter, error) {
+	if m.dir != "" {
+		sbf, err := loadScalableFile(m.path(name), m.opts)
+		if err == nil || !errors.Is(err, fs.ErrNotExist) {
+			return sbf, err
+		}
+	}
+	if create == nil {
+		return nil, ErrNotFound
+	}
+	return create()
+}
+
+// Delete closes the named filter and removes it from the Manager and from disk.
+// Deleting a name that does not exist is not an error.
+func (m *Manager) Delete(name string) error {
+	if err := m.validateName(name); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	entry, ok := m.filters[name]
+	m.mutex.Unlock()
+	if ok {
+		<-entry.ready
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+	if ok && m.filters[name] == entry {
+		delete(m.filters, name)
+	}
+	// Remove the file while holding the lock, so a concurrent Get cannot reload it.
+	if m.dir != "" {
+		if err := os.Remove(m.path(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	if ok && entry.sbf != nil {
+		return entry.sbf.Close()
+	}
+	return nil
+}
+
+// Names returns the sorted names of all filters, both loaded and persisted.
+func (m *Manager) Names() ([]string, error) {
+	seen := make(map[string]bool)
+	if m.dir != "" {
+		entries, err := os.ReadDir(m.dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			name, ok := strings.CutSuffix(e.Name(), managerFileExt)
+			if ok && !e.IsDir() && validManagedName.MatchString(name) {
+				seen[name] = true
+			}
+		}
+	}
+	for name, entry := range m.loaded() {
+		if entry.err == nil {
+			seen[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// StatsAll returns a Stats snapshot of every loaded filter, keyed by name. Persisted
+// filters that have not been loaded yet are not included.
+func (m *Manager) StatsAll() map[string]Stats {
+	stats := make(map[string]Stats)
+	for name, entry := range m.loaded() {
+		if entry.sbf != nil {
+			stats[name] = entry.sbf.Stats()
+		}
+	}
+	return stats
+}
+
+// Flush persists every loaded filter to the Manager's directory. It is a no-op for an
+// in-memory Manager.
+func (m *Manager) Flush() error {
+	if m.dir == "" {
+		return nil
+	}
+	var errs []error
+	for name, entry := range m.loaded() {
+		if entry.sbf != nil {
+			errs = append(errs, entry.sbf.saveFile(m.path(name)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops the sweeper, then persists and closes every loaded filter, waiting for
+// those still loading. Afterwards Get, GetOrCreate, Acquire and Delete return ErrClosed;
+// the persisted files remain for a new Manager to load. Calling Close more than once is
+// safe; later calls return nil.
+func (m *Manager) Close() error {
+	m.closing.Do(func() { close(m.stop) })
+	<-m.swept
+
+	m.mutex.Lock()
+	if m.closed {
+		m.mutex.Unlock()
+		return nil
+	}
+	m.closed = true
+	filters := m.filters
+	m.filters = make(map[string]*managedFilter)
+	m.mutex.Unlock()
+
+	var errs []error
+	for name, entry := range filters {
+		<-entry.ready
+		if entry.sbf == nil {
+			continue
+		}
+		if m.dir != "" {
+			errs = append(errs, entry.sbf.saveFile(m.path(name)))
+		}
+		errs = append(errs, entry.sbf.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// loaded returns the entries whose filters have finished loading, without waiting for
+// those still in progress.
+func (m *Manager) loaded() map[string]*managedFilter {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	loaded := make(map[string]*managedFilter, len(m.filters))
+	for name, entry := range m.filters {
+		select {
+		case <-entry.ready:
+			loaded[name] = entry
+		default:
+		}
+	}
+	return loaded
+}
+
+// validateName rejects names that could escape the Manager's directory. Any name is
+// accepted by an in-memory Manager.
+func (m *Manager) validateName(name string) error {
+	if m.dir != "" && !validManagedName.MatchString(name) {
+		return fmt.Errorf("invalid filter name %q", name)
+	}
+	return nil
+}
+
+// path returns the file a persisted filter is stored in.
+func (m *Manager) path(name string) string {
+	return filepath.Join(m.dir, name+managerFileExt)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestManagerGetOrCreateRace(t *testing.T) {
+	// The Manager resolves its options once; every filter it builds resolves them again.
+	var builds atomic.Int32
+	counting := func(*options) { builds.Add(1) }
+	m, err := NewManager("", counting)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	defer m.Close()
+
+	const callers = 32
+	results := make([]*ScalableBloomFilter, callers)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := "tenant-a"
+			if i%2 == 1 {
+				name = "tenant-b"
+			}
+			sbf, err := m.GetOrCreate(name, testConfig)
+			if err != nil {
+				t.Errorf("GetOrCreate(%s): %v", name, err)
+			}
+			results[i] = sbf
+		}(i)
+	}
+	wg.Wait()
+
+	if got := builds.Load() - 1; got != 2 {
+		t.Errorf("built %d filters for 2 names, want each built once", got)
+	}
+	for i, sbf := range results {
+		if sbf != results[i%2] {
+			t.Fatalf("caller %d got a different filter than caller %d for the same name", i, i%2)
+		}
+	}
+	if results[0] == results[1] {
+		t.Error("two names share a filter")
+	}
+
+	names, err := m.Names()
+	if err != nil || !slices.Equal(names, []string{"tenant-a", "tenant-b"}) {
+		t.Errorf("Names() = %v, %v, want [tenant-a tenant-b]", names, err)
+	}
+	if stats := m.StatsAll(); len(stats) != 2 {
+		t.Errorf("StatsAll() has %d entries, want 2", len(stats))
+	}
+}
+
+func TestManagerLazyLoad(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManager(dir)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	sbf, err := m.GetOrCreate("orders", testConfig)
+	if err != nil {
+		t.Fatalf("GetOrCreate: %v", err)
+	}
+	addAll(t, sbf, testKeys("order", 50))
+	if err := m.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "orders.bloom")); err != nil {
+		t.Fatalf("Flush did not write the filter's file: %v", err)
+	}
+
+	// A new Manager lists the persisted filter but loads it only when asked for.
+	reopened, err := NewManager(dir)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	defer reopened.Close()
+	if names, err := reopened.Names(); err != nil || !slices.Equal(names, []string{"orders"}) {
+		t.Fatalf("Names() = %v, %v, want [orders]", names, err)
+	}
+	if stats := reopened.StatsAll(); len(stats) != 0 {
+		t.Fatalf("StatsAll() before any Get has %d entries, want none loaded", len(stats))
+	}
+	loaded, err := reopened.Get("orders")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !loaded.AllMightContain(testKeys("order", 50)) {
+		t.Error("lazily loaded filter lacks persisted items")
+	}
+	if _, err := reopened.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(missing) = %v, want ErrNotFound", err)
+	}
+
+	if err := reopened.Delete("orders"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "orders.bloom")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file after Delete: %v, want it removed", err)
+	}
+	if _, err := reopened.Get("orders"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete = %v, want ErrNotFound", err)
+	}
+}
+
+func TestManagerNameValidation(t *testing.T) {
+	persistent, err := NewManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	defer persistent.Close()
+	for _, name := range []string{"", ".", "..", "../escape", "a/b", `a\b`, ".hidden", "-flag"} {
+		if _, err := persistent.GetOrCreate(name, testConfig); err == nil {
+			t.Errorf("GetOrCreate(%q) succeeded on a persistent Manager", name)
+		}
+	}
+	for _, name := range []string{"tenant-1", "topic.v2", "A_b"} {
+		if _, err := persistent.GetOrCreate(name, testConfig); err != nil {
+			t.Errorf("GetOrCreate(%q): %v", name, err)
+		}
+	}
+
+	inMemory, err := NewManager("")
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	defer inMemory.Close()
+	if _, err := inMemory.GetOrCreate("../anything goes", testConfig); err != nil {
+		t.Errorf("GetOrCreate on an in-memory Manager: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// MergeReport describes the result of MergeFiles.
+type MergeReport struct {
+	SourceSetBits []uint64 // Set bits in each source, in the order of the source paths
+	SetBits       uint64   // Set bits in the merged filter
+	FillRatio     float64  // Fraction of the merged filter's bits that are set
+}
+
+// MergeFiles writes the union of the serialized filters at srcPaths to dstPath, for
+// combining shard filters from a distributed build. Like MergeSerialized, it validates
+// every header before writing and streams the bitsets one chunk per source at a time,
+// so memory use does not depend on the filter size. The destination is written
+// atomically and is left untouched if any source is incompatible or unreadable.
+// dstPath may be one of the sources.
+func MergeFiles(dstPath string, srcPaths []string) (MergeReport, error) {
+	var report MergeReport
+	readers := make([]io.Reader, len(srcPaths))
+	for i, path := range srcPaths {
+		file, err := os.Open(path)
+		if err != nil {
+			return report, err
+		}
+		defer file.Close()
+		readers[i] = file
+	}
+
+	buffered, headers, err := readMergeHeaders(readers)
+	if err != nil {
+		return report, err
+	}
+	report.SourceSetBits = make([]uint64, len(srcPaths))
+	err = writeFileAtomic(dstPath, func(w io.Writer) error {
+		var err error
+		report.SetBits, err = mergeBitsets(w, buffered, headers, report.SourceSetBits)
+		return err
+	})
+	if err != nil {
+		return MergeReport{}, err
+	}
+	report.FillRatio = float64(report.SetBits) / float64(headers[0].bitSize)
+	return report, nil
+}
+
+// MergeRebuild adds to target every candidate that any of sources reports as possibly
+// present. Unlike Union it works across filters with different bit sizes, numbers of hash
+// functions or hashers, at the cost of RebuildFrom's limitation: only the candidate
+// universe is considered, so items of the sources outside it are lost, and candidates that
+// are false positives of any source are carried over.
+func MergeRebuild(target *BloomFilter, candidates []string, sources ...*BloomFilter) {
+	for _, item := range candidates {
+		for _, source := range sources {
+			if source.MightContain(item) {
+				target.Add(item)
+				break
+			}
+		}
+	}
+}
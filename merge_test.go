@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeShards writes n serialized filters of capacity items, each holding 500 keys of its
+// own, to dir and returns their paths with the in-memory union of them all.
+func writeShards(t *testing.T, dir string, n, capacity int) ([]string, *BloomFilter) {
+	t.Helper()
+	union := NewBloomFilter(capacity, 0.01)
+	var paths []string
+	for i := 0; i < n; i++ {
+		bf := NewBloomFilter(capacity, 0.01)
+		for _, key := range testKeys(fmt.Sprintf("shard%d", i), 500) {
+			bf.Add(key)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("shard-%d.bf", i))
+		if err := os.WriteFile(path, marshal(t, bf), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+		union.Union(bf)
+	}
+	return paths, union
+}
+
+func TestMergeFiles(t *testing.T) {
+	dir := t.TempDir()
+	// Large enough that the bitsets span several merge chunks.
+	srcs, want := writeShards(t, dir, 4, 100000)
+	dst := filepath.Join(dir, "merged.bf")
+
+	report, err := MergeFiles(dst, srcs)
+	if err != nil {
+		t.Fatalf("MergeFiles: %v", err)
+	}
+	data, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, err := ReadBloomFilter(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("reading the merged file: %v", err)
+	}
+	if !bytes.Equal(merged.usedBytes(), want.usedBytes()) {
+		t.Error("merged bitset differs from the in-memory union")
+	}
+
+	if len(report.SourceSetBits) != len(srcs) {
+		t.Fatalf("report has %d source counts, want %d", len(report.SourceSetBits), len(srcs))
+	}
+	for i, path := range srcs {
+		data, _ := os.ReadFile(path)
+		src, _ := ReadBloomFilter(bytes.NewReader(data))
+		if got, want := report.SourceSetBits[i], uint64(popCount(src.usedBytes())); got != want {
+			t.Errorf("source %d: %d set bits reported, want %d", i, got, want)
+		}
+	}
+	if got := uint64(popCount(want.usedBytes())); report.SetBits != got {
+		t.Errorf("report.SetBits = %d, want %d", report.SetBits, got)
+	}
+	if got := want.FillRatio(); math.Abs(report.FillRatio-got) > 1e-9 {
+		t.Errorf("report.FillRatio = %g, want %g", report.FillRatio, got)
+	}
+
+	// The destination may be one of the sources.
+	if _, err := MergeFiles(srcs[0], srcs); err != nil {
+		t.Fatalf("MergeFiles into a source: %v", err)
+	}
+	inPlace, _ := os.ReadFile(srcs[0])
+	if !bytes.Equal(inPlace, data) {
+		t.Error("merging into a source wrote a different result")
+	}
+}
+
+func TestMergeFilesIncompatible(t *testing.T) {
+	dir := t.TempDir()
+	srcs, _ := writeShards(t, dir, 2, 1000)
+	odd := filepath.Join(dir, "odd.bf")
+	if err := os.WriteFile(odd, marshal(t, NewBloomFilter(2000, 0.01)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, "merged.bf")
+	if err := os.WriteFile(dst, []byte("previous"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, paths := range map[string][]string{
+		"bit size": append(srcs, odd),
+		"missing":  append(srcs, filepath.Join(dir, "missing.bf")),
+	} {
+		if _, err := MergeFiles(dst, paths); err == nil {
+			t.Errorf("%s: MergeFiles succeeded", name)
+		}
+		if data, _ := os.ReadFile(dst); string(data) != "previous" {
+			t.Errorf("%s: destination changed to %d bytes although the merge was refused", name, len(data))
+		}
+	}
+}
+
+func TestMergeRebuild(t *testing.T) {
+	// Different sizes, numbers of hash functions and hashers: Union refuses all of them.
+	a := NewBloomFilter(500, 0.1)
+	b := NewBloomFilter(2000, 0.001, WithHasher(FNVHasher))
+	if _, _, _, ka := a.Params(); ka == b.numHashFuncs {
+		t.Fatalf("both sources use %d hash functions, want them to differ", ka)
+	}
+	if err := a.Union(b); err == nil {
+		t.Fatal("Union of differently sized filters succeeded")
+	}
+	aKeys, bKeys := testKeys("a", 300), testKeys("b", 300)
+	for _, key := range aKeys {
+		a.Add(key)
+	}
+	for _, key := range bKeys {
+		b.Add(key)
+	}
+	absent := testKeys("absent", 2000)
+	candidates := slices.Concat(aKeys, bKeys, absent)
+
+	target := NewBloomFilter(5000, 0.001)
+	MergeRebuild(target, candidates, a, b)
+	for _, key := range slices.Concat(aKeys, bKeys) {
+		if !target.MightContain(key) {
+			t.Fatalf("merged filter misses %q", key)
+		}
+	}
+
+	// The absent candidates get in only as false positives of a source.
+	var carried uint
+	for _, key := range absent {
+		if a.MightContain(key) || b.MightContain(key) {
+			carried++
+		}
+	}
+	if got, want := target.ItemCount(), uint(len(aKeys)+len(bKeys))+carried; got != want {
+		t.Errorf("merged filter counts %d items, want %d", got, want)
+	}
+
+	empty := NewBloomFilter(100, 0.01)
+	MergeRebuild(empty, candidates)
+	if empty.ItemCount() != 0 {
+		t.Errorf("MergeRebuild without sources added %d items", empty.ItemCount())
+	}
+}
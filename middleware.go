@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// DedupMiddleware returns HTTP middleware that rejects replayed requests, such as repeated
+// webhook deliveries, without a database round-trip. keyFn extracts the deduplication key;
+// returning false bypasses deduplication for that request. Requests whose key might already
+// be in f are routed to onDuplicate, which defaults to a 409 Conflict response when nil.
+//
+// The middleware itself never reads the request body. Key functions that need it, such as
+// BodyDigestKey, must restore it for downstream handlers. Requests whose body is larger than
+// such a key function allows are answered with 413 Request Entity Too Large.
+func DedupMiddleware(f Filter, keyFn func(*http.Request) (string, bool), onDuplicate http.Handler) func(http.Handler) http.Handler {
+	if onDuplicate == nil {
+		onDuplicate = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "duplicate request", http.StatusConflict)
+		})
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := keyFn(r)
+			if _, tooLarge := r.Body.(oversizedBody); tooLarge {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			present, err := f.TestAndAdd(key)
+			if err != nil {
+				http.Error(w, "deduplication unavailable", http.StatusInternalServerError)
+				return
+			}
+			if present {
+				onDuplicate.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HeaderKey returns a key function that uses the value of the named header.
+// Requests without the header bypass deduplication.
+func HeaderKey(name string) func(*http.Request) (string, bool) {
+	return func(r *http.Request) (string, bool) {
+		value := r.Header.Get(name)
+		return value, value != ""
+	}
+}
+
+// QueryKey returns a key function that uses the value of the named query parameter.
+// Requests without the parameter bypass deduplication.
+func QueryKey(param string) func(*http.Request) (string, bool) {
+	return func(r *http.Request) (string, bool) {
+		value := r.URL.Query().Get(param)
+		return value, value != ""
+	}
+}
+
+// DefaultMaxDigestBody is the largest request body, in bytes, that BodyDigestKey reads.
+const DefaultMaxDigestBody = 1 << 20
+
+// BodyDigestKey is a key function that uses the SHA-256 digest of the request body, which
+// may be at most DefaultMaxDigestBody bytes. See LimitedBodyDigestKey.
+func BodyDigestKey(r *http.Request) (string, bool) {
+	return bodyDigestKey(r, DefaultMaxDigestBody)
+}
+
+// LimitedBodyDigestKey returns a key function that uses the SHA-256 digest of the request
+// body. The body is read fully and then restored so downstream handlers can read it again.
+// Requests without a body, or whose body cannot be read, bypass deduplication. A body larger
+// than limit bytes is not buffered: DedupMiddleware answers the request with 413, and for
+// other callers reading the body again returns an *http.MaxBytesError.
+func LimitedBodyDigestKey(limit int64) func(*http.Request) (string, bool) {
+	return func(r *http.Request) (string, bool) {
+		return bodyDigestKey(r, limit)
+	}
+}
+
+func bodyDigestKey(r *http.Request, limit int64) (string, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return "", false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, limit))
+	r.Body.Close()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		r.Body = oversizedBody{tooLarge}
+		return "", false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return "", false
+	}
+	digest := sha256.Sum256(body)
+	return hex.EncodeToString(digest[:]), true
+}
+
+// oversizedBody replaces a request body that exceeded a digest key's limit.
+type oversizedBody struct {
+	err *http.MaxBytesError
+}
+
+func (b oversizedBody) Read([]byte) (int, error) { return 0, b.err }
+func (b oversizedBody) Close() error             { return nil }
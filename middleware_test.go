@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// echoHandler answers 200 with the request body, so tests can see what reached it.
+var echoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Write(body)
+})
+
+// serve sends a POST with body, and the given delivery ID header unless it is empty,
+// through h and returns the recorded response.
+func serve(h http.Handler, id, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(body))
+	if id != "" {
+		r.Header.Set("X-Delivery-ID", id)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestDedupMiddlewareHeader(t *testing.T) {
+	h := DedupMiddleware(NewExactSet(), HeaderKey("X-Delivery-ID"), nil)(echoHandler)
+
+	for _, tc := range []struct {
+		name, id string
+		want     int
+	}{
+		{"unique", "1", http.StatusOK},
+		{"another unique", "2", http.StatusOK},
+		{"duplicate", "1", http.StatusConflict},
+		{"bypass", "", http.StatusOK},
+		{"bypass again", "", http.StatusOK},
+	} {
+		if got := serve(h, tc.id, "payload").Code; got != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDedupMiddlewareOnDuplicate(t *testing.T) {
+	onDuplicate := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted) // Acknowledge replays so the sender stops retrying
+	})
+	h := DedupMiddleware(NewExactSet(), QueryKey("id"), onDuplicate)(echoHandler)
+
+	for i, want := range []int{http.StatusOK, http.StatusAccepted} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/hook?id=7", nil))
+		if w.Code != want {
+			t.Errorf("request %d: status %d, want %d", i, w.Code, want)
+		}
+	}
+}
+
+func TestDedupMiddlewareBodyDigest(t *testing.T) {
+	h := DedupMiddleware(newTestFilter(t, testConfig), BodyDigestKey, nil)(echoHandler)
+
+	w := serve(h, "", "first")
+	if w.Code != http.StatusOK || w.Body.String() != "first" {
+		t.Fatalf("unique body: %d %q, want 200 and the body restored for the handler", w.Code, w.Body)
+	}
+	if got := serve(h, "", "second").Code; got != http.StatusOK {
+		t.Errorf("another body: status %d, want 200", got)
+	}
+	if got := serve(h, "", "first").Code; got != http.StatusConflict {
+		t.Errorf("replayed body: status %d, want 409", got)
+	}
+	if got := serve(h, "", "").Code; got != http.StatusOK {
+		t.Errorf("empty body: status %d, want 200", got)
+	}
+}
+
+func TestDedupMiddlewareBodyTooLarge(t *testing.T) {
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+	h := DedupMiddleware(NewExactSet(), LimitedBodyDigestKey(8), nil)(next)
+
+	if got := serve(h, "", "12345678").Code; got != http.StatusOK {
+		t.Errorf("body at the limit: status %d, want 200", got)
+	}
+	called = false
+	if got := serve(h, "", "123456789").Code; got != http.StatusRequestEntityTooLarge {
+		t.Errorf("body over the limit: status %d, want 413", got)
+	}
+	if called {
+		t.Error("handler called for a body over the limit")
+	}
+}
+
+func TestLimitedBodyDigestKeyOversized(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("too long"))
+	if _, ok := LimitedBodyDigestKey(3)(r); ok {
+		t.Fatal("key function accepted a body over its limit")
+	}
+	_, err := io.ReadAll(r.Body)
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) || tooLarge.Limit != 3 {
+		t.Errorf("reading the body afterwards: %v, want an *http.MaxBytesError with limit 3", err)
+	}
+}
+
+// failingFilter is a Filter whose TestAndAdd always fails.
+type failingFilter struct{}
+
+func (failingFilter) MightContain(string) bool { return false }
+
+func (failingFilter) TestAndAdd(string) (bool, error) { return false, ErrReadOnly }
+
+func TestDedupMiddlewareFilterError(t *testing.T) {
+	h := DedupMiddleware(failingFilter{}, HeaderKey("X-Delivery-ID"), nil)(echoHandler)
+	if got := serve(h, "1", "").Code; got != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500 when the filter fails", got)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ReadMode selects which filter a MigratingFilter consults on reads.
+type ReadMode int32
+
+const (
+	// ReadOldOnly answers reads from the old filter only.
+	ReadOldOnly ReadMode = iota
+	// ReadEither reports an item present if either filter does.
+	ReadEither
+	// ReadNewOnly answers reads from the new filter only.
+	ReadNewOnly
+)
+
+// MigratingFilter dual-writes to an old and a new filter during a parameter migration,
+// such as a change of false positive rate or hasher, so the new filter can be backfilled
+// and cut over to without a stop-the-world rebuild. It is safe for concurrent use if
+// both underlying filters are.
+type MigratingFilter struct {
+	old      Filter
+	new      Filter
+	readMode atomic.Int32
+	promoted atomic.Bool
+}
+
+// NewMigratingFilter creates a MigratingFilter writing to both filters and reading per readMode.
+func NewMigratingFilter(old, new Filter, readMode ReadMode) *MigratingFilter {
+	mf := &MigratingFilter{old: old, new: new}
+	mf.readMode.Store(int32(readMode))
+	return mf
+}
+
+// Add inserts the item into both filters, or only the new one once promoted.
+// Errors from both filters are joined.
+func (mf *MigratingFilter) Add(item string) error {
+	_, err := mf.TestAndAdd(item)
+	return err
+}
+
+// TestAndAdd reports whether the item might already be present according to the read mode
+// and inserts it into both filters, or only the new one once promoted.
+func (mf *MigratingFilter) TestAndAdd(item string) (bool, error) {
+	newPresent, newErr := mf.new.TestAndAdd(item)
+	if mf.promoted.Load() {
+		return newPresent, newErr
+	}
+	oldPresent, oldErr := mf.old.TestAndAdd(item)
+
+	var present bool
+	switch ReadMode(mf.readMode.Load()) {
+	case ReadOldOnly:
+		present = oldPresent
+	case ReadEither:
+		present = oldPresent || newPresent
+	default:
+		present = newPresent
+	}
+	return present, errors.Join(oldErr, newErr)
+}
+
+// MightContain checks the item against the filter(s) selected by the read mode.
+func (mf *MigratingFilter) MightContain(item string) bool {
+	if mf.promoted.Load() {
+		return mf.new.MightContain(item)
+	}
+	switch ReadMode(mf.readMode.Load()) {
+	case ReadOldOnly:
+		return mf.old.MightContain(item)
+	case ReadEither:
+		return mf.old.MightContain(item) || mf.new.MightContain(item)
+	default:
+		return mf.new.MightContain(item)
+	}
+}
+
+// SetReadMode changes which filter(s) reads consult. It has no effect once promoted.
+func (mf *MigratingFilter) SetReadMode(mode ReadMode) {
+	if !mf.promoted.Load() {
+		mf.readMode.Store(int32(mode))
+	}
+}
+
+// Promote atomically switches to the new filter for both reads and writes.
+// It is irreversible; the old filter is no longer touched afterwards.
+func (mf *MigratingFilter) Promote() {
+	mf.promoted.Store(true)
+	mf.readMode.Store(int32(ReadNewOnly))
+}
+
+// Promoted reports whether Promote has been called.
+func (mf *MigratingFilter) Promoted() bool {
+	return mf.promoted.Load()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// migrationPair returns an old and a new set each holding one item the other lacks.
+func migrationPair() (old, new *ExactSet) {
+	old, new = NewExactSet(), NewExactSet()
+	old.TestAndAdd("old-only")
+	new.TestAndAdd("new-only")
+	return old, new
+}
+
+func TestMigratingFilterReadModes(t *testing.T) {
+	for _, tc := range []struct {
+		mode             ReadMode
+		oldOnly, newOnly bool
+	}{
+		{ReadOldOnly, true, false},
+		{ReadEither, true, true},
+		{ReadNewOnly, false, true},
+	} {
+		old, new := migrationPair()
+		mf := NewMigratingFilter(old, new, tc.mode)
+		if got := mf.MightContain("old-only"); got != tc.oldOnly {
+			t.Errorf("mode %d: MightContain(old-only) = %v, want %v", tc.mode, got, tc.oldOnly)
+		}
+		if got := mf.MightContain("new-only"); got != tc.newOnly {
+			t.Errorf("mode %d: MightContain(new-only) = %v, want %v", tc.mode, got, tc.newOnly)
+		}
+		// TestAndAdd answers by the same mode, and writes go to both filters.
+		if present, err := mf.TestAndAdd("new-only"); present != tc.newOnly || err != nil {
+			t.Errorf("mode %d: TestAndAdd(new-only) = %v, %v, want %v, nil", tc.mode, present, err, tc.newOnly)
+		}
+		if err := mf.Add("both"); err != nil {
+			t.Fatalf("mode %d: Add: %v", tc.mode, err)
+		}
+		if !old.MightContain("both") || !new.MightContain("both") || !old.MightContain("new-only") {
+			t.Errorf("mode %d: a write did not reach both filters", tc.mode)
+		}
+	}
+}
+
+func TestMigratingFilterSetReadMode(t *testing.T) {
+	old, new := migrationPair()
+	mf := NewMigratingFilter(old, new, ReadOldOnly)
+	mf.SetReadMode(ReadNewOnly)
+	if mf.MightContain("old-only") || !mf.MightContain("new-only") {
+		t.Error("SetReadMode(ReadNewOnly) did not switch reads to the new filter")
+	}
+	mf.Promote()
+	mf.SetReadMode(ReadOldOnly)
+	if mf.MightContain("old-only") {
+		t.Error("SetReadMode changed reads after Promote")
+	}
+}
+
+func TestMigratingFilterErrors(t *testing.T) {
+	mf := NewMigratingFilter(failingFilter{}, NewExactSet(), ReadEither)
+	if err := mf.Add("x"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Add = %v, want the old filter's error", err)
+	}
+	if !mf.new.MightContain("x") {
+		t.Error("an error from the old filter kept the item out of the new one")
+	}
+	mf.Promote()
+	if err := mf.Add("y"); err != nil {
+		t.Errorf("Add after Promote = %v, want the old filter left alone", err)
+	}
+}
+
+func TestMigratingFilterPromoteConcurrent(t *testing.T) {
+	old, new := NewExactSet(), NewExactSet()
+	mf := NewMigratingFilter(old, new, ReadOldOnly)
+
+	const writers, perWriter = 4, 500
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for i := 0; i < perWriter; i++ {
+				item := fmt.Sprintf("w%d-%d", w, i)
+				if err := mf.Add(item); err != nil {
+					t.Errorf("Add(%q): %v", item, err)
+					return
+				}
+				// Every write is visible to the next read, before and after the cutover.
+				if !mf.MightContain(item) {
+					t.Errorf("MightContain(%q) = false right after Add", item)
+					return
+				}
+			}
+		}()
+	}
+	close(start)
+	mf.Promote()
+	wg.Wait()
+
+	if !mf.Promoted() {
+		t.Fatal("Promoted() = false after Promote")
+	}
+	// The new filter has seen every write; the old one stopped at the cutover.
+	for w := 0; w < writers; w++ {
+		for i := 0; i < perWriter; i++ {
+			if item := fmt.Sprintf("w%d-%d", w, i); !new.MightContain(item) {
+				t.Fatalf("new filter lacks %q", item)
+			}
+		}
+	}
+	mf.Add("after")
+	if old.MightContain("after") {
+		t.Error("a write after Promote reached the old filter")
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// KeyNormalizer rewrites items before they are hashed, so that keys differing only in
+// incidental ways (casing, surrounding whitespace, Unicode composition) unify.
+// Its name identifies it in serialized filters, so a loaded filter can refuse to run
+// with a different normalizer than the one it was built with.
+type KeyNormalizer struct {
+	name string
+	fn   func(string) string
+}
+
+// NewKeyNormalizer creates a named normalizer from a string function.
+func NewKeyNormalizer(name string, fn func(string) string) KeyNormalizer {
+	return KeyNormalizer{name: name, fn: fn}
+}
+
+// NewKeyNormalizerBytes creates a named normalizer from a byte slice function.
+func NewKeyNormalizerBytes(name string, fn func([]byte) []byte) KeyNormalizer {
+	return KeyNormalizer{name: name, fn: func(s string) string { return string(fn([]byte(s))) }}
+}
+
+// Name returns the normalizer's registered name; the zero KeyNormalizer has an empty name.
+func (n KeyNormalizer) Name() string {
+	return n.name
+}
+
+// Normalize applies the normalizer to item. The zero KeyNormalizer returns item unchanged.
+func (n KeyNormalizer) Normalize(item string) string {
+	if n.fn == nil {
+		return item
+	}
+	return n.fn(item)
+}
+
+// Built-in normalizers.
+var (
+	LowercaseNormalizer = NewKeyNormalizer("lowercase", strings.ToLower)
+	TrimSpaceNormalizer = NewKeyNormalizer("trimspace", strings.TrimSpace)
+	NFCNormalizer       = NewKeyNormalizer("nfc", norm.NFC.String)
+
+	// CaseFoldNormalizer applies Unicode case folding, which unlike lowercasing also
+	// unifies forms such as "ß" and "ss". A Caser is not safe for concurrent use, so each
+	// call makes its own.
+	CaseFoldNormalizer = NewKeyNormalizer("casefold", func(s string) string { return cases.Fold().String(s) })
+)
+
+// ChainNormalizers combines normalizers, applied in order, into one whose name joins
+// theirs with "+", e.g. "lowercase+trimspace".
+func ChainNormalizers(normalizers ...KeyNormalizer) KeyNormalizer {
+	names := make([]string, len(normalizers))
+	for i, n := range normalizers {
+		names[i] = n.name
+	}
+	return KeyNormalizer{
+		name: strings.Join(names, "+"),
+		fn: func(s string) string {
+			for _, n := range normalizers {
+				s = n.Normalize(s)
+			}
+			return s
+		},
+	}
+}
+
+var (
+	normalizers      = map[string]KeyNormalizer{}
+	normalizersMutex sync.RWMutex
+)
+
+func init() {
+	for _, n := range []KeyNormalizer{LowercaseNormalizer, TrimSpaceNormalizer, NFCNormalizer, CaseFoldNormalizer} {
+		RegisterKeyNormalizer(n)
+	}
+}
+
+// RegisterKeyNormalizer makes a normalizer resolvable by name when loading serialized filters.
+// Registering a name twice replaces the earlier normalizer.
+func RegisterKeyNormalizer(n KeyNormalizer) {
+	normalizersMutex.Lock()
+	defer normalizersMutex.Unlock()
+
+	normalizers[n.name] = n
+}
+
+// LookupKeyNormalizer returns the registered normalizer with the given name. Chained names
+// such as "lowercase+trimspace" resolve to the chain of their registered parts, and the
+// empty name resolves to the zero KeyNormalizer.
+func LookupKeyNormalizer(name string) (KeyNormalizer, error) {
+	if name == "" {
+		return KeyNormalizer{}, nil
+	}
+
+	normalizersMutex.RLock()
+	defer normalizersMutex.RUnlock()
+
+	if n, ok := normalizers[name]; ok {
+		return n, nil
+	}
+	parts := strings.Split(name, "+")
+	if len(parts) == 1 {
+		return KeyNormalizer{}, fmt.Errorf("unknown key normalizer %q", name)
+	}
+	chain := make([]KeyNormalizer, len(parts))
+	for i, part := range parts {
+		n, ok := normalizers[part]
+		if !ok {
+			return KeyNormalizer{}, fmt.Errorf("unknown key normalizer %q", part)
+		}
+		chain[i] = n
+	}
+	return ChainNormalizers(chain...), nil
+}
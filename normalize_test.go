@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+// lowerTrim is the lowercase+trimspace chain most tests use.
+var lowerTrim = ChainNormalizers(LowercaseNormalizer, TrimSpaceNormalizer)
+
+func TestKeyNormalizerUnifies(t *testing.T) {
+	sbf := newTestFilter(t, testConfig, WithKeyNormalizer(lowerTrim))
+	if err := sbf.Add("FOO "); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if !sbf.MightContain("foo") {
+		t.Error(`MightContain("foo") = false after Add("FOO ")`)
+	}
+	if present, err := sbf.TestAndAdd("  Foo"); !present || err != nil {
+		t.Errorf(`TestAndAdd("  Foo") = %v, %v, want true, nil`, present, err)
+	}
+
+	if err := sbf.AddBatch([]string{"Bar", " BAZ"}); err != nil {
+		t.Fatalf("AddBatch: %v", err)
+	}
+	ch := make(chan string, 1)
+	ch <- "QUX\t"
+	close(ch)
+	if err := sbf.Consume(context.Background(), ch); err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	for i, present := range sbf.MightContainBatch([]string{"bar", "baz", "qux", "quux"}) {
+		if want := i < 3; present != want {
+			t.Errorf("MightContainBatch result %d = %v, want %v", i, present, want)
+		}
+	}
+
+	bf := NewBloomFilter(100, 0.01, WithKeyNormalizer(lowerTrim))
+	bf.Add("FOO ")
+	if !bf.MightContain("foo") {
+		t.Error(`BloomFilter.MightContain("foo") = false after Add("FOO ")`)
+	}
+}
+
+func TestKeyNormalizerBuiltins(t *testing.T) {
+	for _, tc := range []struct {
+		n        KeyNormalizer
+		in, want string
+	}{
+		{LowercaseNormalizer, "MiXeD", "mixed"},
+		{TrimSpaceNormalizer, " \tpadded\n", "padded"},
+		{NFCNormalizer, "e\u0301", "\u00e9"}, // Decomposed to precomposed
+		{CaseFoldNormalizer, "Straße", "strasse"},
+		{lowerTrim, " FOO ", "foo"},
+		{NewKeyNormalizerBytes("upper", bytes.ToUpper), "abc", "ABC"},
+		{KeyNormalizer{}, " As Is ", " As Is "},
+	} {
+		if got := tc.n.Normalize(tc.in); got != tc.want {
+			t.Errorf("%q.Normalize(%q) = %q, want %q", tc.n.Name(), tc.in, got, tc.want)
+		}
+	}
+	if got := lowerTrim.Name(); got != "lowercase+trimspace" {
+		t.Errorf("chained Name() = %q, want %q", got, "lowercase+trimspace")
+	}
+}
+
+func TestLookupKeyNormalizer(t *testing.T) {
+	n, err := LookupKeyNormalizer("lowercase+trimspace")
+	if err != nil {
+		t.Fatalf("LookupKeyNormalizer of a chain: %v", err)
+	}
+	if got := n.Normalize(" FOO "); got != "foo" {
+		t.Errorf("looked-up chain normalizes %q to %q, want %q", " FOO ", got, "foo")
+	}
+	for _, name := range []string{"nope", "lowercase+nope"} {
+		if _, err := LookupKeyNormalizer(name); err == nil {
+			t.Errorf("LookupKeyNormalizer(%q) succeeded", name)
+		}
+	}
+}
+
+func TestKeyNormalizerSerialized(t *testing.T) {
+	sbf := newTestFilter(t, testConfig, WithKeyNormalizer(lowerTrim))
+	sbf.Add("FOO ")
+	data, err := sbf.GobEncode()
+	if err != nil {
+		t.Fatalf("GobEncode: %v", err)
+	}
+
+	// A filter without a configured normalizer takes the recorded one.
+	var decoded ScalableBloomFilter
+	if err := decoded.GobDecode(data); err != nil {
+		t.Fatalf("GobDecode: %v", err)
+	}
+	if !decoded.MightContain(" foo") {
+		t.Error("decoded filter does not normalize with the recorded normalizer")
+	}
+
+	// One configured with a different normalizer refuses to load it.
+	other := newTestFilter(t, testConfig, WithKeyNormalizer(LowercaseNormalizer))
+	if err := other.GobDecode(data); err == nil {
+		t.Error("GobDecode into a filter with a different normalizer succeeded")
+	}
+
+	bf := NewBloomFilter(100, 0.01, WithKeyNormalizer(lowerTrim))
+	bf.Add("FOO ")
+	bin, err := bf.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	loaded, err := ReadBloomFilter(bytes.NewReader(bin))
+	if err != nil {
+		t.Fatalf("ReadBloomFilter: %v", err)
+	}
+	if got := loaded.normalizer.Name(); got != lowerTrim.Name() {
+		t.Errorf("decoded normalizer = %q, want %q", got, lowerTrim.Name())
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+// BitOrder selects how a bit index maps to a bit within a byte of the bitset.
+// It only matters for interoperability with other implementations reading the raw bytes.
+type BitOrder uint8
+
+const (
+	// LSBFirst stores bit i in byte i/8 at position i%8 counted from the least significant bit.
+	// This is the default.
+	LSBFirst BitOrder = iota
+	// MSBFirst stores bit i in byte i/8 at position i%8 counted from the most significant bit.
+	MSBFirst
+)
+
+// mask returns the mask selecting bit index within its byte under this ordering.
+func (o BitOrder) mask(index uint) uint8 {
+	if o == MSBFirst {
+		return 0x80 >> (index % 8)
+	}
+	return 1 << (index % 8)
+}
+
+// options holds the optional construction parameters shared by the filter constructors.
+type options struct {
+	bitOrder   BitOrder
+	hasher     Hasher
+	normalizer KeyNormalizer
+	clock      Clock
+	logger     Logger
+
+	bitsetAlignment int  // Set by WithBitsetAlignment
+	prefault        bool // Set by WithPrefault
+
+	falsePositiveOverlay bool
+	foldable             bool
+	strict               bool
+	trackSelfCollisions  bool
+}
+
+// Option configures optional behavior of NewBloomFilter and NewScalableBloomFilter.
+type Option func(*options)
+
+// WithBitOrder sets the bit numbering used within each byte of the bitset.
+func WithBitOrder(order BitOrder) Option {
+	return func(o *options) {
+		o.bitOrder = order
+	}
+}
+
+// WithHasher sets the hash function used to derive bit positions. Filters that are
+// compared, merged, or queried together must use the same hasher.
+func WithHasher(h Hasher) Option {
+	return func(o *options) {
+		o.hasher = h
+	}
+}
+
+// WithKeyNormalizer sets a normalizer applied to every string item before hashing, in Add,
+// MightContain, TestAndAdd and everything built on them, such as the batch and stream APIs.
+// Content streamed through AddFromItemReader and the typed key helpers are not normalized.
+func WithKeyNormalizer(n KeyNormalizer) Option {
+	return func(o *options) {
+		o.normalizer = n
+	}
+}
+
+// buildOptions applies opts over the defaults.
+func buildOptions(opts []Option) options {
+	o := options{hasher: MD5Hasher, clock: realClock{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.hasher == nil {
+		o.hasher = MD5Hasher
+	}
+	if o.clock == nil {
+		o.clock = realClock{}
+	}
+	return o
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+// BuildParallel builds a ScalableBloomFilter over items using several workers. The
+// sub-filters a sequential build would fill are allocated up front, subject to MaxFilters
+// as usual, and each takes the next range of items up to its capacity. Workers hash the
+// items, then set the bits of each sub-filter's range in private copies of its bitset,
+// which are ORed into it. The result has the layout of a sequentially built filter and
+// keeps growing from it as items are added. Repeated items are counted once per worker
+// that sees them, so the filter may grow slightly sooner than a sequential build would.
+// Each worker holds a copy of the sub-filter being filled. workers <= 0 uses GOMAXPROCS
+// workers.
+func BuildParallel(items []string, config Config, workers int, opts ...Option) (*ScalableBloomFilter, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	result, err := NewScalableBloomFilter(config, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return result, nil
+	}
+	if _, err := result.PreGrow(len(items)); err != nil {
+		return nil, err
+	}
+
+	// Phase 1: each worker hashes a contiguous range of items.
+	sums := make([][]byte, len(items))
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			start, end := len(items)*w/workers, len(items)*(w+1)/workers
+			for i := start; i < end; i++ {
+				sums[i] = result.digest(items[i])
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// Phase 2: the sub-filters are filled in order, each from the next range of digests.
+	start := 0
+	for _, stage := range result.filters {
+		end := min(start+stage.capacity, len(sums))
+		fillStage(stage, sums[start:end], workers)
+		start = end
+	}
+	return result, nil
+}
+
+// fillStage sets the bits of sums in stage, splitting them among workers that each set
+// them in a private copy of the bitset, and ORs the copies into it. The stage's count is
+// the sum of the workers' counts.
+func fillStage(stage *BloomFilter, sums [][]byte, workers int) {
+	workers = max(min(workers, len(sums)), 1)
+	copies := make([]*BloomFilter, workers)
+	var wg sync.WaitGroup
+	for w := range copies {
+		copies[w] = &BloomFilter{
+			bitset:       make([]uint8, len(stage.bitset)),
+			bitSize:      stage.bitSize,
+			numHashFuncs: stage.numHashFuncs,
+			bitOrder:     stage.bitOrder,
+			hasher:       stage.hasher,
+			normalizer:   stage.normalizer,
+
+			trackSelfCollisions: stage.trackSelfCollisions,
+		}
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for _, sum := range sums[len(sums)*w/workers : len(sums)*(w+1)/workers] {
+				copies[w].addDigest(sum)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for _, c := range copies {
+		for i := range stage.bitset {
+			stage.bitset[i] |= c.bitset[i]
+		}
+		stage.count += c.count
+		stage.distinctAdds.Add(c.distinctAdds.Load())
+		stage.selfCollisions += c.selfCollisions
+	}
+}
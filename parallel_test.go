@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestBuildParallel(t *testing.T) {
+	items := testKeys("item", 50000)
+	config := Config{InitialFP: 0.01, GrowthFactor: 2, TighteningRatio: 0.5, InitialCapacity: 50000}
+	sbf, err := BuildParallel(items, config, 4)
+	if err != nil {
+		t.Fatalf("BuildParallel: %v", err)
+	}
+	for _, item := range items {
+		if !sbf.MightContain(item) {
+			t.Fatalf("MightContain(%q) = false for a built item", item)
+		}
+	}
+
+	// Splitting the target among shards keeps the combined rate near the configured one.
+	positives := 0
+	absent := testKeys("absent", 20000)
+	for _, item := range absent {
+		if sbf.MightContain(item) {
+			positives++
+		}
+	}
+	if rate := float64(positives) / float64(len(absent)); rate > 2*config.InitialFP {
+		t.Errorf("false positive rate %.4f, want at most about %g", rate, config.InitialFP)
+	}
+
+	// The result is an ordinary filter that keeps taking items.
+	addAll(t, sbf, testKeys("later", 100))
+	if !sbf.MightContain("later-99") {
+		t.Error("item added after BuildParallel is missing")
+	}
+}
+
+// TestBuildParallelWorkers covers the GOMAXPROCS default and a worker count that does not
+// divide the items evenly; it is most useful under -race.
+func TestBuildParallelWorkers(t *testing.T) {
+	items := testKeys("item", 5000)
+	for _, workers := range []int{0, 1, 3, 8} {
+		sbf, err := BuildParallel(items, testConfig, workers)
+		if err != nil {
+			t.Fatalf("%d workers: BuildParallel: %v", workers, err)
+		}
+		if !sbf.AllMightContain(items) {
+			t.Errorf("%d workers: an item is missing", workers)
+		}
+	}
+
+	if _, err := BuildParallel(items, Config{}, 4); err == nil {
+		t.Error("BuildParallel with an invalid config succeeded")
+	}
+}
+
+func TestBuildParallelLayout(t *testing.T) {
+	config := Config{InitialFP: 0.01, GrowthFactor: 2, TighteningRatio: 0.5, InitialCapacity: 1000}
+	items := testKeys("item", 1000)
+	sbf, err := BuildParallel(items, config, 64)
+	if err != nil {
+		t.Fatalf("BuildParallel: %v", err)
+	}
+	sequential := newTestFilter(t, config)
+	addAll(t, sequential, items)
+	if !slices.Equal(stageLayout(sbf), stageLayout(sequential)) {
+		t.Fatalf("64 workers built stages %s, a sequential build %s", formatLayout(stageLayout(sbf)), formatLayout(stageLayout(sequential)))
+	}
+
+	// Later adds grow the filter from there like a sequential one.
+	more := testKeys("more", 10000)
+	addAll(t, sbf, more)
+	addAll(t, sequential, more)
+	if len(sbf.filters) != len(sequential.filters) {
+		t.Errorf("after more adds: %d sub-filters, a sequential build has %d", len(sbf.filters), len(sequential.filters))
+	}
+	if !sbf.AllMightContain(items) || !sbf.AllMightContain(more) {
+		t.Error("an item is missing after more adds")
+	}
+	if got := sbf.ItemCount(); got > uint(len(items)+len(more)) || got < sequential.ItemCount()*99/100 {
+		t.Errorf("ItemCount() = %d, sequential build counts %d", got, sequential.ItemCount())
+	}
+}
+
+func TestBuildParallelMaxFilters(t *testing.T) {
+	limited := testConfig
+	limited.MaxFilters = 2 // Room for 100+200 items
+	if _, err := BuildParallel(testKeys("item", 1000), limited, 8); !errors.Is(err, ErrMaxFilters) {
+		t.Errorf("BuildParallel past MaxFilters = %v, want ErrMaxFilters", err)
+	}
+	sbf, err := BuildParallel(testKeys("item", 250), limited, 8)
+	if err != nil {
+		t.Fatalf("BuildParallel within MaxFilters: %v", err)
+	}
+	if len(sbf.filters) != 2 {
+		t.Fatalf("BuildParallel of 250 items made %d sub-filters, want 2", len(sbf.filters))
+	}
+	var addErr error
+	for _, item := range testKeys("more", 100) {
+		if addErr = sbf.Add(item); addErr != nil {
+			break
+		}
+	}
+	if !errors.Is(addErr, ErrMaxFilters) {
+		t.Errorf("adding past MaxFilters after BuildParallel = %v, want ErrMaxFilters", addErr)
+	}
+
+	empty, err := BuildParallel(nil, limited, 8)
+	if err != nil || len(empty.filters) != 0 {
+		t.Errorf("BuildParallel(nil) = %d sub-filters, %v, want an empty filter", len(empty.filters), err)
+	}
+}
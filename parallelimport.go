@@ -0,0 +1,117 @@
+package main
+
+import "slices"
+
+// importPool hashes and inserts the batches of an import on worker goroutines, for
+// WithImportWorkers. Only the importing goroutine calls its methods and updates the
+// Report; the workers send back what each batch did.
+type importPool struct {
+	sbf     *ScalableBloomFilter
+	report  *Report
+	batches chan []string
+	results chan importCounts
+	pending int   // Batches sent whose counts have not been collected
+	err     error // First insert error
+}
+
+// importCounts is what inserting one batch did.
+type importCounts struct {
+	lines      int
+	added      int
+	duplicates int
+	filters    int
+	err        error
+}
+
+// startImportPool starts workers goroutines inserting into sbf; wait must be called to
+// stop them.
+func (sbf *ScalableBloomFilter) startImportPool(workers int, report *Report) *importPool {
+	p := &importPool{
+		sbf:     sbf,
+		report:  report,
+		batches: make(chan []string, workers),
+		results: make(chan importCounts, workers),
+	}
+	for range workers {
+		go func() {
+			for batch := range p.batches {
+				p.results <- sbf.addHashedBatch(batch)
+			}
+		}()
+	}
+	return p
+}
+
+// insert hands a copy of batch to a worker, collecting finished batches while it waits. It
+// returns the first insert error seen so far.
+func (p *importPool) insert(batch []string) error {
+	batch = slices.Clone(batch)
+	for sent := false; !sent; {
+		select {
+		case p.batches <- batch:
+			p.pending++
+			sent = true
+		case counts := <-p.results:
+			p.collect(counts)
+		}
+	}
+	// Keep the report current for progress callbacks without waiting for anything.
+	for {
+		select {
+		case counts := <-p.results:
+			p.collect(counts)
+		default:
+			return p.err
+		}
+	}
+}
+
+// wait stops the workers once they have inserted every batch handed to them and returns
+// the first insert error.
+func (p *importPool) wait() error {
+	close(p.batches)
+	for p.pending > 0 {
+		p.collect(<-p.results)
+	}
+	return p.err
+}
+
+// collect adds the counts of a finished batch to the report.
+func (p *importPool) collect(counts importCounts) {
+	p.pending--
+	p.report.LinesRead += counts.lines
+	p.report.ItemsAdded += counts.added
+	p.report.Duplicates += counts.duplicates
+	p.report.Filters = max(p.report.Filters, counts.filters)
+	if counts.err != nil && p.err == nil {
+		p.err = counts.err
+	}
+}
+
+// addHashedBatch hashes items without holding the lock, which is what lets workers run in
+// parallel, then tests and adds each digest under a single lock like addImportBatch.
+func (sbf *ScalableBloomFilter) addHashedBatch(items []string) importCounts {
+	sums := make([][]byte, len(items))
+	for i, item := range items {
+		sums[i] = sbf.digest(item)
+	}
+
+	sbf.mutex.Lock()
+	defer sbf.mutex.Unlock()
+
+	var counts importCounts
+	for _, sum := range sums {
+		if sbf.containsDigest(sum) {
+			counts.lines++
+			counts.duplicates++
+			continue
+		}
+		if counts.err = sbf.addDigest(sum); counts.err != nil {
+			break
+		}
+		counts.lines++
+		counts.added++
+	}
+	counts.filters = len(sbf.filters)
+	return counts
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic writes a file through write into a temporary file in the same directory
+// and renames it over path once it is synced, so readers never observe a partial file and
+// a crash leaves either the old or the new contents.
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	// Removing the temporary file fails harmlessly once it has been renamed.
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// saveFile atomically writes the filter's gob encoding to path.
+func (sbf *ScalableBloomFilter) saveFile(path string) error {
+	data, err := sbf.GobEncode()
+	if err != nil {
+		return err
+	}
+	return writeFileBytes(path, data)
+}
+
+// snapshotTo atomically writes the filter's gob encoding to path even while the filter is
+// being closed, for cleanups registered with onClose; the caller must not hold the lock.
+func (sbf *ScalableBloomFilter) snapshotTo(path string) error {
+	sbf.mutex.RLock()
+	data, err := sbf.encodeGob()
+	sbf.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+	return writeFileBytes(path, data)
+}
+
+// writeFileBytes atomically replaces the file at path with data.
+func writeFileBytes(path string, data []byte) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// loadScalableFile reads a filter written by saveFile. The options apply as for
+// NewScalableBloomFilter, except that the file's configuration and hasher take
+// precedence; a configured key normalizer must match the file's.
+func loadScalableFile(path string, opts []Option) (*ScalableBloomFilter, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sbf := &ScalableBloomFilter{options: buildOptions(opts)}
+	if err := sbf.GobDecode(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return sbf, nil
+}
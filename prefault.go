@@ -0,0 +1,41 @@
+package main
+
+import "os"
+
+// prefaultMask is XORed into the bitset by Prefault. It is always zero, but as a variable
+// the compiler cannot drop the stores as no-ops.
+var prefaultMask uint8
+
+// WithPrefault makes every new sub-filter call Prefault on its bitset as it is allocated,
+// so that a large filter takes its page faults when it is built or grows rather than on
+// the Adds that first write to each page.
+func WithPrefault() Option {
+	return func(o *options) {
+		o.prefault = true
+	}
+}
+
+// Prefault writes to every page of the bitset so that the operating system backs all of it
+// with memory now. A large bitset is allocated as untouched zero pages, each faulting in on
+// its first write, which would otherwise happen during Adds, for example while handling a
+// request. The bits are unchanged. Whether the pages stay resident is up to the operating
+// system.
+func (bf *BloomFilter) Prefault() {
+	bf.mutex.Lock()
+	defer bf.mutex.Unlock()
+
+	bf.prefault()
+}
+
+// prefault implements Prefault; the caller must hold the write lock or own the filter.
+func (bf *BloomFilter) prefault() {
+	if len(bf.bitset) == 0 {
+		return
+	}
+	// The bitset need not start on a page boundary, so the last byte may be on a page the
+	// stride skips.
+	for i := 0; i < len(bf.bitset); i += os.Getpagesize() {
+		bf.bitset[i] ^= prefaultMask
+	}
+	bf.bitset[len(bf.bitset)-1] ^= prefaultMask
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"syscall"
+	"testing"
+)
+
+// minorFaults returns the number of page faults the process has taken without I/O.
+func minorFaults(t *testing.T) int64 {
+	t.Helper()
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		t.Skipf("getrusage: %v", err)
+	}
+	return usage.Minflt
+}
+
+// addFaults returns the page faults taken by adding keys to a new filter of capacity.
+func addFaults(t *testing.T, capacity int, keys []string, opts ...Option) int64 {
+	bf := NewBloomFilter(capacity, 0.01, opts...)
+	before := minorFaults(t)
+	for _, key := range keys {
+		bf.Add(key)
+	}
+	return minorFaults(t) - before
+}
+
+func TestPrefaultAvoidsFaults(t *testing.T) {
+	if testing.Short() {
+		t.Skip("allocates large filters")
+	}
+	// A 60 MB bitset, touched on about every page by the keys. Faults are counted for the
+	// whole process, and the race detector's shadow memory faults on first write however
+	// the bitset was touched, so the comparison is loose.
+	const capacity = 50_000_000
+	keys := testKeys("key", 200000)
+	lazy := addFaults(t, capacity, keys)
+	if lazy < 1000 {
+		t.Skipf("adds to a fresh bitset took only %d page faults; its memory was already resident", lazy)
+	}
+	if eager := addFaults(t, capacity, keys, WithPrefault()); eager > lazy/2 {
+		t.Errorf("adds took %d page faults after prefaulting, %d without", eager, lazy)
+	}
+}
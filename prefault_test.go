@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrefault(t *testing.T) {
+	bf := NewBloomFilter(100000, 0.01)
+	keys := testKeys("key", 1000)
+	for _, key := range keys {
+		bf.Add(key)
+	}
+	before := bytes.Clone(bf.bitset)
+	bf.Prefault()
+	if !bytes.Equal(bf.bitset, before) {
+		t.Fatal("Prefault changed the bits")
+	}
+	for _, key := range keys {
+		if !bf.MightContain(key) {
+			t.Fatalf("MightContain(%q) = false after Prefault", key)
+		}
+	}
+
+	// Empty and single-byte bitsets are left alone too.
+	(&BloomFilter{}).Prefault()
+	tiny := &BloomFilter{bitset: []uint8{0xa5}}
+	if tiny.Prefault(); tiny.bitset[0] != 0xa5 {
+		t.Errorf("Prefault changed a one-byte bitset to %#x", tiny.bitset[0])
+	}
+}
+
+func TestWithPrefault(t *testing.T) {
+	plain := newTestFilter(t, testConfig)
+	sbf := newTestFilter(t, testConfig, WithPrefault(), WithBitsetAlignment(64))
+	items := testKeys("item", 500) // Several sub-filters, each prefaulted as it is added
+	addAll(t, plain, items)
+	addAll(t, sbf, items)
+	if len(sbf.filters) != len(plain.filters) {
+		t.Fatalf("prefaulted filter has %d sub-filters, want %d", len(sbf.filters), len(plain.filters))
+	}
+	for i := range sbf.filters {
+		if !bytes.Equal(sbf.filters[i].usedBytes(), plain.filters[i].usedBytes()) {
+			t.Errorf("sub-filter %d: prefaulted bits differ", i)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import "fmt"
+
+// StagePlan describes a sub-filter that PreGrow allocates ahead of time.
+type StagePlan struct {
+	Index    int     `json:"index"`     // Position among the sub-filters, oldest first
+	Capacity int     `json:"capacity"`  // Number of items it is sized for
+	TargetFP float64 `json:"target_fp"` // False positive rate it is sized for
+	BitSize  uint    `json:"bit_size"`  // Number of bits (m)
+	Bytes    int     `json:"bytes"`     // Bytes allocated for its bitset
+}
+
+// ExpectAdditional returns the sub-filters the filter would grow by to take n more
+// distinct items, without allocating them. The room left in the active sub-filter and in
+// sub-filters already allocated by PreGrow is used first. It fails with ErrMaxFilters if
+// MaxFilters does not allow the sub-filters needed, and with ErrCapacityOverflow if one
+// would be too large, returning the plan up to that point.
+func (sbf *ScalableBloomFilter) ExpectAdditional(n int) ([]StagePlan, error) {
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+
+	return sbf.planGrowth(n)
+}
+
+// PreGrow allocates the sub-filters that ExpectAdditional returns for n, so that adding n
+// more distinct items does not allocate during the load. The new sub-filters stay empty
+// until the ones before them are full. Nothing is allocated if ExpectAdditional fails.
+func (sbf *ScalableBloomFilter) PreGrow(n int) ([]StagePlan, error) {
+	sbf.mutex.Lock()
+	defer sbf.mutex.Unlock()
+
+	if sbf.closed {
+		return nil, ErrClosed
+	}
+	if sbf.frozen {
+		return nil, ErrReadOnly
+	}
+	plan, err := sbf.planGrowth(n)
+	if err != nil {
+		return plan, err
+	}
+	for range plan {
+		if err := sbf.grow(); err != nil {
+			return plan, err
+		}
+	}
+	return plan, nil
+}
+
+// planGrowth implements ExpectAdditional; the caller must hold the lock.
+func (sbf *ScalableBloomFilter) planGrowth(n int) ([]StagePlan, error) {
+	remaining := n
+	if len(sbf.filters) > 0 {
+		for _, filter := range sbf.filters[sbf.activeIndex():] {
+			remaining -= max(filter.capacity-int(filter.ItemCount()), 0)
+		}
+	}
+	var plan []StagePlan
+	next := len(sbf.filters)
+	for ; remaining > 0; next++ {
+		capacity, fp, err := sbf.stageSize(next)
+		if err != nil {
+			return plan, err
+		}
+		m := sbf.options.bitSize(capacity, fp)
+		plan = append(plan, StagePlan{
+			Index:    next,
+			Capacity: capacity,
+			TargetFP: fp,
+			BitSize:  m,
+			Bytes:    int(alignedLen((m+7)/8, sbf.options.bitsetAlignment)),
+		})
+		remaining -= capacity
+	}
+	if sbf.maxFilters > 0 && next > sbf.maxFilters {
+		return plan, fmt.Errorf("%d more items need %d sub-filters, %d of them new, over MaxFilters %d: %w",
+			n, next, len(plan), sbf.maxFilters, ErrMaxFilters)
+	}
+	return plan, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExpectAdditional(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	// Capacities double from 100, so 1000 items need 100+200+400+800.
+	plan, err := sbf.ExpectAdditional(1000)
+	if err != nil {
+		t.Fatalf("ExpectAdditional: %v", err)
+	}
+	if len(plan) != 4 || len(sbf.filters) != 0 {
+		t.Fatalf("ExpectAdditional(1000) planned %d sub-filters and allocated %d, want 4 and none", len(plan), len(sbf.filters))
+	}
+	for i, stage := range plan {
+		capacity, fp, _ := sbf.stageSize(i)
+		if stage.Index != i || stage.Capacity != capacity || stage.TargetFP != fp || stage.Bytes != int(stage.BitSize+7)/8 {
+			t.Errorf("stage %d = %+v, want capacity %d at %g", i, stage, capacity, fp)
+		}
+	}
+
+	// Room left in the active sub-filter is used first.
+	addAll(t, sbf, testKeys("item", 50))
+	if plan, err := sbf.ExpectAdditional(50); err != nil || len(plan) != 0 {
+		t.Errorf("ExpectAdditional(50) with 50 of 100 free = %+v, %v, want no sub-filters", plan, err)
+	}
+	if plan, err := sbf.ExpectAdditional(51); err != nil || len(plan) != 1 || plan[0].Index != 1 {
+		t.Errorf("ExpectAdditional(51) with 50 of 100 free = %+v, %v, want sub-filter 1", plan, err)
+	}
+}
+
+func TestPreGrow(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	addAll(t, sbf, testKeys("item", 50))
+	plan, err := sbf.PreGrow(1000)
+	if err != nil {
+		t.Fatalf("PreGrow: %v", err)
+	}
+	stages := len(sbf.filters)
+	if stages != 1+len(plan) {
+		t.Fatalf("PreGrow planned %d sub-filters and left %d, want %d", len(plan), stages, 1+len(plan))
+	}
+	if again, err := sbf.ExpectAdditional(1000); err != nil || len(again) != 0 {
+		t.Errorf("ExpectAdditional after PreGrow = %+v, %v, want no sub-filters", again, err)
+	}
+
+	// The expected load allocates nothing more, and fills the sub-filters in order.
+	addAll(t, sbf, testKeys("load", 1000))
+	if len(sbf.filters) != stages {
+		t.Errorf("adding the expected items grew the filter from %d to %d sub-filters", stages, len(sbf.filters))
+	}
+	for i, filter := range sbf.filters[:stages-1] {
+		if filter.ItemCount() != uint(filter.capacity) {
+			t.Errorf("sub-filter %d holds %d of %d items before a later one was used", i, filter.ItemCount(), filter.capacity)
+		}
+	}
+}
+
+func TestPreGrowMaxFilters(t *testing.T) {
+	limited := testConfig
+	limited.MaxFilters = 2
+	sbf := newTestFilter(t, limited)
+	plan, err := sbf.PreGrow(1000)
+	if !errors.Is(err, ErrMaxFilters) {
+		t.Fatalf("PreGrow past MaxFilters = %v, want ErrMaxFilters", err)
+	}
+	if len(plan) != 4 || len(sbf.filters) != 0 {
+		t.Errorf("PreGrow past MaxFilters planned %d and allocated %d sub-filters, want 4 and none", len(plan), len(sbf.filters))
+	}
+	if _, err := sbf.PreGrow(300); err != nil || len(sbf.filters) != 2 {
+		t.Errorf("PreGrow within MaxFilters = %v with %d sub-filters, want 2", err, len(sbf.filters))
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// Roaring bitmap portable serialization, as specified at
+// https://github.com/RoaringBitmap/RoaringFormatSpec. Bit positions are split into a
+// 16-bit container key and a 16-bit value within the container. ExportRoaring writes
+// array and bitmap containers only; ImportRoaring also accepts run containers.
+const (
+	roaringCookieNoRuns  = 12346
+	roaringCookieRuns    = 12347
+	roaringArrayMax      = 4096 // Containers with more values are stored as bitmaps
+	roaringBitmapBytes   = 8192 // 2^16 bits
+	roaringNoOffsetLimit = 4    // Run-cookie bitmaps with fewer containers omit offsets
+)
+
+// ExportRoaring writes the positions of the filter's set bits to w as a roaring bitmap in
+// the portable serialization format, so they can be consumed by any roaring implementation.
+// Roaring bitmaps hold 32-bit integers, so filters with more than 2^32 bits are rejected.
+// Only the bit positions are written; ImportRoaring needs the filter's bit size, number of
+// hash functions and hasher to make it queryable again.
+func (bf *BloomFilter) ExportRoaring(w io.Writer) error {
+	bf.mutex.RLock()
+	defer bf.mutex.RUnlock()
+
+	if uint64(bf.bitSize) > math.MaxUint32+1 {
+		return fmt.Errorf("bit size %d exceeds the 32-bit roaring space", bf.bitSize)
+	}
+
+	// Every container covers 8192 bitset bytes whatever the bit order, so cardinalities can
+	// be counted per byte range before any position is decoded.
+	var keys []uint16
+	var cards []int
+	for start := 0; start < len(bf.bitset); start += roaringBitmapBytes {
+		card := int(popCount(bf.bitset[start:min(start+roaringBitmapBytes, len(bf.bitset))]))
+		if card > 0 {
+			keys = append(keys, uint16(start/roaringBitmapBytes))
+			cards = append(cards, card)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	header := make([]byte, 0, 8+8*len(keys))
+	header = binary.LittleEndian.AppendUint32(header, roaringCookieNoRuns)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(keys)))
+	for i, key := range keys {
+		header = binary.LittleEndian.AppendUint16(header, key)
+		header = binary.LittleEndian.AppendUint16(header, uint16(cards[i]-1))
+	}
+	offset := uint32(len(header) + 4*len(keys))
+	for _, card := range cards {
+		header = binary.LittleEndian.AppendUint32(header, offset)
+		if card > roaringArrayMax {
+			offset += roaringBitmapBytes
+		} else {
+			offset += 2 * uint32(card)
+		}
+	}
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+
+	for i, key := range keys {
+		var container []byte
+		if cards[i] > roaringArrayMax {
+			container = make([]byte, roaringBitmapBytes)
+		} else {
+			container = make([]byte, 0, 2*cards[i])
+		}
+		start := int(key) * roaringBitmapBytes
+		for j, b := range bf.bitset[start:min(start+roaringBitmapBytes, len(bf.bitset))] {
+			for bit := uint(0); bit < 8 && b != 0; bit++ {
+				pos := uint(j)*8 + bit
+				if b&bf.bitOrder.mask(pos) == 0 {
+					continue
+				}
+				if cards[i] > roaringArrayMax {
+					container[pos/8] |= 1 << (pos % 8)
+				} else {
+					container = binary.LittleEndian.AppendUint16(container, uint16(pos))
+				}
+			}
+		}
+		if _, err := bw.Write(container); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ImportRoaring reconstructs a BloomFilter from set-bit positions written by ExportRoaring
+// or by another roaring implementation. m, k and hasher must match the filter the
+// positions came from, or lookups will be meaningless. The bitmap does not record how many
+// items were added, so the item count is estimated from the number of set bits.
+func ImportRoaring(r io.Reader, m uint64, k uint, hasher string) (*BloomFilter, error) {
+	if m == 0 || m > math.MaxUint32+1 {
+		return nil, fmt.Errorf("bit size %d is outside the 32-bit roaring space", m)
+	}
+	if k == 0 {
+		return nil, errors.New("number of hash functions must be greater than 0")
+	}
+	h, err := LookupHasher(hasher)
+	if err != nil {
+		return nil, err
+	}
+	bf := &BloomFilter{
+		bitset:       make([]uint8, (m+7)/8),
+		bitSize:      uint(m),
+		numHashFuncs: k,
+		hasher:       h,
+	}
+	set := func(pos uint64) error {
+		if pos >= m {
+			return fmt.Errorf("bit position %d is outside a filter of %d bits", pos, m)
+		}
+		bf.bitset[pos/8] |= bf.bitOrder.mask(uint(pos))
+		return nil
+	}
+
+	br := bufio.NewReader(r)
+	var cookie uint32
+	if err := binary.Read(br, binary.LittleEndian, &cookie); err != nil {
+		return nil, fmt.Errorf("reading roaring header: %w", err)
+	}
+	var size uint32
+	var runs []byte
+	switch {
+	case cookie == roaringCookieNoRuns:
+		if err := binary.Read(br, binary.LittleEndian, &size); err != nil {
+			return nil, fmt.Errorf("reading roaring header: %w", err)
+		}
+	case cookie&0xFFFF == roaringCookieRuns:
+		size = cookie>>16 + 1
+		runs = make([]byte, (size+7)/8)
+		if _, err := io.ReadFull(br, runs); err != nil {
+			return nil, fmt.Errorf("reading roaring header: %w", err)
+		}
+	default:
+		return nil, errors.New("not a portable roaring bitmap")
+	}
+	if size > 1<<16 {
+		return nil, fmt.Errorf("invalid roaring container count %d", size)
+	}
+
+	descriptive := make([]uint16, 2*size)
+	if err := binary.Read(br, binary.LittleEndian, descriptive); err != nil {
+		return nil, fmt.Errorf("reading roaring header: %w", err)
+	}
+	if runs == nil || size >= roaringNoOffsetLimit {
+		// Containers are read in order, so the offsets are not needed.
+		if _, err := br.Discard(4 * int(size)); err != nil {
+			return nil, fmt.Errorf("reading roaring header: %w", err)
+		}
+	}
+
+	for i := uint32(0); i < size; i++ {
+		base := uint64(descriptive[2*i]) << 16
+		card := int(descriptive[2*i+1]) + 1
+		switch {
+		case runs != nil && runs[i/8]&(1<<(i%8)) != 0:
+			var n uint16
+			if err := binary.Read(br, binary.LittleEndian, &n); err != nil {
+				return nil, fmt.Errorf("reading roaring container %d: %w", i, err)
+			}
+			pairs := make([]uint16, 2*int(n))
+			if err := binary.Read(br, binary.LittleEndian, pairs); err != nil {
+				return nil, fmt.Errorf("reading roaring container %d: %w", i, err)
+			}
+			for j := 0; j < len(pairs); j += 2 {
+				for v := uint64(pairs[j]); v <= uint64(pairs[j])+uint64(pairs[j+1]); v++ {
+					if err := set(base + v); err != nil {
+						return nil, err
+					}
+				}
+			}
+		case card > roaringArrayMax:
+			words := make([]uint64, roaringBitmapBytes/8)
+			if err := binary.Read(br, binary.LittleEndian, words); err != nil {
+				return nil, fmt.Errorf("reading roaring container %d: %w", i, err)
+			}
+			for j, word := range words {
+				for ; word != 0; word &= word - 1 {
+					if err := set(base + uint64(j)*64 + uint64(bits.TrailingZeros64(word))); err != nil {
+						return nil, err
+					}
+				}
+			}
+		default:
+			values := make([]uint16, card)
+			if err := binary.Read(br, binary.LittleEndian, values); err != nil {
+				return nil, fmt.Errorf("reading roaring container %d: %w", i, err)
+			}
+			for _, v := range values {
+				if err := set(base + uint64(v)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if n, err := estimateCardinality(popCount(bf.bitset), bf.bitSize, k); err == nil {
+		bf.count = uint(math.Round(n))
+	} else {
+		bf.count = uint(m)
+	}
+	// As with filters decoded without a recorded capacity, treat the filter as full.
+	bf.capacity = int(bf.count)
+	return bf, nil
+}
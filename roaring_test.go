@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// referencePositions are the values in testdata/bitmapwith*.bin. The files were written by
+// the Java reference implementation of roaring bitmaps and are copied from the testdata of
+// github.com/RoaringBitmap/roaring, where they check interoperability.
+func referencePositions() []uint {
+	var positions []uint
+	for k := uint(0); k < 100000; k += 1000 {
+		positions = append(positions, k)
+	}
+	for k := uint(100000); k < 200000; k++ {
+		positions = append(positions, 3*k)
+	}
+	for k := uint(700000); k < 800000; k++ {
+		positions = append(positions, k)
+	}
+	return positions
+}
+
+// setPositions returns the positions of bf's set bits.
+func setPositions(bf *BloomFilter) []uint {
+	var positions []uint
+	for i := uint(0); i < bf.bitSize; i++ {
+		if bf.bitset[i/8]&bf.bitOrder.mask(i) != 0 {
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}
+
+func TestImportRoaringReference(t *testing.T) {
+	want := referencePositions()
+	for _, name := range []string{"bitmapwithoutruns.bin", "bitmapwithruns.bin"} {
+		data, err := os.ReadFile("testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bf, err := ImportRoaring(bytes.NewReader(data), 800000, 1, "md5")
+		if err != nil {
+			t.Fatalf("%s: ImportRoaring: %v", name, err)
+		}
+		got := setPositions(bf)
+		if len(got) != len(want) {
+			t.Fatalf("%s: %d positions set, want %d", name, len(got), len(want))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("%s: position %d is %d, want %d", name, i, got[i], want[i])
+			}
+		}
+
+		// Exporting the same positions reproduces the reference serialization, which
+		// uses no run containers.
+		if name == "bitmapwithoutruns.bin" {
+			var buf bytes.Buffer
+			if err := bf.ExportRoaring(&buf); err != nil {
+				t.Fatalf("ExportRoaring: %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), data) {
+				t.Errorf("exported %d bytes differ from the %d bytes of the reference implementation", buf.Len(), len(data))
+			}
+		}
+	}
+}
+
+func TestRoaringRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		items int
+		opts  []Option
+	}{
+		{"sparse", 100, nil},  // Array containers
+		{"dense", 20000, nil}, // Bitmap containers
+		{"lsb first", 20000, []Option{WithBitOrder(LSBFirst)}}, // Positions, not bytes, are exported
+		{"empty", 0, nil},
+	} {
+		bf := NewBloomFilter(20000, 0.01, tc.opts...)
+		keys := testKeys("key", tc.items)
+		for _, key := range keys {
+			bf.Add(key)
+		}
+		var buf bytes.Buffer
+		if err := bf.ExportRoaring(&buf); err != nil {
+			t.Fatalf("%s: ExportRoaring: %v", tc.name, err)
+		}
+		imported, err := ImportRoaring(&buf, uint64(bf.bitSize), bf.numHashFuncs, "md5")
+		if err != nil {
+			t.Fatalf("%s: ImportRoaring: %v", tc.name, err)
+		}
+		if got, want := setPositions(imported), setPositions(bf); len(got) != len(want) {
+			t.Fatalf("%s: %d positions after the round trip, want %d", tc.name, len(got), len(want))
+		}
+		for _, key := range keys {
+			if !imported.MightContain(key) {
+				t.Fatalf("%s: imported filter lacks %q", tc.name, key)
+			}
+		}
+		if tc.items > 0 && (imported.ItemCount() < uint(tc.items)*9/10 || imported.ItemCount() > uint(tc.items)*11/10) {
+			t.Errorf("%s: estimated ItemCount() = %d, want about %d", tc.name, imported.ItemCount(), tc.items)
+		}
+	}
+}
+
+func TestImportRoaringErrors(t *testing.T) {
+	var valid bytes.Buffer
+	bf := NewBloomFilter(1000, 0.01)
+	bf.Add("item")
+	bf.ExportRoaring(&valid)
+
+	for _, tc := range []struct {
+		name   string
+		data   []byte
+		m      uint64
+		k      uint
+		hasher string
+	}{
+		{"zero bit size", valid.Bytes(), 0, 7, "md5"},
+		{"bit size over 2^32", valid.Bytes(), 1<<32 + 1, 7, "md5"},
+		{"zero hash functions", valid.Bytes(), uint64(bf.bitSize), 0, "md5"},
+		{"unknown hasher", valid.Bytes(), uint64(bf.bitSize), 7, "crc"},
+		{"position outside the filter", valid.Bytes(), 8, 7, "md5"},
+		{"bad cookie", []byte{1, 2, 3, 4, 0, 0, 0, 0}, 1000, 7, "md5"},
+		{"empty", nil, 1000, 7, "md5"},
+		{"truncated", valid.Bytes()[:valid.Len()-1], uint64(bf.bitSize), 7, "md5"},
+	} {
+		if _, err := ImportRoaring(bytes.NewReader(tc.data), tc.m, tc.k, tc.hasher); err == nil {
+			t.Errorf("%s: ImportRoaring succeeded", tc.name)
+		}
+	}
+
+	huge := &BloomFilter{bitSize: 1<<32 + 8}
+	if err := huge.ExportRoaring(&bytes.Buffer{}); err == nil {
+		t.Error("ExportRoaring of a filter over 2^32 bits succeeded")
+	}
+}
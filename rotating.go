@@ -0,0 +1,122 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// RotatingBloomFilter is a time-decaying filter made of a ring of equally sized windows.
+// Items are added to the current window and found in any window; each Rotate clears the
+// oldest window and makes it current, so an item is forgotten after as many rotations as
+// there are windows. It is safe for concurrent use.
+type RotatingBloomFilter struct {
+	windows  []*BloomFilter
+	current  int
+	capacity int
+	fp       float64
+	options  options
+	onRotate func(clearedFilterIndex int, approxItemsCleared uint)
+	mutex    sync.RWMutex
+}
+
+// NewRotatingBloomFilter creates a RotatingBloomFilter with the given number of windows,
+// each sized for windowCapacity items at false positive rate fp.
+func NewRotatingBloomFilter(windows, windowCapacity int, fp float64, opts ...Option) *RotatingBloomFilter {
+	windows = max(windows, 1)
+	rbf := &RotatingBloomFilter{
+		windows:  make([]*BloomFilter, windows),
+		capacity: windowCapacity,
+		fp:       fp,
+		options:  buildOptions(opts),
+	}
+	for i := range rbf.windows {
+		rbf.windows[i] = newBloomFilter(windowCapacity, fp, rbf.options)
+	}
+	return rbf
+}
+
+// OnRotate sets a callback invoked after each rotation with the index of the window that
+// was cleared and the approximate number of items it held, e.g. to persist aggregate stats.
+// The callback runs without the filter's lock held. A nil callback disables it.
+func (rbf *RotatingBloomFilter) OnRotate(fn func(clearedFilterIndex int, approxItemsCleared uint)) {
+	rbf.mutex.Lock()
+	defer rbf.mutex.Unlock()
+
+	rbf.onRotate = fn
+}
+
+// Rotate clears the oldest window and makes it the current one.
+func (rbf *RotatingBloomFilter) Rotate() {
+	rbf.mutex.Lock()
+	rbf.current = (rbf.current + 1) % len(rbf.windows)
+	cleared := rbf.current
+	approxItems := rbf.windows[cleared].ItemCount()
+	rbf.windows[cleared] = newBloomFilter(rbf.capacity, rbf.fp, rbf.options)
+	onRotate := rbf.onRotate
+	rbf.mutex.Unlock()
+
+	if onRotate != nil {
+		onRotate(cleared, approxItems)
+	}
+}
+
+// Add inserts an item into the current window.
+// Returns true if at least one bit was newly set in that window.
+func (rbf *RotatingBloomFilter) Add(item string) bool {
+	rbf.mutex.RLock()
+	defer rbf.mutex.RUnlock()
+
+	return rbf.windows[rbf.current].Add(item)
+}
+
+// TestAndAdd reports whether the item might already be present in any window and inserts
+// it into the current window otherwise.
+func (rbf *RotatingBloomFilter) TestAndAdd(item string) (bool, error) {
+	// The write lock keeps the check and the insert atomic with respect to other callers.
+	rbf.mutex.Lock()
+	defer rbf.mutex.Unlock()
+
+	if rbf.mightContain(item) {
+		return true, nil
+	}
+	rbf.windows[rbf.current].Add(item)
+	return false, nil
+}
+
+// MightContain checks if an item might be in any window.
+// Returns true if the item might be present, false if it is definitely not present.
+func (rbf *RotatingBloomFilter) MightContain(item string) bool {
+	rbf.mutex.RLock()
+	defer rbf.mutex.RUnlock()
+
+	return rbf.mightContain(item)
+}
+
+// mightContain checks all windows; the caller must hold at least the read lock.
+func (rbf *RotatingBloomFilter) mightContain(item string) bool {
+	for _, window := range rbf.windows {
+		if window.MightContain(item) {
+			return true
+		}
+	}
+	return false
+}
+
+// RecommendRotationInterval returns the longest rotation interval at which a
+// RotatingBloomFilter receiving insertsPerSecond items keeps each window within
+// windowCapacity, so no window exceeds its target false positive rate. The window count
+// does not change the interval, since each window only receives the inserts of one
+// interval, but together they determine the retention horizon: an item is remembered for
+// between windows-1 and windows intervals. It returns 0 if any argument is not positive.
+func RecommendRotationInterval(insertsPerSecond float64, windowCapacity int, windows int) time.Duration {
+	if insertsPerSecond <= 0 || windowCapacity <= 0 || windows <= 0 {
+		return 0
+	}
+	seconds := float64(windowCapacity) / insertsPerSecond
+	if seconds >= float64(math.MaxInt64)/float64(time.Second) {
+		return time.Duration(math.MaxInt64)
+	}
+	// Truncate rather than round so interval × rate never exceeds the capacity.
+	return time.Duration(seconds * float64(time.Second))
+}
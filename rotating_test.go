@@ -0,0 +1,102 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRotatingBloomFilter(t *testing.T) {
+	rbf := NewRotatingBloomFilter(2, 1000, 0.01)
+	rbf.Add("old")
+	rbf.Rotate()
+	if found, err := rbf.TestAndAdd("new"); found || err != nil {
+		t.Fatalf("TestAndAdd(new) = %v, %v, want false, nil", found, err)
+	}
+	if !rbf.MightContain("old") || !rbf.MightContain("new") {
+		t.Fatal("items from the last two windows are missing")
+	}
+	rbf.Rotate()
+	if rbf.MightContain("old") {
+		t.Error("item still present after as many rotations as there are windows")
+	}
+	if !rbf.MightContain("new") {
+		t.Error("item from the previous window is missing")
+	}
+}
+
+func TestRotatingBloomFilterOnRotate(t *testing.T) {
+	type rotation struct {
+		index int
+		items uint
+	}
+	var got []rotation
+	rbf := NewRotatingBloomFilter(3, 1000, 0.01)
+	rbf.OnRotate(func(index int, items uint) {
+		got = append(got, rotation{index, items})
+		rbf.MightContain("x") // The lock is not held
+	})
+
+	add := func(prefix string, n int) {
+		for _, key := range testKeys(prefix, n) {
+			rbf.Add(key)
+		}
+	}
+	add("first", 300)
+	rbf.Rotate()
+	add("second", 50)
+	rbf.Rotate()
+	rbf.Rotate() // Clears the window holding the first 300 items
+	rbf.Rotate()
+
+	want := []rotation{{1, 0}, {2, 0}, {0, 300}, {1, 50}}
+	if len(got) != len(want) {
+		t.Fatalf("callback ran %d times, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		// ItemCount misses the odd item whose bits were all set already.
+		if got[i].index != w.index || got[i].items > w.items || float64(got[i].items) < 0.98*float64(w.items) {
+			t.Errorf("rotation %d: callback(%d, %d), want (%d, about %d)", i, got[i].index, got[i].items, w.index, w.items)
+		}
+	}
+
+	rbf.OnRotate(nil)
+	rbf.Rotate()
+	if len(got) != len(want) {
+		t.Error("callback ran after being cleared")
+	}
+}
+
+func TestRecommendRotationInterval(t *testing.T) {
+	for _, tc := range []struct {
+		rate     float64
+		capacity int
+		windows  int
+		want     time.Duration
+	}{
+		{100, 6000, 4, time.Minute},
+		{3, 10, 2, 3333333333 * time.Nanosecond},
+		{0, 10, 2, 0},
+		{1, 0, 2, 0},
+		{1, 10, 0, 0},
+	} {
+		if got := RecommendRotationInterval(tc.rate, tc.capacity, tc.windows); got != tc.want {
+			t.Errorf("RecommendRotationInterval(%g, %d, %d) = %v, want %v", tc.rate, tc.capacity, tc.windows, got, tc.want)
+		}
+	}
+
+	// At sample rates, one interval's inserts fit in a window, and barely so.
+	for _, rate := range []float64{0.3, 1, 7, 1234.5, 1e6} {
+		for _, capacity := range []int{1, 1000, 999983} {
+			interval := RecommendRotationInterval(rate, capacity, 3)
+			inserts := interval.Seconds() * rate
+			if inserts > float64(capacity) || inserts < 0.999*float64(capacity) {
+				t.Errorf("RecommendRotationInterval(%g, %d, 3) = %v, admitting %.2f inserts per window",
+					rate, capacity, interval, inserts)
+			}
+		}
+	}
+	if got := RecommendRotationInterval(1e-300, 1, 2); got != time.Duration(math.MaxInt64) {
+		t.Errorf("RecommendRotationInterval at a negligible rate = %v, want the longest duration", got)
+	}
+}
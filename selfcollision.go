@@ -0,0 +1,46 @@
+package main
+
+// WithSelfCollisionTracking makes filters count inserts whose hash indices are not all
+// distinct. When the bit size is small, several of a key's k indices can land on the same
+// bit, so the key effectively uses fewer hash functions and the false positive rate rises
+// above the target. The counts appear in Stats as SelfCollisions, and the first such
+// insert into each sub-filter is reported to the Logger. A steadily growing count signals
+// an undersized filter. Counts cover inserts since the filter was built or loaded.
+func WithSelfCollisionTracking() Option {
+	return func(o *options) {
+		o.trackSelfCollisions = true
+	}
+}
+
+// countSelfCollision records an insert whose indices are not all distinct; the caller
+// must hold the write lock.
+func (bf *BloomFilter) countSelfCollision(hashes []uint) {
+	distinct := distinctCount(hashes)
+	if distinct == len(hashes) {
+		return
+	}
+	if bf.selfCollisions == 0 {
+		bf.warnf("bloom: key mapped to %d distinct bits of %d; the %d-bit filter may be undersized",
+			distinct, len(hashes), bf.bitSize)
+	}
+	bf.selfCollisions++
+}
+
+// distinctCount returns the number of distinct values in hashes, which is short enough
+// for a quadratic scan to beat a map.
+func distinctCount(hashes []uint) int {
+	distinct := 0
+	for i, hash := range hashes {
+		repeated := false
+		for _, earlier := range hashes[:i] {
+			if earlier == hash {
+				repeated = true
+				break
+			}
+		}
+		if !repeated {
+			distinct++
+		}
+	}
+	return distinct
+}
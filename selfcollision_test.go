@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSelfCollisionTracking(t *testing.T) {
+	logger := &captureLogger{}
+	// Two items at 1% need 7 hash functions over about 20 bits, so most keys repeat a bit.
+	bf := NewBloomFilter(2, 0.01, WithSelfCollisionTracking(), WithLogger(logger))
+	untracked := NewBloomFilter(2, 0.01)
+	var want uint64
+	for _, key := range testKeys("tiny", 100) {
+		if distinctCount(bf.getHashes(key)) < int(bf.numHashFuncs) {
+			want++
+		}
+		bf.Add(key)
+		untracked.Add(key)
+	}
+	if want == 0 {
+		t.Fatalf("no key of %d bits and k=%d repeats an index; the test needs a smaller filter", bf.bitSize, bf.numHashFuncs)
+	}
+	if bf.selfCollisions != want {
+		t.Errorf("selfCollisions = %d, want the %d keys with repeated indices", bf.selfCollisions, want)
+	}
+	if untracked.selfCollisions != 0 {
+		t.Errorf("selfCollisions without tracking = %d, want 0", untracked.selfCollisions)
+	}
+	if warnings := logger.logged(); len(warnings) != 1 || !strings.Contains(warnings[0], "undersized") {
+		t.Errorf("warnings = %q, want one about an undersized filter", warnings)
+	}
+
+	// A well-sized filter practically never repeats an index.
+	large := NewBloomFilter(100000, 0.01, WithSelfCollisionTracking())
+	for _, key := range testKeys("large", 1000) {
+		large.Add(key)
+	}
+	if large.selfCollisions > 1 {
+		t.Errorf("selfCollisions of a well-sized filter = %d, want about 0", large.selfCollisions)
+	}
+}
+
+func TestSelfCollisionStats(t *testing.T) {
+	config := Config{InitialFP: 0.01, GrowthFactor: 2, TighteningRatio: 0.5, InitialCapacity: 1}
+	sbf := newTestFilter(t, config, WithSelfCollisionTracking())
+	addAll(t, sbf, testKeys("key", 20)) // Several tiny sub-filters
+	stats := sbf.Stats()
+	var total uint64
+	for _, fs := range stats.Filters {
+		total += fs.SelfCollisions
+	}
+	if stats.SelfCollisions == 0 || stats.SelfCollisions != total {
+		t.Errorf("Stats().SelfCollisions = %d with %d across sub-filters, want the positive sum", stats.SelfCollisions, total)
+	}
+}
+
+func TestDistinctCount(t *testing.T) {
+	for _, tc := range []struct {
+		hashes []uint
+		want   int
+	}{
+		{nil, 0},
+		{[]uint{3}, 1},
+		{[]uint{1, 2, 3}, 3},
+		{[]uint{1, 2, 1, 2, 1}, 2},
+		{[]uint{5, 5, 5}, 1},
+	} {
+		if got := distinctCount(tc.hashes); got != tc.want {
+			t.Errorf("distinctCount(%v) = %d, want %d", tc.hashes, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+// Set adapts a Filter to set-style vocabulary so it can be dropped into code written
+// against a set abstraction. Contains may report false positives, as with any Bloom filter.
+type Set struct {
+	filter Filter
+}
+
+// NewSet wraps f in a Set.
+func NewSet(f Filter) *Set {
+	return &Set{filter: f}
+}
+
+// Insert adds an item to the set.
+func (s *Set) Insert(item string) error {
+	_, err := s.filter.TestAndAdd(item)
+	return err
+}
+
+// Contains reports whether the item might be in the set.
+func (s *Set) Contains(item string) bool {
+	return s.filter.MightContain(item)
+}
+
+// Len returns the number of items in the set, as reported by the underlying filter's ItemCount.
+// Filters that do not track an item count report 0.
+func (s *Set) Len() int {
+	if counter, ok := s.filter.(interface{ ItemCount() uint }); ok {
+		return int(counter.ItemCount())
+	}
+	return 0
+}
+
+// Union merges other into s. It is only supported when both sets wrap a *BloomFilter;
+// otherwise ErrUnsupported is returned.
+func (s *Set) Union(other *Set) error {
+	a, okA := s.filter.(*BloomFilter)
+	b, okB := other.filter.(*BloomFilter)
+	if !okA || !okB {
+		return ErrUnsupported
+	}
+	return a.Union(b)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// The Set adapter works with every filter type it documents.
+var (
+	_ Filter = (*BloomFilter)(nil)
+	_ Filter = (*ScalableBloomFilter)(nil)
+	_ Filter = (*CountingBloomFilter)(nil)
+)
+
+func TestSet(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		filter Filter
+	}{
+		{"BloomFilter", NewBloomFilter(1000, 0.01)},
+		{"ScalableBloomFilter", newTestFilter(t, testConfig)},
+		{"CountingBloomFilter", NewCountingBloomFilter(1000, 0.01)},
+	} {
+		s := NewSet(tc.filter)
+		keys := testKeys("set", 50)
+		for _, key := range keys {
+			if err := s.Insert(key); err != nil {
+				t.Fatalf("%s: Insert(%q): %v", tc.name, key, err)
+			}
+		}
+		for _, key := range keys {
+			if !s.Contains(key) {
+				t.Errorf("%s: Contains(%q) = false after Insert", tc.name, key)
+			}
+		}
+		// Len follows ItemCount, which may fall short of the true size by false positives.
+		if got := s.Len(); got < len(keys)-2 || got > len(keys) {
+			t.Errorf("%s: Len() = %d, want about %d", tc.name, got, len(keys))
+		}
+	}
+
+	if got := NewSet(NewExactSet()).Len(); got != 0 {
+		t.Errorf("Len() of a filter without ItemCount = %d, want 0", got)
+	}
+}
+
+func TestSetUnion(t *testing.T) {
+	a, b := NewSet(NewBloomFilter(1000, 0.01)), NewSet(NewBloomFilter(1000, 0.01))
+	a.Insert("a")
+	b.Insert("b")
+	if err := a.Union(b); err != nil {
+		t.Fatalf("Union: %v", err)
+	}
+	if !a.Contains("a") || !a.Contains("b") {
+		t.Error("union is missing an item of either set")
+	}
+
+	for _, other := range []*Set{
+		NewSet(NewCountingBloomFilter(1000, 0.01)),
+		NewSet(newTestFilter(t, testConfig)),
+	} {
+		if err := a.Union(other); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Union with a %T = %v, want ErrUnsupported", other.filter, err)
+		}
+	}
+}
+
+func TestBloomFilterUnionIncompatible(t *testing.T) {
+	base := NewBloomFilter(1000, 0.01)
+	for name, other := range map[string]*BloomFilter{
+		"bit size":   NewBloomFilter(2000, 0.01),
+		"hasher":     NewBloomFilter(1000, 0.01, WithHasher(FNVHasher)),
+		"normalizer": NewBloomFilter(1000, 0.01, WithKeyNormalizer(LowercaseNormalizer)),
+		"bit order":  NewBloomFilter(1000, 0.01, WithBitOrder(MSBFirst)),
+	} {
+		other.Add("x")
+		if err := base.Union(other); err == nil {
+			t.Errorf("Union with a different %s succeeded", name)
+		}
+	}
+	if base.MightContain("x") {
+		t.Error("a refused Union modified the filter")
+	}
+}
+
+func TestBloomFilterUnionCount(t *testing.T) {
+	a, b := NewBloomFilter(10000, 0.01), NewBloomFilter(10000, 0.01)
+	shared := testKeys("shared", 500)
+	for _, key := range append(testKeys("a", 500), shared...) {
+		a.Add(key)
+	}
+	for _, key := range append(testKeys("b", 500), shared...) {
+		b.Add(key)
+	}
+	if err := a.Union(b); err != nil {
+		t.Fatalf("Union: %v", err)
+	}
+	// 1500 distinct items; the sum of both counts would be 2000.
+	if got := a.ItemCount(); got < 1400 || got > 1600 {
+		t.Errorf("ItemCount() after Union = %d, want about 1500", got)
+	}
+
+	// Merging a subset sets no new bits and leaves the count alone.
+	before := a.ItemCount()
+	if err := a.Union(b); err != nil {
+		t.Fatalf("second Union: %v", err)
+	}
+	if got := a.ItemCount(); got != before {
+		t.Errorf("ItemCount() after merging a subset = %d, want %d", got, before)
+	}
+}
+
+func ExampleSet() {
+	seen := NewSet(NewBloomFilter(1000, 0.01))
+	for _, id := range []string{"order-1", "order-2", "order-1"} {
+		if seen.Contains(id) {
+			fmt.Println("duplicate", id)
+			continue
+		}
+		seen.Insert(id)
+	}
+	fmt.Println(seen.Len(), "distinct")
+	// Output:
+	// duplicate order-1
+	// 2 distinct
+}
+
+func ExampleSet_Union() {
+	a := NewSet(NewBloomFilter(1000, 0.01))
+	b := NewSet(NewBloomFilter(1000, 0.01))
+	a.Insert("x")
+	b.Insert("y")
+	if err := a.Union(b); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println(a.Contains("x"), a.Contains("y"))
+
+	if err := a.Union(NewSet(NewCountingBloomFilter(1000, 0.01))); err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// true true
+	// operation not supported by this filter
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// Binary format of a serialized SparseBloomFilter: the BloomFilter header introduced by
+// the magic "BLMS" instead of "BLMF", followed by the number of set bits and the set bit
+// indices in ascending order, each as the uvarint difference from the previous index.
+// At low fill the gaps are small, so most indices take one or two bytes.
+
+// sparseMagic identifies a serialized SparseBloomFilter.
+var sparseMagic = [4]byte{'B', 'L', 'M', 'S'}
+
+// SparseBloomFilter is a read-only BloomFilter that stores only the indices of its set
+// bits. A filter sized for a large capacity but holding few items takes far less space
+// this way, which makes the sparse form suited to serialization and transfer; above
+// roughly one set bit in eight the plain bitset is smaller.
+type SparseBloomFilter struct {
+	header     filterHeader
+	hasher     Hasher
+	normalizer KeyNormalizer
+	indices    []uint // Set bit indices in ascending order
+}
+
+// ToSparse returns the sparse representation of the filter.
+func (bf *BloomFilter) ToSparse() SparseBloomFilter {
+	bf.mutex.RLock()
+	defer bf.mutex.RUnlock()
+
+	indices := make([]uint, 0, popCount(bf.bitset))
+	for i := uint(0); i < bf.bitSize; i++ {
+		if bf.bitset[i/8]&bf.bitOrder.mask(i) != 0 {
+			indices = append(indices, i)
+		}
+	}
+	return SparseBloomFilter{
+		header:     bf.header(),
+		hasher:     bf.hasher,
+		normalizer: bf.normalizer,
+		indices:    indices,
+	}
+}
+
+// FromSparse rebuilds the BloomFilter that s was made from, so items can be added again.
+// It fails if s does not describe a usable filter, such as the zero SparseBloomFilter.
+func FromSparse(s SparseBloomFilter) (*BloomFilter, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	bf := &BloomFilter{
+		bitset:       make([]uint8, s.header.bitsetLen()),
+		bitSize:      uint(s.header.bitSize),
+		numHashFuncs: uint(s.header.numHashFuncs),
+		capacity:     int(s.header.capacity),
+		targetFP:     s.header.targetFP,
+		bitOrder:     s.header.bitOrder,
+		hasher:       s.hasher,
+		normalizer:   s.normalizer,
+		count:        uint(s.header.count),
+	}
+	for _, i := range s.indices {
+		bf.bitset[i/8] |= bf.bitOrder.mask(i)
+	}
+	return bf, nil
+}
+
+// validate checks s like BloomFilter.validate, and that every set bit is in range.
+func (s *SparseBloomFilter) validate() error {
+	if err := checkDimensions(s.header.bitSize, uint64(s.header.numHashFuncs)); err != nil {
+		return err
+	}
+	if s.hasher == nil {
+		return errors.New("hasher must be set")
+	}
+	for _, i := range s.indices {
+		if uint64(i) >= s.header.bitSize {
+			return fmt.Errorf("set bit index %d is out of range for bit size %d", i, s.header.bitSize)
+		}
+	}
+	return nil
+}
+
+// MightContain checks if an item might be in the filter.
+// Returns true if the item might be present, false if it is definitely not present.
+func (s *SparseBloomFilter) MightContain(item string) bool {
+	sum := s.hasher.Sum([]byte(s.normalizer.Normalize(item)))
+	for _, i := range digestIndices(sum, uint(s.header.numHashFuncs), uint(s.header.bitSize)) {
+		if _, found := slices.BinarySearch(s.indices, i); !found {
+			return false
+		}
+	}
+	return true
+}
+
+// SetBits returns the number of set bits.
+func (s *SparseBloomFilter) SetBits() int {
+	return len(s.indices)
+}
+
+// MarshalBinary encodes the filter in the sparse binary format.
+func (s *SparseBloomFilter) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeMagicHeader(&buf, sparseMagic, s.header); err != nil {
+		return nil, err
+	}
+	buf.Write(binary.AppendUvarint(nil, uint64(len(s.indices))))
+	var prev uint
+	for _, i := range s.indices {
+		buf.Write(binary.AppendUvarint(nil, uint64(i-prev)))
+		prev = i
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary replaces the filter's contents with data in the sparse binary format.
+func (s *SparseBloomFilter) UnmarshalBinary(data []byte) error {
+	r := bufio.NewReader(bytes.NewReader(data))
+	h, err := readMagicHeader(r, sparseMagic, "not a serialized sparse bloom filter")
+	if err != nil {
+		return err
+	}
+	if err := checkDimensions(h.bitSize, uint64(h.numHashFuncs)); err != nil {
+		return err
+	}
+	hasher, err := LookupHasher(h.hasher)
+	if err != nil {
+		return err
+	}
+	normalizer, err := LookupKeyNormalizer(h.normalizer)
+	if err != nil {
+		return err
+	}
+
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("reading set bit count: %w", err)
+	}
+	if n > h.bitSize {
+		return fmt.Errorf("%d set bits exceed the bit size %d", n, h.bitSize)
+	}
+	// Every index takes at least one byte, which bounds the allocation for corrupt counts.
+	if n > uint64(len(data)) {
+		return fmt.Errorf("%d set bits cannot fit in %d bytes", n, len(data))
+	}
+	indices := make([]uint, n)
+	var next uint64
+	for j := range indices {
+		delta, err := binary.ReadUvarint(r)
+		if err != nil {
+			return fmt.Errorf("reading set bit %d: %w", j, err)
+		}
+		if j > 0 && delta == 0 {
+			return fmt.Errorf("set bit %d repeats index %d", j, next)
+		}
+		next += delta
+		if next >= h.bitSize {
+			return fmt.Errorf("set bit index %d is out of range for bit size %d", next, h.bitSize)
+		}
+		indices[j] = uint(next)
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		return errors.New("trailing bytes after filter")
+	}
+
+	s.header = h
+	s.hasher = hasher
+	s.normalizer = normalizer
+	s.indices = indices
+	return nil
+}
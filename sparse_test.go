@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"slices"
+	"testing"
+)
+
+// mustMarshalSparse returns the binary encoding of s, failing the test on error.
+func mustMarshalSparse(t *testing.T, s *SparseBloomFilter) []byte {
+	t.Helper()
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	return data
+}
+
+func TestSparseRoundTrip(t *testing.T) {
+	bf := NewBloomFilter(1000000, 0.01, WithHasher(FNVHasher), WithKeyNormalizer(LowercaseNormalizer))
+	members := testKeys("sparse", 100)
+	for _, key := range members {
+		bf.Add(key)
+	}
+	sparse := bf.ToSparse()
+	if got, want := sparse.SetBits(), int(popCount(bf.bitset)); got != want {
+		t.Errorf("SetBits() = %d, want the %d set bits of the filter", got, want)
+	}
+	for _, key := range members {
+		if !sparse.MightContain(key) {
+			t.Fatalf("sparse MightContain(%q) = false", key)
+		}
+	}
+	for _, key := range testKeys("absent", 1000) {
+		if sparse.MightContain(key) != bf.MightContain(key) {
+			t.Fatalf("sparse and dense filters disagree on %q", key)
+		}
+	}
+
+	dense, sparseData := marshal(t, bf), mustMarshalSparse(t, &sparse)
+	if len(sparseData)*10 > len(dense) {
+		t.Errorf("sparse form takes %d bytes, want far less than the %d of the bitset", len(sparseData), len(dense))
+	}
+	t.Logf("serialized: dense %d bytes, sparse %d bytes", len(dense), len(sparseData))
+
+	var decoded SparseBloomFilter
+	if err := decoded.UnmarshalBinary(sparseData); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	rebuilt, err := FromSparse(decoded)
+	if err != nil {
+		t.Fatalf("FromSparse: %v", err)
+	}
+	if !bytes.Equal(rebuilt.bitset, bf.bitset) || rebuilt.ItemCount() != bf.ItemCount() || rebuilt.header() != bf.header() {
+		t.Error("FromSparse of the decoded sparse form differs from the original filter")
+	}
+	// Keys go through the original normalizer, and the rebuilt filter takes new items.
+	if !rebuilt.MightContain("SPARSE-7") {
+		t.Error("rebuilt filter lost the key normalizer")
+	}
+	rebuilt.Add("later")
+	if !rebuilt.MightContain("later") {
+		t.Error("Add on the rebuilt filter had no effect")
+	}
+}
+
+func TestSparseEmpty(t *testing.T) {
+	sparse := NewBloomFilter(1000, 0.01).ToSparse()
+	if sparse.SetBits() != 0 || sparse.MightContain("anything") {
+		t.Error("sparse form of an empty filter is not empty")
+	}
+	var decoded SparseBloomFilter
+	if err := decoded.UnmarshalBinary(mustMarshalSparse(t, &sparse)); err != nil || decoded.SetBits() != 0 {
+		t.Errorf("round trip of an empty sparse filter: %d set bits, %v", decoded.SetBits(), err)
+	}
+}
+
+func TestSparseUnmarshalMalformed(t *testing.T) {
+	bf := NewBloomFilter(1000, 0.01)
+	bf.Add("x")
+	sparse := bf.ToSparse()
+	good := mustMarshalSparse(t, &sparse)
+	var header bytes.Buffer
+	if err := writeMagicHeader(&header, sparseMagic, bf.header()); err != nil {
+		t.Fatal(err)
+	}
+	withIndices := func(count uint64, deltas ...uint64) []byte {
+		data := binary.AppendUvarint(bytes.Clone(header.Bytes()), count)
+		for _, d := range deltas {
+			data = binary.AppendUvarint(data, d)
+		}
+		return data
+	}
+
+	for name, data := range map[string][]byte{
+		"dense magic":  marshal(t, bf),
+		"truncated":    good[:len(good)-1],
+		"trailing":     append(bytes.Clone(good), 0),
+		"repeat":       withIndices(2, 5, 0),
+		"out of range": withIndices(1, uint64(bf.bitSize)),
+		"huge count":   withIndices(uint64(bf.bitSize)),
+	} {
+		var s SparseBloomFilter
+		if err := s.UnmarshalBinary(data); err == nil {
+			t.Errorf("%s: UnmarshalBinary succeeded", name)
+		}
+	}
+
+	for name, edit := range map[string]func(*filterHeader){
+		"no hash functions":       func(h *filterHeader) { h.numHashFuncs = 0 },
+		"too many hash functions": func(h *filterHeader) { h.numHashFuncs = maxHashFuncs + 1 },
+		"bit size past MaxInt":    func(h *filterHeader) { h.bitSize = maxBitSize + 1 },
+		"wrapped bit size":        func(h *filterHeader) { h.bitSize = math.MaxUint64 },
+	} {
+		h := bf.header()
+		edit(&h)
+		var buf bytes.Buffer
+		if err := writeMagicHeader(&buf, sparseMagic, h); err != nil {
+			t.Fatal(err)
+		}
+		var s SparseBloomFilter
+		if err := s.UnmarshalBinary(binary.AppendUvarint(buf.Bytes(), 0)); err == nil {
+			t.Errorf("%s: UnmarshalBinary succeeded", name)
+		}
+	}
+}
+
+// TestFromSparseInvalid checks that FromSparse refuses filters that UnmarshalBinary would
+// not produce rather than allocating or indexing past the bitset.
+func TestFromSparseInvalid(t *testing.T) {
+	bf := NewBloomFilter(1000, 0.01)
+	bf.Add("x")
+	for name, edit := range map[string]func(*SparseBloomFilter){
+		"zero value":        func(s *SparseBloomFilter) { *s = SparseBloomFilter{} },
+		"no hash functions": func(s *SparseBloomFilter) { s.header.numHashFuncs = 0 },
+		"wrapped bit size":  func(s *SparseBloomFilter) { s.header.bitSize = math.MaxUint64 },
+		"index out of range": func(s *SparseBloomFilter) {
+			s.indices = append(slices.Clone(s.indices), uint(s.header.bitSize))
+		},
+	} {
+		s := bf.ToSparse()
+		edit(&s)
+		if _, err := FromSparse(s); err == nil {
+			t.Errorf("%s: FromSparse succeeded", name)
+		}
+	}
+}
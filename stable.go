@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// StableBloomFilter is a Stable Bloom Filter (Deng & Rafiei, 2006) for deduplicating unbounded
+// streams in bounded memory. Every insert first decrements a few cells, so information about
+// old items gradually expires and the filter never fully saturates. In exchange it can yield
+// false negatives for items that were added long ago. It is safe for concurrent use.
+type StableBloomFilter struct {
+	cells        []uint8
+	size         uint
+	numHashFuncs uint
+	max          uint8 // Value a cell is set to on insert
+	decrements   uint  // Number of cells decremented per insert (P in the paper)
+	rng          *rand.Rand
+	mutex        sync.RWMutex
+}
+
+// NewStableBloomFilter creates a StableBloomFilter with m cells of d bits each (1 <= d <= 8),
+// tuned so that the false positive rate converges to fp once the filter reaches its stable state.
+// It returns an error if m is 0 or fp is not between 0 and 1.
+func NewStableBloomFilter(m uint, d uint8, fp float64) (*StableBloomFilter, error) {
+	if m == 0 {
+		return nil, errors.New("m must be greater than 0")
+	}
+	if !(fp > 0 && fp < 1) {
+		return nil, errors.New("fp must be between 0 and 1")
+	}
+	if d < 1 {
+		d = 1
+	}
+	if d > 8 {
+		d = 8
+	}
+	k := uint(math.Ceil(math.Log2(1 / fp)))
+	if k < 1 {
+		k = 1
+	}
+	max := uint8(1<<d - 1)
+	return &StableBloomFilter{
+		cells:        make([]uint8, m),
+		size:         m,
+		numHashFuncs: k,
+		max:          max,
+		decrements:   optimalStableDecrements(m, k, max, fp),
+		rng:          rand.New(rand.NewSource(rand.Int63())),
+	}, nil
+}
+
+// optimalStableDecrements calculates the number of cells to decrement per insert (P) so the
+// stable false positive rate matches fp.
+func optimalStableDecrements(m, k uint, max uint8, fp float64) uint {
+	subDenom := math.Pow(1-math.Pow(fp, 1/float64(k)), 1/float64(max))
+	denom := (1/subDenom - 1) * (1/float64(k) - 1/float64(m))
+	p := 1 / denom
+	if p < 1 || math.IsInf(p, 0) || math.IsNaN(p) {
+		return 1
+	}
+	return uint(p)
+}
+
+// Add inserts an item into the stable filter, first letting older information decay.
+func (s *StableBloomFilter) Add(item string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.add(hashIndices(item, s.numHashFuncs, s.size))
+}
+
+// TestAndAdd reports whether the item might already be present and inserts it either way,
+// which refreshes recently seen items so they do not expire.
+func (s *StableBloomFilter) TestAndAdd(item string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	indices := hashIndices(item, s.numHashFuncs, s.size)
+	present := s.contains(indices)
+	s.add(indices)
+	return present, nil
+}
+
+// MightContain checks if an item might be in the stable filter.
+// Returns true if the item might be present, false if it is probably not present.
+func (s *StableBloomFilter) MightContain(item string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.contains(hashIndices(item, s.numHashFuncs, s.size))
+}
+
+// contains reports whether every cell at indices is non-zero; the caller must hold the lock.
+func (s *StableBloomFilter) contains(indices []uint) bool {
+	for _, index := range indices {
+		if s.cells[index] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// add decrements P consecutive cells starting at a random position and then sets the
+// item's cells to max; the caller must hold the write lock.
+func (s *StableBloomFilter) add(indices []uint) {
+	start := uint(s.rng.Int63n(int64(s.size)))
+	for i := uint(0); i < s.decrements; i++ {
+		index := (start + i) % s.size
+		if s.cells[index] > 0 {
+			s.cells[index]--
+		}
+	}
+	for _, index := range indices {
+		s.cells[index] = s.max
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// fpRate returns the fraction of n keys never added to s that it reports as present.
+func fpRate(s *StableBloomFilter, prefix string, n int) float64 {
+	positives := 0
+	for i := 0; i < n; i++ {
+		if s.MightContain(fmt.Sprintf("%s-%d", prefix, i)) {
+			positives++
+		}
+	}
+	return float64(positives) / float64(n)
+}
+
+func TestStableBloomFilterStabilizes(t *testing.T) {
+	const (
+		cells = 10000
+		fp    = 0.01
+		probe = 5000
+	)
+	s, err := NewStableBloomFilter(cells, 3, fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stream 50 times as many items as there are cells, sampling the false positive rate
+	// after each tenth. A plain Bloom filter would approach 1 long before the end.
+	var rates []float64
+	for round := 0; round < 10; round++ {
+		for i := 0; i < 5*cells; i++ {
+			s.Add(fmt.Sprintf("stream-%d-%d", round, i))
+		}
+		rates = append(rates, fpRate(s, fmt.Sprintf("probe-%d", round), probe))
+	}
+	for i, rate := range rates {
+		if rate > 4*fp {
+			t.Errorf("false positive rate after %d times the cell count = %.4f, want it near %g", 5*(i+1), rate, fp)
+		}
+	}
+	// Once stable, the rate no longer trends upwards.
+	if first, last := rates[len(rates)/2], rates[len(rates)-1]; last > first+2*fp {
+		t.Errorf("false positive rate grew from %.4f to %.4f in the stable state", first, last)
+	}
+	t.Logf("false positive rates: %.4f", rates)
+}
+
+func TestStableBloomFilterRecentItems(t *testing.T) {
+	s, err := NewStableBloomFilter(10000, 3, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100000; i++ {
+		s.Add(fmt.Sprintf("old-%d", i))
+	}
+	// Items added just now have not had time to decay.
+	recent := testKeys("recent", 10)
+	for _, key := range recent {
+		if _, err := s.TestAndAdd(key); err != nil {
+			t.Fatalf("TestAndAdd(%q): %v", key, err)
+		}
+	}
+	for _, key := range recent {
+		if !s.MightContain(key) {
+			t.Errorf("MightContain(%q) = false right after adding it", key)
+		}
+	}
+}
+
+func TestNewStableBloomFilterInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		m  uint
+		fp float64
+	}{
+		{0, 0.01},
+		{10000, 0},
+		{10000, 1},
+		{10000, -0.5},
+		{10000, math.NaN()},
+	} {
+		if s, err := NewStableBloomFilter(tc.m, 3, tc.fp); err == nil || s != nil {
+			t.Errorf("NewStableBloomFilter(%d, 3, %g) = %v, %v, want an error", tc.m, tc.fp, s, err)
+		}
+	}
+}
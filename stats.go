@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// FilterStats describes one sub-filter of a Scalable Bloom Filter.
+type FilterStats struct {
+	Capacity     int       `json:"capacity"`       // Number of items the sub-filter was sized for
+	TargetFP     float64   `json:"target_fp"`      // False positive rate it was sized for; 0 if unknown
+	BitSize      uint      `json:"bit_size"`       // Number of bits (m)
+	NumHashFuncs uint      `json:"num_hash_funcs"` // Number of hash functions (k)
+	ItemCount    uint      `json:"item_count"`     // Number of items inserted into the sub-filter
+	FillRatio    float64   `json:"fill_ratio"`     // Fraction of bits set
+	EstimatedFP  float64   `json:"estimated_fp"`   // False positive rate estimated from the fill ratio
+	Created      time.Time `json:"created"`        // When the sub-filter was added; zero if unknown
+
+	SelfCollisions uint64 `json:"self_collisions"` // Inserts with repeated indices; see WithSelfCollisionTracking
+}
+
+// Stats is a point-in-time snapshot of a Scalable Bloom Filter.
+type Stats struct {
+	Filters          []FilterStats `json:"filters"`            // Sub-filters, oldest first
+	ItemCount        uint          `json:"item_count"`         // Total items across sub-filters
+	MemoryBytes      int           `json:"memory_bytes"`       // Bytes allocated for bitsets
+	EstimatedFP      float64       `json:"estimated_fp"`       // Compound false positive rate across sub-filters
+	Hasher           string        `json:"hasher"`             // Name of the hasher
+	Normalizer       string        `json:"normalizer"`         // Name of the key normalizer, empty if none
+	LastGrowthReason string        `json:"last_growth_reason"` // See LastGrowthReason
+	Frozen           bool          `json:"frozen"`             // See Freeze
+	FormatVersion    int           `json:"format_version"`     // Version of the format it was decoded from; 0 if built in memory
+	SelfCollisions   uint64        `json:"self_collisions"`    // Total across sub-filters; see WithSelfCollisionTracking
+}
+
+// Stats returns a snapshot of the filter's structure and estimated accuracy. The compound
+// false positive rate assumes the sub-filters' estimates are independent: an absent item
+// is a false positive if any sub-filter reports it.
+func (sbf *ScalableBloomFilter) Stats() Stats {
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+
+	stats := Stats{
+		Filters:          make([]FilterStats, len(sbf.filters)),
+		Hasher:           sbf.options.hasher.Name(),
+		Normalizer:       sbf.options.normalizer.Name(),
+		LastGrowthReason: sbf.lastGrowth,
+		Frozen:           sbf.frozen,
+		FormatVersion:    sbf.formatVersion,
+	}
+	allNegative := 1.0
+	for i, filter := range sbf.filters {
+		filter.mutex.RLock()
+		fill := float64(popCount(filter.bitset)) / float64(filter.bitSize)
+		fs := FilterStats{
+			Capacity:     filter.capacity,
+			TargetFP:     filter.targetFP,
+			BitSize:      filter.bitSize,
+			NumHashFuncs: filter.numHashFuncs,
+			ItemCount:    filter.count,
+			FillRatio:    fill,
+			EstimatedFP:  math.Pow(fill, float64(filter.numHashFuncs)),
+			Created:      filter.created,
+
+			SelfCollisions: filter.selfCollisions,
+		}
+		stats.MemoryBytes += len(filter.bitset)
+		filter.mutex.RUnlock()
+
+		stats.Filters[i] = fs
+		stats.ItemCount += fs.ItemCount
+		stats.SelfCollisions += fs.SelfCollisions
+		allNegative *= 1 - fs.EstimatedFP
+	}
+	stats.EstimatedFP = 1 - allNegative
+	return stats
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Default batching parameters used by Consume.
+const (
+	defaultBatchSize     = 256
+	defaultFlushInterval = 100 * time.Millisecond
+)
+
+// consumeConfig holds the batching parameters for Consume.
+type consumeConfig struct {
+	batchSize     int
+	flushInterval time.Duration
+}
+
+// ConsumeOption configures the batching behavior of Consume and ConsumeBytes.
+type ConsumeOption func(*consumeConfig)
+
+// WithBatchSize sets the number of items buffered before they are inserted under a single lock.
+// Values below 1 are ignored.
+func WithBatchSize(n int) ConsumeOption {
+	return func(c *consumeConfig) {
+		if n > 0 {
+			c.batchSize = n
+		}
+	}
+}
+
+// WithFlushInterval sets the maximum time an item may wait in a partial batch before it is inserted.
+// Values below or equal to zero are ignored.
+func WithFlushInterval(d time.Duration) ConsumeOption {
+	return func(c *consumeConfig) {
+		if d > 0 {
+			c.flushInterval = d
+		}
+	}
+}
+
+// Consume drains ch into the filter until the channel is closed or ctx is done.
+// Items are inserted in batches, flushed when the batch is full or when its oldest item
+// has waited for the flush interval. Every item received before Consume returns is
+// guaranteed to be inserted. Returns nil when ch is closed, or ctx's error on cancellation.
+func (sbf *ScalableBloomFilter) Consume(ctx context.Context, ch <-chan string, opts ...ConsumeOption) error {
+	return consume(ctx, sbf, ch, func(item string) string { return item }, opts)
+}
+
+// ConsumeBytes is like Consume for producers that emit byte slices.
+func (sbf *ScalableBloomFilter) ConsumeBytes(ctx context.Context, ch <-chan []byte, opts ...ConsumeOption) error {
+	return consume(ctx, sbf, ch, func(item []byte) string { return string(item) }, opts)
+}
+
+// consume implements Consume for any item type convertible to a string.
+func consume[T any](ctx context.Context, sbf *ScalableBloomFilter, ch <-chan T, convert func(T) string, opts []ConsumeOption) error {
+	config := consumeConfig{batchSize: defaultBatchSize, flushInterval: defaultFlushInterval}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	batch := make([]string, 0, config.batchSize)
+	// deadline fires once the oldest item of the current batch has waited for the flush
+	// interval; it is nil, and thus never ready, while the batch is empty.
+	var deadline <-chan time.Time
+
+	flush := func() error {
+		deadline = nil
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := sbf.addBatch(batch)
+		batch = batch[:0]
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := flush(); err != nil {
+				return err
+			}
+			return ctx.Err()
+		case item, ok := <-ch:
+			if !ok {
+				return flush()
+			}
+			if len(batch) == 0 {
+				deadline = sbf.options.clock.After(config.flushInterval)
+			}
+			batch = append(batch, convert(item))
+			if len(batch) >= config.batchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-deadline:
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Result is the answer to a membership query made by MightContainStream.
+type Result struct {
+	Item     string
+	Contains bool
+}
+
+// MightContainStream checks every item received from in and sends the answers, in order,
+// on the returned channel, which is closed once in is closed or ctx is done. The channel
+// is unbuffered: the next item is not read from in until the previous answer has been
+// received, so a slow consumer holds back the producer instead of answers piling up.
+// Answers not yet received when ctx is done are dropped, so a consumer that stops early
+// should cancel ctx to release the goroutine reading in.
+func (sbf *ScalableBloomFilter) MightContainStream(ctx context.Context, in <-chan string) <-chan Result {
+	out := make(chan Result)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case item, ok := <-in:
+				if !ok {
+					return
+				}
+				select {
+				case out <- Result{Item: item, Contains: sbf.MightContain(item)}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
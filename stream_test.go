@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-bloom-filter/bloomtest"
+)
+
+// waitFor polls cond until it holds, failing the test after a generous timeout.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConsumeClose(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	ch := make(chan string)
+	done := make(chan error, 1)
+	go func() { done <- sbf.Consume(context.Background(), ch, WithBatchSize(64)) }()
+
+	keys := testKeys("consume", 1000)
+	for _, key := range keys {
+		ch <- key
+	}
+	close(ch)
+	if err := <-done; err != nil {
+		t.Fatalf("Consume = %v, want nil after close", err)
+	}
+	for _, key := range keys {
+		if !sbf.MightContain(key) {
+			t.Fatalf("MightContain(%q) = false; items sent before close must be inserted", key)
+		}
+	}
+}
+
+func TestConsumeBytes(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	ch := make(chan []byte, 2)
+	ch <- []byte("a")
+	ch <- []byte("b")
+	close(ch)
+	if err := sbf.ConsumeBytes(context.Background(), ch); err != nil {
+		t.Fatalf("ConsumeBytes: %v", err)
+	}
+	if !sbf.MightContain("a") || !sbf.MightContain("b") {
+		t.Error("items received as bytes are missing")
+	}
+}
+
+func TestConsumeCancel(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan string)
+	done := make(chan error, 1)
+	go func() { done <- sbf.Consume(ctx, ch, WithBatchSize(1000), WithFlushInterval(time.Hour)) }()
+
+	// The channel is unbuffered, so every completed send has been received.
+	keys := testKeys("cancel", 10)
+	for _, key := range keys {
+		ch <- key
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Consume = %v, want context.Canceled", err)
+	}
+	for _, key := range keys {
+		if !sbf.MightContain(key) {
+			t.Errorf("MightContain(%q) = false; items received before cancellation must be inserted", key)
+		}
+	}
+}
+
+func TestConsumeFlushInterval(t *testing.T) {
+	clock := bloomtest.NewFakeClock(time.Unix(0, 0))
+	sbf := newTestFilter(t, testConfig, WithClock(clock))
+	ch := make(chan string)
+	done := make(chan error, 1)
+	go func() {
+		done <- sbf.Consume(context.Background(), ch, WithBatchSize(100), WithFlushInterval(time.Second))
+	}()
+
+	// A slow producer: one item, far short of the batch size, then nothing.
+	ch <- "slow"
+	waitFor(t, "the flush timer", func() bool { return clock.Waiters() == 1 })
+	if sbf.MightContain("slow") {
+		t.Fatal("item inserted before the batch was full or the flush interval elapsed")
+	}
+	clock.Advance(time.Second)
+	waitFor(t, "the latency-triggered flush", func() bool { return sbf.MightContain("slow") })
+
+	close(ch)
+	if err := <-done; err != nil {
+		t.Fatalf("Consume = %v, want nil after close", err)
+	}
+}
+
+func TestMightContainStream(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	members, absent := testKeys("member", 300), testKeys("absent", 300)
+	addAll(t, sbf, members)
+
+	in := make(chan string)
+	var items []string
+	for i := range members {
+		items = append(items, members[i], absent[i])
+	}
+	go func() {
+		for _, item := range items {
+			in <- item
+		}
+		close(in)
+	}()
+
+	var results []Result
+	for result := range sbf.MightContainStream(context.Background(), in) {
+		results = append(results, result)
+	}
+	if len(results) != len(items) {
+		t.Fatalf("received %d results for %d items", len(results), len(items))
+	}
+	for i, result := range results {
+		if want := (Result{items[i], sbf.MightContain(items[i])}); result != want {
+			t.Fatalf("result %d = %+v, want %+v", i, result, want)
+		}
+		if i%2 == 0 && !result.Contains {
+			t.Fatalf("result %d: member %q reported absent", i, result.Item)
+		}
+	}
+}
+
+func TestMightContainStreamBackpressure(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan string)
+	out := sbf.MightContainStream(ctx, in)
+
+	// The first item is read, and its answer waits for a receiver, so the second is not.
+	in <- "first"
+	select {
+	case in <- "second":
+		t.Fatal("second item read before the first answer was received")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if result := <-out; result.Item != "first" {
+		t.Fatalf("first result = %+v, want the answer for %q", result, "first")
+	}
+	in <- "second"
+	if result := <-out; result.Item != "second" {
+		t.Fatalf("second result = %+v, want the answer for %q", result, "second")
+	}
+}
+
+func TestMightContainStreamCancel(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan string)
+	out := sbf.MightContainStream(ctx, in)
+
+	in <- "pending" // Its answer is never received.
+	cancel()
+	for range out {
+		// Answers pending at cancellation may be dropped, but the channel must close.
+	}
+	select {
+	case in <- "late":
+		t.Fatal("item read after the context was done")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+// WithStrictMode makes filters panic on programming errors, such as combining or comparing
+// filters with incompatible layouts, instead of returning an error. Errors caused by
+// runtime input, such as corrupt serialized data or I/O failures, are still returned.
+// It is meant for development and tests, to fail fast at the offending call site.
+func WithStrictMode() Option {
+	return func(o *options) {
+		o.strict = true
+	}
+}
+
+// misuse reports a programming error: it panics if strict is set and returns err otherwise.
+func misuse(strict bool, err error) error {
+	if strict {
+		panic(err)
+	}
+	return err
+}
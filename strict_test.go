@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// panicValue runs fn and returns the value it panicked with, or nil.
+func panicValue(fn func()) (recovered any) {
+	defer func() { recovered = recover() }()
+	fn()
+	return nil
+}
+
+func TestStrictModeIncompatibleUnion(t *testing.T) {
+	// Without strict mode, an incompatible union is an error.
+	a, b := NewBloomFilter(1000, 0.01), NewBloomFilter(2000, 0.01)
+	if err := a.Union(b); err == nil {
+		t.Fatal("Union of incompatible filters succeeded")
+	}
+
+	// With strict mode on either filter, it panics with the same error.
+	for name, pair := range map[string][2]*BloomFilter{
+		"receiver": {NewBloomFilter(1000, 0.01, WithStrictMode()), NewBloomFilter(2000, 0.01)},
+		"argument": {NewBloomFilter(1000, 0.01), NewBloomFilter(2000, 0.01, WithStrictMode())},
+	} {
+		got := panicValue(func() { pair[0].Union(pair[1]) })
+		err, ok := got.(error)
+		if !ok || !strings.Contains(err.Error(), "incompatible") {
+			t.Errorf("strict %s: Union panicked with %v, want the incompatibility error", name, got)
+		}
+	}
+	if got := panicValue(func() { EstimateJaccard(NewBloomFilter(1000, 0.01, WithStrictMode()), b) }); got == nil {
+		t.Error("strict EstimateJaccard of incompatible filters did not panic")
+	}
+}
+
+func TestStrictModeRuntimeErrors(t *testing.T) {
+	// Input errors are returned, not panicked, even in strict mode.
+	strict := NewBloomFilter(1000, 0.01, WithStrictMode())
+	if got := panicValue(func() {
+		if err := strict.UnmarshalBinary([]byte("corrupt")); err == nil {
+			t.Error("UnmarshalBinary of corrupt data succeeded")
+		}
+		if _, err := ReadBloomFilter(bytes.NewReader(nil)); err == nil {
+			t.Error("ReadBloomFilter of no data succeeded")
+		}
+	}); got != nil {
+		t.Errorf("strict mode panicked on an input error: %v", got)
+	}
+
+	// Compatible filters combine normally.
+	other := NewBloomFilter(1000, 0.01, WithStrictMode())
+	other.Add("item")
+	if err := strict.Union(other); err != nil || !strict.MightContain("item") {
+		t.Errorf("strict Union of compatible filters = %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer splits text into tokens, so that words rather than whole lines are added to
+// or checked against a filter. Tokens pass through the filter's key normalizer like any
+// other item.
+type Tokenizer func(text string) []string
+
+// WordTokens splits text into words with a simplified form of Unicode word segmentation
+// (UAX #29): a word is a run of letters, combining marks, digits and connector
+// punctuation such as "_", which may contain an apostrophe between letters, as in
+// "don't", and a period or comma between digits, as in "3.14". Han ideographs and
+// Hiragana, which are written without spaces, form one token per character. Everything
+// else separates words and is dropped.
+func WordTokens(text string) []string {
+	var tokens []string
+	start := -1
+	for i, r := range text {
+		switch {
+		case isIdeograph(r):
+			if start >= 0 {
+				tokens = append(tokens, text[start:i])
+				start = -1
+			}
+			tokens = append(tokens, text[i:i+utf8.RuneLen(r)])
+		case isWordRune(r):
+			if start < 0 {
+				start = i
+			}
+		case (r == '\'' || r == '’') && start >= 0 && between(text, i, r, isLetter):
+			// Part of the word, as in "don't"
+		case (r == '.' || r == ',') && start >= 0 && between(text, i, r, unicode.IsDigit):
+			// Part of the number, as in "3.14"
+		default:
+			if start >= 0 {
+				tokens = append(tokens, text[start:i])
+				start = -1
+			}
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, text[start:])
+	}
+	return tokens
+}
+
+// isWordRune reports whether r can be part of a word.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r) || unicode.Is(unicode.Pc, r)
+}
+
+// isIdeograph reports whether r forms a word on its own.
+func isIdeograph(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r)
+}
+
+// isLetter reports whether r is a letter that joins other letters into a word.
+func isLetter(r rune) bool {
+	return unicode.IsLetter(r) && !isIdeograph(r)
+}
+
+// between reports whether the punctuation r at byte i of text has runes satisfying pred on
+// both sides.
+func between(text string, i int, r rune, pred func(rune) bool) bool {
+	before, _ := utf8.DecodeLastRuneInString(text[:i])
+	after, _ := utf8.DecodeRuneInString(text[i+utf8.RuneLen(r):])
+	return pred(before) && pred(after)
+}
+
+// RegexpTokenizer returns a Tokenizer whose tokens are the non-overlapping matches of re,
+// for tokens that WordTokens would split or join differently, such as e-mail addresses.
+// Empty matches are dropped.
+func RegexpTokenizer(re *regexp.Regexp) Tokenizer {
+	return func(text string) []string {
+		matches := re.FindAllString(text, -1)
+		tokens := matches[:0]
+		for _, m := range matches {
+			if m != "" {
+				tokens = append(tokens, m)
+			}
+		}
+		return tokens
+	}
+}
+
+// tokenRecords returns a function producing the tokens of the records produced by next,
+// one at a time, in the form addRecords expects. Records without tokens are skipped. An
+// error that came with a record is returned with its last token.
+func tokenRecords(next func() (string, bool, error), tokenize Tokenizer) func() (string, bool, error) {
+	var pending []string
+	var pendingErr error
+	return func() (string, bool, error) {
+		for len(pending) == 0 {
+			if pendingErr != nil {
+				err := pendingErr
+				pendingErr = nil
+				return "", false, err
+			}
+			record, found, err := next()
+			if !found {
+				return "", false, err
+			}
+			pending, pendingErr = tokenize(record), err
+		}
+		token := pending[0]
+		pending = pending[1:]
+		if len(pending) == 0 && pendingErr != nil {
+			err := pendingErr
+			pendingErr = nil
+			return token, true, err
+		}
+		return token, true, nil
+	}
+}
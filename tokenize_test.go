@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWordTokens(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want []string
+	}{
+		{"Don't panic: π is 3.14, isn't it?", []string{"Don't", "panic", "π", "is", "3.14", "isn't", "it"}},
+		{"1,000 dogs' bowls, 'quoted'", []string{"1,000", "dogs", "bowls", "quoted"}},
+		{"Die Straße über Öl-Preise", []string{"Die", "Straße", "über", "Öl", "Preise"}},
+		{"Привет, мир! Как дела?", []string{"Привет", "мир", "Как", "дела"}},
+		{"مرحبا بالعالم", []string{"مرحبا", "بالعالم"}},
+		{"नमस्ते दुनिया", []string{"नमस्ते", "दुनिया"}}, // Combining vowel signs stay in the word
+		{"東京へ行く", []string{"東", "京", "へ", "行", "く"}},
+		{"カタカナ語とabc", []string{"カタカナ", "語", "と", "abc"}},
+		{"snake_case éte", []string{"snake_case", "éte"}},
+		{"  -- ... ", nil},
+		{"", nil},
+	} {
+		if got := WordTokens(tc.text); !slices.Equal(got, tc.want) {
+			t.Errorf("WordTokens(%q) = %q, want %q", tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestRegexpTokenizer(t *testing.T) {
+	emails := RegexpTokenizer(regexp.MustCompile(`[\w.+-]+@[\w-]+(\.[\w-]+)+`))
+	text := "contact: ann.lee+bloom@example.com, bob@mail.example.org; not@an"
+	if got, want := emails(text), []string{"ann.lee+bloom@example.com", "bob@mail.example.org"}; !slices.Equal(got, want) {
+		t.Errorf("e-mail tokens = %q, want %q", got, want)
+	}
+	// Empty matches are dropped.
+	digits := RegexpTokenizer(regexp.MustCompile(`\d*`))
+	if got, want := digits("a1b22c"), []string{"1", "22"}; !slices.Equal(got, want) {
+		t.Errorf("digit tokens = %q, want %q", got, want)
+	}
+}
+
+func TestTokenRecords(t *testing.T) {
+	errRead := errors.New("read failed")
+	records := []struct {
+		text string
+		err  error
+	}{{"one two", nil}, {"...", nil}, {"three", errRead}, {"four", nil}}
+	i := 0
+	next := tokenRecords(func() (string, bool, error) {
+		if i == len(records) {
+			return "", false, nil
+		}
+		r := records[i]
+		i++
+		return r.text, true, r.err
+	}, WordTokens)
+
+	var tokens []string
+	var errs []error
+	for {
+		token, found, err := next()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if !found {
+			break
+		}
+		tokens = append(tokens, token)
+	}
+	// The record without tokens is skipped, and the error comes with the last token of its record.
+	if want := []string{"one", "two", "three", "four"}; !slices.Equal(tokens, want) {
+		t.Errorf("tokens = %q, want %q", tokens, want)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], errRead) {
+		t.Errorf("errors = %v, want the read error once", errs)
+	}
+}
+
+func TestAddFromReaderTokenizer(t *testing.T) {
+	sbf := newTestFilter(t, testConfig)
+	input := "The quick brown fox\n\nJumps over THE lazy dog\nПривет мир\n"
+	report, err := sbf.AddFromReader(context.Background(), strings.NewReader(input), WithTokenizer(WordTokens))
+	if err != nil {
+		t.Fatalf("AddFromReader: %v", err)
+	}
+	// Tokens are counted where lines would be; the empty line has none.
+	if report.LinesRead != 11 || report.ItemsAdded != 11 || report.Duplicates != 0 {
+		t.Errorf("report = %+v, want 11 tokens read and added", report)
+	}
+	for _, word := range []string{"quick", "THE", "The", "мир"} {
+		if !sbf.MightContain(word) {
+			t.Errorf("MightContain(%q) = false for an imported token", word)
+		}
+	}
+	if sbf.MightContain("the quick brown fox") || sbf.MightContain("the") {
+		t.Error("whole lines or unseen case variants were added")
+	}
+}
+
+func TestCaseFoldNormalizer(t *testing.T) {
+	for in, want := range map[string]string{"Straße": "strasse", "ΣΊΣΥΦΟΣ": "σίσυφοσ", "Hello": "hello"} {
+		if got := CaseFoldNormalizer.Normalize(in); got != want {
+			t.Errorf("CaseFoldNormalizer.Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if n, err := LookupKeyNormalizer("casefold"); err != nil || n.Name() != "casefold" {
+		t.Errorf("LookupKeyNormalizer(casefold) = %v, %v", n, err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// XXHashHasher hashes with XXH64, a fast non-cryptographic hash. XXH64 yields 8 bytes,
+// so the digest is the big-endian XXH64 of the content with seed 0 followed by the one
+// with seed 1, to meet the Hasher minimum of 16 bytes.
+var XXHashHasher Hasher = stdHasher{
+	name:  "xxhash",
+	newFn: func() hash.Hash { return &xxhashDigest{a: newXXH64(0), b: newXXH64(1)} },
+	sumFn: func(data []byte) []byte {
+		sum := binary.BigEndian.AppendUint64(make([]byte, 0, 16), xxh64Sum(data, 0))
+		return binary.BigEndian.AppendUint64(sum, xxh64Sum(data, 1))
+	},
+}
+
+// XXH64 primes.
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+// xxh64Sum returns the XXH64 of data with seed.
+func xxh64Sum(data []byte, seed uint64) uint64 {
+	h := seed + xxPrime5
+	total := uint64(len(data))
+	if len(data) >= 32 {
+		v := xxh64Init(seed)
+		data = v.stripes(data)
+		h = v.merge()
+	}
+	return xxh64Finish(h+total, data)
+}
+
+// xxh64Lanes are the four accumulators XXH64 mixes 32-byte stripes into.
+type xxh64Lanes [4]uint64
+
+func xxh64Init(seed uint64) xxh64Lanes {
+	return xxh64Lanes{seed + xxPrime1 + xxPrime2, seed + xxPrime2, seed, seed - xxPrime1}
+}
+
+func xxh64Round(acc, input uint64) uint64 {
+	return bits.RotateLeft64(acc+input*xxPrime2, 31) * xxPrime1
+}
+
+// stripes mixes every whole 32-byte stripe of data into v and returns the rest.
+func (v *xxh64Lanes) stripes(data []byte) []byte {
+	for ; len(data) >= 32; data = data[32:] {
+		for i := range v {
+			v[i] = xxh64Round(v[i], binary.LittleEndian.Uint64(data[8*i:]))
+		}
+	}
+	return data
+}
+
+// merge combines the accumulators once at least one stripe was mixed in.
+func (v *xxh64Lanes) merge() uint64 {
+	h := bits.RotateLeft64(v[0], 1) + bits.RotateLeft64(v[1], 7) + bits.RotateLeft64(v[2], 12) + bits.RotateLeft64(v[3], 18)
+	for _, lane := range v {
+		h = (h^xxh64Round(0, lane))*xxPrime1 + xxPrime4
+	}
+	return h
+}
+
+// xxh64Finish mixes the final partial stripe, under 32 bytes, into h and avalanches it.
+// h must already include the total length.
+func xxh64Finish(h uint64, tail []byte) uint64 {
+	for ; len(tail) >= 8; tail = tail[8:] {
+		h = bits.RotateLeft64(h^xxh64Round(0, binary.LittleEndian.Uint64(tail)), 27)*xxPrime1 + xxPrime4
+	}
+	if len(tail) >= 4 {
+		h = bits.RotateLeft64(h^uint64(binary.LittleEndian.Uint32(tail))*xxPrime1, 23)*xxPrime2 + xxPrime3
+		tail = tail[4:]
+	}
+	for _, b := range tail {
+		h = bits.RotateLeft64(h^uint64(b)*xxPrime5, 11) * xxPrime1
+	}
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+// xxh64 is the streaming form of xxh64Sum.
+type xxh64 struct {
+	seed  uint64
+	lanes xxh64Lanes
+	buf   [32]byte
+	n     int    // Bytes in buf
+	total uint64 // Bytes written
+}
+
+func newXXH64(seed uint64) xxh64 {
+	return xxh64{seed: seed, lanes: xxh64Init(seed)}
+}
+
+func (d *xxh64) write(p []byte) {
+	d.total += uint64(len(p))
+	if d.n > 0 {
+		copied := copy(d.buf[d.n:], p)
+		d.n += copied
+		p = p[copied:]
+		if d.n < len(d.buf) {
+			return
+		}
+		d.lanes.stripes(d.buf[:])
+		d.n = 0
+	}
+	p = d.lanes.stripes(p)
+	d.n = copy(d.buf[:], p)
+}
+
+func (d *xxh64) sum64() uint64 {
+	h := d.seed + xxPrime5
+	if d.total >= 32 {
+		h = d.lanes.merge()
+	}
+	return xxh64Finish(h+d.total, d.buf[:d.n])
+}
+
+// xxhashDigest is the hash.Hash of XXHashHasher.
+type xxhashDigest struct {
+	a, b xxh64 // Seeds 0 and 1
+}
+
+func (d *xxhashDigest) Write(p []byte) (int, error) {
+	d.a.write(p)
+	d.b.write(p)
+	return len(p), nil
+}
+
+func (d *xxhashDigest) Sum(in []byte) []byte {
+	in = binary.BigEndian.AppendUint64(in, d.a.sum64())
+	return binary.BigEndian.AppendUint64(in, d.b.sum64())
+}
+
+func (d *xxhashDigest) Reset() {
+	d.a, d.b = newXXH64(d.a.seed), newXXH64(d.b.seed)
+}
+
+func (d *xxhashDigest) Size() int      { return 16 }
+func (d *xxhashDigest) BlockSize() int { return 32 }
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestXXH64(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"as", 0x1c330fb2d66be179},
+		{"asd", 0x631c37ce72a97393},
+		{"asdf", 0x415872f599cea71e},
+		{"Call me Ishmael. Some years ago--never mind how long precisely-", 0x02a2e85470d6fd96},
+	} {
+		if got := xxh64Sum([]byte(tc.in), 0); got != tc.want {
+			t.Errorf("xxh64Sum(%q) = %#x, want %#x", tc.in, got, tc.want)
+		}
+	}
+}
+
+// TestXXH64Streaming splits content at every offset, so partial stripes are buffered
+// across writes of every length.
+func TestXXH64Streaming(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789abcdef", 9)) // Four stripes and a tail
+	for n := range len(content) + 1 {
+		for i := 0; i <= n; i++ {
+			d := newXXH64(1)
+			d.write(content[:i])
+			d.write(content[i:n])
+			if got, want := d.sum64(), xxh64Sum(content[:n], 1); got != want {
+				t.Fatalf("%d bytes written as %d and %d: %#x, want %#x", n, i, n-i, got, want)
+			}
+		}
+	}
+
+	h := XXHashHasher.New()
+	h.Write(content)
+	h.Reset()
+	h.Write([]byte("abc"))
+	if got, want := h.Sum(nil), XXHashHasher.Sum([]byte("abc")); string(got) != string(want) {
+		t.Errorf("digest after Reset = %x, want %x", got, want)
+	}
+}